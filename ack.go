@@ -0,0 +1,291 @@
+package sockx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// EventAck is sent by a client to acknowledge a message that carried an
+// Ack ID, and by the server to answer protocol requests that carried one.
+// The reply carries the same Ack ID and an optional response in Data.
+const EventAck = "sockx:ack"
+
+var (
+	// ErrNoAck is reported for members that had not acknowledged when an
+	// aggregated ack resolved early.
+	ErrNoAck = errors.New("sockx: no ack received")
+
+	// ErrQuorumNotMet is returned by EmitWithAcks when every member has
+	// answered or failed without reaching the requested quorum.
+	ErrQuorumNotMet = errors.New("sockx: ack quorum not met")
+
+	// ErrAckTimeout is returned by Client.EmitWithAck when the client has
+	// not acknowledged in time.
+	ErrAckTimeout = errors.New("sockx: ack timed out")
+)
+
+// AckHandler handles an inbound event and returns the response to send
+// back as its acknowledgement. Register it with OnWithAck.
+type AckHandler func(c *Client, data interface{}) interface{}
+
+// AckResult is one recipient's answer to a message sent with an ack.
+type AckResult struct {
+	Data interface{}
+	Err  error
+}
+
+// AckOption customizes EmitWithAcks.
+type AckOption func(*ackOptions)
+
+type ackOptions struct {
+	quorum float64
+}
+
+// Quorum resolves EmitWithAcks as soon as the given fraction of the room's
+// members, between 0 and 1, has acknowledged.
+func Quorum(fraction float64) AckOption {
+	return func(o *ackOptions) { o.quorum = fraction }
+}
+
+type ackReply struct {
+	client *Client
+	data   interface{}
+	err    error
+}
+
+// EmitWithAck sends event to this client with an Ack ID and waits for the
+// client to acknowledge it, returning the Data of its EventAck. It returns
+// ErrAckTimeout if no acknowledgement arrives within timeout, or
+// ErrClientClosed if the client disconnects first; a zero timeout waits
+// until either happens. A late acknowledgement is discarded.
+func (c *Client) EmitWithAck(event string, data interface{}, timeout time.Duration) (interface{}, error) {
+	ns := c.Namespace()
+	id := atomic.AddUint64(&ns.server.ackSeq, 1)
+	p, err := ns.encode(Message{Event: event, Data: data, Ack: id}, emitOptions{})
+	if err != nil {
+		return nil, err
+	}
+	reply := make(chan ackReply, 1)
+	if !c.expectAck(id, reply) {
+		return nil, ErrClientClosed
+	}
+	defer c.cancelAck(id)
+	if err := c.send(p.frame(c), false); err != nil {
+		return nil, err
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case rep := <-reply:
+		return rep.data, rep.err
+	case <-expired:
+		return nil, ErrAckTimeout
+	}
+}
+
+// OnWithAck registers h for event, replacing any previous handler. The
+// value h returns is sent back as the event's acknowledgement, as with
+// Event.Ack, if the client asked for one by setting the message's Ack ID.
+func (ns *Namespace) OnWithAck(event string, h AckHandler, opts ...HandlerOption) *Subscription {
+	return ns.OnEvent(event, ackEventFunc(h), opts...)
+}
+
+// ackEventFunc adapts an AckHandler to an EventFunc.
+func ackEventFunc(h AckHandler) EventFunc {
+	return func(ev *Event) { ev.Ack(h(ev.client, ev.legacyData())) }
+}
+
+// EmitWithAcks sends event to every member of the room and collects their
+// acknowledgements, keyed by client ID. It resolves when every member has
+// answered, when the Quorum option is satisfied, or when ctx is done, in
+// which case ctx's error is returned along with the results so far.
+// Members that disconnect while waiting are reported with ErrClientClosed,
+// and members that had not answered when the call resolved with ErrNoAck
+// or ctx's error. Acks arriving after resolution are discarded.
+//
+// Only members connected to this server are asked; the message is not
+// published through the adapter.
+func (r *Room) EmitWithAcks(ctx context.Context, event string, data interface{}, opts ...AckOption) (map[string]AckResult, error) {
+	var o ackOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ns := r.Namespace()
+	members := r.snapshot()
+	results := make(map[string]AckResult, len(members))
+	if len(members) == 0 {
+		return results, nil
+	}
+
+	id := atomic.AddUint64(&ns.server.ackSeq, 1)
+	p, err := ns.encode(Message{Event: event, Room: r.name, Data: data, Ack: id}, emitOptions{})
+	if err != nil {
+		return nil, err
+	}
+	replies := make(chan ackReply, len(members))
+	waiting := make(map[*Client]bool, len(members))
+	defer func() {
+		for c := range waiting {
+			c.cancelAck(id)
+		}
+	}()
+	var sent int64
+	for _, c := range members {
+		if !c.expectAck(id, replies) {
+			results[c.id] = AckResult{Err: ErrClientClosed}
+			continue
+		}
+		m := p.frame(c)
+		if err := c.enqueue(m, false); err != nil {
+			c.cancelAck(id)
+			results[c.id] = AckResult{Err: err}
+			continue
+		}
+		sent += int64(len(m.data))
+		waiting[c] = true
+	}
+	ns.bytes.add(r.name, sent)
+
+	need := len(members)
+	if o.quorum > 0 {
+		need = int(math.Ceil(o.quorum * float64(len(members))))
+	}
+	acked := 0
+	for len(waiting) > 0 && acked < need {
+		select {
+		case rep := <-replies:
+			if !waiting[rep.client] {
+				continue
+			}
+			delete(waiting, rep.client)
+			results[rep.client.id] = AckResult{Data: rep.data, Err: rep.err}
+			if rep.err == nil {
+				acked++
+			}
+		case <-ctx.Done():
+			for c := range waiting {
+				results[c.id] = AckResult{Err: ctx.Err()}
+			}
+			return results, ctx.Err()
+		}
+	}
+	for c := range waiting {
+		results[c.id] = AckResult{Err: ErrNoAck}
+	}
+	if o.quorum > 0 && acked < need {
+		return results, ErrQuorumNotMet
+	}
+	return results, nil
+}
+
+// expectAck registers ch to receive the client's ack for id. It reports
+// false if the client has disconnected.
+func (c *Client) expectAck(id uint64, ch chan<- ackReply) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.acksClosed {
+		return false
+	}
+	if c.acks == nil {
+		c.acks = make(map[uint64]chan<- ackReply)
+	}
+	c.acks[id] = ch
+	return true
+}
+
+func (c *Client) cancelAck(id uint64) {
+	c.mu.Lock()
+	delete(c.acks, id)
+	c.mu.Unlock()
+}
+
+// Ack answers the event's Ack ID with data in an EventAck, or in an
+// EventAcks batch if the client negotiated FeatureAckBatch. It does nothing
+// if the event carries no Ack ID. For Idempotent handlers the answer is
+// remembered and sent again in reply to repeats of the event.
+func (ev *Event) Ack(data interface{}) {
+	ev.ack(data, false)
+}
+
+func (ev *Event) ack(data interface{}, now bool) {
+	if ev.msg.Ack == 0 {
+		return
+	}
+	if ev.seen != nil {
+		ev.seen.recordAck(data)
+	}
+	if now {
+		ev.client.sendAckNow(ev.msg.Ack, data)
+		return
+	}
+	ev.client.sendAck(ev.msg.Ack, data)
+}
+
+// sendAck answers a request from the client that carried Ack ID id,
+// batching the answer if the client negotiated FeatureAckBatch.
+func (c *Client) sendAck(id uint64, data interface{}) {
+	if c.batchesAcks() {
+		c.queueAck(AckBatchEntry{Ack: id, Data: data})
+		return
+	}
+	c.sendAckNow(id, data)
+}
+
+// sendAckNow answers a request from the client right away.
+func (c *Client) sendAckNow(id uint64, data interface{}) {
+	m, err := c.encode(Message{Event: EventAck, Namespace: c.muxNamespace(), Ack: id, Data: data})
+	if err != nil {
+		return
+	}
+	c.pushAck(m, 1)
+}
+
+// pushAck queues m, carrying n answers to the client's requests, on the
+// control lane, or on the normal lane if the control lane is full. Answers
+// neither lane takes are counted in the namespace's DroppedAcks and
+// reported to its OnError hooks, as the requests they answer will time
+// out.
+func (c *Client) pushAck(m *outbound, n int) {
+	_, err := c.queue.push(m, true)
+	if errors.Is(err, ErrQueueFull) {
+		_, err = c.queue.push(m, false)
+	}
+	if err == nil || errors.Is(err, ErrClientClosed) {
+		return
+	}
+	ns := c.Namespace()
+	atomic.AddInt64(&ns.droppedAcks, int64(n))
+	ns.reportError(c, EventAck, fmt.Errorf("%w: %d answers to client %s dropped", err, n, c.id))
+}
+
+// resolveAck delivers the client's ack for id. Unknown and repeated IDs
+// are ignored.
+func (c *Client) resolveAck(id uint64, data interface{}) {
+	c.mu.Lock()
+	ch, ok := c.acks[id]
+	delete(c.acks, id)
+	c.mu.Unlock()
+	if ok {
+		ch <- ackReply{client: c, data: data}
+	}
+}
+
+// failAcks fails every pending ack with err and refuses new ones.
+func (c *Client) failAcks(err error) {
+	c.mu.Lock()
+	acks := c.acks
+	c.acks, c.acksClosed = nil, true
+	c.mu.Unlock()
+	for _, ch := range acks {
+		ch <- ackReply{client: c, err: err}
+	}
+}
@@ -0,0 +1,213 @@
+package sockx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmitWithAckReturnsClientAnswer(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	tc := dial(t, s, "/")
+	c := ns.Client(tc.welcome.ID)
+
+	type answer struct {
+		data interface{}
+		err  error
+	}
+	done := make(chan answer, 1)
+	go func() {
+		data, err := c.EmitWithAck("question", "ping?", testTimeout)
+		done <- answer{data, err}
+	}()
+	msg := tc.expect("question")
+	if msg.Ack == 0 {
+		t.Fatal("message sent with EmitWithAck carries no Ack ID")
+	}
+	tc.send(Message{Event: EventAck, Ack: msg.Ack, Data: "pong"})
+	if a := <-done; a.err != nil || a.data != "pong" {
+		t.Fatalf("EmitWithAck = %v, %v; want pong", a.data, a.err)
+	}
+}
+
+func TestEmitWithAckTimesOut(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	tc := dial(t, s, "/")
+	c := ns.Client(tc.welcome.ID)
+	if _, err := c.EmitWithAck("question", nil, 20*time.Millisecond); !errors.Is(err, ErrAckTimeout) {
+		t.Fatalf("EmitWithAck without answer = %v, want ErrAckTimeout", err)
+	}
+	// A late answer is discarded.
+	msg := tc.expect("question")
+	tc.send(Message{Event: EventAck, Ack: msg.Ack, Data: "late"})
+}
+
+func TestOnWithAckAnswersRequest(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.OnWithAck("add", func(c *Client, data interface{}) interface{} {
+		var sum float64
+		for _, n := range data.([]interface{}) {
+			sum += n.(float64)
+		}
+		return sum
+	})
+	tc := dial(t, s, "/")
+	tc.send(Message{Event: "add", Data: []int{1, 2, 3}, Ack: 7})
+	msg := tc.expect(EventAck)
+	if msg.Ack != 7 || msg.Data != 6.0 {
+		t.Fatalf("ack = %d %v, want 7 6", msg.Ack, msg.Data)
+	}
+}
+
+func TestMessagesWithoutAckOmitTheField(t *testing.T) {
+	data, _, err := JSONCodec{}.Marshal(Message{Event: "chat", Data: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"ack"`) {
+		t.Fatalf("message without Ack ID encoded as %s", data)
+	}
+}
+
+func TestAckFallsBackToNormalLaneThenReportsDrop(t *testing.T) {
+	s := newTestServer(t, WithSendQueueSize(2))
+	ns := s.Of("/")
+	var mu sync.Mutex
+	var reported []error
+	ns.OnError(func(c *Client, event string, err error) {
+		mu.Lock()
+		reported = append(reported, err)
+		mu.Unlock()
+	})
+	release := make(chan struct{})
+	c := NewDetachedClient(ns, DetachedOutbox(func([]byte) { <-release }))
+	defer close(release)
+	for c.Emit("urgent", nil, Critical()) == nil {
+	}
+
+	// The control lane is full: answers go to the normal lane while it
+	// has room.
+	c.sendAckNow(1, "ok")
+	c.sendAckNow(2, "ok")
+	if n := ns.Stats().DroppedAcks; n != 0 {
+		t.Fatalf("DroppedAcks = %d with room in the normal lane, want 0", n)
+	}
+	c.sendAckNow(3, "ok")
+	if n := ns.Stats().DroppedAcks; n != 1 {
+		t.Fatalf("DroppedAcks = %d, want 1", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || !errors.Is(reported[0], ErrQueueFull) {
+		t.Fatalf("OnError saw %v, want one ErrQueueFull", reported)
+	}
+}
+
+// ackRoom connects n clients to namespace / and puts them in room r.
+func ackRoom(t *testing.T, n int) (*Room, []*testConn) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	conns := make([]*testConn, n)
+	for i := range conns {
+		conns[i] = dial(t, s, "/")
+		ns.Client(conns[i].welcome.ID).Join("r")
+	}
+	return ns.Room("r"), conns
+}
+
+// roomAcks is the outcome of Room.EmitWithAcks.
+type roomAcks struct {
+	results map[string]AckResult
+	err     error
+}
+
+// emitWithAcks runs r.EmitWithAcks in the background.
+func emitWithAcks(ctx context.Context, r *Room, opts ...AckOption) <-chan roomAcks {
+	done := make(chan roomAcks, 1)
+	go func() {
+		results, err := r.EmitWithAcks(ctx, "question", "ready?", opts...)
+		done <- roomAcks{results, err}
+	}()
+	return done
+}
+
+// answer acknowledges the next question with data.
+func (tc *testConn) answer(data interface{}) {
+	tc.t.Helper()
+	msg := tc.expect("question")
+	if msg.Ack == 0 || msg.Room != "r" {
+		tc.t.Fatalf("question = %+v, want an Ack ID and room r", msg)
+	}
+	tc.send(Message{Event: EventAck, Ack: msg.Ack, Data: data})
+}
+
+func TestRoomEmitWithAcksCollectsEveryMember(t *testing.T) {
+	r, conns := ackRoom(t, 3)
+	done := emitWithAcks(context.Background(), r)
+	for i, tc := range conns {
+		tc.answer(float64(i))
+	}
+	got := <-done
+	if got.err != nil || len(got.results) != 3 {
+		t.Fatalf("EmitWithAcks = %v, %v", got.results, got.err)
+	}
+	for i, tc := range conns {
+		if res := got.results[tc.welcome.ID]; res.Err != nil || res.Data != float64(i) {
+			t.Fatalf("result of member %d = %+v", i, res)
+		}
+	}
+}
+
+func TestRoomEmitWithAcksResolvesOnQuorum(t *testing.T) {
+	r, conns := ackRoom(t, 3)
+	done := emitWithAcks(context.Background(), r, Quorum(0.5))
+	conns[0].answer("yes")
+	conns[1].answer("yes")
+	got := <-done
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	if res := got.results[conns[2].welcome.ID]; res.Err != ErrNoAck {
+		t.Fatalf("silent member = %+v, want %v", res, ErrNoAck)
+	}
+}
+
+func TestRoomEmitWithAcksReportsDisconnects(t *testing.T) {
+	r, conns := ackRoom(t, 3)
+	done := emitWithAcks(context.Background(), r, Quorum(1))
+	conns[0].answer("yes")
+	conns[1].answer("yes")
+	conns[2].expect("question")
+	conns[2].conn.Close()
+	got := <-done
+	if got.err != ErrQuorumNotMet {
+		t.Fatalf("EmitWithAcks = %v, want %v", got.err, ErrQuorumNotMet)
+	}
+	if res := got.results[conns[2].welcome.ID]; res.Err != ErrClientClosed {
+		t.Fatalf("disconnected member = %+v, want %v", res, ErrClientClosed)
+	}
+}
+
+func TestRoomEmitWithAcksStopsWithContext(t *testing.T) {
+	r, conns := ackRoom(t, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := emitWithAcks(ctx, r)
+	conns[0].answer("yes")
+	got := <-done
+	if got.err != context.DeadlineExceeded {
+		t.Fatalf("EmitWithAcks = %v, want %v", got.err, context.DeadlineExceeded)
+	}
+	if res := got.results[conns[0].welcome.ID]; res.Err != nil || res.Data != "yes" {
+		t.Fatalf("answering member = %+v", res)
+	}
+	if res := got.results[conns[1].welcome.ID]; res.Err != context.DeadlineExceeded {
+		t.Fatalf("silent member = %+v, want %v", res, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,129 @@
+package sockx
+
+import (
+	"sync"
+	"time"
+)
+
+// EventAcks carries several acknowledgements in one frame, to and from
+// clients that negotiated FeatureAckBatch. Its data is a list of
+// AckBatchEntry, each answering the request with its Ack ID as an EventAck
+// would.
+const EventAcks = "sockx:acks"
+
+// FeatureAckBatch lets each end coalesce the acknowledgements it sends
+// during a burst, such as a sync loop answering many requests, into
+// EventAcks frames instead of one EventAck frame each. An acknowledgement
+// waits up to 5ms for others to join it, and a batch is sent as soon as it
+// holds 50, so batching delays acknowledgements by at most a few
+// milliseconds; see Event.AckNow for those that cannot wait. The server
+// only batches for clients that speak JSONCodec, and acknowledgements may
+// arrive after messages the server sent later.
+const FeatureAckBatch Feature = "acks"
+
+const (
+	// ackBatchWindow is how long an acknowledgement waits for others to
+	// be batched with it.
+	ackBatchWindow = 5 * time.Millisecond
+
+	// maxAckBatch is the most acknowledgements sent in one EventAcks
+	// frame.
+	maxAckBatch = 50
+)
+
+func init() {
+	supportedFeatures = append(supportedFeatures, FeatureAckBatch)
+}
+
+// AckBatchEntry is one acknowledgement of an EventAcks frame.
+type AckBatchEntry struct {
+	Ack  uint64      `json:"ack"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// ackBatch holds the acknowledgements a client is waiting to send.
+type ackBatch struct {
+	mu      sync.Mutex
+	entries []AckBatchEntry
+	timer   *time.Timer
+}
+
+// takeLocked empties the batch and returns what it held. b.mu must be
+// held.
+func (b *ackBatch) takeLocked() []AckBatchEntry {
+	entries := b.entries
+	b.entries = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return entries
+}
+
+// AckNow answers the event's Ack ID like Ack, but sends the answer right
+// away even if the client negotiated FeatureAckBatch, for latency-sensitive
+// requests the client waits on.
+func (ev *Event) AckNow(data interface{}) {
+	ev.ack(data, true)
+}
+
+// batchesAcks reports whether the acknowledgements sent to the client are
+// batched.
+func (c *Client) batchesAcks() bool {
+	return isJSON(c.codec) && c.Supports(FeatureAckBatch)
+}
+
+// queueAck adds an acknowledgement to the client's batch, sending the
+// batch if it is full and otherwise when the batch window closes.
+func (c *Client) queueAck(e AckBatchEntry) {
+	b := &c.ackBatch
+	b.mu.Lock()
+	b.entries = append(b.entries, e)
+	if len(b.entries) >= maxAckBatch {
+		entries := b.takeLocked()
+		b.mu.Unlock()
+		c.sendAcks(entries)
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(ackBatchWindow, c.flushAcks)
+	}
+	b.mu.Unlock()
+}
+
+// flushAcks sends the acknowledgements batched so far.
+func (c *Client) flushAcks() {
+	b := &c.ackBatch
+	b.mu.Lock()
+	entries := b.takeLocked()
+	b.mu.Unlock()
+	c.sendAcks(entries)
+}
+
+// sendAcks sends entries in one EventAcks frame, or one by one if there is
+// a single entry or the frame cannot be encoded, so that one bad answer
+// does not lose the others.
+func (c *Client) sendAcks(entries []AckBatchEntry) {
+	if len(entries) > 1 {
+		m, err := c.encode(Message{Event: EventAcks, Namespace: c.muxNamespace(), Data: entries})
+		if err == nil {
+			c.pushAck(m, len(entries))
+			return
+		}
+	}
+	for _, e := range entries {
+		c.sendAckNow(e.Ack, e.Data)
+	}
+}
+
+// resolveAcks delivers the acknowledgements of an EventAcks frame.
+func (c *Client) resolveAcks(msg Message) {
+	var entries []AckBatchEntry
+	if err := msg.Bind(&entries); err != nil {
+		c.sendControl(EventError, ErrorData{Code: ErrCodeBadMessage, Message: "bad " + EventAcks + ": " + err.Error()})
+		return
+	}
+	for _, e := range entries {
+		c.resolveAck(e.Ack, e.Data)
+	}
+}
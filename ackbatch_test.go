@@ -0,0 +1,157 @@
+package sockx
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collectAcks reads tc until it has answers for acks 1..n, and returns
+// them with the number of frames they took.
+func collectAcks(t *testing.T, tc *testConn, n int) (map[uint64]interface{}, int) {
+	t.Helper()
+	got := make(map[uint64]interface{})
+	frames := 0
+	for len(got) < n {
+		msg := tc.read()
+		switch msg.Event {
+		case EventAck:
+			got[msg.Ack] = msg.Data
+		case EventAcks:
+			var entries []AckBatchEntry
+			if err := msg.Bind(&entries); err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				got[e.Ack] = e.Data
+			}
+		default:
+			continue
+		}
+		frames++
+	}
+	return got, frames
+}
+
+func TestAckBatchingReducesFrames(t *testing.T) {
+	const requests = 40
+	frames := make(map[bool]int)
+	for _, batched := range []bool{false, true} {
+		s := newTestServer(t)
+		s.Of("/").OnEvent("ping", func(ev *Event) { ev.Ack(ev.Data()) })
+		var tc *testConn
+		if batched {
+			tc = dialFeatures(t, s, "/", FeatureAckBatch)
+		} else {
+			tc = dial(t, s, "/")
+		}
+		for i := 1; i <= requests; i++ {
+			tc.send(Message{Event: "ping", Data: i, Ack: uint64(i)})
+		}
+		got, n := collectAcks(t, tc, requests)
+		for i := 1; i <= requests; i++ {
+			if got[uint64(i)] != float64(i) {
+				t.Fatalf("batched=%v: ack %d answered with %v", batched, i, got[uint64(i)])
+			}
+		}
+		frames[batched] = n
+	}
+	t.Logf("%d acks took %d frames unbatched and %d batched", requests, frames[false], frames[true])
+	if frames[false] != requests || frames[true] > requests/2 {
+		t.Fatalf("%d frames unbatched and %d batched, want %d and at most %d", frames[false], frames[true], requests, requests/2)
+	}
+}
+
+func TestAckNowIsNotBatched(t *testing.T) {
+	s := newTestServer(t)
+	s.Of("/").OnEvent("ping", func(ev *Event) { ev.AckNow("now") })
+	tc := dialFeatures(t, s, "/", FeatureAckBatch)
+	tc.send(Message{Event: "ping", Ack: 1})
+	if msg := tc.read(); msg.Event != EventAck || msg.Ack != 1 || msg.Data != "now" {
+		t.Fatalf("got %+v, want an EventAck on its own", msg)
+	}
+}
+
+func TestBatchedAcksRacingDisconnectResolveEveryRequest(t *testing.T) {
+	const requests = 20
+	s := newTestServer(t)
+	ns := s.Of("/")
+	tc := dialFeatures(t, s, "/", FeatureAckBatch)
+	c := ns.Client(tc.welcome.ID)
+
+	type result struct {
+		i    int
+		data interface{}
+		err  error
+	}
+	results := make(chan result, requests+1)
+	var wg sync.WaitGroup
+	for i := 0; i <= requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			event := "sync"
+			if i == requests {
+				event = "unanswered"
+			}
+			data, err := c.EmitWithAck(event, i, time.Minute)
+			results <- result{i, data, err}
+		}(i)
+	}
+
+	// Answer every sync request in one batch and hang up right after it.
+	var entries []AckBatchEntry
+	for len(entries) < requests {
+		if msg := tc.read(); msg.Event == "sync" {
+			entries = append(entries, AckBatchEntry{Ack: msg.Ack, Data: msg.Data})
+		}
+	}
+	tc.send(Message{Event: EventAcks, Data: entries})
+	tc.conn.Close()
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("requests still waiting after the client left")
+	}
+	close(results)
+	for r := range results {
+		if r.i == requests {
+			if !errors.Is(r.err, ErrClientClosed) {
+				t.Errorf("unanswered request = %v, want ErrClientClosed", r.err)
+			}
+			continue
+		}
+		if r.err != nil || r.data != float64(r.i) {
+			t.Errorf("request %d = %v, %v; want its answer", r.i, r.data, r.err)
+		}
+	}
+}
+
+func TestAckBatchFlushAfterDisconnect(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	handled := make(chan struct{}, 10)
+	ns.OnEvent("ping", func(ev *Event) {
+		ev.Ack(nil)
+		handled <- struct{}{}
+	})
+	tc := dialFeatures(t, s, "/", FeatureAckBatch)
+	for i := 1; i <= 10; i++ {
+		tc.send(Message{Event: "ping", Ack: uint64(i)})
+	}
+	for i := 0; i < 10; i++ {
+		<-handled
+	}
+	// The batch is still waiting for its window when the client leaves:
+	// its flush finds the queue closed, which is not a congestion drop.
+	tc.conn.Close()
+	waitFor(t, "client gone", func() bool { return ns.Count() == 0 })
+	time.Sleep(2 * ackBatchWindow)
+	if n := ns.Stats().DroppedAcks; n != 0 {
+		t.Fatalf("DroppedAcks = %d, want 0", n)
+	}
+}
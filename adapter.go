@@ -0,0 +1,123 @@
+package sockx
+
+import "sync"
+
+// Adapter connects the namespaces of several servers so that emits reach
+// clients connected to any of them. Namespace and room emits are published
+// through the adapter and delivered locally; messages received from the
+// adapter are delivered to local clients only and never published again.
+//
+// A failing adapter degrades the server to local delivery rather than
+// failing emits, which report the failure in EmitResult.PublishErr: see
+// Config.AdapterBreaker and Server.AdapterHealth.
+type Adapter interface {
+	// Publish sends msg to the other nodes. room is empty for
+	// namespace-wide emits.
+	Publish(namespace, room string, msg Message) error
+
+	// Subscribe registers the handler for messages published by other
+	// nodes, replacing any previous one. It is called by NewServer and
+	// again whenever the adapter recovers from an outage, so that a
+	// subscription lost with the backend is restored.
+	Subscribe(handler func(namespace, room string, msg Message))
+}
+
+// ChannelNamer is implemented by adapters that can name the backend
+// channel or subject a message for a room is published to, as reported in
+// EmitResult.Channel. For other adapters the channel is the namespace
+// name, followed by "#" and the room for room emits.
+type ChannelNamer interface {
+	Channel(namespace, room string) string
+}
+
+// adapterChannel names what a publishes messages for room to.
+func adapterChannel(a Adapter, namespace, room string) string {
+	if n, ok := a.(ChannelNamer); ok {
+		return n.Channel(namespace, room)
+	}
+	if room == "" {
+		return namespace
+	}
+	return namespace + "#" + room
+}
+
+// WithAdapter connects the server to other nodes through a.
+func WithAdapter(a Adapter) Option {
+	return func(c *Config) { c.Adapter = a }
+}
+
+// handleRemote delivers a message received from the adapter to local
+// clients. Messages the server published itself, which some backends echo
+// back, are dropped.
+func (s *Server) handleRemote(namespace, room string, msg Message) {
+	if msg.OriginNode == s.NodeID() {
+		return
+	}
+	s.mu.RLock()
+	ns, ok := s.namespaces[namespace]
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+	s.received.add(msg.Origin[LabelZone])
+	s.fromNodes.add(msg.OriginNode)
+	msg.Room, msg.Origin, msg.OriginNode = room, nil, ""
+	recipients := ns.snapshotClients
+	if room != "" {
+		recipients = ns.roomClients(room)
+	}
+	ns.emit(msg, recipients, emitOptions{localOnly: true})
+}
+
+// MemoryBus connects the adapters of servers running in the same process.
+// It is meant for tests and for trying out multi-node setups.
+type MemoryBus struct {
+	mu       sync.RWMutex
+	adapters []*memoryAdapter
+}
+
+// NewMemoryBus returns an empty bus.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Adapter returns a new adapter attached to the bus, for one server.
+func (b *MemoryBus) Adapter() Adapter {
+	a := &memoryAdapter{bus: b}
+	b.mu.Lock()
+	b.adapters = append(b.adapters, a)
+	b.mu.Unlock()
+	return a
+}
+
+type memoryAdapter struct {
+	bus *MemoryBus
+
+	mu      sync.RWMutex
+	handler func(namespace, room string, msg Message)
+}
+
+// Publish delivers msg synchronously to every other adapter on the bus.
+func (a *memoryAdapter) Publish(namespace, room string, msg Message) error {
+	a.bus.mu.RLock()
+	peers := a.bus.adapters
+	a.bus.mu.RUnlock()
+	for _, peer := range peers {
+		if peer == a {
+			continue
+		}
+		peer.mu.RLock()
+		h := peer.handler
+		peer.mu.RUnlock()
+		if h != nil {
+			h(namespace, room, msg)
+		}
+	}
+	return nil
+}
+
+func (a *memoryAdapter) Subscribe(handler func(namespace, room string, msg Message)) {
+	a.mu.Lock()
+	a.handler = handler
+	a.mu.Unlock()
+}
@@ -0,0 +1,112 @@
+package sockx
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingAdapter counts the messages its server publishes.
+type countingAdapter struct {
+	Adapter
+	published atomic.Int64
+}
+
+func (a *countingAdapter) Publish(namespace, room string, msg Message) error {
+	a.published.Add(1)
+	return a.Adapter.Publish(namespace, room, msg)
+}
+
+// cluster is a set of servers connected by a MemoryBus, with a client of
+// namespace / on each.
+type cluster struct {
+	servers  []*Server
+	adapters []*countingAdapter
+	conns    []*testConn
+}
+
+func newCluster(t *testing.T, nodes int) *cluster {
+	bus := NewMemoryBus()
+	cl := &cluster{}
+	for i := 0; i < nodes; i++ {
+		a := &countingAdapter{Adapter: bus.Adapter()}
+		s := newTestServer(t, WithAdapter(a))
+		cl.servers = append(cl.servers, s)
+		cl.adapters = append(cl.adapters, a)
+		cl.conns = append(cl.conns, dial(t, s, "/"))
+	}
+	return cl
+}
+
+// expectDeliveries checks which of the cluster's clients receive event
+// exactly once, and that the others receive nothing. It must be the last
+// read of the cluster's connections.
+func (cl *cluster) expectDeliveries(t *testing.T, event string, want ...bool) {
+	t.Helper()
+	for i, tc := range cl.conns {
+		if want[i] {
+			tc.expect(event)
+		}
+		tc.expectNone(event, 50*time.Millisecond)
+	}
+}
+
+// published returns the number of messages each server published.
+func (cl *cluster) published() []int64 {
+	var n []int64
+	for _, a := range cl.adapters {
+		n = append(n, a.published.Load())
+	}
+	return n
+}
+
+func TestAdapterDeliversExactlyOncePerClient(t *testing.T) {
+	cl := newCluster(t, 3)
+	res, err := cl.servers[0].Of("/").Emit("news", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Published || res.Delivered != 1 {
+		t.Fatalf("EmitResult = %+v, want published and delivered to the local client", res)
+	}
+	cl.expectDeliveries(t, "news", true, true, true)
+	if n := cl.published(); n[0] != 1 || n[1] != 0 || n[2] != 0 {
+		t.Fatalf("published %v, want the emitting node only, once", n)
+	}
+}
+
+func TestAdapterDeliversRoomEmitsToMembersOnly(t *testing.T) {
+	cl := newCluster(t, 3)
+	cl.servers[2].Of("/").Client(cl.conns[2].welcome.ID).Join("r")
+	if _, err := cl.servers[0].Of("/").EmitTo("r", "chat", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	cl.expectDeliveries(t, "chat", false, false, true)
+	if n := cl.published(); n[0] != 1 || n[1]+n[2] != 0 {
+		t.Fatalf("published %v, want the emitting node only, once", n)
+	}
+}
+
+func TestLocalOnlyDeliversToLocalClientsOnly(t *testing.T) {
+	cl := newCluster(t, 3)
+	res, err := cl.servers[0].Of("/").Emit("local", nil, LocalOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Published {
+		t.Fatal("LocalOnly emit published")
+	}
+	cl.expectDeliveries(t, "local", true, false, false)
+}
+
+func TestRemoteOnlyDeliversToOtherNodesOnly(t *testing.T) {
+	cl := newCluster(t, 3)
+	res, err := cl.servers[0].Of("/").Emit("remote", nil, RemoteOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Published || res.Delivered != 0 {
+		t.Fatalf("RemoteOnly EmitResult = %+v, want published and not delivered locally", res)
+	}
+	cl.expectDeliveries(t, "remote", false, true, true)
+}
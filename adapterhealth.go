@@ -0,0 +1,162 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrAdapterUnavailable is the cause of an AdapterError for a publish that
+// was skipped because the adapter's breaker is open.
+var ErrAdapterUnavailable = errors.New("sockx: adapter unavailable")
+
+// AdapterError reports an emit that could not be published to other nodes,
+// in EmitResult.PublishErr. The emit has still been delivered to local
+// clients. Publish failures are also reported to OnError; publishes
+// skipped while the breaker is open, wrapping ErrAdapterUnavailable, are
+// only counted in AdapterHealth.Skipped.
+type AdapterError struct {
+	Namespace string
+	Room      string
+	Event     string
+	Err       error
+}
+
+func (e *AdapterError) Error() string {
+	return fmt.Sprintf("sockx: publishing %q to other nodes: %v", e.Event, e.Err)
+}
+
+func (e *AdapterError) Unwrap() error { return e.Err }
+
+// AdapterHealth is a point-in-time view of the server's adapter.
+type AdapterHealth struct {
+	// Configured is false when the server has no adapter, in which case
+	// the other fields are zero.
+	Configured bool
+
+	// State is the adapter breaker's state. Anything but BreakerClosed
+	// means emits are reaching local clients only.
+	State BreakerState
+
+	// Failures counts failed publishes and Skipped counts publishes not
+	// attempted because the breaker was open.
+	Failures int64
+	Skipped  int64
+
+	// Recoveries counts outages the adapter has recovered from.
+	Recoveries int64
+
+	LastError   error
+	LastFailure time.Time
+}
+
+// adapterBreaker tracks publish failures and keeps a failing adapter from
+// being called on every emit. It follows the namespace breaker's states.
+type adapterBreaker struct {
+	mu          sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	failures    int
+	openedAt    time.Time
+	probing     bool
+
+	total       int64
+	skipped     int64
+	recoveries  int64
+	lastErr     error
+	lastFailure time.Time
+}
+
+// admit reports whether a publish may be attempted and whether it is a
+// half-open probe.
+func (b *adapterBreaker) admit(cfg BreakerConfig, now time.Time) (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cfg.Failures < 0 || b.state == BreakerClosed {
+		return true, false
+	}
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= cfg.Cooldown {
+		b.state = BreakerHalfOpen
+	}
+	if b.state == BreakerHalfOpen && !b.probing {
+		b.probing = true
+		return true, true
+	}
+	b.skipped++
+	return false, false
+}
+
+// record feeds a publish outcome into the breaker. It reports whether the
+// publish ended an outage.
+func (b *adapterBreaker) record(cfg BreakerConfig, err error, probe bool, now time.Time) (recovered bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.total++
+		b.lastErr, b.lastFailure = err, now
+	}
+	switch {
+	case probe:
+		b.probing = false
+		if err != nil {
+			b.state, b.openedAt = BreakerOpen, now
+			return false
+		}
+		b.state, b.failures = BreakerClosed, 0
+		b.recoveries++
+		return true
+	case err != nil && b.state == BreakerClosed && cfg.Failures > 0:
+		if now.Sub(b.windowStart) > cfg.Window {
+			b.windowStart, b.failures = now, 0
+		}
+		b.failures++
+		if b.failures >= cfg.Failures {
+			b.state, b.openedAt, b.failures = BreakerOpen, now, 0
+		}
+	}
+	return false
+}
+
+// publish sends msg through the adapter, guarded by the adapter breaker.
+// Failures are reported to the namespace's error handlers as an
+// AdapterError. When a probe succeeds after an outage the adapter is
+// subscribed again and every namespace fires LifecycleAdapterRecovered.
+func (ns *Namespace) publish(a Adapter, msg Message) error {
+	s := ns.server
+	cfg := s.cfg()
+	ok, probe := s.adapter.admit(cfg.AdapterBreaker, time.Now())
+	if !ok {
+		return &AdapterError{Namespace: ns.name, Room: msg.Room, Event: msg.Event, Err: ErrAdapterUnavailable}
+	}
+	msg.Origin, msg.OriginNode = cfg.Labels, cfg.NodeID
+	err := a.Publish(ns.name, msg.Room, msg)
+	if s.adapter.record(cfg.AdapterBreaker, err, probe, time.Now()) {
+		a.Subscribe(s.handleRemote)
+		s.fireAll(LifecycleEvent{Kind: LifecycleAdapterRecovered})
+	}
+	if err != nil {
+		err = &AdapterError{Namespace: ns.name, Room: msg.Room, Event: msg.Event, Err: err}
+		ns.reportError(nil, msg.Event, err)
+	}
+	return err
+}
+
+// AdapterHealth returns the state of the server's adapter.
+func (s *Server) AdapterHealth() AdapterHealth {
+	if s.cfg().Adapter == nil {
+		return AdapterHealth{}
+	}
+	b := &s.adapter
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return AdapterHealth{
+		Configured:  true,
+		State:       b.state,
+		Failures:    b.total,
+		Skipped:     b.skipped,
+		Recoveries:  b.recoveries,
+		LastError:   b.lastErr,
+		LastFailure: b.lastFailure,
+	}
+}
@@ -0,0 +1,112 @@
+package sockx
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyAdapter is an adapter whose publishes fail while failing is set.
+type flakyAdapter struct {
+	Adapter
+	failing    atomic.Bool
+	publishes  atomic.Int64
+	subscribes atomic.Int64
+}
+
+var errBackendDown = errors.New("backend down")
+
+func (a *flakyAdapter) Publish(namespace, room string, msg Message) error {
+	a.publishes.Add(1)
+	if a.failing.Load() {
+		return errBackendDown
+	}
+	return a.Adapter.Publish(namespace, room, msg)
+}
+
+func (a *flakyAdapter) Subscribe(handler func(namespace, room string, msg Message)) {
+	a.subscribes.Add(1)
+	a.Adapter.Subscribe(handler)
+}
+
+func TestAdapterOutageDegradesToLocalDelivery(t *testing.T) {
+	const cooldown = 100 * time.Millisecond
+	a := &flakyAdapter{Adapter: NewMemoryBus().Adapter()}
+	s := newTestServer(t, WithAdapter(a), WithAdapterBreaker(BreakerConfig{Failures: 2, Window: time.Minute, Cooldown: cooldown}))
+	ns := s.Of("/")
+	var reported atomic.Int64
+	ns.OnError(func(c *Client, event string, err error) {
+		var ae *AdapterError
+		if errors.As(err, &ae) && errors.Is(err, errBackendDown) {
+			reported.Add(1)
+		}
+	})
+	recovered := make(chan struct{}, 1)
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind == LifecycleAdapterRecovered {
+			recovered <- struct{}{}
+		}
+	})
+	tc := dial(t, s, "/")
+	emit := func() EmitResult {
+		t.Helper()
+		res, err := ns.Emit("news", nil)
+		if err != nil {
+			t.Fatalf("emit failed with the adapter down: %v", err)
+		}
+		if res.Delivered != 1 {
+			t.Fatalf("delivered to %d local clients, want 1", res.Delivered)
+		}
+		tc.expect("news")
+		return res
+	}
+
+	a.failing.Store(true)
+	for i := 0; i < 2; i++ {
+		if res := emit(); res.Published || !errors.Is(res.PublishErr, errBackendDown) {
+			t.Fatalf("failed publish reported as %+v", res)
+		}
+	}
+	if h := s.AdapterHealth(); h.State != BreakerOpen || h.Failures != 2 || !errors.Is(h.LastError, errBackendDown) {
+		t.Fatalf("health after two failures = %+v, want the breaker open", h)
+	}
+	if n := reported.Load(); n != 2 {
+		t.Fatalf("%d failures reported to OnError, want 2", n)
+	}
+
+	// While the breaker is open the adapter is not called.
+	publishes := a.publishes.Load()
+	if res := emit(); !errors.Is(res.PublishErr, ErrAdapterUnavailable) {
+		t.Fatalf("emit during the outage reported %v, want ErrAdapterUnavailable", res.PublishErr)
+	}
+	if a.publishes.Load() != publishes || s.AdapterHealth().Skipped != 1 {
+		t.Fatalf("adapter called while the breaker was open: %+v", s.AdapterHealth())
+	}
+
+	a.failing.Store(false)
+	time.Sleep(cooldown)
+	if res := emit(); !res.Published || res.PublishErr != nil {
+		t.Fatalf("probe emit = %+v, want published", res)
+	}
+	select {
+	case <-recovered:
+	case <-time.After(testTimeout):
+		t.Fatal("LifecycleAdapterRecovered not fired")
+	}
+	if h := s.AdapterHealth(); h.State != BreakerClosed || h.Recoveries != 1 {
+		t.Fatalf("health after recovery = %+v", h)
+	}
+	if n := a.subscribes.Load(); n != 2 {
+		t.Fatalf("adapter subscribed %d times, want again after recovering", n)
+	}
+}
+
+func TestRemoteOnlyEmitReturnsPublishError(t *testing.T) {
+	a := &flakyAdapter{Adapter: NewMemoryBus().Adapter()}
+	a.failing.Store(true)
+	s := newTestServer(t, WithAdapter(a))
+	if _, err := s.Of("/").Emit("news", nil, RemoteOnly()); !errors.Is(err, errBackendDown) {
+		t.Fatalf("RemoteOnly emit = %v, want the publish error", err)
+	}
+}
@@ -0,0 +1,229 @@
+package sockx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRoomArchiving is returned by Join and MigrateRoom for a room whose
+// previous incarnation is still being archived; see OnRoomArchive.
+var ErrRoomArchiving = errors.New("sockx: room is being archived")
+
+const (
+	// defaultArchiveTimeout bounds a single call of a RoomArchiver.
+	defaultArchiveTimeout = 30 * time.Second
+
+	// maxMembershipLog is how many membership changes a room keeps for
+	// its archive. Older ones are dropped.
+	maxMembershipLog = 1000
+)
+
+// RoomArchive is the final record of a room, given to the namespace's
+// RoomArchiver when the room is destroyed.
+type RoomArchive struct {
+	Namespace string
+	Room      string
+
+	// Metadata is the room's directory metadata, if it is listed; see
+	// SetListing.
+	Metadata map[string]interface{}
+
+	// History holds the messages of the room's history, oldest first, if
+	// the namespace has history enabled.
+	History []Message
+
+	// Memberships logs the joins and leaves of the room, oldest first,
+	// while the server had a membership feed; see MembershipFeed. Only the
+	// last 1000 are kept, and MembershipsTruncated is set if older ones
+	// were dropped.
+	Memberships          []MembershipChange
+	MembershipsTruncated bool
+
+	CreatedAt   time.Time
+	DestroyedAt time.Time
+}
+
+// RoomArchiver persists the archive of a destroyed room. It runs on a
+// goroutine of its own, after the room's last member left; ctx is done
+// when the attempt times out.
+type RoomArchiver func(ctx context.Context, archive RoomArchive) error
+
+// ArchiveOption configures a RoomArchiver.
+type ArchiveOption func(*archiveConfig)
+
+type archiveConfig struct {
+	fn       RoomArchiver
+	timeout  time.Duration
+	backoff  BackoffPolicy
+	attempts int
+}
+
+// ArchiveRetry retries a failed archive up to attempts times in all,
+// waiting as policy advises between attempts. A zero policy uses
+// DefaultBackoffPolicy. By default a failed archive is not retried.
+func ArchiveRetry(policy BackoffPolicy, attempts int) ArchiveOption {
+	return func(cfg *archiveConfig) {
+		if policy == (BackoffPolicy{}) {
+			policy = DefaultBackoffPolicy
+		}
+		cfg.backoff, cfg.attempts = policy, attempts
+	}
+}
+
+// ArchiveTimeout bounds each attempt to archive a room. Defaults to 30s.
+func ArchiveTimeout(d time.Duration) ArchiveOption {
+	return func(cfg *archiveConfig) { cfg.timeout = d }
+}
+
+// OnRoomArchive sets fn to archive the namespace's rooms when they are
+// destroyed, replacing any previous archiver; nil stops archiving. Until
+// fn succeeds or its attempts run out the room's name stays reserved:
+// joining it fails with ErrRoomArchiving, so that the room is not
+// recreated before its previous incarnation is saved. A room that is
+// migrated to another namespace is not destroyed and not archived.
+// Archives that fail for good are logged and reported to OnError.
+func (ns *Namespace) OnRoomArchive(fn RoomArchiver, opts ...ArchiveOption) {
+	var cfg *archiveConfig
+	if fn != nil {
+		cfg = &archiveConfig{fn: fn, timeout: defaultArchiveTimeout, attempts: 1}
+		for _, opt := range opts {
+			opt(cfg)
+		}
+	}
+	ns.mu.Lock()
+	ns.archiver = cfg
+	ns.mu.Unlock()
+}
+
+// archiveJob is the archiving of a destroyed room.
+type archiveJob struct {
+	room        *Room
+	destroyedAt time.Time
+	started     bool
+}
+
+// reserveArchiveLocked reserves the name of r, which has just been
+// destroyed, until it is archived, if the namespace archives rooms. The
+// archive starts when the destruction is reported. ns.mu must be held for
+// writing.
+func (ns *Namespace) reserveArchiveLocked(r *Room) {
+	if ns.archiver == nil {
+		return
+	}
+	if ns.archiving == nil {
+		ns.archiving = make(map[string]*archiveJob)
+	}
+	ns.archiving[r.name] = &archiveJob{room: r, destroyedAt: time.Now()}
+}
+
+// startArchive archives the destroyed room name, if its name was reserved
+// for it.
+func (ns *Namespace) startArchive(name string) {
+	ns.mu.Lock()
+	job := ns.archiving[name]
+	cfg := ns.archiver
+	if job == nil || job.started {
+		ns.mu.Unlock()
+		return
+	}
+	if cfg == nil {
+		delete(ns.archiving, name)
+		ns.mu.Unlock()
+		return
+	}
+	job.started = true
+	ns.mu.Unlock()
+
+	archive := ns.roomArchive(job)
+	go ns.runArchive(cfg, archive)
+}
+
+// runArchive calls the archiver until it succeeds or runs out of attempts,
+// and then releases the room's name.
+func (ns *Namespace) runArchive(cfg *archiveConfig, archive RoomArchive) {
+	for attempt := 1; ; attempt++ {
+		err := callArchiver(cfg, archive)
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.attempts {
+			err = fmt.Errorf("sockx: archiving room %q failed after %d attempts: %w", archive.Room, attempt, err)
+			ns.server.logf("%v", err)
+			ns.reportError(nil, "", err)
+			break
+		}
+		time.Sleep(cfg.backoff.Delay(attempt))
+	}
+	ns.mu.Lock()
+	delete(ns.archiving, archive.Room)
+	ns.mu.Unlock()
+}
+
+// callArchiver makes one attempt to archive, treating a panic as an error.
+func callArchiver(cfg *archiveConfig, archive RoomArchive) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("sockx: panic: %v", p)
+		}
+	}()
+	return cfg.fn(ctx, archive)
+}
+
+// roomArchive collects the archive of job's room.
+func (ns *Namespace) roomArchive(job *archiveJob) RoomArchive {
+	r := job.room
+	a := RoomArchive{
+		Namespace:   ns.name,
+		Room:        r.name,
+		CreatedAt:   r.createdAt,
+		DestroyedAt: job.destroyedAt,
+	}
+	if h := r.history; h != nil {
+		h.mu.Lock()
+		a.History = make([]Message, len(h.entries))
+		for i, e := range h.entries {
+			a.History[i] = e.p.msg
+		}
+		h.mu.Unlock()
+	}
+	r.mu.RLock()
+	a.Memberships = append([]MembershipChange(nil), r.membershipLog...)
+	a.MembershipsTruncated = r.membershipLogTruncated
+	r.mu.RUnlock()
+
+	d := &ns.directory
+	d.mu.Lock()
+	if l := d.listings[r.name]; l != nil {
+		a.Metadata = l.metadata
+	}
+	d.mu.Unlock()
+	return a
+}
+
+// logMembership adds ch to the membership log of its room, if the
+// namespace archives rooms. The room may just have been destroyed by the
+// change, in which case it is found among the rooms being archived.
+func (ns *Namespace) logMembership(ch MembershipChange) {
+	ns.mu.RLock()
+	r := ns.rooms[ch.Room]
+	if job := ns.archiving[ch.Room]; r == nil && job != nil && !job.started {
+		r = job.room
+	}
+	archives := ns.archiver != nil
+	ns.mu.RUnlock()
+	if r == nil || !archives {
+		return
+	}
+	r.mu.Lock()
+	if len(r.membershipLog) == maxMembershipLog {
+		copy(r.membershipLog, r.membershipLog[1:])
+		r.membershipLog = r.membershipLog[:len(r.membershipLog)-1]
+		r.membershipLogTruncated = true
+	}
+	r.membershipLog = append(r.membershipLog, ch)
+	r.mu.Unlock()
+}
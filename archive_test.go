@@ -0,0 +1,99 @@
+package sockx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRoomArchiveRecordsDestroyedRoom(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.EnableHistory(10)
+	_, cancel := s.MembershipFeed(10)
+	defer cancel()
+	archives := make(chan RoomArchive, 1)
+	release := make(chan struct{})
+	ns.OnRoomArchive(func(ctx context.Context, a RoomArchive) error {
+		archives <- a
+		<-release
+		return nil
+	})
+	a, b := NewDetachedClient(ns), NewDetachedClient(ns)
+	a.Join("r")
+	ns.SetListing("r", Listed(true), ListingMetadata(map[string]interface{}{"topic": "go"}))
+	b.Join("r")
+	ns.EmitTo("r", "msg", 1)
+	a.Leave("r")
+	b.Disconnect(websocket.CloseNormalClosure, "")
+
+	got := <-archives
+	var memberships []string
+	for _, ch := range got.Memberships {
+		memberships = append(memberships, fmt.Sprint(ch.Type))
+	}
+	if got.Namespace != "/" || got.Room != "r" || got.Metadata["topic"] != "go" {
+		t.Fatalf("archive = %+v", got)
+	}
+	if len(got.History) != 1 || got.History[0].Event != "msg" {
+		t.Fatalf("archived history %+v, want the msg", got.History)
+	}
+	if want := "[join join leave disconnect]"; fmt.Sprint(memberships) != want || got.MembershipsTruncated {
+		t.Fatalf("archived memberships %v, want %s", memberships, want)
+	}
+	if got.CreatedAt.IsZero() || got.DestroyedAt.Before(got.CreatedAt) {
+		t.Fatalf("room created at %v and destroyed at %v", got.CreatedAt, got.DestroyedAt)
+	}
+
+	// The name is reserved until the archive is saved.
+	if err := a.Join("r"); !errors.Is(err, ErrRoomArchiving) {
+		t.Fatalf("Join while archiving = %v, want %v", err, ErrRoomArchiving)
+	}
+	close(release)
+	waitFor(t, "the room to be released", func() bool { return a.Join("r") == nil })
+}
+
+func TestRoomArchiveRetriesAndReportsFailure(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var log errorLog
+	log.watch(ns)
+	var attempts atomic.Int64
+	ns.OnRoomArchive(func(ctx context.Context, a RoomArchive) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("archive attempt without a deadline")
+		}
+		if attempts.Add(1) == 1 {
+			panic("store down")
+		}
+		return errors.New("store still down")
+	}, ArchiveRetry(BackoffPolicy{Base: time.Millisecond, Max: time.Millisecond, Multiplier: 1}, 3), ArchiveTimeout(time.Second))
+	c := NewDetachedClient(ns)
+	c.Join("r")
+	c.Leave("r")
+
+	waitFor(t, "the archive to fail", func() bool { return log.last() != nil })
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("archiver called %d times, want 3", n)
+	}
+	if err := log.last(); !strings.Contains(err.Error(), `room "r" failed after 3 attempts: store still down`) {
+		t.Fatalf("reported %v", err)
+	}
+	waitFor(t, "the room to be released", func() bool { return c.Join("r") == nil })
+
+	// Without an archiver rooms are not reserved.
+	ns.OnRoomArchive(nil)
+	c.Leave("r")
+	if err := c.Join("r"); err != nil {
+		t.Fatalf("Join without an archiver = %v", err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("archiver called %d times after it was removed", n)
+	}
+}
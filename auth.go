@@ -0,0 +1,226 @@
+package sockx
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// Protocol events sent when a client's identity changes.
+const (
+	EventAuthenticated   = "sockx:authenticated"
+	EventDeauthenticated = "sockx:deauthenticated"
+)
+
+// ErrEmptyUserID is returned by Authenticate when userID is empty.
+var ErrEmptyUserID = errors.New("sockx: empty user ID")
+
+// AuthData is the payload of EventAuthenticated and EventDeauthenticated.
+// Ejected lists the rooms the client was removed from because the room
+// guard no longer admits it.
+type AuthData struct {
+	UserID  string   `json:"userId,omitempty"`
+	Ejected []string `json:"ejected,omitempty"`
+}
+
+// SessionPolicy controls how many connections a single user may hold in a
+// namespace.
+type SessionPolicy int
+
+const (
+	// SessionMulti allows any number of connections per user. It is the
+	// default.
+	SessionMulti SessionPolicy = iota
+
+	// SessionSingle disconnects a user's other connections when one of
+	// them authenticates.
+	SessionSingle
+)
+
+// RoomGuard decides whether c may be in room. A non-nil error denies
+// membership and is returned from Join.
+type RoomGuard func(c *Client, room string) error
+
+// SetSessionPolicy sets the namespace's session policy.
+func (ns *Namespace) SetSessionPolicy(p SessionPolicy) {
+	ns.mu.Lock()
+	ns.sessionPolicy = p
+	ns.mu.Unlock()
+}
+
+// SetRoomGuard installs g to vet every Join. Guards are re-evaluated for
+// the rooms a client is in whenever its identity changes.
+func (ns *Namespace) SetRoomGuard(g RoomGuard) {
+	ns.mu.Lock()
+	ns.roomGuard = g
+	ns.mu.Unlock()
+}
+
+// UserClients returns the connections authenticated as userID.
+func (ns *Namespace) UserClients(userID string) []*Client {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	clients := make([]*Client, 0, len(ns.users[userID]))
+	for c := range ns.users[userID] {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// EmitToUser sends event to every connection authenticated as userID on
+// this server. Connections that switch identity while it runs are only
+// sent the message if they are still userID's.
+func (ns *Namespace) EmitToUser(userID, event string, data interface{}, opts ...EmitOption) (EmitResult, error) {
+	return ns.broadcastSelected(ns.UserClients(userID), func(snapshot []*ClientInfo) []*Client {
+		clients := make([]*Client, 0, len(snapshot))
+		for _, ci := range snapshot {
+			if ci.UserID == userID {
+				clients = append(clients, ci.Client)
+			}
+		}
+		return clients
+	}, Message{Event: event, Data: data}, buildEmitOptions(opts))
+}
+
+func (ns *Namespace) checkRoomGuard(c *Client, room string) error {
+	ns.mu.RLock()
+	g := ns.roomGuard
+	ns.mu.RUnlock()
+	if g == nil {
+		return nil
+	}
+	return g(c, room)
+}
+
+// setIdentity updates c's identity and the user index. Under SessionSingle
+// it returns the user's other connections, which the caller must
+// disconnect.
+func (ns *Namespace) setIdentity(c *Client, userID string, claims map[string]interface{}) ([]*Client, error) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if !ns.clients[c] {
+		if !c.admitting.Load() {
+			return nil, ErrClientClosed
+		}
+		// Middleware is vetting the client; addClient indexes it.
+		c.mu.Lock()
+		c.userID, c.claims = userID, claims
+		c.mu.Unlock()
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	prev := c.userID
+	c.userID, c.claims = userID, claims
+	c.mu.Unlock()
+
+	ns.unindexUserLocked(c, prev)
+	if userID == "" {
+		return nil, nil
+	}
+	var others []*Client
+	if ns.sessionPolicy == SessionSingle {
+		for other := range ns.users[userID] {
+			others = append(others, other)
+		}
+	}
+	ns.indexUserLocked(c, userID)
+	return others, nil
+}
+
+func (ns *Namespace) indexUserLocked(c *Client, userID string) {
+	if userID == "" {
+		return
+	}
+	sessions, ok := ns.users[userID]
+	if !ok {
+		sessions = make(map[*Client]bool)
+		ns.users[userID] = sessions
+	}
+	sessions[c] = true
+}
+
+func (ns *Namespace) unindexUserLocked(c *Client, userID string) {
+	if sessions, ok := ns.users[userID]; ok {
+		delete(sessions, c)
+		if len(sessions) == 0 {
+			delete(ns.users, userID)
+		}
+	}
+}
+
+// Authenticate attaches a user identity to an anonymous or already
+// authenticated client, typically from a "login" event handler. It updates
+// the namespace's user index, applies the session policy, removes the client
+// from rooms the room guard no longer admits it to and confirms the change
+// with EventAuthenticated. Called from connection middleware, it only
+// records the identity; see Namespace.Use.
+func (c *Client) Authenticate(userID string, claims map[string]interface{}) error {
+	if userID == "" {
+		return ErrEmptyUserID
+	}
+	copied := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		copied[k] = v
+	}
+	others, err := c.Namespace().setIdentity(c, userID, copied)
+	if err != nil {
+		return err
+	}
+	if c.admitting.Load() {
+		return nil
+	}
+	c.server.stopGuestClock(c)
+	c.server.matchTrace(c)
+	for _, other := range others {
+		other.disconnect(websocket.ClosePolicyViolation, "session replaced")
+	}
+	c.sendControl(EventAuthenticated, AuthData{UserID: userID, Ejected: c.recheckRooms()})
+	return nil
+}
+
+// Deauthenticate drops the client's user identity, making it anonymous
+// again, re-applies the room guard and confirms with EventDeauthenticated.
+func (c *Client) Deauthenticate() error {
+	if _, err := c.Namespace().setIdentity(c, "", nil); err != nil {
+		return err
+	}
+	c.server.startGuestClock(c)
+	c.sendControl(EventDeauthenticated, AuthData{Ejected: c.recheckRooms()})
+	return nil
+}
+
+// UserID returns the authenticated user ID, or "" for anonymous clients.
+func (c *Client) UserID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.userID
+}
+
+// Claims returns the claims passed to Authenticate. The map must not be
+// modified.
+func (c *Client) Claims() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.claims
+}
+
+// recheckRooms removes the client from every room the guard now rejects and
+// returns their names.
+func (c *Client) recheckRooms() []string {
+	c.mu.RLock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	c.mu.RUnlock()
+
+	var ejected []string
+	for _, room := range rooms {
+		if c.Namespace().checkRoomGuard(c, room) != nil {
+			c.leave(room, MembershipKicked)
+			ejected = append(ejected, room)
+		}
+	}
+	return ejected
+}
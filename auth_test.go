@@ -0,0 +1,96 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// errMembersOnly is returned by the room guard of authRoom.
+var errMembersOnly = errors.New("members only")
+
+// authRoom sets up namespace / whose clients sign in and out with "login"
+// and "logout" events, and whose room "members" admits only signed-in
+// clients.
+func authRoom(t *testing.T) (*Namespace, string) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SetRoomGuard(func(c *Client, room string) error {
+		if room == "members" && c.UserID() == "" {
+			return errMembersOnly
+		}
+		return nil
+	})
+	ns.On("login", func(c *Client, data interface{}) {
+		user, _ := data.(string)
+		c.Authenticate(user, map[string]interface{}{"role": "admin"})
+	})
+	ns.On("logout", func(c *Client, data interface{}) { c.Deauthenticate() })
+	return ns, serve(t, s, "/")
+}
+
+func TestAuthenticateMidSession(t *testing.T) {
+	ns, url := authRoom(t)
+	tc := dialURL(t, url, nil)
+	c := ns.Client(tc.welcome.ID)
+	if err := c.Join("members"); !errors.Is(err, errMembersOnly) {
+		t.Fatalf("anonymous Join = %v, want %v", err, errMembersOnly)
+	}
+
+	tc.emit("login", "alice")
+	var auth AuthData
+	if err := tc.expect(EventAuthenticated).Bind(&auth); err != nil {
+		t.Fatal(err)
+	}
+	if auth.UserID != "alice" {
+		t.Fatalf("authenticated as %q, want alice", auth.UserID)
+	}
+	if c.UserID() != "alice" || c.Claims()["role"] != "admin" {
+		t.Fatalf("identity = %q %v", c.UserID(), c.Claims())
+	}
+	if got := ns.UserClients("alice"); len(got) != 1 || got[0] != c {
+		t.Fatalf("UserClients = %v", got)
+	}
+	if err := c.Join("members"); err != nil {
+		t.Fatal(err)
+	}
+	c.Join("lobby")
+
+	tc.emit("logout", nil)
+	if err := tc.expect(EventDeauthenticated).Bind(&auth); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(auth.Ejected) != "[members]" {
+		t.Fatalf("ejected from %v, want [members]", auth.Ejected)
+	}
+	if got := fmt.Sprint(c.Rooms()); got != "[lobby]" {
+		t.Fatalf("rooms after logout = %s, want [lobby]", got)
+	}
+	if c.UserID() != "" || len(ns.UserClients("alice")) != 0 {
+		t.Fatalf("still signed in as %q", c.UserID())
+	}
+	if err := c.Authenticate("", nil); err != ErrEmptyUserID {
+		t.Fatalf("Authenticate with no user = %v, want %v", err, ErrEmptyUserID)
+	}
+}
+
+func TestSessionSingleReplacesOtherConnections(t *testing.T) {
+	ns, url := authRoom(t)
+	ns.SetSessionPolicy(SessionSingle)
+	first, second := dialURL(t, url, nil), dialURL(t, url, nil)
+	first.emit("login", "alice")
+	first.expect(EventAuthenticated)
+
+	second.emit("login", "alice")
+	second.expect(EventAuthenticated)
+	ce, _ := expectClose(t, first, "")
+	if ce.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("replaced session closed with %d, want %d", ce.Code, websocket.ClosePolicyViolation)
+	}
+	waitFor(t, "the replaced session removed", func() bool { return len(ns.UserClients("alice")) == 1 })
+	if ns.UserClients("alice")[0].ID() != second.welcome.ID {
+		t.Fatal("the newer connection was replaced")
+	}
+}
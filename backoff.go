@@ -0,0 +1,105 @@
+package sockx
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BackoffPolicy computes the retry delay advised to rejected clients. The
+// n-th rejection of the same user or IP within Reset of the previous one
+// advises Base*Multiplier^(n-1), capped at Max. The advice is never shorter
+// than the cause of the rejection requires, e.g. a rate limiter's own
+// retry-after.
+type BackoffPolicy struct {
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Reset      time.Duration
+}
+
+// DefaultBackoffPolicy is used when Config.Backoff is zero.
+var DefaultBackoffPolicy = BackoffPolicy{
+	Base:       time.Second,
+	Max:        time.Minute,
+	Multiplier: 2,
+	Reset:      5 * time.Minute,
+}
+
+// WithBackoff sets the policy used to compute retry advice.
+func WithBackoff(p BackoffPolicy) Option {
+	return func(c *Config) { c.Backoff = p }
+}
+
+// Delay returns the delay for the n-th consecutive attempt, counting from
+// 1: the advice for the n-th rejection, or the wait before the n-th
+// reconnect of a client following the policy.
+func (p BackoffPolicy) Delay(n int) time.Duration {
+	d := float64(p.Base) * math.Pow(p.Multiplier, float64(n-1))
+	if d > float64(p.Max) {
+		return p.Max
+	}
+	return time.Duration(d)
+}
+
+// rejectionTracker counts recent rejections per subject.
+type rejectionTracker struct {
+	policy BackoffPolicy
+
+	mu      sync.Mutex
+	entries map[string]*rejection
+	calls   int
+}
+
+type rejection struct {
+	count int
+	last  time.Time
+}
+
+func newRejectionTracker(p BackoffPolicy) *rejectionTracker {
+	return &rejectionTracker{policy: p, entries: make(map[string]*rejection)}
+}
+
+// reject records a rejection of subject and returns the delay to advise,
+// which is at least floor.
+func (t *rejectionTracker) reject(subject string, floor time.Duration) time.Duration {
+	now := time.Now()
+	t.mu.Lock()
+	t.calls++
+	if t.calls%sweepEvery == 0 {
+		for k, e := range t.entries {
+			if now.Sub(e.last) > t.policy.Reset {
+				delete(t.entries, k)
+			}
+		}
+	}
+	e, ok := t.entries[subject]
+	if !ok || now.Sub(e.last) > t.policy.Reset {
+		e = &rejection{}
+		t.entries[subject] = e
+	}
+	e.count++
+	e.last = now
+	d := t.policy.Delay(e.count)
+	t.mu.Unlock()
+	if d < floor {
+		d = floor
+	}
+	return d
+}
+
+// rejectHTTP replies with status and a Retry-After header escalated for the
+// requesting IP.
+func (s *Server) rejectHTTP(w http.ResponseWriter, r *http.Request, status int, msg string, floor time.Duration) {
+	d := s.rejections.reject("ip:"+s.realIP(r), floor)
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10))
+	http.Error(w, msg, status)
+}
+
+// reject sends the client an error event with escalated retry advice.
+func (c *Client) reject(code, msg string, floor time.Duration) {
+	d := c.server.rejections.reject(c.rateSubject(), floor)
+	c.sendControl(EventError, ErrorData{Code: code, Message: msg, RetryAfterMs: d.Milliseconds()})
+}
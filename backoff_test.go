@@ -0,0 +1,89 @@
+package sockx
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoffPolicyDelay(t *testing.T) {
+	p := BackoffPolicy{Base: time.Second, Max: 10 * time.Second, Multiplier: 2}
+	for n, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		if got := p.Delay(n); got != want {
+			t.Errorf("delay(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestRejectionTrackerEscalatesPerSubjectAndResets(t *testing.T) {
+	tr := newRejectionTracker(BackoffPolicy{Base: time.Second, Max: time.Minute, Multiplier: 3, Reset: 50 * time.Millisecond})
+	if d := tr.reject("a", 0); d != time.Second {
+		t.Fatalf("first rejection advises %v, want 1s", d)
+	}
+	if d := tr.reject("a", 0); d != 3*time.Second {
+		t.Fatalf("second rejection advises %v, want 3s", d)
+	}
+	if d := tr.reject("b", 0); d != time.Second {
+		t.Fatalf("other subject advised %v, want 1s", d)
+	}
+	if d := tr.reject("b", 30*time.Second); d != 30*time.Second {
+		t.Fatalf("advice below the floor: %v", d)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if d := tr.reject("a", 0); d != time.Second {
+		t.Fatalf("rejection after Reset advises %v, want 1s", d)
+	}
+}
+
+func TestRateLimitedEventsAdviseEscalatingRetry(t *testing.T) {
+	s := newTestServer(t,
+		WithBackoff(BackoffPolicy{Base: 10 * time.Second, Max: time.Minute, Multiplier: 2, Reset: time.Minute}),
+		WithRateLimits(RateLimits{Events: RateLimit{Rate: 1, Burst: 1}}),
+	)
+	s.Of("/").On("ping", func(c *Client, data interface{}) {})
+	tc := dial(t, s, "/")
+	for i := 0; i < 4; i++ {
+		tc.emit("ping", i)
+	}
+	for _, want := range []int64{10000, 20000, 40000} {
+		var e ErrorData
+		tc.expect(EventError).Bind(&e)
+		if e.Code != ErrCodeRateLimited || e.RetryAfterMs != want {
+			t.Fatalf("rejection = %s after %dms, want %s after %dms", e.Code, e.RetryAfterMs, ErrCodeRateLimited, want)
+		}
+	}
+}
+
+func TestRefusedHandshakesAdviseEscalatingRetryAfter(t *testing.T) {
+	s := newTestServer(t)
+	release := make(chan struct{})
+	defer close(release)
+	go s.OfSetup("/slow", func(ns *Namespace) { <-release }, RejectUntilReady())
+	waitFor(t, "namespace created", func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.namespaces["/slow"] != nil
+	})
+	url := "http" + strings.TrimPrefix(serve(t, s, "/slow"), "ws")
+	for _, want := range []string{"1", "2", "4"} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d, want 503", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Retry-After"); got != want {
+			t.Fatalf("Retry-After = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package sockx
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// Binary messages carry an event with a raw payload. With JSONCodec they
+// are sent in a single WebSocket binary frame, so that they keep their
+// place among the text messages of the connection. The frame holds the
+// length of a header as two big-endian bytes, the header, a JSON Message
+// without Data, and then the payload as is:
+//
+//	| len (2) | {"event":"upload","namespace":"/files"} | payload ... |
+//
+// Clients send binary messages the same way. Their header may set any
+// Message field but Data, which is ignored. Codecs with a binary type of
+// their own, such as MessagePack, carry the payload as the Data of an
+// ordinary message instead.
+
+// maxBinaryHeader is the largest header a binary frame can carry.
+const maxBinaryHeader = 1<<16 - 1
+
+var (
+	errBinaryHeader     = errors.New("binary message header is too long")
+	errBinaryFrameShort = errors.New("binary message shorter than its header")
+)
+
+// BinaryHandler handles an inbound binary message. Register it with
+// OnBinary. The payload is only valid until the handler returns.
+type BinaryHandler func(c *Client, payload []byte)
+
+// OnBinary registers h for binary messages of event, replacing any
+// previous handler of the event. Text messages of the event reach h with
+// a nil payload.
+func (ns *Namespace) OnBinary(event string, h BinaryHandler, opts ...HandlerOption) *Subscription {
+	return ns.OnEvent(event, binaryEventFunc(h), opts...)
+}
+
+// OnBinary registers h for event in the new set, like Namespace.OnBinary.
+func (reg *Registry) OnBinary(event string, h BinaryHandler, opts ...HandlerOption) *Subscription {
+	return reg.OnEvent(event, binaryEventFunc(h), opts...)
+}
+
+func binaryEventFunc(h BinaryHandler) EventFunc {
+	return func(ev *Event) { h(ev.client, ev.Binary()) }
+}
+
+// Binary returns the payload of a binary message, and nil for other
+// messages. It may share the frame the message was read into; see Event
+// for how long it is available.
+func (ev *Event) Binary() []byte {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.checkReleasedLocked("Binary")
+	b, _ := ev.msg.Data.([]byte)
+	return b
+}
+
+// IsBinary reports whether the event is a binary message.
+func (ev *Event) IsBinary() bool {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	_, ok := ev.msg.Data.([]byte)
+	return ok
+}
+
+// EmitBinary sends payload to this client as a binary message of event.
+func (c *Client) EmitBinary(event string, payload []byte) error {
+	msg := Message{Event: event, Namespace: c.muxNamespace()}
+	if !isJSON(c.codec) {
+		msg.Data = payload
+		m, err := c.encode(msg)
+		if err != nil {
+			return err
+		}
+		return c.send(m, false)
+	}
+	b, err := c.codec.(JSONCodec).encodeBinary(msg, payload)
+	if err != nil {
+		return err
+	}
+	return c.send(&outbound{msgType: websocket.BinaryMessage, data: b}, false)
+}
+
+// encodeBinary frames payload as a binary message with the header msg.
+func (j JSONCodec) encodeBinary(msg Message, payload []byte) ([]byte, error) {
+	msg.Data = nil
+	header, err := j.marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > maxBinaryHeader {
+		return nil, errBinaryHeader
+	}
+	b := make([]byte, 2, 2+len(header)+len(payload))
+	binary.BigEndian.PutUint16(b, uint16(len(header)))
+	b = append(b, header...)
+	return append(b, payload...), nil
+}
+
+// decodeBinary parses the header of a binary frame and returns it with the
+// offset of the payload in frame.
+func (j JSONCodec) decodeBinary(frame []byte) (Message, int, error) {
+	var msg Message
+	if len(frame) < 2 {
+		return msg, 0, errBinaryFrameShort
+	}
+	end := 2 + int(binary.BigEndian.Uint16(frame))
+	if len(frame) < end {
+		return msg, 0, errBinaryFrameShort
+	}
+	if err := j.unmarshal(frame[2:end], &msg); err != nil {
+		return msg, 0, err
+	}
+	msg.Data = nil
+	return msg, end, nil
+}
@@ -0,0 +1,87 @@
+package sockx
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// sendBinary writes a binary message of event carrying payload.
+func (tc *testConn) sendBinary(event string, payload []byte) {
+	tc.t.Helper()
+	frame, err := JSONCodec{}.encodeBinary(Message{Event: event}, payload)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	if err := tc.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+// readBinary reads the next frame, which must be a binary message, and
+// returns its header and payload.
+func (tc *testConn) readBinary() (Message, []byte) {
+	tc.t.Helper()
+	msgType, frame, err := tc.conn.ReadMessage()
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	if msgType != websocket.BinaryMessage {
+		tc.t.Fatalf("read a text frame %s, want a binary message", frame)
+	}
+	msg, off, err := JSONCodec{}.decodeBinary(frame)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return msg, frame[off:]
+}
+
+func TestBinaryMessagesRoundTrip(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.OnBinary("upload", func(c *Client, payload []byte) {
+		if payload == nil {
+			c.Emit("text", nil)
+			return
+		}
+		c.EmitBinary("stored", bytes.ToUpper(payload))
+	})
+	tc := dial(t, s, "/")
+
+	payload := []byte("raw \x00\xff bytes")
+	tc.sendBinary("upload", payload)
+	msg, got := tc.readBinary()
+	if msg.Event != "stored" || !bytes.Equal(got, bytes.ToUpper(payload)) {
+		t.Fatalf("got %s %q, want stored %q", msg.Event, got, bytes.ToUpper(payload))
+	}
+
+	// Text messages of the event reach the handler with no payload.
+	tc.emit("upload", "not binary")
+	tc.expect("text")
+
+	tc.conn.WriteMessage(websocket.BinaryMessage, []byte{0, 200, '{'})
+	var e ErrorData
+	if err := tc.expect(EventError).Bind(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != ErrCodeBadMessage {
+		t.Fatalf("truncated binary message: %+v", e)
+	}
+}
+
+func TestEventIsBinary(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	kinds := make(chan bool, 2)
+	ns.OnEvent("upload", func(ev *Event) { kinds <- ev.IsBinary() && len(ev.Binary()) == 3 })
+	tc := dial(t, s, "/")
+	tc.sendBinary("upload", []byte("abc"))
+	tc.emit("upload", "abc")
+	if !<-kinds {
+		t.Fatal("binary message not reported as binary")
+	}
+	if <-kinds {
+		t.Fatal("text message reported as binary")
+	}
+}
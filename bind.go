@@ -0,0 +1,74 @@
+package sockx
+
+import "encoding/json"
+
+// Bind decodes the message's data into v, a pointer, as encoding/json
+// would. Data that is a json.RawMessage, as events from JSON clients carry
+// it, is decoded directly; other data is converted through JSON. Data
+// that is absent leaves v unchanged.
+func (m Message) Bind(v interface{}) error {
+	return bindData(m.Data, v)
+}
+
+// decodeData decodes msg.Data in place if it is a json.RawMessage, into
+// the types Unmarshal gives it.
+func (m *Message) decodeData() error {
+	raw, ok := m.Data.(json.RawMessage)
+	if !ok {
+		return nil
+	}
+	m.Data = nil
+	return json.Unmarshal(raw, &m.Data)
+}
+
+func bindData(data, v interface{}) error {
+	if data == nil {
+		return nil
+	}
+	raw, ok := data.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Bind decodes the event's data into v, a pointer, as encoding/json would.
+// With JSONCodec the data is decoded straight from the received frame,
+// without going through the generic values Data returns; with other
+// codecs it is converted from the codec's decoding through JSON. Data that
+// is absent or null leaves v unchanged. Like Data, it is only available
+// while the handler runs; see Event.
+func (ev *Event) Bind(v interface{}) error {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.checkReleasedLocked("Bind")
+	if ev.rawData != nil {
+		return json.Unmarshal(ev.rawData, v)
+	}
+	return bindData(ev.msg.Data, v)
+}
+
+// RawData returns the event's data as received if it arrived in a JSON
+// text frame, for example to store or forward it without decoding it, and
+// nil otherwise. Like Data, it is only available while the handler runs;
+// see Event.
+func (ev *Event) RawData() json.RawMessage {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.checkReleasedLocked("RawData")
+	return ev.rawData
+}
+
+// decodeDataLocked decodes the event's raw data, the first time it is
+// needed, into the values Data returns. ev.mu must be held.
+func (ev *Event) decodeDataLocked() {
+	if ev.rawData == nil || ev.decoded {
+		return
+	}
+	ev.decoded = true
+	// The frame was valid JSON when it was read, so this does not fail.
+	json.Unmarshal(ev.rawData, &ev.msg.Data)
+}
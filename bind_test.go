@@ -0,0 +1,100 @@
+package sockx
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type position struct {
+	Player string `json:"player"`
+	X, Y   float64
+	Trail  []struct{ X, Y float64 } `json:"trail"`
+}
+
+const positionFrame = `{"event":"pos","data":{"player":"p1","X":1.5,"Y":-2,"trail":[{"X":1,"Y":1},{"X":1.25,"Y":-1}]}}`
+
+func TestMessageBind(t *testing.T) {
+	var raw Message
+	if err := (JSONCodec{}).unmarshalRaw([]byte(positionFrame), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw.Data.(json.RawMessage); !ok {
+		t.Fatalf("data kept as %T, want json.RawMessage", raw.Data)
+	}
+	var generic Message
+	if err := json.Unmarshal([]byte(positionFrame), &generic); err != nil {
+		t.Fatal(err)
+	}
+	var fromRaw, fromGeneric position
+	if err := raw.Bind(&fromRaw); err != nil {
+		t.Fatal(err)
+	}
+	if err := generic.Bind(&fromGeneric); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromRaw, fromGeneric) || fromRaw.Player != "p1" || len(fromRaw.Trail) != 2 {
+		t.Fatalf("Bind = %+v from raw data and %+v from generic data", fromRaw, fromGeneric)
+	}
+
+	kept := position{Player: "kept"}
+	if err := (Message{Event: "pos"}).Bind(&kept); err != nil || kept.Player != "kept" {
+		t.Fatalf("Bind without data = %+v, %v; want v unchanged", kept, err)
+	}
+}
+
+func TestEventDataCompatibility(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	legacy := make(chan interface{}, 1)
+	raw := make(chan string, 1)
+	ns.On("legacy", func(c *Client, data interface{}) { legacy <- data })
+	ns.OnEvent("raw", func(ev *Event) { raw <- string(ev.RawData()) })
+	tc := dial(t, s, "/")
+
+	tc.emit("legacy", map[string]interface{}{"n": 1, "list": []int{1}})
+	select {
+	case data := <-legacy:
+		want := map[string]interface{}{"n": 1.0, "list": []interface{}{1.0}}
+		if !reflect.DeepEqual(data, want) {
+			t.Fatalf("legacy handler got %#v, want %#v", data, want)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("legacy handler not called")
+	}
+	tc.emit("raw", map[string]int{"n": 1})
+	select {
+	case data := <-raw:
+		if data != `{"n":1}` {
+			t.Fatalf("RawData = %s", data)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("event handler not called")
+	}
+}
+
+// BenchmarkInboundBind compares binding an inbound event's data to a
+// struct when the data is decoded into generic values first, as before,
+// and when it is kept raw until bound.
+func BenchmarkInboundBind(b *testing.B) {
+	frame := []byte(positionFrame)
+	b.Run("generic", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var msg Message
+			json.Unmarshal(frame, &msg)
+			var p position
+			msg.Bind(&p)
+		}
+	})
+	b.Run("raw", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var msg Message
+			(JSONCodec{}).unmarshalRaw(frame, &msg)
+			var p position
+			msg.Bind(&p)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package sockx
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a namespace's circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed is normal operation.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects inbound events and new connections until the
+	// cool-down elapses.
+	BreakerOpen
+	// BreakerHalfOpen admits one probe event at a time; a successful probe
+	// closes the breaker and a failed one opens it again.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig configures a namespace circuit breaker. The breaker opens
+// when Failures handler failures (panics) happen within Window and stays
+// open for Cooldown.
+type BreakerConfig struct {
+	Failures int
+	Window   time.Duration
+	Cooldown time.Duration
+}
+
+// BreakerHook is called on every breaker state transition.
+type BreakerHook func(ns *Namespace, from, to BreakerState)
+
+type breaker struct {
+	mu          sync.Mutex
+	cfg         BreakerConfig
+	state       BreakerState
+	windowStart time.Time
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	trips       int64
+	hooks       []BreakerHook
+}
+
+// SetCircuitBreaker isolates the namespace from its own misbehaving
+// handlers: once handlers fail cfg.Failures times within cfg.Window, the
+// namespace answers inbound events with an ErrCodeUnavailable error and
+// rejects new connections with 503 for cfg.Cooldown, after which it probes
+// with single events until one succeeds. Other namespaces are unaffected.
+// A zero cfg.Failures disables the breaker.
+func (ns *Namespace) SetCircuitBreaker(cfg BreakerConfig) {
+	b := &ns.breaker
+	b.mu.Lock()
+	b.cfg = cfg
+	from := b.state
+	b.state, b.failures, b.probing = BreakerClosed, 0, false
+	hooks := b.hooks
+	b.mu.Unlock()
+	ns.fireBreakerHooks(hooks, from, BreakerClosed)
+}
+
+// OnBreakerStateChange registers h to be called on breaker transitions.
+func (ns *Namespace) OnBreakerStateChange(h BreakerHook) {
+	ns.breaker.mu.Lock()
+	ns.breaker.hooks = append(ns.breaker.hooks, h)
+	ns.breaker.mu.Unlock()
+}
+
+// BreakerState returns the current state of the namespace's breaker.
+func (ns *Namespace) BreakerState() BreakerState {
+	ns.breaker.mu.Lock()
+	defer ns.breaker.mu.Unlock()
+	return ns.breaker.state
+}
+
+func (ns *Namespace) fireBreakerHooks(hooks []BreakerHook, from, to BreakerState) {
+	if from == to {
+		return
+	}
+	for _, h := range hooks {
+		h(ns, from, to)
+	}
+}
+
+// admitEvent reports whether an inbound event may run and whether it is a
+// half-open probe whose outcome decides the breaker state. Rejections come
+// with the remaining cool-down.
+func (ns *Namespace) admitEvent() (ok, probe bool, retry time.Duration) {
+	b := &ns.breaker
+	b.mu.Lock()
+	if b.cfg.Failures <= 0 || b.state == BreakerClosed {
+		b.mu.Unlock()
+		return true, false, 0
+	}
+	now := time.Now()
+	from := b.coolLocked(now)
+	if b.state == BreakerHalfOpen && !b.probing {
+		b.probing = true
+		ok, probe = true, true
+	}
+	retry = b.remainingLocked(now)
+	to, hooks := b.state, b.hooks
+	b.mu.Unlock()
+	ns.fireBreakerHooks(hooks, from, to)
+	return ok, probe, retry
+}
+
+// admitConnection reports whether a new connection may join and, if not,
+// the remaining cool-down.
+func (ns *Namespace) admitConnection() (bool, time.Duration) {
+	b := &ns.breaker
+	b.mu.Lock()
+	now := time.Now()
+	from := b.coolLocked(now)
+	retry := b.remainingLocked(now)
+	to, hooks := b.state, b.hooks
+	b.mu.Unlock()
+	ns.fireBreakerHooks(hooks, from, to)
+	return to != BreakerOpen, retry
+}
+
+func (b *breaker) remainingLocked(now time.Time) time.Duration {
+	if b.state != BreakerOpen {
+		return 0
+	}
+	return b.cfg.Cooldown - now.Sub(b.openedAt)
+}
+
+// coolLocked moves an open breaker to half-open once its cool-down has
+// elapsed. It returns the state before the check.
+func (b *breaker) coolLocked(now time.Time) BreakerState {
+	from := b.state
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.cfg.Cooldown {
+		b.state = BreakerHalfOpen
+	}
+	return from
+}
+
+// releaseProbe ends a half-open probe that ran no handler, leaving the
+// state unchanged.
+func (ns *Namespace) releaseProbe() {
+	ns.breaker.mu.Lock()
+	ns.breaker.probing = false
+	ns.breaker.mu.Unlock()
+}
+
+// recordEvent feeds the outcome of a handler run into the breaker.
+func (ns *Namespace) recordEvent(failed, probe bool) {
+	b := &ns.breaker
+	b.mu.Lock()
+	if b.cfg.Failures <= 0 {
+		b.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	from := b.state
+	switch {
+	case probe:
+		b.probing = false
+		if failed {
+			b.openLocked(now)
+		} else {
+			b.state, b.failures = BreakerClosed, 0
+		}
+	case failed && b.state == BreakerClosed:
+		if now.Sub(b.windowStart) > b.cfg.Window {
+			b.windowStart, b.failures = now, 0
+		}
+		b.failures++
+		if b.failures >= b.cfg.Failures {
+			b.openLocked(now)
+		}
+	}
+	to, hooks := b.state, b.hooks
+	b.mu.Unlock()
+	ns.fireBreakerHooks(hooks, from, to)
+}
+
+func (b *breaker) openLocked(now time.Time) {
+	b.state, b.openedAt, b.failures = BreakerOpen, now, 0
+	b.trips++
+}
@@ -0,0 +1,93 @@
+package sockx
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCircuitBreakerIsolatesFailingNamespace(t *testing.T) {
+	const cooldown = 200 * time.Millisecond
+	s := newTestServer(t)
+	ns := s.Of("/a")
+	ns.SetCircuitBreaker(BreakerConfig{Failures: 2, Window: time.Second, Cooldown: cooldown})
+	var mu sync.Mutex
+	var transitions []string
+	ns.OnBreakerStateChange(func(ns *Namespace, from, to BreakerState) {
+		mu.Lock()
+		transitions = append(transitions, fmt.Sprintf("%s->%s", from, to))
+		mu.Unlock()
+	})
+	handled := make(chan string, 10)
+	for _, n := range []*Namespace{ns, s.Of("/b")} {
+		n.On("boom", func(c *Client, data interface{}) { panic("boom") })
+		n.On("ok", func(c *Client, data interface{}) { handled <- c.Namespace().Name() })
+	}
+	url := serve(t, s, "/a")
+	a, b := dialURL(t, url, nil), dial(t, s, "/b")
+
+	a.emit("boom", nil)
+	a.emit("boom", nil)
+	waitFor(t, "the breaker to open", func() bool { return ns.BreakerState() == BreakerOpen })
+	opened := time.Now()
+	if st := ns.Stats(); st.Breaker != BreakerOpen || st.BreakerTrips != 1 {
+		t.Fatalf("stats = %s with %d trips", st.Breaker, st.BreakerTrips)
+	}
+
+	a.emit("ok", nil)
+	var e ErrorData
+	if err := a.expect(EventError).Bind(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != ErrCodeUnavailable || e.RetryAfterMs <= 0 {
+		t.Fatalf("error = %+v, want %s with a retry delay", e, ErrCodeUnavailable)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("connecting to the open namespace: %v, want 503", err)
+	}
+
+	// The other namespace's handlers fail the same way without effect.
+	b.emit("boom", nil)
+	b.emit("boom", nil)
+	b.emit("ok", nil)
+	if got := <-handled; got != "/b" {
+		t.Fatalf("handled in %s, want /b", got)
+	}
+	if st := s.Of("/b").BreakerState(); st != BreakerClosed {
+		t.Fatalf("breaker of /b = %s", st)
+	}
+
+	// After the cool-down a successful probe closes the breaker.
+	time.Sleep(cooldown - time.Since(opened))
+	a.emit("ok", nil)
+	if got := <-handled; got != "/a" {
+		t.Fatalf("handled in %s, want /a", got)
+	}
+	waitFor(t, "the breaker to close", func() bool { return ns.BreakerState() == BreakerClosed })
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := fmt.Sprint(transitions), "[closed->open open->half-open half-open->closed]"; got != want {
+		t.Fatalf("transitions = %s, want %s", got, want)
+	}
+}
+
+func TestCircuitBreakerReopensOnFailedProbe(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SetCircuitBreaker(BreakerConfig{Failures: 1, Window: time.Second, Cooldown: time.Millisecond})
+	ns.On("boom", func(c *Client, data interface{}) { panic("boom") })
+	tc := dial(t, s, "/")
+
+	tc.emit("boom", nil)
+	waitFor(t, "the breaker to open", func() bool { return ns.BreakerState() == BreakerOpen })
+	time.Sleep(2 * time.Millisecond)
+	tc.emit("boom", nil)
+	waitFor(t, "the failed probe", func() bool { return ns.Stats().BreakerTrips == 2 })
+	if st := ns.BreakerState(); st != BreakerOpen {
+		t.Fatalf("breaker after a failed probe = %s, want open", st)
+	}
+}
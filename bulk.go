@@ -0,0 +1,118 @@
+package sockx
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// bulkParallelism is how many clients a bulk operation acts on at once.
+const bulkParallelism = 16
+
+// BulkResult summarizes a bulk operation such as DisconnectAll.
+type BulkResult struct {
+	// Targeted is the number of clients the operation selected, and Done
+	// the number it was applied to.
+	Targeted int
+	Done     int
+
+	// Failures lists the clients it could not be applied to, for example
+	// because they disconnected or left in the meantime.
+	Failures []BulkFailure
+}
+
+// BulkFailure is a client a bulk operation failed on, by ID.
+type BulkFailure struct {
+	ClientID string
+	Err      error
+}
+
+// DisconnectAll disconnects every client of the namespace with a normal
+// close frame carrying reason; see DisconnectWhere.
+func (ns *Namespace) DisconnectAll(reason string) BulkResult {
+	return ns.DisconnectWhere(func(*Client) bool { return true }, reason)
+}
+
+// DisconnectWhere disconnects the clients of the namespace for which pred
+// returns true with a normal close frame carrying reason. The clients are
+// selected from a snapshot taken first, so clients connecting meanwhile
+// are left alone, and disconnected several at a time with no lock held:
+// it is safe to call from a handler or an admin endpoint while traffic
+// flows. Unlike Client.Disconnect, messages already queued for the
+// clients are written before the close frame, so a broadcast made just
+// before reaches them. The disconnect hooks run with ReasonServerClosed
+// before it returns. Clients that are already gone are reported as
+// failures with ErrClientClosed.
+func (ns *Namespace) DisconnectWhere(pred func(c *Client) bool, reason string) BulkResult {
+	var targets []*Client
+	for _, c := range ns.snapshotClients() {
+		if pred(c) {
+			targets = append(targets, c)
+		}
+	}
+	reason = closeReason(reason)
+	return bulk(targets, func(c *Client) error {
+		if !c.disconnectFor(ReasonServerClosed, websocket.CloseNormalClosure, reason) {
+			return ErrClientClosed
+		}
+		return nil
+	})
+}
+
+// Clear removes every member of the room, as if each had left, reporting
+// reason to the leave hooks; MembershipKicked suits most uses. Like
+// DisconnectWhere it works from a snapshot of the members, several at a
+// time with no lock held. Members that left in the meantime are reported
+// as failures with ErrNotMember.
+func (r *Room) Clear(reason MembershipReason) BulkResult {
+	return bulk(r.snapshot(), func(c *Client) error {
+		return c.leave(r.name, reason)
+	})
+}
+
+// bulk applies fn to clients with bounded parallelism. A panic in fn, or
+// in a hook it runs, fails only the client at hand.
+func bulk(clients []*Client, fn func(c *Client) error) BulkResult {
+	res := BulkResult{Targeted: len(clients)}
+	var (
+		next int64 = -1
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+	)
+	work := func() {
+		defer wg.Done()
+		for {
+			i := atomic.AddInt64(&next, 1)
+			if i >= int64(len(clients)) {
+				return
+			}
+			c := clients[i]
+			err := applySafely(fn, c)
+			mu.Lock()
+			if err != nil {
+				res.Failures = append(res.Failures, BulkFailure{ClientID: c.id, Err: err})
+			} else {
+				res.Done++
+			}
+			mu.Unlock()
+		}
+	}
+	n := min(len(clients), bulkParallelism)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go work()
+	}
+	wg.Wait()
+	return res
+}
+
+func applySafely(fn func(c *Client) error, c *Client) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("sockx: panic: %v", p)
+		}
+	}()
+	return fn(c)
+}
@@ -0,0 +1,86 @@
+package sockx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDisconnectWhereWritesQueuedMessagesFirst(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	conns := []*testConn{dial(t, s, "/"), dial(t, s, "/"), dial(t, s, "/")}
+	ns.Client(conns[0].welcome.ID).Authenticate("spammer", nil)
+	ns.Client(conns[1].welcome.ID).Authenticate("spammer", nil)
+	gone := ns.Client(conns[1].welcome.ID)
+
+	ns.Emit("notice", "maintenance")
+	res := ns.DisconnectWhere(func(c *Client) bool {
+		if c == gone {
+			c.Disconnect(websocket.CloseNormalClosure, "")
+		}
+		return c.UserID() == "spammer"
+	}, "banned")
+	if res.Targeted != 2 || res.Done != 1 || len(res.Failures) != 1 {
+		t.Fatalf("result = %+v, want 2 targeted, 1 done", res)
+	}
+	if f := res.Failures[0]; f.ClientID != gone.ID() || f.Err != ErrClientClosed {
+		t.Fatalf("failure = %+v, want %s with %v", f, gone.ID(), ErrClientClosed)
+	}
+
+	ce, notices := expectClose(t, conns[0], "notice")
+	if ce.Code != websocket.CloseNormalClosure || ce.Text != "banned" || notices != 1 {
+		t.Fatalf("closed with %d %q after %d notices", ce.Code, ce.Text, notices)
+	}
+	if ns.Client(conns[2].welcome.ID) == nil {
+		t.Fatal("unselected client disconnected")
+	}
+	conns[2].expect("notice")
+
+	if res := ns.DisconnectAll("bye"); res.Targeted != 1 || res.Done != 1 {
+		t.Fatalf("DisconnectAll = %+v", res)
+	}
+	if n := ns.Stats().Clients; n != 0 {
+		t.Fatalf("%d clients left", n)
+	}
+}
+
+func TestRoomClearIsolatesFailures(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var ids []string
+	for i := 0; i < 20; i++ {
+		tc := dial(t, s, "/")
+		ns.Client(tc.welcome.ID).Join("r")
+		ids = append(ids, tc.welcome.ID)
+	}
+	var mu sync.Mutex
+	var left []string
+	ns.OnLeave(func(c *Client, room string, reason MembershipReason) {
+		if c.ID() == ids[0] {
+			panic("hook failed")
+		}
+		mu.Lock()
+		left = append(left, fmt.Sprint(room, " ", reason))
+		mu.Unlock()
+	})
+
+	res := ns.Room("r").Clear(MembershipKicked)
+	if res.Targeted != 20 || res.Done != 19 || len(res.Failures) != 1 {
+		t.Fatalf("result = %+v, want 20 targeted, 19 done", res)
+	}
+	if f := res.Failures[0]; f.ClientID != ids[0] || !strings.Contains(f.Err.Error(), "hook failed") {
+		t.Fatalf("failure = %+v", f)
+	}
+	sort.Strings(left)
+	if len(left) != 19 || left[0] != "r "+MembershipKicked.String() {
+		t.Fatalf("leave hooks saw %v", left)
+	}
+	if ns.Room("r") != nil {
+		t.Fatal("room not emptied")
+	}
+}
@@ -0,0 +1,37 @@
+package sockx
+
+// AnyHandler receives an event of any name, with its data as On handlers
+// get it.
+type AnyHandler func(c *Client, event string, data interface{})
+
+// OnAny registers h to be called for every event clients send to the
+// namespace, such as for an audit log, before and in addition to the
+// event's own handler. Events refused before dispatch, for instance by
+// rate limits, do not reach it. h runs on the event's dispatch goroutine,
+// so it should be quick; a panic in h is logged and does not keep the
+// event from its handler.
+func (ns *Namespace) OnAny(h AnyHandler) {
+	ns.updateHandlers(func(t *handlerTable) { t.any = appendTo(t.any, h) })
+}
+
+// OnUnhandled registers h to be called for events that have no handler,
+// which are otherwise dropped, or buffered if BufferUnhandled is enabled.
+// A panic in h is logged.
+func (ns *Namespace) OnUnhandled(h AnyHandler) {
+	ns.updateHandlers(func(t *handlerTable) { t.unhandled = appendTo(t.unhandled, h) })
+}
+
+// callAny calls the hooks in handlers for ev, recovering from their
+// panics.
+func (ns *Namespace) callAny(handlers []AnyHandler, ev *Event) {
+	for _, h := range handlers {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					ns.server.logf("catch-all handler for %q in %s panicked: %v", ev.msg.Event, ns.name, p)
+				}
+			}()
+			h(ev.client, ev.msg.Event, ev.legacyData())
+		}()
+	}
+}
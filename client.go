@@ -0,0 +1,577 @@
+package sockx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/text/language"
+)
+
+// clientSeq numbers clients in connection order.
+var clientSeq uint64
+
+// Client is a single WebSocket connection attached to a namespace.
+type Client struct {
+	id     string
+	seq    uint64
+	conn   *websocket.Conn
+	server *Server
+	ns     atomic.Pointer[Namespace]
+	queue  *sendQueue
+	codec  Codec
+
+	mu     sync.RWMutex
+	rooms  map[string]bool
+	userID string
+	claims map[string]interface{}
+	locale language.Tag
+
+	// features are the protocol extensions negotiated with the client.
+	features map[Feature]bool
+
+	// acks routes EventAck replies to the emits waiting for them.
+	acks       map[uint64]chan<- ackReply
+	acksClosed bool
+
+	// ackBatch holds the acknowledgements waiting to be sent together;
+	// see FeatureAckBatch.
+	ackBatch ackBatch
+
+	// handlers are the client's own one-shot handlers, consulted before
+	// the namespace's; see Client.Once.
+	handlers map[string]*Subscription
+
+	realIP      string
+	resumeToken string
+	closeErr    error
+	labels      map[string]string
+
+	// values holds the application's per-connection data; see Client.Set.
+	values map[string]interface{}
+
+	// ctx is the client's context; cancels cancel it and those it
+	// replaced once the client disconnects, setting ctxDone.
+	ctx     context.Context
+	cancels []context.CancelFunc
+	ctxDone bool
+
+	// readLimit is the size of the largest message the client may send,
+	// or zero for no limit; see Config.MaxMessageSize.
+	readLimit int64
+
+	// admitting is set while connection middleware runs.
+	admitting atomic.Bool
+
+	// departing is set once teardown starts, so that nothing more is
+	// queued for the client, even by its own disconnect hooks.
+	departing atomic.Bool
+
+	// request is the handshake request of the connection. A client added
+	// to another namespace with EventConnect has the connection's client
+	// as parent and shares its connection and send queue; mux holds those
+	// clients, until muxClosed when the connection ends.
+	request   *http.Request
+	parent    *Client
+	mux       map[*Client]bool
+	muxClosed bool
+
+	// guestWarning and guestExpiry are the client's guest session
+	// deadlines, until the session ends at guestUntil; see GuestTTL.
+	guestWarning, guestExpiry *deadline
+	guestUntil                time.Time
+
+	// writeStart is the UnixNano time the write in progress started, or
+	// zero between writes. The watchdog reads it.
+	writeStart int64
+
+	dispatchMu sync.Mutex
+	inFlight   int
+	pending    []*Event
+
+	closeOnce sync.Once
+}
+
+// newClient returns a client of ns on conn that sends through queue, or
+// through a send queue of its own if queue is nil.
+func newClient(ns *Namespace, conn *websocket.Conn, queue *sendQueue) *Client {
+	if queue == nil {
+		queue = newSendQueue(ns.server.cfg().SendQueueSize, ns.server.cfg().FairQueuing)
+	}
+	c := &Client{
+		seq:    atomic.AddUint64(&clientSeq, 1),
+		conn:   conn,
+		server: ns.server,
+		queue:  queue,
+		rooms:  make(map[string]bool),
+		codec:  ns.Codec(),
+	}
+	c.WithContext(context.Background())
+	c.id = ns.server.claimID(c)
+	c.ns.Store(ns)
+	return c
+}
+
+// ID returns the client's unique identifier.
+func (c *Client) ID() string { return c.id }
+
+// Namespace returns the namespace the client is attached to. It changes if
+// a room the client is in is migrated with MigrateRoom.
+func (c *Client) Namespace() *Namespace {
+	ns := c.ns.Load()
+	if ns == nil {
+		panic("sockx: Client was not created by the server; use NewDetachedClient to create clients without a connection")
+	}
+	return ns
+}
+
+// Emit sends event to this client only.
+func (c *Client) Emit(event string, data interface{}, opts ...EmitOption) error {
+	o := buildEmitOptions(opts)
+	p, err := c.Namespace().encode(Message{Event: event, Data: data}, o)
+	if err != nil {
+		return err
+	}
+	return c.send(p.frame(c), o.critical)
+}
+
+// Broadcast sends event to every other client in the client's namespace.
+func (c *Client) Broadcast(event string, data interface{}) (EmitResult, error) {
+	return c.Namespace().EmitExcept(event, data, c)
+}
+
+// BroadcastToRoom sends event to every other client in room. The client
+// need not be in the room.
+func (c *Client) BroadcastToRoom(room, event string, data interface{}) (EmitResult, error) {
+	ns := c.Namespace()
+	return ns.emit(Message{Event: event, Room: room, Data: data}, ns.roomClients(room), emitOptions{exclude: []*Client{c}})
+}
+
+// send queues a frame for this client alone and accounts for its bytes.
+func (c *Client) send(m *outbound, control bool) error {
+	if err := c.enqueue(m, control); err != nil {
+		return err
+	}
+	c.Namespace().bytes.add("", int64(len(m.data)))
+	return nil
+}
+
+// Join adds the client to room, creating the room if needed. It returns the
+// room guard's error if the namespace's guard rejects the client, and
+// ErrAlreadyJoined without firing any hooks if the client is already in
+// the room, unless the namespace has AllowDuplicateJoins set,
+// ErrTooManyRooms if the client is in Config.MaxRoomsPerClient rooms, and
+// ErrRoomArchiving while a previous room of the name is being archived.
+func (c *Client) Join(room string) error {
+	ns := c.Namespace()
+	if c.InRoom(room) {
+		return ns.duplicateJoin()
+	}
+	if err := ns.checkRoomGuard(c, room); err != nil {
+		return err
+	}
+	if ok, _ := c.allow(RateKindJoins, c.server.cfg().RateLimits.Joins, 1); !ok {
+		return ErrRateLimited
+	}
+	c.mu.Lock()
+	if c.rooms[room] {
+		// A concurrent Join got there first.
+		c.mu.Unlock()
+		return ns.duplicateJoin()
+	}
+	if max := c.server.cfg().MaxRoomsPerClient; max > 0 && len(c.rooms) >= max {
+		c.mu.Unlock()
+		return ErrTooManyRooms
+	}
+	c.rooms[room] = true
+	c.mu.Unlock()
+	if err := ns.joinRoom(room, c); err != nil {
+		c.mu.Lock()
+		delete(c.rooms, room)
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Leave removes the client from room. It returns ErrNotMember, without
+// firing any hooks, if the client is not in the room.
+func (c *Client) Leave(room string) error {
+	return c.leave(room, MembershipRequested)
+}
+
+func (c *Client) leave(room string, reason MembershipReason) error {
+	c.mu.Lock()
+	if !c.rooms[room] {
+		c.mu.Unlock()
+		return ErrNotMember
+	}
+	delete(c.rooms, room)
+	c.mu.Unlock()
+	c.Namespace().leaveRoom(room, c, reason)
+	return nil
+}
+
+// LeaveAll removes the client from every room it is in and returns their
+// names, sorted. The client's rooms are taken in one step, so each is left
+// exactly once even if Leave or LeaveAll is called concurrently; the leave
+// hooks fire for each room as with Leave.
+func (c *Client) LeaveAll() []string {
+	return c.leaveAll(MembershipRequested)
+}
+
+func (c *Client) leaveAll(reason MembershipReason) []string {
+	c.mu.Lock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	c.rooms = make(map[string]bool)
+	c.mu.Unlock()
+	sort.Strings(rooms)
+	c.Namespace().leaveRooms(rooms, c, reason)
+	return rooms
+}
+
+// Rooms returns the names of the rooms the client is in, sorted. The slice
+// is a copy the caller may keep.
+func (c *Client) Rooms() []string {
+	c.mu.RLock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	c.mu.RUnlock()
+	sort.Strings(rooms)
+	return rooms
+}
+
+// RoomCount returns the number of rooms the client is in.
+func (c *Client) RoomCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.rooms)
+}
+
+// InRoom reports whether the client is in room.
+func (c *Client) InRoom(room string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rooms[room]
+}
+
+// enqueue queues an encoded frame. When the normal lane overflows the client
+// is told once, over the control lane, that messages are being dropped.
+func (c *Client) enqueue(m *outbound, control bool) error {
+	if c.departing.Load() {
+		return ErrClientClosed
+	}
+	if m == nil {
+		return errRecode
+	}
+	firstOverflow, err := c.queue.push(m, control)
+	if firstOverflow {
+		c.notifyOverflow()
+	}
+	return err
+}
+
+// notifyOverflow tells the client that its send queue started dropping
+// messages.
+func (c *Client) notifyOverflow() {
+	c.sendControl(EventError, ErrorData{
+		Code:    ErrCodeQueueFull,
+		Message: "send queue full, messages are being dropped",
+	})
+}
+
+// sendControl queues a protocol message on the control lane.
+func (c *Client) sendControl(event string, data interface{}) {
+	m, err := c.encode(Message{Event: event, Namespace: c.muxNamespace(), Data: data})
+	if err != nil {
+		return
+	}
+	c.queue.push(m, true)
+}
+
+func (c *Client) readPump() {
+	var readErr error
+	defer func() { c.close(readErr) }()
+	c.conn.SetPongHandler(func(string) error {
+		c.extendReadDeadline()
+		return nil
+	})
+	for first := true; ; first = false {
+		c.extendReadDeadline()
+		c.refreshReadLimit()
+		msgType, frame, err := c.readFrame()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				c.teardown(ReasonPingTimeout, nil, err)
+			} else if errors.Is(err, ErrMessageTooLarge) {
+				c.teardown(ReasonMessageTooLarge, nil, err)
+			}
+			readErr = err
+			return
+		}
+		receivedAt := time.Now()
+		var msg Message
+		err = c.unmarshal(frame.Bytes(), msgType, &msg)
+		c.traceInbound(msg, frame.Len(), err)
+		if err != nil {
+			putFrame(frame)
+			c.sendControl(EventError, ErrorData{Code: ErrCodeBadMessage, Message: err.Error()})
+			continue
+		}
+		target := c.consume(msg, first, frame.Len())
+		if target == nil {
+			putFrame(frame)
+			continue
+		}
+		target.dispatch(newEvent(target, msg, frame, receivedAt))
+	}
+}
+
+// unmarshal decodes an inbound frame into msg in the client's codec. With
+// JSONCodec the data of an event is left as a json.RawMessage, to be
+// decoded only when its handler asks for it, and then into the handler's
+// own type if it uses Bind. The data of protocol messages is decoded up
+// front, except that of EventAcks, whose entries are bound as they are
+// resolved.
+func (c *Client) unmarshal(frame []byte, msgType int, msg *Message) error {
+	j, ok := c.codec.(JSONCodec)
+	if !ok || msgType == websocket.BinaryMessage {
+		return c.codec.Unmarshal(frame, msgType, msg)
+	}
+	if err := j.unmarshalRaw(frame, msg); err != nil {
+		return err
+	}
+	if strings.HasPrefix(msg.Event, reservedPrefix) && msg.Event != EventAcks {
+		return msg.decodeData()
+	}
+	return nil
+}
+
+// consume handles msg, a frame of size bytes, if it is protocol traffic,
+// rejected by the rate limits or addressed to a namespace the connection
+// is not in, and then returns nil. Other messages are events for
+// handlers, and consume returns the client of the namespace they are for.
+func (c *Client) consume(msg Message, first bool, size int) *Client {
+	switch msg.Event {
+	case EventConnect, EventDisconnect:
+		c.handleMux(msg)
+		return nil
+	}
+	target := c.route(msg)
+	if target == nil {
+		c.sendControl(EventError, ErrorData{
+			Code:    ErrCodeBadMessage,
+			Message: "not connected to namespace " + msg.Namespace + ", event " + msg.Event + " dropped",
+		})
+		return nil
+	}
+	switch msg.Event {
+	case EventHello:
+		err := errHelloNotFirst
+		if first {
+			err = c.handleHello(msg)
+		}
+		if err != nil {
+			c.sendControl(EventError, ErrorData{Code: ErrCodeBadMessage, Message: err.Error()})
+		}
+		return nil
+	case EventAck:
+		target.resolveAck(msg.Ack, msg.Data)
+		return nil
+	case EventAcks:
+		target.resolveAcks(msg)
+		return nil
+	}
+	if c.server.cfg().RateLimits.enabled() {
+		if ok, retry := c.allowInbound(msg, size); !ok {
+			target.reject(ErrCodeRateLimited, "rate limit exceeded, event "+msg.Event+" dropped", retry)
+			return nil
+		}
+	}
+	switch msg.Event {
+	case EventSeen:
+		target.handleSeen(msg)
+		return nil
+	case EventDirectorySubscribe, EventDirectoryUnsubscribe:
+		target.handleDirectory(msg)
+		return nil
+	}
+	return target
+}
+
+// extendReadDeadline gives the client PongWait to send its next message
+// or pong, or all the time it needs if the heartbeat is disabled.
+func (c *Client) extendReadDeadline() {
+	cfg := c.server.cfg()
+	if cfg.PingInterval < 0 {
+		c.conn.SetReadDeadline(time.Time{})
+		return
+	}
+	c.conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+}
+
+func (c *Client) writePump() {
+	defer c.server.untrackConn(c)
+	defer c.conn.Close()
+	var ticker *time.Ticker
+	var interval time.Duration
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	for {
+		// Pick up a PingInterval changed with UpdateConfig.
+		if d := c.server.cfg().PingInterval; d != interval {
+			interval = d
+			switch {
+			case d <= 0 && ticker != nil:
+				ticker.Stop()
+				ticker = nil
+			case d > 0 && ticker == nil:
+				ticker = time.NewTicker(d)
+			case d > 0:
+				ticker.Reset(d)
+			}
+		}
+		var ping <-chan time.Time
+		if ticker != nil {
+			ping = ticker.C
+		}
+		select {
+		case <-c.queue.notify:
+			if !c.drainQueue() {
+				return
+			}
+		case <-ping:
+			deadline := time.Now().Add(c.server.cfg().WriteTimeout)
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.close(err)
+				return
+			}
+		}
+	}
+}
+
+// drainQueue writes the queued frames until the queue is empty. It
+// reports false once the connection is done with, after a failed write,
+// the close frame or the end of a closed queue.
+func (c *Client) drainQueue() bool {
+	for {
+		m, closed := c.queue.pop()
+		if m == nil {
+			return !closed
+		}
+		msgType := m.msgType
+		if msgType == 0 {
+			msgType = websocket.TextMessage
+		}
+		cfg := c.server.cfg()
+		// Without negotiated compression this has no effect.
+		c.conn.EnableWriteCompression(len(m.data) >= cfg.CompressionThreshold)
+		now := time.Now()
+		atomic.StoreInt64(&c.writeStart, now.UnixNano())
+		c.conn.SetWriteDeadline(now.Add(cfg.WriteTimeout))
+		err := c.conn.WriteMessage(msgType, m.data)
+		atomic.StoreInt64(&c.writeStart, 0)
+		if err != nil {
+			c.close(err)
+			return false
+		}
+		c.queue.note(TraceWrite, m, 1, "")
+		if msgType == websocket.CloseMessage {
+			return false
+		}
+	}
+}
+
+// close detaches the client after the connection failed with err or the
+// peer went away. It is safe to call more than once.
+func (c *Client) close(err error) {
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		err = nil
+	}
+	c.teardown(ReasonTransportClosed, nil, err)
+}
+
+// CloseError returns the error that ended a client's connection when the
+// transport failed, or nil if it is still connected, the peer closed it
+// cleanly or the server closed it. It is meant for disconnect hooks.
+func (c *Client) CloseError() error { return c.closeErr }
+
+// disconnect detaches the client and sends a close frame with the given
+// code and reason once already queued messages have been written.
+func (c *Client) disconnect(code int, reason string) {
+	c.disconnectFor(ReasonServerClosed, code, reason)
+}
+
+// disconnectFor is disconnect reporting why with why. It reports false if
+// the client was already disconnected.
+func (c *Client) disconnectFor(why DisconnectReason, code int, reason string) bool {
+	return c.teardown(why, &outbound{
+		msgType: websocket.CloseMessage,
+		data:    websocket.FormatCloseMessage(code, reason),
+	}, nil)
+}
+
+// teardown removes the client from its rooms and namespace, closes its send
+// queue and reports the disconnect with reason and the transport error
+// err, if any; writePump closes the connection after writing final. Only
+// the first call has any effect, and it alone reports true.
+func (c *Client) teardown(reason DisconnectReason, final *outbound, err error) (first bool) {
+	c.closeOnce.Do(func() {
+		first = true
+		c.closeErr = err
+		c.departing.Store(true)
+		// Leave the namespace first so that concurrent Joins fail instead
+		// of adding the client to rooms after the snapshot below. A
+		// concurrent MigrateRoom may move the client before it is removed,
+		// in which case it is removed from the new namespace.
+		ns := c.Namespace()
+		for {
+			ns.removeClient(c)
+			if next := c.Namespace(); next != ns {
+				ns = next
+				continue
+			}
+			break
+		}
+
+		rooms := c.leaveAll(MembershipDisconnected)
+		saved := reason != ReasonServerClosed && ns.saveSession(c, rooms)
+		ns.releaseDedup(c, saved)
+		c.server.releaseID(c)
+		c.dropPending()
+		c.failAcks(ErrClientClosed)
+		c.server.stopGuestClock(c)
+		for _, sub := range c.takeMux() {
+			sub.teardown(reason, nil, err)
+		}
+		// Answers already given go out before the connection closes.
+		c.flushAcks()
+		if c.parent != nil {
+			c.parent.detachMux(c, final)
+		} else {
+			c.queue.close(final)
+		}
+		ns.fire(LifecycleEvent{Kind: LifecycleDisconnect, Client: c, DisconnectReason: reason, Err: err})
+		c.cancelContext()
+		if c.parent == nil && c.tracer() != nil {
+			c.server.stopTrace(c)
+		}
+	})
+	return first
+}
@@ -0,0 +1,830 @@
+// Package client connects Go programs to a sockx server. It speaks the
+// same Message envelope as the server, so events, rooms and
+// acknowledgements work as they do for any other client.
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// defaultTimeout bounds the handshake and requests awaiting an ack.
+	defaultTimeout = 10 * time.Second
+
+	// sendQueueSize is the capacity of a connection's outbound queue.
+	sendQueueSize = 256
+
+	// ackBatchWindow and maxAckBatch bound acknowledgement batches, as
+	// the server does; see sockx.FeatureAckBatch.
+	ackBatchWindow = 5 * time.Millisecond
+	maxAckBatch    = 50
+)
+
+var (
+	// ErrClosed is returned when using a connection that has been closed.
+	ErrClosed = errors.New("sockx/client: connection closed")
+
+	// ErrTimeout is returned when the server does not answer in time.
+	ErrTimeout = errors.New("sockx/client: timed out")
+)
+
+// ServerError is an EventError sent by the server, or the error of a
+// refused Join.
+type ServerError struct {
+	sockx.ErrorData
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("sockx/client: server error %s: %s", e.Code, e.Message)
+}
+
+// Handler handles an event received from the server.
+type Handler func(data interface{})
+
+// AckHandler handles an event received from the server and returns the
+// answer to send back when the server asked for an acknowledgement.
+type AckHandler func(data interface{}) interface{}
+
+// ErrorHandler receives the connection's errors: the ServerErrors sent by
+// the server, and the read or write error that ended the connection.
+type ErrorHandler func(err error)
+
+// Option configures Dial.
+type Option func(*config)
+
+type config struct {
+	dialer      *websocket.Dialer
+	header      http.Header
+	timeout     time.Duration
+	codec       sockx.Codec
+	ackBatching bool
+	reconnect   *sockx.BackoffPolicy
+}
+
+// WithDialer dials with d instead of websocket.DefaultDialer.
+func WithDialer(d *websocket.Dialer) Option {
+	return func(c *config) { c.dialer = d }
+}
+
+// WithHeader sends h with the handshake request, for example to
+// authenticate.
+func WithHeader(h http.Header) Option {
+	return func(c *config) { c.header = h }
+}
+
+// WithCodec speaks codec with the server, which must use the same one for
+// the namespace dialed. Defaults to sockx.JSONCodec.
+func WithCodec(codec sockx.Codec) Option {
+	return func(c *config) { c.codec = codec }
+}
+
+// WithAckBatching negotiates sockx.FeatureAckBatch with the server, so
+// that during bursts, such as sync loops, the acknowledgements sent each
+// way are coalesced into sockx.EventAcks frames instead of one frame each.
+// An acknowledgement then waits up to 5ms for others to join it; handlers
+// registered with OnWithAckNow are still answered right away. Batching
+// only happens with sockx.JSONCodec and servers that enable the feature.
+func WithAckBatching() Option {
+	return func(c *config) { c.ackBatching = true }
+}
+
+// WithReconnect makes the connection redial when it is lost, until Close,
+// waiting as policy advises before each attempt: policy.Delay(n) before
+// the n-th attempt in a row. A zero policy uses sockx.DefaultBackoffPolicy.
+// The wait is stretched to honor the server's advice, the Retry-After
+// header of a refused handshake and the RetryAfterMs of the latest
+// EventError. A close from the server with a normal closure ends the
+// connection for good.
+//
+// Handlers stay registered and queued emits are sent over the new
+// connection, which gets a new ID; OnReconnect hooks run once it is up.
+// Requests awaiting an answer when the connection was lost are not
+// answered and time out.
+//
+// If the namespace lets sessions resume (see Namespace.EnableResume), the
+// new connection resumes the lost one's: it sends the resume token of the
+// welcome and the sequence number of the last message received from each
+// room, and the server rejoins the rooms and replays what was missed, in
+// order, before sockx.EventResumeComplete and any live message. Handlers
+// registered for sockx.EventResumeComplete receive its sockx.ResumeData.
+func WithReconnect(policy sockx.BackoffPolicy) Option {
+	return func(c *config) {
+		if policy == (sockx.BackoffPolicy{}) {
+			policy = sockx.DefaultBackoffPolicy
+		}
+		c.reconnect = &policy
+	}
+}
+
+// WithTimeout bounds the wait for the server's welcome after dialing and
+// the wait for answers to Join. Defaults to 10s.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) { c.timeout = d }
+}
+
+// Conn is a connection to a namespace of a sockx server. Its methods are
+// safe for concurrent use. Handlers run one at a time, in the order the
+// events arrive, on a goroutine of the connection's own, so a slow handler
+// delays the events behind it but not acknowledgements: handlers may call
+// Join and EmitWithAck and wait for the answer.
+type Conn struct {
+	url     string
+	cfg     config
+	timeout time.Duration
+	codec   sockx.Codec
+	send    chan frame
+
+	mu          sync.Mutex
+	ws          *websocket.Conn // nil while reconnecting
+	lost        chan struct{}   // closed when ws is lost
+	id          string
+	node        string
+	batchAcks   bool
+	handlers    map[string]handler
+	onError     []ErrorHandler
+	onReconnect []func()
+	ackSeq      uint64
+	acks        map[uint64]chan interface{}
+	err         error
+
+	// resumeToken and cursors, the last sequence number received from
+	// each room, resume the session when reconnecting; resumed reports
+	// whether the current connection did.
+	resumeToken string
+	cursors     map[string]uint64
+	resumed     bool
+
+	// retryAt is when the server last advised retrying, with the
+	// RetryAfterMs of an EventError.
+	retryAt time.Time
+
+	// ackBatch holds the acknowledgements waiting to be sent together,
+	// until ackTimer sends them.
+	ackBatch []sockx.AckBatchEntry
+	ackTimer *time.Timer
+
+	// events holds the events read and not yet handled; dispatchPump is
+	// told of new ones on eventsReady.
+	events      []sockx.Message
+	eventsReady chan struct{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Dial connects to the sockx endpoint at url, a ws:// or wss:// URL
+// served by Server.ServeWebSocket, and waits for the server's welcome.
+func Dial(url string, opts ...Option) (*Conn, error) {
+	cfg := config{dialer: websocket.DefaultDialer, timeout: defaultTimeout, codec: sockx.JSONCodec{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.ackBatching {
+		var err error
+		if url, err = withFeature(url, sockx.FeatureAckBatch); err != nil {
+			return nil, err
+		}
+	}
+	c := &Conn{
+		url:      url,
+		cfg:      cfg,
+		timeout:  cfg.timeout,
+		codec:    cfg.codec,
+		send:     make(chan frame, sendQueueSize),
+		handlers: make(map[string]handler),
+		acks:     make(map[uint64]chan interface{}),
+		done:     make(chan struct{}),
+
+		eventsReady: make(chan struct{}, 1),
+	}
+	ws, _, err := c.handshake(url)
+	if err != nil {
+		return nil, err
+	}
+	go c.readPump(ws)
+	go c.dispatchPump()
+	return c, nil
+}
+
+// handshake dials url and reads the server's welcome. On success the new
+// connection becomes c's current one and its write pump is started. The
+// response is that of a refused handshake.
+func (c *Conn) handshake(url string) (*websocket.Conn, *http.Response, error) {
+	ws, resp, err := c.cfg.dialer.Dial(url, c.cfg.header)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	ws.SetReadDeadline(time.Now().Add(c.timeout))
+	var msg sockx.Message
+	var welcome sockx.WelcomeData
+	msgType, data, err := ws.ReadMessage()
+	if err == nil {
+		err = c.codec.Unmarshal(data, msgType, &msg)
+	}
+	if err == nil && msg.Event != sockx.EventWelcome {
+		err = fmt.Errorf("sockx/client: expected %s, got %q", sockx.EventWelcome, msg.Event)
+	}
+	if err == nil {
+		err = convert(msg.Data, &welcome)
+	}
+	if err != nil {
+		ws.Close()
+		return nil, nil, err
+	}
+	ws.SetReadDeadline(time.Time{})
+
+	batchAcks := false
+	if _, ok := c.codec.(sockx.JSONCodec); ok && c.cfg.ackBatching {
+		for _, f := range welcome.Enabled {
+			batchAcks = batchAcks || f == sockx.FeatureAckBatch
+		}
+	}
+	lost := make(chan struct{})
+	c.mu.Lock()
+	c.ws, c.lost = ws, lost
+	c.id, c.node, c.batchAcks = welcome.ID, welcome.Node, batchAcks
+	c.resumeToken, c.resumed = welcome.ResumeToken, welcome.Resumed
+	if !welcome.Resumed {
+		c.cursors = make(map[string]uint64)
+	}
+	c.mu.Unlock()
+	go c.writePump(ws, lost)
+	return ws, nil, nil
+}
+
+// resumeURL returns the URL to reconnect to, asking to resume the session
+// if the server gave it a resume token.
+func (c *Conn) resumeURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumeToken == "" {
+		return c.url
+	}
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return c.url
+	}
+	q := u.Query()
+	q.Set(sockx.ResumeTokenParam, c.resumeToken)
+	for room, seq := range c.cursors {
+		q.Add(sockx.ResumeCursorParam, strconv.FormatUint(seq, 10)+":"+room)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// withFeature adds f to the features rawURL declares to the server.
+func withFeature(rawURL string, f sockx.Feature) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	features := q.Get(sockx.FeaturesQueryParam)
+	if features != "" {
+		features += ","
+	}
+	q.Set(sockx.FeaturesQueryParam, features+string(f))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// ID returns the client ID the server assigned to the connection. It
+// changes when the connection is re-established; see WithReconnect.
+func (c *Conn) ID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id
+}
+
+// Resumed reports whether the connection resumed the session of the one
+// it replaced; see WithReconnect.
+func (c *Conn) Resumed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed
+}
+
+// Node returns the NodeID of the server the connection landed on.
+func (c *Conn) Node() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.node
+}
+
+// On registers h for event, replacing any previous handler.
+func (c *Conn) On(event string, h Handler) {
+	c.OnWithAck(event, func(data interface{}) interface{} {
+		h(data)
+		return nil
+	})
+}
+
+// OnWithAck registers h for event, replacing any previous handler. When
+// the server sent the event with an Ack ID, h's result is sent back as the
+// acknowledgement.
+func (c *Conn) OnWithAck(event string, h AckHandler) {
+	c.mu.Lock()
+	c.handlers[event] = handler{fn: h}
+	c.mu.Unlock()
+}
+
+// OnWithAckNow registers h for event like OnWithAck, but sends h's answers
+// right away rather than batching them, for requests the server waits on
+// to proceed; see WithAckBatching.
+func (c *Conn) OnWithAckNow(event string, h AckHandler) {
+	c.mu.Lock()
+	c.handlers[event] = handler{fn: h, now: true}
+	c.mu.Unlock()
+}
+
+// handler is a registered AckHandler, and whether its answers skip the
+// acknowledgement batch.
+type handler struct {
+	fn  AckHandler
+	now bool
+}
+
+// OnError registers h to be called with the connection's errors.
+func (c *Conn) OnError(h ErrorHandler) {
+	c.mu.Lock()
+	c.onError = append(c.onError, h)
+	c.mu.Unlock()
+}
+
+// OnReconnect registers h to be called each time the connection has been
+// re-established; see WithReconnect. Events arriving over the new
+// connection are handled after the hooks return.
+func (c *Conn) OnReconnect(h func()) {
+	c.mu.Lock()
+	c.onReconnect = append(c.onReconnect, h)
+	c.mu.Unlock()
+}
+
+// Emit sends event with data to the server. It blocks while the outbound
+// queue is full and returns ErrClosed once the connection is closed.
+func (c *Conn) Emit(event string, data interface{}) error {
+	return c.write(sockx.Message{Event: event, Data: data})
+}
+
+// EmitWithAck sends event with data and an Ack ID and waits for the
+// server's acknowledgement, returning its data. It returns ErrTimeout if
+// none arrives within timeout; a zero timeout waits until the connection
+// closes.
+func (c *Conn) EmitWithAck(event string, data interface{}, timeout time.Duration) (interface{}, error) {
+	return c.request(sockx.Message{Event: event, Data: data}, timeout)
+}
+
+// Join asks the server to add the connection to room and returns the
+// room's snapshot. The namespace must have client joins enabled with
+// EnableClientJoins. A refused join returns a *ServerError.
+func (c *Conn) Join(room string) (sockx.JoinResult, error) {
+	var res sockx.JoinResult
+	data, err := c.request(sockx.Message{Event: sockx.EventJoin, Data: room}, c.timeout)
+	if err != nil {
+		return res, err
+	}
+	if err := convert(data, &res); err != nil {
+		return res, err
+	}
+	if res.Error != nil {
+		return res, &ServerError{*res.Error}
+	}
+	return res, nil
+}
+
+// Close writes the messages already queued, including the
+// acknowledgements waiting to be batched, and closes the connection with a
+// normal closure; it gives up on the queued messages after the timeout.
+// Pending EmitWithAck and Join calls fail with ErrClosed.
+func (c *Conn) Close() error {
+	c.flushAcks()
+	c.mu.Lock()
+	connected := c.ws != nil
+	c.mu.Unlock()
+	if !connected {
+		// Reconnecting: there is nothing to write to.
+		c.shutdown(nil)
+		return nil
+	}
+	closing := frame{websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")}
+	t := time.NewTimer(c.timeout)
+	defer t.Stop()
+	select {
+	case c.send <- closing:
+		select {
+		case <-c.done:
+		case <-t.C:
+		}
+	case <-c.done:
+	case <-t.C:
+	}
+	c.shutdown(nil)
+	return nil
+}
+
+// Done is closed once the connection is closed.
+func (c *Conn) Done() <-chan struct{} { return c.done }
+
+// Err returns the error that ended the connection, or nil while it is
+// open or if it was closed with Close or a clean close from the server.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// request sends msg with a new Ack ID and waits for the answer.
+func (c *Conn) request(msg sockx.Message, timeout time.Duration) (interface{}, error) {
+	reply := make(chan interface{}, 1)
+	c.mu.Lock()
+	c.ackSeq++
+	msg.Ack = c.ackSeq
+	c.acks[msg.Ack] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.acks, msg.Ack)
+		c.mu.Unlock()
+	}()
+	if err := c.write(msg); err != nil {
+		return nil, err
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case data := <-reply:
+		return data, nil
+	case <-expired:
+		return nil, ErrTimeout
+	case <-c.done:
+		return nil, ErrClosed
+	}
+}
+
+// frame is an encoded message and its websocket message type.
+type frame struct {
+	msgType int
+	data    []byte
+}
+
+// write queues msg for the write pump.
+func (c *Conn) write(msg sockx.Message) error {
+	data, msgType, err := c.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	select {
+	case c.send <- frame{msgType, data}:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	}
+}
+
+// readPump reads from ws, and from the connections replacing it when it
+// is lost, until the connection is closed for good.
+func (c *Conn) readPump(ws *websocket.Conn) {
+	for ws != nil {
+		err := c.readFrom(ws)
+		ws = c.reconnect(ws, err)
+	}
+}
+
+// readFrom handles the messages read from ws until reading fails, and
+// returns the error.
+func (c *Conn) readFrom(ws *websocket.Conn) error {
+	for {
+		var msg sockx.Message
+		msgType, data, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if err := c.codec.Unmarshal(data, msgType, &msg); err != nil {
+			c.reportError(fmt.Errorf("sockx/client: bad message: %w", err))
+			continue
+		}
+		c.handle(msg)
+	}
+}
+
+// reconnect handles the loss of ws after err. Without WithReconnect, or
+// once closed, it shuts the connection down and returns nil; otherwise it
+// redials until it succeeds or the connection is closed, and returns the
+// new connection.
+func (c *Conn) reconnect(ws *websocket.Conn, err error) *websocket.Conn {
+	policy := c.cfg.reconnect
+	switch {
+	case websocket.IsCloseError(err, websocket.CloseNormalClosure):
+		c.shutdown(nil)
+		return nil
+	case policy == nil:
+		if websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			err = nil
+		}
+		c.shutdown(err)
+		return nil
+	}
+	c.mu.Lock()
+	if c.ws == ws {
+		c.ws = nil
+		close(c.lost)
+	}
+	c.mu.Unlock()
+	ws.Close()
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	c.reportError(err)
+
+	for attempt := 1; ; attempt++ {
+		wait := policy.Delay(attempt)
+		c.mu.Lock()
+		if d := time.Until(c.retryAt); d > wait {
+			wait = d
+		}
+		c.mu.Unlock()
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-c.done:
+			t.Stop()
+			return nil
+		}
+
+		next, resp, err := c.handshake(c.resumeURL())
+		if err != nil {
+			if d, ok := retryAfter(resp); ok {
+				c.mu.Lock()
+				c.retryAt = time.Now().Add(d)
+				c.mu.Unlock()
+			}
+			c.reportError(err)
+			continue
+		}
+		select {
+		case <-c.done:
+			// Closed while dialing.
+			next.Close()
+			return nil
+		default:
+		}
+		c.mu.Lock()
+		hooks := c.onReconnect
+		c.mu.Unlock()
+		for _, h := range hooks {
+			h()
+		}
+		return next
+	}
+}
+
+// retryAfter returns the wait advised by the Retry-After header of resp,
+// given in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// handle processes one message from the server on the read loop: answers
+// and errors right away, and events by queueing them for dispatchPump, so
+// that answers reach handlers waiting for them.
+func (c *Conn) handle(msg sockx.Message) {
+	switch msg.Event {
+	case sockx.EventAck:
+		c.resolve(msg.Ack, msg.Data)
+		return
+	case sockx.EventAcks:
+		var entries []sockx.AckBatchEntry
+		if err := convert(msg.Data, &entries); err != nil {
+			c.reportError(fmt.Errorf("sockx/client: bad %s: %w", sockx.EventAcks, err))
+			return
+		}
+		for _, e := range entries {
+			c.resolve(e.Ack, e.Data)
+		}
+		return
+	case sockx.EventError:
+		var e ServerError
+		if convert(msg.Data, &e.ErrorData) == nil {
+			if e.RetryAfterMs > 0 {
+				c.mu.Lock()
+				c.retryAt = time.Now().Add(time.Duration(e.RetryAfterMs) * time.Millisecond)
+				c.mu.Unlock()
+			}
+			c.reportError(&e)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	if msg.Room != "" && msg.Seq != 0 {
+		c.cursors[msg.Room] = msg.Seq
+	}
+	c.events = append(c.events, msg)
+	c.mu.Unlock()
+	select {
+	case c.eventsReady <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchPump runs the handlers of the queued events in order. Once the
+// connection is closed it handles the events already read and stops.
+func (c *Conn) dispatchPump() {
+	for {
+		closed := false
+		select {
+		case <-c.eventsReady:
+		case <-c.done:
+			closed = true
+		}
+		for {
+			c.mu.Lock()
+			if len(c.events) == 0 {
+				c.mu.Unlock()
+				break
+			}
+			msg := c.events[0]
+			c.events[0] = sockx.Message{}
+			c.events = c.events[1:]
+			c.mu.Unlock()
+			c.dispatch(msg)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// dispatch runs the handler of an event and answers it.
+func (c *Conn) dispatch(msg sockx.Message) {
+	c.mu.Lock()
+	h := c.handlers[msg.Event]
+	c.mu.Unlock()
+	if h.fn == nil {
+		return
+	}
+	answer := h.fn(msg.Data)
+	if msg.Ack != 0 {
+		c.ack(msg.Ack, answer, h.now)
+	}
+}
+
+// resolve delivers the server's answer to request id.
+func (c *Conn) resolve(id uint64, data interface{}) {
+	c.mu.Lock()
+	reply, ok := c.acks[id]
+	delete(c.acks, id)
+	c.mu.Unlock()
+	if ok {
+		reply <- data
+	}
+}
+
+// ack answers the server's request id, adding the answer to the batch
+// unless now is set or acknowledgements are not batched.
+func (c *Conn) ack(id uint64, data interface{}, now bool) {
+	c.mu.Lock()
+	if !c.batchAcks || now {
+		c.mu.Unlock()
+		c.write(sockx.Message{Event: sockx.EventAck, Ack: id, Data: data})
+		return
+	}
+	c.ackBatch = append(c.ackBatch, sockx.AckBatchEntry{Ack: id, Data: data})
+	if len(c.ackBatch) < maxAckBatch {
+		if c.ackTimer == nil {
+			c.ackTimer = time.AfterFunc(ackBatchWindow, c.flushAcks)
+		}
+		c.mu.Unlock()
+		return
+	}
+	entries := c.takeAcksLocked()
+	c.mu.Unlock()
+	c.writeAcks(entries)
+}
+
+// flushAcks sends the acknowledgements batched so far.
+func (c *Conn) flushAcks() {
+	c.mu.Lock()
+	entries := c.takeAcksLocked()
+	c.mu.Unlock()
+	c.writeAcks(entries)
+}
+
+// takeAcksLocked empties the acknowledgement batch and returns what it
+// held. c.mu must be held.
+func (c *Conn) takeAcksLocked() []sockx.AckBatchEntry {
+	entries := c.ackBatch
+	c.ackBatch = nil
+	if c.ackTimer != nil {
+		c.ackTimer.Stop()
+		c.ackTimer = nil
+	}
+	return entries
+}
+
+// writeAcks sends entries in one sockx.EventAcks message, or one by one if
+// there is a single entry or the batch cannot be encoded, so that one bad
+// answer does not lose the others.
+func (c *Conn) writeAcks(entries []sockx.AckBatchEntry) {
+	if len(entries) > 1 && c.write(sockx.Message{Event: sockx.EventAcks, Data: entries}) == nil {
+		return
+	}
+	for _, e := range entries {
+		c.write(sockx.Message{Event: sockx.EventAck, Ack: e.Ack, Data: e.Data})
+	}
+}
+
+// writePump writes the queued frames to ws until ws fails, lost is
+// closed or the connection is closed for good.
+func (c *Conn) writePump(ws *websocket.Conn, lost chan struct{}) {
+	for {
+		select {
+		case f := <-c.send:
+			if f.msgType == websocket.CloseMessage {
+				ws.WriteControl(f.msgType, f.data, time.Now().Add(c.timeout))
+				c.shutdown(nil)
+				return
+			}
+			ws.SetWriteDeadline(time.Now().Add(c.timeout))
+			if err := ws.WriteMessage(f.msgType, f.data); err != nil {
+				if c.cfg.reconnect == nil {
+					c.shutdown(err)
+				} else {
+					// The read pump sees the connection fail and redials.
+					ws.Close()
+				}
+				return
+			}
+		case <-lost:
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// shutdown closes the connection after err, nil for a clean close, and
+// reports err to the error handlers. Only the first call has any effect.
+func (c *Conn) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		ws := c.ws
+		c.mu.Unlock()
+		close(c.done)
+		if ws != nil {
+			ws.Close()
+		}
+		if err != nil {
+			c.reportError(err)
+		}
+	})
+}
+
+func (c *Conn) reportError(err error) {
+	c.mu.Lock()
+	handlers := c.onError
+	c.mu.Unlock()
+	for _, h := range handlers {
+		h(err)
+	}
+}
+
+// convert decodes data, as the codec decoded it, into v, a pointer to the
+// type it stands for.
+func convert(data interface{}, v interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,152 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/client"
+)
+
+// testTimeout bounds every wait in the tests.
+const testTimeout = 5 * time.Second
+
+// serve serves namespace / of a new sockx server configured with opts for
+// the duration of the test and returns the server and its WebSocket URL.
+func serve(t *testing.T, opts ...sockx.Option) (*sockx.Server, string) {
+	t.Helper()
+	s := sockx.NewServer(opts...)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s, listen(t, s.ServeWebSocket("/"))
+}
+
+// listen serves h for the duration of the test and returns its WebSocket
+// URL.
+func listen(t *testing.T, h http.Handler) string {
+	t.Helper()
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+// dial connects to url and closes the connection when the test ends.
+func dial(t *testing.T, url string) *client.Conn {
+	t.Helper()
+	c, err := client.Dial(url, client.WithTimeout(testTimeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestEmitReachesServerAndReplyReachesHandler(t *testing.T) {
+	s, url := serve(t)
+	s.Of("/").On("hello", func(c *sockx.Client, data interface{}) {
+		c.Emit("greeting", "hello, "+data.(string))
+	})
+	c := dial(t, url)
+	got := make(chan interface{}, 1)
+	c.On("greeting", func(data interface{}) { got <- data })
+	if err := c.Emit("hello", "gopher"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-got:
+		if data != "hello, gopher" {
+			t.Fatalf("greeting = %v, want hello, gopher", data)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("no greeting")
+	}
+}
+
+func TestHandlerCanJoinAndEmitWithAck(t *testing.T) {
+	s, url := serve(t)
+	ns := s.Of("/")
+	ns.EnableClientJoins(nil)
+	ns.OnWithAck("double", func(c *sockx.Client, data interface{}) interface{} {
+		return data.(float64) * 2
+	})
+	c := dial(t, url)
+
+	type result struct {
+		room   string
+		answer interface{}
+		err    error
+	}
+	done := make(chan result, 1)
+	c.On("invite", func(data interface{}) {
+		res, err := c.Join(data.(string))
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		answer, err := c.EmitWithAck("double", 21, testTimeout)
+		done <- result{res.Room, answer, err}
+	})
+	ns.Client(c.ID()).Emit("invite", "lobby")
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("request from a handler: %v", r.err)
+		}
+		if r.room != "lobby" || r.answer != 42.0 {
+			t.Fatalf("joined %q and got %v, want lobby and 42", r.room, r.answer)
+		}
+	case <-time.After(2 * testTimeout):
+		t.Fatal("handler waiting for an answer hung")
+	}
+	if r := ns.Room("lobby"); r == nil || r.Size() != 1 {
+		t.Fatal("client not in the joined room")
+	}
+}
+
+func TestHandlersRunInArrivalOrder(t *testing.T) {
+	const events = 200
+	s, url := serve(t)
+	c := dial(t, url)
+	got := make(chan float64, events)
+	c.On("n", func(data interface{}) {
+		time.Sleep(time.Microsecond)
+		got <- data.(float64)
+	})
+	sc := s.Of("/").Client(c.ID())
+	for i := 0; i < events; i++ {
+		sc.Emit("n", i)
+	}
+	for want := 0; want < events; want++ {
+		select {
+		case n := <-got:
+			if n != float64(want) {
+				t.Fatalf("handled %v, want %d", n, want)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("event %d not handled", want)
+		}
+	}
+}
+
+func TestServerEmitWithAckAnsweredByHandler(t *testing.T) {
+	s, url := serve(t)
+	c := dial(t, url)
+	c.OnWithAckNow("question", func(data interface{}) interface{} {
+		return "answer to " + data.(string)
+	})
+	answer, err := s.Of("/").Client(c.ID()).EmitWithAck("question", "life", testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "answer to life" {
+		t.Fatalf("answer = %v", answer)
+	}
+}
@@ -0,0 +1,186 @@
+package client_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/client"
+	"github.com/gorilla/websocket"
+)
+
+// fastRetry reconnects without waiting of its own, so that the waits
+// measured are the server's advice.
+var fastRetry = sockx.BackoffPolicy{Base: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+
+// reconnects returns a channel receiving the time of each of c's
+// reconnects.
+func reconnects(c *client.Conn) <-chan time.Time {
+	at := make(chan time.Time, 4)
+	c.OnReconnect(func() { at <- time.Now() })
+	return at
+}
+
+// awaitTime returns the next time received on ch.
+func awaitTime(t *testing.T, ch <-chan time.Time, what string) time.Time {
+	t.Helper()
+	select {
+	case at := <-ch:
+		return at
+	case <-time.After(testTimeout):
+		t.Fatalf("no %s", what)
+		return time.Time{}
+	}
+}
+
+func TestReconnectKeepsHandlersAndHonorsRetryAfterHeader(t *testing.T) {
+	s, _ := serve(t)
+	var mu sync.Mutex
+	var handshakes int
+	var refusedAt time.Time
+	url := listen(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		handshakes++
+		refuse := handshakes == 2
+		if refuse {
+			refusedAt = time.Now()
+		}
+		mu.Unlock()
+		if refuse {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		s.ServeWebSocket("/")(w, r)
+	}))
+	c, err := client.Dial(url, client.WithTimeout(testTimeout), client.WithReconnect(fastRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := make(chan interface{}, 1)
+	c.On("news", func(data interface{}) { got <- data })
+	back := reconnects(c)
+	first := c.ID()
+
+	s.Of("/").Client(first).Disconnect(websocket.CloseTryAgainLater, "")
+	at := awaitTime(t, back, "reconnect")
+	mu.Lock()
+	waited := at.Sub(refusedAt)
+	mu.Unlock()
+	if waited < time.Second {
+		t.Fatalf("reconnected %v after a refusal advising 1s", waited)
+	}
+	if c.ID() == first {
+		t.Fatal("ID unchanged by the reconnect")
+	}
+	s.Of("/").Client(c.ID()).Emit("news", "after")
+	select {
+	case data := <-got:
+		if data != "after" {
+			t.Fatalf("received %v", data)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("handler lost across the reconnect")
+	}
+}
+
+func TestReconnectHonorsRetryAfterMs(t *testing.T) {
+	const advice = 600 * time.Millisecond
+	s, url := serve(t,
+		sockx.WithRateLimits(sockx.RateLimits{PerEvent: map[string]sockx.RateLimit{"spam": {Rate: 10, Burst: 1}}}),
+		sockx.WithBackoff(sockx.BackoffPolicy{Base: advice, Max: advice, Multiplier: 1, Reset: time.Minute}))
+	c, err := client.Dial(url, client.WithTimeout(testTimeout), client.WithReconnect(fastRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	rejected := make(chan time.Time, 1)
+	c.OnError(func(err error) {
+		if se, ok := err.(*client.ServerError); ok && se.RetryAfterMs == advice.Milliseconds() {
+			rejected <- time.Now()
+		}
+	})
+	back := reconnects(c)
+
+	c.Emit("spam", 1)
+	c.Emit("spam", 2)
+	at := awaitTime(t, rejected, "rejection advising a retry")
+	s.Of("/").Client(c.ID()).Disconnect(websocket.CloseInternalServerErr, "")
+	if waited := awaitTime(t, back, "reconnect").Sub(at); waited < advice {
+		t.Fatalf("reconnected %v after advice of %v", waited, advice)
+	}
+}
+
+func TestNormalClosureEndsReconnectingConnection(t *testing.T) {
+	s, url := serve(t)
+	c, err := client.Dial(url, client.WithTimeout(testTimeout), client.WithReconnect(fastRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := reconnects(c)
+	s.Of("/").Client(c.ID()).Disconnect(websocket.CloseNormalClosure, "bye")
+	select {
+	case <-c.Done():
+	case <-time.After(testTimeout):
+		t.Fatal("connection not closed")
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("Err = %v after a normal closure", err)
+	}
+	select {
+	case <-back:
+		t.Fatal("reconnected after a normal closure")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCloseStopsReconnecting(t *testing.T) {
+	s, _ := serve(t)
+	var mu sync.Mutex
+	handshakes := 0
+	url := listen(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		handshakes++
+		first := handshakes == 1
+		mu.Unlock()
+		if !first {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		s.ServeWebSocket("/")(w, r)
+	}))
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return handshakes
+	}
+	retry := sockx.BackoffPolicy{Base: 10 * time.Millisecond, Max: 10 * time.Millisecond, Multiplier: 1}
+	c, err := client.Dial(url, client.WithTimeout(testTimeout), client.WithReconnect(retry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Of("/").Client(c.ID()).Disconnect(websocket.CloseGoingAway, "")
+	deadline := time.Now().Add(testTimeout)
+	for count() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("no reconnect attempts")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	c.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Close took %v while reconnecting", d)
+	}
+	<-c.Done()
+	n := count()
+	time.Sleep(50 * time.Millisecond)
+	// An attempt already under way when Close was called may still land.
+	if count() > n+1 {
+		t.Fatal("still reconnecting after Close")
+	}
+}
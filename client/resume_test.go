@@ -0,0 +1,102 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/client"
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectResumesSession(t *testing.T) {
+	s, url := serve(t)
+	ns := s.Of("/")
+	ns.EnableHistory(16)
+	ns.EnableResume(time.Minute)
+	ns.EnableClientJoins(nil)
+	// A detached member keeps the room, and its history, alive while the
+	// connection is away.
+	sockx.NewDetachedClient(ns).Join("r")
+
+	// The first connection is dropped at the network; redials wait for
+	// the missed messages to be emitted.
+	conns := make(chan net.Conn, 1)
+	redial := make(chan struct{})
+	var once sync.Once
+	dialer := &websocket.Dialer{NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		first := false
+		once.Do(func() { first = true })
+		if !first {
+			<-redial
+		}
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if first && err == nil {
+			conns <- conn
+		}
+		return conn, err
+	}}
+	c, err := client.Dial(url, client.WithDialer(dialer), client.WithTimeout(testTimeout), client.WithReconnect(fastRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := make(chan string, 16)
+	c.On("msg", func(data interface{}) { got <- fmt.Sprint("msg ", data) })
+	c.On(sockx.EventResumeComplete, func(data interface{}) {
+		rooms, _ := data.(map[string]interface{})["rooms"].([]interface{})
+		if len(rooms) != 1 {
+			got <- fmt.Sprint("complete ", data)
+			return
+		}
+		r := rooms[0].(map[string]interface{})
+		got <- fmt.Sprint("complete ", r["room"], " replayed ", r["replayed"])
+	})
+	next := func() string {
+		t.Helper()
+		select {
+		case s := <-got:
+			return s
+		case <-time.After(testTimeout):
+			t.Fatal("nothing received")
+			return ""
+		}
+	}
+	if _, err := c.Join("r"); err != nil {
+		t.Fatal(err)
+	}
+	ns.EmitTo("r", "msg", 1)
+	if m := next(); m != "msg 1" {
+		t.Fatalf("received %s, want msg 1", m)
+	}
+
+	(<-conns).Close()
+	deadline := time.Now().Add(testTimeout)
+	for ns.Stats().Clients != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not notice the drop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 2; i <= 4; i++ {
+		ns.EmitTo("r", "msg", i)
+	}
+	close(redial)
+
+	for _, want := range []string{"msg 2", "msg 3", "msg 4", "complete r replayed 3"} {
+		if m := next(); m != want {
+			t.Fatalf("received %s, want %s", m, want)
+		}
+	}
+	if !c.Resumed() {
+		t.Fatal("connection not resumed")
+	}
+	ns.EmitTo("r", "msg", 5)
+	if m := next(); m != "msg 5" {
+		t.Fatalf("received %s after resuming, want msg 5", m)
+	}
+}
@@ -0,0 +1,134 @@
+package sockx
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func keyedFrame(key, s string) *outbound { return &outbound{data: []byte(s), key: key} }
+
+// drain pops every frame queued in q.
+func drain(q *sendQueue) []string {
+	var out []string
+	for {
+		m, _ := q.pop()
+		if m == nil {
+			return out
+		}
+		out = append(out, string(m.data))
+	}
+}
+
+func TestCoalesceReplacesPendingFrameInPlace(t *testing.T) {
+	for _, fair := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fair=%v", fair), func(t *testing.T) {
+			q := newSendQueue(8, fair)
+			q.push(frame("a"), false)
+			q.push(keyedFrame("cursor", "x1"), false)
+			q.push(frame("b"), false)
+			q.push(keyedFrame("cursor", "x2"), false)
+			q.push(keyedFrame("cursor", "x3"), false)
+			if n := q.normal.len(); n != 3 {
+				t.Fatalf("queue depth = %d, want 3", n)
+			}
+			if got := fmt.Sprint(drain(q)); got != "[a x3 b]" {
+				t.Fatalf("popped %s, want [a x3 b]", got)
+			}
+		})
+	}
+}
+
+func TestCoalesceKeyClearedOnceWritten(t *testing.T) {
+	q := newSendQueue(8, false)
+	q.push(keyedFrame("cursor", "x1"), false)
+	if m, _ := q.pop(); string(m.data) != "x1" {
+		t.Fatalf("popped %s, want x1", m.data)
+	}
+	q.push(frame("a"), false)
+	q.push(keyedFrame("cursor", "x2"), false)
+	if got := fmt.Sprint(drain(q)); got != "[a x2]" {
+		t.Fatalf("popped %s, want the new frame appended after a", got)
+	}
+	if len(q.keyed) != 0 {
+		t.Fatalf("%d keys left indexed after draining", len(q.keyed))
+	}
+}
+
+func TestCoalesceIntoFullLane(t *testing.T) {
+	q := newSendQueue(2, false)
+	q.push(keyedFrame("cursor", "x1"), false)
+	q.push(frame("a"), false)
+	if _, err := q.push(keyedFrame("cursor", "x2"), false); err != nil {
+		t.Fatalf("coalescing push into a full lane: %v", err)
+	}
+	if _, err := q.push(keyedFrame("other", "y"), false); err != ErrQueueFull {
+		t.Fatalf("push of a new key into a full lane = %v, want ErrQueueFull", err)
+	}
+	if got := fmt.Sprint(drain(q)); got != "[x2 a]" {
+		t.Fatalf("popped %s, want [x2 a]", got)
+	}
+}
+
+func TestCoalesceKeepsLanesApart(t *testing.T) {
+	q := newSendQueue(8, false)
+	q.push(keyedFrame("k", "n1"), false)
+	q.push(keyedFrame("k", "c1"), true)
+	q.push(keyedFrame("k", "n2"), false)
+	q.push(keyedFrame("k", "c2"), true)
+	if got := fmt.Sprint(drain(q)); got != "[c2 n2]" {
+		t.Fatalf("popped %s, want the control frame first and one frame per lane", got)
+	}
+}
+
+func TestCoalesceWhileHolding(t *testing.T) {
+	q := newSendQueue(8, false)
+	q.push(keyedFrame("k", "x1"), false)
+	q.hold()
+	q.push(keyedFrame("k", "x2"), false)
+	q.push(frame("a"), false)
+	q.push(keyedFrame("k", "x3"), false)
+	if dropped := q.release(); dropped != 0 {
+		t.Fatalf("release dropped %d frames", dropped)
+	}
+	if got := fmt.Sprint(drain(q)); got != "[x3 a]" {
+		t.Fatalf("popped %s, want the held frame to replace the queued one", got)
+	}
+}
+
+func TestSlowClientGetsNewestCoalescedValue(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	release := make(chan struct{})
+	frames := make(chan []byte, 64)
+	c := NewDetachedClient(ns, DetachedOutbox(func(f []byte) {
+		<-release
+		frames <- f
+	}))
+	for i := 0; i < 50; i++ {
+		if err := c.Emit("cursor", i, Coalesce("cursor:"+c.ID())); err != nil {
+			t.Fatalf("Emit %d: %v", i, err)
+		}
+	}
+	c.Emit("done", nil)
+	close(release)
+
+	var got []int
+	for {
+		var msg Message
+		if err := json.Unmarshal(<-frames, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Event == "done" {
+			break
+		}
+		var v int
+		msg.Bind(&v)
+		got = append(got, v)
+	}
+	// The first value may already be with the writer when the rest are
+	// queued; everything after it collapses into the newest.
+	if len(got) == 0 || len(got) > 2 || got[len(got)-1] != 49 {
+		t.Fatalf("received %v, want at most one stale value followed by 49", got)
+	}
+}
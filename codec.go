@@ -0,0 +1,283 @@
+package sockx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// Codec encodes the messages exchanged with clients. Marshal returns the
+// websocket message type to send the encoding as, TextMessage or
+// BinaryMessage, and Unmarshal is given the type of a received message.
+//
+// A connection speaks the codec of the namespace it connected to for its
+// whole life; see Namespace.SetCodec. Codecs are compared with ==, so
+// implementations must be comparable, such as empty structs or pointers.
+type Codec interface {
+	Marshal(msg Message) (data []byte, msgType int, err error)
+	Unmarshal(data []byte, msgType int, msg *Message) error
+}
+
+// JSONCodec encodes messages as JSON text messages. It is the default.
+// It also reads the binary messages of Client.EmitBinary's framing, whose
+// payload becomes the message's Data as a []byte.
+//
+// The zero value uses the field names of Message; NewJSONCodec returns one
+// that names them otherwise on the wire.
+type JSONCodec struct {
+	env *envelope
+}
+
+// EnvelopeFields names the fields of the JSON envelope on the wire, for
+// protocols that already name them otherwise, such as "type" for the
+// event and "payload" for the data. Empty names keep sockx's own: "id",
+// "event", "namespace", "room", "data", "ack", "seq" and "correlation".
+// Envelopes of other shapes, such as positional arrays, need a Codec of
+// their own.
+type EnvelopeFields struct {
+	ID, Event, Namespace, Room, Data, Ack, Seq, Correlation string
+}
+
+// Envelope fields, in the order they are encoded.
+const (
+	fieldID = iota
+	fieldEvent
+	fieldNamespace
+	fieldRoom
+	fieldData
+	fieldAck
+	fieldSeq
+	fieldCorrelation
+	fieldCount
+)
+
+// envelope holds the wire names of the envelope's fields, as is and
+// JSON-quoted.
+type envelope struct {
+	names  [fieldCount]string
+	quoted [fieldCount][]byte
+}
+
+// defaultEnvelope has the field names of Message.
+var defaultEnvelope = newEnvelope(EnvelopeFields{})
+
+func newEnvelope(fields EnvelopeFields) *envelope {
+	e := &envelope{names: [fieldCount]string{
+		fieldID:          "id",
+		fieldEvent:       "event",
+		fieldNamespace:   "namespace",
+		fieldRoom:        "room",
+		fieldData:        "data",
+		fieldAck:         "ack",
+		fieldSeq:         "seq",
+		fieldCorrelation: "correlation",
+	}}
+	for i, name := range [fieldCount]string{
+		fields.ID, fields.Event, fields.Namespace, fields.Room, fields.Data, fields.Ack, fields.Seq, fields.Correlation,
+	} {
+		if name != "" {
+			e.names[i] = name
+		}
+		e.quoted[i], _ = json.Marshal(e.names[i])
+	}
+	return e
+}
+
+// NewJSONCodec returns a JSONCodec that names the envelope's fields as
+// fields does, both in the messages it sends and in those it reads.
+func NewJSONCodec(fields EnvelopeFields) JSONCodec {
+	return JSONCodec{env: newEnvelope(fields)}
+}
+
+// envelope returns the codec's field names.
+func (j JSONCodec) envelope() *envelope {
+	if j.env == nil {
+		return defaultEnvelope
+	}
+	return j.env
+}
+
+// WithEnvelopeFields sets Codec to a JSONCodec naming the event, data,
+// namespace and room fields of the envelope as given; see EnvelopeFields.
+func WithEnvelopeFields(event, data, namespace, room string) Option {
+	return WithCodec(NewJSONCodec(EnvelopeFields{Event: event, Data: data, Namespace: namespace, Room: room}))
+}
+
+// Marshal encodes msg as JSON.
+func (j JSONCodec) Marshal(msg Message) ([]byte, int, error) {
+	b, err := j.marshal(msg)
+	return b, websocket.TextMessage, err
+}
+
+// Unmarshal decodes a JSON text message or a framed binary message into
+// msg. The Data of a binary message shares data.
+func (j JSONCodec) Unmarshal(data []byte, msgType int, msg *Message) error {
+	if msgType != websocket.BinaryMessage {
+		return j.unmarshal(data, msg)
+	}
+	header, at, err := j.decodeBinary(data)
+	if err != nil {
+		return err
+	}
+	*msg = header
+	msg.Data = data[at:]
+	return nil
+}
+
+func (j JSONCodec) marshal(msg Message) ([]byte, error) {
+	if j.env == nil {
+		return json.Marshal(msg)
+	}
+	var b bytes.Buffer
+	b.WriteByte('{')
+	field := func(f int, v interface{}) error {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.Write(j.env.quoted[f])
+		b.WriteByte(':')
+		b.Write(raw)
+		return nil
+	}
+	if msg.ID != "" {
+		field(fieldID, msg.ID)
+	}
+	field(fieldEvent, msg.Event)
+	if msg.Namespace != "" {
+		field(fieldNamespace, msg.Namespace)
+	}
+	if msg.Room != "" {
+		field(fieldRoom, msg.Room)
+	}
+	if msg.Data != nil {
+		if err := field(fieldData, msg.Data); err != nil {
+			return nil, err
+		}
+	}
+	if msg.Ack != 0 {
+		field(fieldAck, msg.Ack)
+	}
+	if msg.Seq != 0 {
+		field(fieldSeq, msg.Seq)
+	}
+	if msg.Correlation != "" {
+		field(fieldCorrelation, msg.Correlation)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (j JSONCodec) unmarshal(data []byte, msg *Message) error {
+	if j.env == nil {
+		return json.Unmarshal(data, msg)
+	}
+	if err := j.unmarshalRaw(data, msg); err != nil {
+		return err
+	}
+	return msg.decodeData()
+}
+
+// wireMessage is Message without its methods, for decoding around its
+// Data field.
+type wireMessage Message
+
+// unmarshalRaw decodes a JSON text message into msg like unmarshal, but
+// leaves its data undecoded: msg.Data is the data's json.RawMessage, or
+// nil if it is absent or null.
+func (j JSONCodec) unmarshalRaw(data []byte, msg *Message) error {
+	var raw json.RawMessage
+	if j.env == nil {
+		m := struct {
+			*wireMessage
+			Data *json.RawMessage `json:"data"`
+		}{(*wireMessage)(msg), &raw}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+	} else {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		for f, v := range [fieldCount]interface{}{
+			fieldID:          &msg.ID,
+			fieldEvent:       &msg.Event,
+			fieldNamespace:   &msg.Namespace,
+			fieldRoom:        &msg.Room,
+			fieldAck:         &msg.Ack,
+			fieldSeq:         &msg.Seq,
+			fieldCorrelation: &msg.Correlation,
+		} {
+			if v == nil {
+				continue
+			}
+			if raw, ok := fields[j.env.names[f]]; ok {
+				if err := json.Unmarshal(raw, v); err != nil {
+					return err
+				}
+			}
+		}
+		raw = fields[j.env.names[fieldData]]
+	}
+	msg.Data = nil
+	if len(raw) > 0 && string(raw) != "null" {
+		msg.Data = raw
+	}
+	return nil
+}
+
+// errRecode is reported for a client a message could not be encoded for
+// in the client's own codec, or whose data could not be transformed for
+// it; see SetPayloadTransformer.
+var errRecode = errors.New("sockx: message cannot be encoded for the client")
+
+// WithCodec sets Codec.
+func WithCodec(c Codec) Option {
+	return func(cfg *Config) { cfg.Codec = c }
+}
+
+// SetCodec sets the codec of the connections made to the namespace,
+// overriding Config.Codec; nil goes back to Config.Codec. Messages are
+// encoded in each recipient's codec, so clients already connected, and
+// those that joined the namespace with EventConnect, keep theirs.
+func (ns *Namespace) SetCodec(c Codec) {
+	if c == nil {
+		ns.codec.Store(nil)
+		return
+	}
+	ns.codec.Store(&c)
+}
+
+// Codec returns the codec of the namespace's new connections.
+func (ns *Namespace) Codec() Codec {
+	if c := ns.codec.Load(); c != nil {
+		return *c
+	}
+	return ns.server.cfg().Codec
+}
+
+// encode encodes msg for c in its codec.
+func (c *Client) encode(msg Message) (*outbound, error) {
+	return encodeMessage(c.codec, msg)
+}
+
+func encodeMessage(codec Codec, msg Message) (*outbound, error) {
+	data, msgType, err := codec.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &outbound{msgType: msgType, data: data, room: msg.Room, correlation: msg.Correlation}, nil
+}
+
+// isJSON reports whether codec is JSONCodec, whose frames can be tagged
+// with a namespace without decoding them; see JSONCodec.inNamespace.
+func isJSON(codec Codec) bool {
+	_, ok := codec.(JSONCodec)
+	return ok
+}
@@ -0,0 +1,100 @@
+package sockx
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+var productFields = EnvelopeFields{
+	ID: "msgId", Event: "type", Namespace: "ns", Room: "channel", Data: "payload",
+	Ack: "ackId", Seq: "sequence", Correlation: "trace",
+}
+
+// wireKeys returns the sorted top-level keys of a JSON object.
+func wireKeys(t *testing.T, data []byte) []string {
+	t.Helper()
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("%s: %v", data, err)
+	}
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestEnvelopeFieldsRoundTrip(t *testing.T) {
+	c := NewJSONCodec(productFields)
+	in := Message{
+		ID: "m1", Event: "chat", Namespace: "/support", Room: "lobby",
+		Data: map[string]interface{}{"text": "hi", "tags": []interface{}{"a", "b"}, "n": 2.5},
+		Ack:  3, Seq: 9, Correlation: "req-1",
+	}
+	data, msgType, err := c.Marshal(in)
+	if err != nil || msgType != websocket.TextMessage {
+		t.Fatalf("Marshal = %d, %v", msgType, err)
+	}
+	want := []string{"ackId", "channel", "msgId", "ns", "payload", "sequence", "trace", "type"}
+	if keys := wireKeys(t, data); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("wire keys = %v, want %v", keys, want)
+	}
+	var out Message
+	if err := c.Unmarshal(data, msgType, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestEnvelopeFieldsDecodeForeignFrames(t *testing.T) {
+	c := NewJSONCodec(productFields)
+	var msg Message
+	frame := `{"type":"chat","payload":{"text":"hi"},"channel":"lobby","event":"ignored","data":1}`
+	if err := c.Unmarshal([]byte(frame), websocket.TextMessage, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "chat" || msg.Room != "lobby" || !reflect.DeepEqual(msg.Data, map[string]interface{}{"text": "hi"}) {
+		t.Fatalf("decoded %+v", msg)
+	}
+
+	// The zero codec keeps sockx's own names.
+	data, _, _ := JSONCodec{}.Marshal(Message{Event: "chat", Room: "lobby", Data: 1})
+	if keys := wireKeys(t, data); !reflect.DeepEqual(keys, []string{"data", "event", "room"}) {
+		t.Fatalf("default wire keys = %v", keys)
+	}
+}
+
+func TestServerSpeaksCustomEnvelope(t *testing.T) {
+	s := newTestServer(t, WithEnvelopeFields("type", "payload", "ns", "channel"))
+	s.Of("/").On("echo", func(c *Client, data interface{}) { c.Emit("echo", data) })
+	conn, _, err := websocket.DefaultDialer.Dial(serve(t, s, "/"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	read := func() map[string]json.RawMessage {
+		t.Helper()
+		var m map[string]json.RawMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m["event"]; ok {
+			t.Fatalf("frame uses sockx's field names: %v", m)
+		}
+		return m
+	}
+	if welcome := read(); string(welcome["type"]) != `"`+EventWelcome+`"` {
+		t.Fatalf("welcome = %s", welcome)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"echo","payload":{"x":1}}`))
+	if echo := read(); string(echo["type"]) != `"echo"` || string(echo["payload"]) != `{"x":1}` {
+		t.Fatalf("echo = %s", echo)
+	}
+}
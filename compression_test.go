@@ -0,0 +1,147 @@
+package sockx
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// countingConn counts the bytes read from the network.
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// dialCounting connects to url offering compression and returns the
+// connection and the count of bytes it has read off the wire.
+func dialCounting(t testing.TB, url string) (*websocket.Conn, *atomic.Int64) {
+	t.Helper()
+	wire := new(atomic.Int64)
+	d := websocket.Dialer{
+		EnableCompression: true,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			c, err := net.Dial(network, addr)
+			return countingConn{c, wire}, err
+		},
+	}
+	conn, _, err := d.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("reading welcome: %v", err)
+	}
+	return conn, wire
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	small, large := strings.Repeat("a", 512), strings.Repeat("a", 64<<10)
+	for _, tt := range []struct {
+		name          string
+		opts          []Option
+		smallSquashed bool
+		largeSquashed bool
+	}{
+		{"disabled", nil, false, false},
+		{"every message", []Option{WithCompression()}, true, true},
+		{"above threshold", []Option{WithCompression(), WithCompressionThreshold(1024)}, false, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.opts...)
+			ns := s.Of("/")
+			conn, wire := dialCounting(t, serve(t, s, "/"))
+			// Alternate sizes, so each message needs the writer to toggle
+			// compression again.
+			for i := 0; i < 3; i++ {
+				for _, payload := range []string{small, large} {
+					before := wire.Load()
+					ns.Emit("data", payload)
+					if _, _, err := conn.ReadMessage(); err != nil {
+						t.Fatal(err)
+					}
+					squashed := wire.Load()-before < int64(len(payload))
+					want := tt.smallSquashed
+					if len(payload) == len(large) {
+						want = tt.largeSquashed
+					}
+					if squashed != want {
+						t.Fatalf("%d-byte payload compressed = %v, want %v", len(payload), squashed, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// chatPayload returns about size bytes of chat-like JSON.
+func chatPayload(size int) []map[string]interface{} {
+	var msgs []map[string]interface{}
+	for n := 0; n < size; n += 80 {
+		msgs = append(msgs, map[string]interface{}{
+			"user": fmt.Sprint("user-", n%37),
+			"text": fmt.Sprint("message number ", n, " in the busy room"),
+			"at":   1700000000 + n,
+		})
+	}
+	return msgs
+}
+
+// BenchmarkBroadcastCompression measures broadcasting a large payload to
+// many clients with and without permessage-deflate, reporting the bytes
+// each broadcast puts on the wire.
+func BenchmarkBroadcastCompression(b *testing.B) {
+	const clients = 50
+	payload := chatPayload(16 << 10)
+	for _, compress := range []bool{false, true} {
+		b.Run(fmt.Sprintf("compression=%v", compress), func(b *testing.B) {
+			var opts []Option
+			if compress {
+				opts = append(opts, WithCompression(), WithCompressionThreshold(1024))
+			}
+			s := newTestServer(b, opts...)
+			ns := s.Of("/")
+			url := serve(b, s, "/")
+			var wg sync.WaitGroup
+			var wire []*atomic.Int64
+			for i := 0; i < clients; i++ {
+				conn, n := dialCounting(b, url)
+				wire = append(wire, n)
+				go func() {
+					for {
+						if _, _, err := conn.ReadMessage(); err != nil {
+							return
+						}
+						wg.Done()
+					}
+				}()
+			}
+			total := func() (sum int64) {
+				for _, n := range wire {
+					sum += n.Load()
+				}
+				return sum
+			}
+			start := total()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				wg.Add(clients)
+				ns.Emit("chat", payload)
+				wg.Wait()
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(total()-start)/float64(b.N), "wire-B/op")
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package sockx
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// Config holds server settings. A zero field selects its default.
+//
+// Settings can be changed on a running server with UpdateConfig. Changes
+// apply to new connections and, on their next use, to live ones; that
+// covers the rate limits, the room and namespace caps, the namespace
+// creation rate and veto, handler concurrency caps, write
+// timeout, pong wait, stall timeout, strict namespaces, trusted proxies,
+// debug events and emits, tracing, guest TTL, compression threshold and adapter
+// breaker. Live connections apply a new MaxMessageSize before reading
+// their next message, and a new PingInterval from their next ping or
+// write.
+// HandlerWorkers, RateLimiter, Backoff, Adapter, Rand, NodeID, Codec,
+// WarmUp and the handshake, buffer and send queue settings are fixed by
+// NewServer, as is whether the watchdog runs at all.
+type Config struct {
+	// HandlerWorkers is the number of goroutines running event handlers.
+	// Zero runs each handler on its client's read loop, one at a time.
+	HandlerWorkers int
+
+	// MaxHandlerConcurrency caps how many of a single client's events run
+	// at once on the worker pool. Defaults to 4. Set it to 1 to run each
+	// client's events strictly in order.
+	MaxHandlerConcurrency int
+
+	// MaxPendingEvents caps how many of a single client's events may wait
+	// for a free handler slot. Events beyond it are rejected with an
+	// ErrCodeTooManyEvents error. Defaults to 64.
+	MaxPendingEvents int
+
+	// MaxRoomsPerClient caps the rooms a single client may be in; Join
+	// fails with ErrTooManyRooms beyond it. Zero means no limit. Rooms
+	// rejoined when resuming a session are not limited.
+	MaxRoomsPerClient int
+
+	// MaxNamespacesPerConnection caps the namespaces a single connection
+	// may connect to with EventConnect, besides the one it was made to.
+	// Defaults to 8; a negative value means no limit.
+	MaxNamespacesPerConnection int
+
+	// NamespaceCreationRate limits how fast clients may create namespaces
+	// with EventConnect, across the server. No limit applies by default.
+	// It does not limit Of.
+	NamespaceCreationRate RateLimit
+
+	// VetoNamespace, if set, decides whether a client may create the
+	// namespace name with EventConnect, given the handshake request of its
+	// connection. A non-nil error refuses the connect with
+	// ErrCodeForbidden and the error's text. Namespaces that exist are not
+	// vetoed.
+	VetoNamespace func(name string, r *http.Request) error
+
+	// RateLimits are the limits enforced per user or IP. No limits are
+	// enforced by default.
+	RateLimits RateLimits
+
+	// RateLimiter enforces RateLimits. Defaults to an in-memory
+	// TokenBucketLimiter.
+	RateLimiter RateLimiter
+
+	// Backoff computes the retry advice sent with rejections. Defaults to
+	// DefaultBackoffPolicy.
+	Backoff BackoffPolicy
+
+	// Adapter connects the server to other nodes. Nil keeps emits local.
+	Adapter Adapter
+
+	// AdapterBreaker stops publishing through the adapter once publishes
+	// fail Failures times within Window, and probes it again after
+	// Cooldown. Defaults to 5 failures in 10s with a 5s cool-down; a
+	// negative Failures disables the breaker.
+	AdapterBreaker BreakerConfig
+
+	// WriteTimeout bounds a single write to a client. Defaults to 10s.
+	WriteTimeout time.Duration
+
+	// PingInterval is how often the server pings each client. Defaults to
+	// 25s; a negative value disables the heartbeat, and with it the
+	// detection of dead connections.
+	PingInterval time.Duration
+
+	// PongWait is how long a client may stay silent, sending neither a
+	// message nor a pong, before its connection is considered dead and
+	// closed with ReasonPingTimeout. It should comfortably exceed
+	// PingInterval. Defaults to 60s.
+	PongWait time.Duration
+
+	// StallTimeout enables the write watchdog, which disconnects clients
+	// with ReasonStalled when their queue has not drained at all for
+	// StallTimeout while non-empty, or a single write has been in progress
+	// for well over WriteTimeout. Zero disables the watchdog.
+	StallTimeout time.Duration
+
+	// FairQueuing drains each new connection's send queue round-robin
+	// across the rooms its messages were emitted to, so a chatty room
+	// cannot hold up a quiet one. Messages of one room stay in order, but
+	// messages of different rooms may reach the client in a different
+	// order than they were emitted. Critical and protocol messages keep
+	// their own lane and priority either way.
+	FairQueuing bool
+
+	// Labels describe the server's place in the topology, such as its
+	// LabelZone. They travel with every message published through the
+	// adapter, so receiving nodes can attribute traffic to its origin.
+	Labels map[string]string
+
+	// IDGenerator generates client IDs. IDs already used by a connected
+	// client are rejected and generated again. Defaults to 16 random hex
+	// characters drawn from Rand.
+	IDGenerator func() string
+
+	// Rand is the source of client IDs and resume tokens. Defaults to
+	// crypto/rand; tests can supply a deterministic source such as
+	// sockxtest.Sequential for stable output.
+	Rand io.Reader
+
+	// StrictNamespaces stops ServeWebSocket from creating namespaces on
+	// first use. Connections to a namespace without event handlers or
+	// lifecycle hooks, and not created by OfSetup, are refused: WebSocket
+	// handshakes are closed with a policy violation and the reason
+	// "unknown namespace", and other requests get a 404. The registered
+	// namespaces are logged on the first connection attempt.
+	StrictNamespaces bool
+
+	// TrustedProxies are the proxies whose forwarding headers are believed
+	// when determining a client's address. See WithTrustedProxies.
+	TrustedProxies []netip.Prefix
+
+	// CheckOrigin accepts or rejects a WebSocket handshake by its request,
+	// for namespaces without an UpgradePolicy. Nil accepts every origin.
+	// See also SetAllowedOrigins.
+	CheckOrigin func(r *http.Request) bool
+
+	// ReadBufferSize and WriteBufferSize are the sizes in bytes of each
+	// connection's I/O buffers. They do not limit message size. Zero uses
+	// the websocket package's default of 4096.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// HandshakeTimeout bounds the WebSocket handshake, for namespaces
+	// without an UpgradePolicy. Zero means no limit.
+	HandshakeTimeout time.Duration
+
+	// EnableCompression negotiates per-message compression with clients
+	// that support it, for namespaces without an UpgradePolicy.
+	EnableCompression bool
+
+	// CompressionThreshold is the size in bytes from which messages are
+	// compressed on connections that negotiated compression. Smaller ones,
+	// for which compressing costs more than it saves, are sent as is.
+	// Zero compresses every message.
+	CompressionThreshold int
+
+	// MaxMessageSize is the size in bytes of the largest message a client
+	// may send, after decompression. A client sending a larger one is
+	// closed with CloseMessageTooBig, and its disconnect hooks see
+	// ReasonMessageTooLarge and ErrMessageTooLarge. Namespaces can set
+	// their own with SetMaxMessageSize. Defaults to 512KiB; a negative
+	// value removes the limit.
+	MaxMessageSize int64
+
+	// WarmUp limits the rate of new connections for a while after the
+	// server starts serving. No limit applies by default.
+	WarmUp WarmUpPolicy
+
+	// SendQueueSize is how many messages may wait to be written to a
+	// client before further ones are dropped. Defaults to 256.
+	SendQueueSize int
+
+	// Codec encodes the messages exchanged with clients, in namespaces
+	// without a codec of their own; see Namespace.SetCodec. Defaults to
+	// JSONCodec.
+	Codec Codec
+
+	// GuestTTL limits how long a client may stay connected without a user
+	// identity. A guest is warned with EventGuestExpiring a minute before
+	// its time is up, or halfway through shorter sessions, and then
+	// disconnected with ReasonGuestExpired; Authenticate stops the clock
+	// and Deauthenticate restarts it. Zero lets guests stay indefinitely.
+	// A change applies to clients that connect or deauthenticate after it.
+	GuestTTL time.Duration
+
+	// NodeID identifies the server among the nodes sharing an adapter. It
+	// is sent to clients in the welcome and stamped on the messages the
+	// server publishes, so traffic can be attributed to the node it came
+	// from. Defaults to a random ID.
+	NodeID string
+
+	// DebugEvents makes Event.Data, Raw and Retain panic when called after
+	// the event's handler returned without retaining it, instead of
+	// quietly returning nil. Use it in tests and development to find
+	// handlers that keep events they don't own.
+	DebugEvents bool
+
+	// DebugEmits logs the outcome of every emit: how many local clients it
+	// was queued for or dropped by, whether it had no local recipients,
+	// and whether and where it was published through the adapter. It
+	// helps find out why a client did not get a message, at the price of
+	// a log line per emit.
+	DebugEmits bool
+
+	// MaxTracedClients caps the connections traced with TraceClient at
+	// once. Defaults to 16.
+	MaxTracedClients int
+
+	// TraceSink receives the records of connections traced with
+	// TraceClient. Records that do not fit in the channel are dropped
+	// rather than slowing the connection down. Without it records are
+	// logged.
+	TraceSink chan<- TraceRecord
+}
+
+const (
+	defaultMaxHandlerConcurrency = 4
+	defaultMaxPendingEvents      = 64
+	defaultWriteTimeout          = 10 * time.Second
+	defaultPingInterval          = 25 * time.Second
+	defaultPongWait              = 60 * time.Second
+	defaultMaxMessageSize        = 512 << 10
+	defaultMaxNamespaces         = 8
+
+	defaultAdapterFailures = 5
+	defaultAdapterWindow   = 10 * time.Second
+	defaultAdapterCooldown = 5 * time.Second
+)
+
+// Option configures a Server.
+type Option func(*Config)
+
+// WithHandlerWorkers runs event handlers on a pool of n goroutines instead
+// of on each client's read loop, so slow handlers don't stall reading.
+func WithHandlerWorkers(n int) Option {
+	return func(c *Config) { c.HandlerWorkers = n }
+}
+
+// WithHandlerConcurrency sets MaxHandlerConcurrency and MaxPendingEvents.
+func WithHandlerConcurrency(perClient, maxPending int) Option {
+	return func(c *Config) {
+		c.MaxHandlerConcurrency = perClient
+		c.MaxPendingEvents = maxPending
+	}
+}
+
+// WithMaxRoomsPerClient sets MaxRoomsPerClient.
+func WithMaxRoomsPerClient(n int) Option {
+	return func(c *Config) { c.MaxRoomsPerClient = n }
+}
+
+// WithMaxNamespacesPerConnection sets MaxNamespacesPerConnection.
+func WithMaxNamespacesPerConnection(n int) Option {
+	return func(c *Config) { c.MaxNamespacesPerConnection = n }
+}
+
+// WithNamespaceCreationRate sets NamespaceCreationRate.
+func WithNamespaceCreationRate(lim RateLimit) Option {
+	return func(c *Config) { c.NamespaceCreationRate = lim }
+}
+
+// WithNamespaceVeto sets VetoNamespace.
+func WithNamespaceVeto(veto func(name string, r *http.Request) error) Option {
+	return func(c *Config) { c.VetoNamespace = veto }
+}
+
+// WithWriteTimeout sets WriteTimeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(c *Config) { c.WriteTimeout = d }
+}
+
+// WithAdapterBreaker sets AdapterBreaker.
+func WithAdapterBreaker(cfg BreakerConfig) Option {
+	return func(c *Config) { c.AdapterBreaker = cfg }
+}
+
+// WithFairQueuing enables FairQueuing.
+func WithFairQueuing() Option {
+	return func(c *Config) { c.FairQueuing = true }
+}
+
+// WithIDGenerator sets IDGenerator.
+func WithIDGenerator(gen func() string) Option {
+	return func(c *Config) { c.IDGenerator = gen }
+}
+
+// WithRandSource sets Rand.
+func WithRandSource(r io.Reader) Option {
+	return func(c *Config) { c.Rand = r }
+}
+
+// WithHeartbeat sets PingInterval and PongWait.
+func WithHeartbeat(pingInterval, pongWait time.Duration) Option {
+	return func(c *Config) {
+		c.PingInterval = pingInterval
+		c.PongWait = pongWait
+	}
+}
+
+// WithCheckOrigin sets CheckOrigin.
+func WithCheckOrigin(check func(r *http.Request) bool) Option {
+	return func(c *Config) { c.CheckOrigin = check }
+}
+
+// WithBufferSizes sets ReadBufferSize and WriteBufferSize.
+func WithBufferSizes(read, write int) Option {
+	return func(c *Config) {
+		c.ReadBufferSize = read
+		c.WriteBufferSize = write
+	}
+}
+
+// WithHandshakeTimeout sets HandshakeTimeout.
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(c *Config) { c.HandshakeTimeout = d }
+}
+
+// WithCompression enables EnableCompression.
+func WithCompression() Option {
+	return func(c *Config) { c.EnableCompression = true }
+}
+
+// WithCompressionThreshold sets CompressionThreshold.
+func WithCompressionThreshold(n int) Option {
+	return func(c *Config) { c.CompressionThreshold = n }
+}
+
+// WithMaxMessageSize sets MaxMessageSize.
+func WithMaxMessageSize(n int64) Option {
+	return func(c *Config) { c.MaxMessageSize = n }
+}
+
+// WithSendQueueSize sets SendQueueSize.
+func WithSendQueueSize(n int) Option {
+	return func(c *Config) { c.SendQueueSize = n }
+}
+
+// WithNodeID sets NodeID.
+func WithNodeID(id string) Option {
+	return func(c *Config) { c.NodeID = id }
+}
+
+// WithDebugEvents enables DebugEvents.
+func WithDebugEvents() Option {
+	return func(c *Config) { c.DebugEvents = true }
+}
+
+// WithDebugEmits enables DebugEmits.
+func WithDebugEmits() Option {
+	return func(c *Config) { c.DebugEmits = true }
+}
+
+// WithWatchdog enables the write watchdog with the given StallTimeout.
+func WithWatchdog(stall time.Duration) Option {
+	return func(c *Config) { c.StallTimeout = stall }
+}
+
+// ErrInvalidConfig is returned by NewServerWithOptions for settings out of
+// range.
+var ErrInvalidConfig = errors.New("sockx: invalid config")
+
+// validate rejects settings that setDefaults would otherwise replace
+// silently.
+func (c *Config) validate() error {
+	switch {
+	case c.ReadBufferSize < 0:
+		return fmt.Errorf("%w: negative ReadBufferSize %d", ErrInvalidConfig, c.ReadBufferSize)
+	case c.WriteBufferSize < 0:
+		return fmt.Errorf("%w: negative WriteBufferSize %d", ErrInvalidConfig, c.WriteBufferSize)
+	case c.HandshakeTimeout < 0:
+		return fmt.Errorf("%w: negative HandshakeTimeout %v", ErrInvalidConfig, c.HandshakeTimeout)
+	case c.CompressionThreshold < 0:
+		return fmt.Errorf("%w: negative CompressionThreshold %d", ErrInvalidConfig, c.CompressionThreshold)
+	case c.SendQueueSize < 0:
+		return fmt.Errorf("%w: negative SendQueueSize %d", ErrInvalidConfig, c.SendQueueSize)
+	case c.MaxRoomsPerClient < 0:
+		return fmt.Errorf("%w: negative MaxRoomsPerClient %d", ErrInvalidConfig, c.MaxRoomsPerClient)
+	case c.WriteTimeout < 0:
+		return fmt.Errorf("%w: negative WriteTimeout %v", ErrInvalidConfig, c.WriteTimeout)
+	case c.PongWait < 0:
+		return fmt.Errorf("%w: negative PongWait %v", ErrInvalidConfig, c.PongWait)
+	case c.StallTimeout < 0:
+		return fmt.Errorf("%w: negative StallTimeout %v", ErrInvalidConfig, c.StallTimeout)
+	case c.GuestTTL < 0:
+		return fmt.Errorf("%w: negative GuestTTL %v", ErrInvalidConfig, c.GuestTTL)
+	}
+	return c.RateLimits.validate()
+}
+
+func (c *Config) setDefaults() {
+	if c.MaxHandlerConcurrency <= 0 {
+		c.MaxHandlerConcurrency = defaultMaxHandlerConcurrency
+	}
+	if c.MaxPendingEvents <= 0 {
+		c.MaxPendingEvents = defaultMaxPendingEvents
+	}
+	if c.MaxNamespacesPerConnection == 0 {
+		c.MaxNamespacesPerConnection = defaultMaxNamespaces
+	}
+	if c.MaxTracedClients <= 0 {
+		c.MaxTracedClients = defaultMaxTracedClients
+	}
+	if c.MaxMessageSize == 0 {
+		c.MaxMessageSize = defaultMaxMessageSize
+	}
+	if c.SendQueueSize == 0 {
+		c.SendQueueSize = defaultSendQueueSize
+	}
+	if c.Codec == nil {
+		c.Codec = JSONCodec{}
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = defaultWriteTimeout
+	}
+	if c.PingInterval == 0 {
+		c.PingInterval = defaultPingInterval
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = defaultPongWait
+	}
+	if c.Backoff == (BackoffPolicy{}) {
+		c.Backoff = DefaultBackoffPolicy
+	}
+	if c.Rand == nil {
+		c.Rand = rand.Reader
+	}
+	if c.AdapterBreaker.Failures == 0 {
+		c.AdapterBreaker.Failures = defaultAdapterFailures
+	}
+	if c.AdapterBreaker.Window <= 0 {
+		c.AdapterBreaker.Window = defaultAdapterWindow
+	}
+	if c.AdapterBreaker.Cooldown <= 0 {
+		c.AdapterBreaker.Cooldown = defaultAdapterCooldown
+	}
+}
+
+// UpdateConfig applies fn to a copy of the server's configuration and
+// installs the result atomically. Fields that are fixed by NewServer keep
+// their values whatever fn does to them. If a setting is out of range, an
+// error wrapping ErrInvalidConfig is returned and the configuration is
+// left unchanged.
+func (s *Server) UpdateConfig(fn func(c *Config)) error {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	old := s.cfg()
+	cfg := *old
+	cfg.TrustedProxies = append([]netip.Prefix(nil), old.TrustedProxies...)
+	cfg.RateLimits.PerEvent = copyLimits(old.RateLimits.PerEvent)
+	cfg.Labels = copyLabels(old.Labels)
+	fn(&cfg)
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	cfg.setDefaults()
+	cfg.HandlerWorkers = old.HandlerWorkers
+	cfg.RateLimiter = old.RateLimiter
+	cfg.Backoff = old.Backoff
+	cfg.Adapter = old.Adapter
+	cfg.Rand = old.Rand
+	cfg.NodeID = old.NodeID
+	cfg.CheckOrigin = old.CheckOrigin
+	cfg.ReadBufferSize, cfg.WriteBufferSize = old.ReadBufferSize, old.WriteBufferSize
+	cfg.HandshakeTimeout = old.HandshakeTimeout
+	cfg.EnableCompression = old.EnableCompression
+	cfg.SendQueueSize = old.SendQueueSize
+	cfg.Codec = old.Codec
+	cfg.WarmUp = old.WarmUp
+	s.config.Store(&cfg)
+	return nil
+}
+
+// cfg returns the server's current configuration, which must not be
+// modified.
+func (s *Server) cfg() *Config { return s.config.Load() }
+
+func copyLimits(m map[string]RateLimit) map[string]RateLimit {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]RateLimit, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyLabels(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
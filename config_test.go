@@ -0,0 +1,131 @@
+package sockx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// errorCode returns the code of an EventError message.
+func errorCode(t testing.TB, msg Message) string {
+	t.Helper()
+	var e ErrorData
+	if err := msg.Bind(&e); err != nil {
+		t.Fatalf("binding error data: %v", err)
+	}
+	return e.Code
+}
+
+func TestUpdateConfigTightensRateLimitOfLiveConnection(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	handled := make(chan struct{}, 16)
+	ns.On("ping", func(c *Client, data interface{}) { handled <- struct{}{} })
+	tc := dial(t, s, "/")
+
+	for i := 0; i < 5; i++ {
+		tc.emit("ping", i)
+		<-handled
+	}
+	err := s.UpdateConfig(func(c *Config) {
+		c.RateLimits.Events = RateLimit{Rate: 0.001, Burst: 1}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.emit("ping", "allowed")
+	tc.emit("ping", "limited")
+	if code := errorCode(t, tc.expect(EventError)); code != ErrCodeRateLimited {
+		t.Fatalf("error code = %s, want %s", code, ErrCodeRateLimited)
+	}
+	if len(handled) != 1 {
+		t.Fatalf("%d events handled after the limit tightened, want 1", len(handled))
+	}
+}
+
+func TestUpdateConfigMaxMessageSizeAppliesToLiveConnection(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	reasons := make(chan DisconnectReason, 1)
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind == LifecycleDisconnect {
+			reasons <- ev.DisconnectReason
+		}
+	})
+	tc := dial(t, s, "/")
+	tc.emit("big", strings.Repeat("x", 1024))
+
+	if err := s.UpdateConfig(func(c *Config) { c.MaxMessageSize = 256 }); err != nil {
+		t.Fatal(err)
+	}
+	// The read loop applies the limit before reading the message after
+	// the one it is waiting for.
+	tc.emit("small", "x")
+	tc.emit("big", strings.Repeat("x", 1024))
+	_, err := tc.next(testTimeout)
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("read after oversized message = %v, want CloseMessageTooBig", err)
+	}
+	select {
+	case r := <-reasons:
+		if r != ReasonMessageTooLarge {
+			t.Errorf("disconnect reason = %v, want %v", r, ReasonMessageTooLarge)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("no disconnect")
+	}
+}
+
+func TestUpdateConfigPingIntervalAppliesToLiveConnection(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	tc := dial(t, s, "/")
+	pinged := make(chan struct{}, 1)
+	tc.conn.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	if err := s.UpdateConfig(func(c *Config) { c.PingInterval = 20 * time.Millisecond }); err != nil {
+		t.Fatal(err)
+	}
+	// The writer picks the new interval up when it next wakes.
+	ns.Emit("wake", nil)
+	deadline := time.Now().Add(testTimeout)
+	for {
+		tc.next(50 * time.Millisecond)
+		select {
+		case <-pinged:
+			return
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no ping at the new interval")
+		}
+	}
+}
+
+func TestUpdateConfigRejectsInvalidSettings(t *testing.T) {
+	s := newTestServer(t, WithWriteTimeout(time.Second))
+	for name, fn := range map[string]func(*Config){
+		"WriteTimeout": func(c *Config) { c.WriteTimeout = -time.Second },
+		"PongWait":     func(c *Config) { c.PongWait = -time.Second },
+		"RateLimits":   func(c *Config) { c.RateLimits.PerEvent = map[string]RateLimit{"chat": {Rate: -1}} },
+	} {
+		if err := s.UpdateConfig(fn); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: UpdateConfig = %v, want ErrInvalidConfig", name, err)
+		}
+	}
+	if got := s.cfg().WriteTimeout; got != time.Second {
+		t.Errorf("WriteTimeout after rejected update = %v, want 1s", got)
+	}
+	if len(s.cfg().RateLimits.PerEvent) != 0 {
+		t.Error("rejected rate limits installed")
+	}
+}
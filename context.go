@@ -0,0 +1,45 @@
+package sockx
+
+import "context"
+
+// Context returns the client's context, for work started on the client's
+// behalf, such as subscriptions or database watches, to end when it
+// disconnects: it is cancelled once the client's disconnect hooks have
+// run. It derives from the handshake request's context, or for a client
+// added with EventConnect from its connection's client's, and carries the
+// values connection middleware added with WithContext.
+func (c *Client) Context() context.Context {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ctx
+}
+
+// WithContext replaces the client's context with ctx, typically derived
+// from Context by connection middleware to carry values such as the
+// authenticated user. The new context is cancelled when the client
+// disconnects like the one it replaces, which is cancelled then too, and
+// right away if the client has disconnected already.
+func (c *Client) WithContext(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.ctx = ctx
+	if c.ctxDone {
+		c.mu.Unlock()
+		cancel()
+		return
+	}
+	c.cancels = append(c.cancels, cancel)
+	c.mu.Unlock()
+}
+
+// cancelContext cancels the client's context and those it replaced.
+func (c *Client) cancelContext() {
+	c.mu.Lock()
+	cancels := c.cancels
+	c.cancels = nil
+	c.ctxDone = true
+	c.mu.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
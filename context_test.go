@@ -0,0 +1,63 @@
+package sockx
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type tenantKey struct{}
+
+func TestClientContextEndsWithClient(t *testing.T) {
+	s := newTestServer(t)
+	var mu sync.Mutex
+	var replaced []context.Context
+	live := make(chan bool, 2)
+	for _, name := range []string{"/", "/b"} {
+		ns := s.Of(name)
+		ns.Use(func(c *Client, r *http.Request) error {
+			mu.Lock()
+			replaced = append(replaced, c.Context())
+			mu.Unlock()
+			c.WithContext(context.WithValue(c.Context(), tenantKey{}, "acme"))
+			return nil
+		})
+		ns.On("tenant", func(c *Client, data interface{}) { c.Emit("tenant", c.Context().Value(tenantKey{})) })
+		ns.OnDisconnect(func(c *Client, reason DisconnectReason) { live <- c.Context().Err() == nil })
+	}
+	tc := dial(t, s, "/")
+	c, sub := tc.client(s.Of("/")), s.Of("/b").Client(tc.connectNamespace("/b"))
+
+	for _, name := range []string{"/", "/b"} {
+		tc.send(Message{Namespace: name, Event: "tenant"})
+		var got string
+		if err := tc.expect("tenant").Bind(&got); err != nil || got != "acme" {
+			t.Fatalf("tenant in %s = %q (%v), want acme", name, got, err)
+		}
+	}
+
+	tc.conn.Close()
+	for i := 0; i < 2; i++ {
+		if !<-live {
+			t.Fatal("context cancelled before the disconnect hooks ran")
+		}
+	}
+	mu.Lock()
+	ctxs := append(replaced, c.Context(), sub.Context())
+	mu.Unlock()
+	for _, ctx := range ctxs {
+		select {
+		case <-ctx.Done():
+		case <-time.After(testTimeout):
+			t.Fatal("client context not cancelled on disconnect")
+		}
+	}
+
+	// A context set after the client disconnected is cancelled at once.
+	c.WithContext(context.Background())
+	if c.Context().Err() == nil {
+		t.Fatal("context set after disconnecting not cancelled")
+	}
+}
@@ -0,0 +1,39 @@
+package sockx
+
+import "context"
+
+// correlationKey is the context key of a correlation ID.
+type correlationKey struct{}
+
+// Correlation stamps the message with id in its Correlation field, so that
+// clients, hooks, debug logs and traces can tie it to the request that
+// caused it, such as the HTTP API call whose change it announces. It is
+// carried through the adapter to the other nodes. An empty id leaves the
+// field out of the message.
+func Correlation(id string) EmitOption {
+	return func(o *emitOptions) { o.correlation = id }
+}
+
+// ContextWithCorrelation returns a copy of ctx carrying the correlation ID
+// id, typically set by HTTP middleware from the request's ID, for
+// CorrelationFromContext to find deep in a service.
+func ContextWithCorrelation(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationFromContext returns the Correlation option for the
+// correlation ID ctx carries, which leaves messages unstamped if it
+// carries none:
+//
+//	ns.EmitTo(room, "order-updated", order, sockx.CorrelationFromContext(r.Context()))
+func CorrelationFromContext(ctx context.Context) EmitOption {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return Correlation(id)
+}
+
+// correlate stamps msg with the option's correlation ID, if any.
+func (o emitOptions) correlate(msg *Message) {
+	if o.correlation != "" {
+		msg.Correlation = o.correlation
+	}
+}
@@ -0,0 +1,53 @@
+package sockx
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCorrelationReachesLocalAndRemoteClients(t *testing.T) {
+	for name, emit := range map[string]func(ns *Namespace, opt EmitOption) error{
+		"Emit": func(ns *Namespace, opt EmitOption) error {
+			_, err := ns.Emit("order-updated", 1, opt)
+			return err
+		},
+		"EmitAsync": func(ns *Namespace, opt EmitOption) error {
+			_, err := ns.EmitAsync("order-updated", 1, opt).Wait(context.Background())
+			return err
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bus := NewMemoryBus()
+			a := newTestServer(t, WithAdapter(bus.Adapter()))
+			b := newTestServer(t, WithAdapter(bus.Adapter()))
+			local := dial(t, a, "/")
+			remote := dial(t, b, "/")
+
+			ctx := ContextWithCorrelation(context.Background(), "req-42")
+			if err := emit(a.Of("/"), CorrelationFromContext(ctx)); err != nil {
+				t.Fatal(err)
+			}
+			for where, tc := range map[string]*testConn{"local": local, "remote": remote} {
+				if got := tc.expect("order-updated").Correlation; got != "req-42" {
+					t.Errorf("%s client got correlation %q, want req-42", where, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRoomEmitAsyncIsTrackedForReceipts(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	tc := dial(t, s, "/")
+	ns.Client(tc.welcome.ID).Join("r")
+	ns.EnableReceipts("r", ReceiptOptions{})
+	ns.Room("r").EmitAsync("msg", nil)
+	id := tc.expect("msg").ID
+	if id == "" {
+		t.Fatal("room message with receipts enabled has no ID")
+	}
+	if _, ok := ns.Room("r").Receipts(id); !ok {
+		t.Fatal("message not tracked for receipts")
+	}
+}
@@ -0,0 +1,244 @@
+package sockx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxUnknownEvents caps the names of unhandled events coverage tracking
+// counts, so that clients sending made-up names cannot grow it without
+// bound.
+const maxUnknownEvents = 256
+
+// eventCoverage counts a namespace's events while coverage tracking is
+// enabled.
+type eventCoverage struct {
+	since time.Time
+
+	mu      sync.RWMutex
+	handled map[string]*eventCounter
+	unknown map[string]*eventCounter
+
+	// unknownDropped counts the unhandled events whose names were not
+	// counted because maxUnknownEvents were counted already.
+	unknownDropped atomic.Int64
+}
+
+// eventCounter counts an event and records when it was last seen, in
+// UnixNano.
+type eventCounter struct {
+	n    atomic.Int64
+	last atomic.Int64
+}
+
+// EventCount is how often an event was received.
+type EventCount struct {
+	Event string
+	Count int64
+	Last  time.Time
+}
+
+// EventCoverage reports which of a namespace's events clients use; see
+// Namespace.TrackCoverage. Handled lists the events with a handler
+// registered, by name, including those never received; Unknown lists the
+// events received without a handler, the most frequent first.
+// UnknownDropped counts unhandled events not listed because 256 names were
+// counted already.
+type EventCoverage struct {
+	Since          time.Time
+	Handled        []EventCount
+	Unknown        []EventCount
+	UnknownDropped int64
+}
+
+// TrackCoverage starts or stops counting the namespace's events by name:
+// how often each event with a handler was handled, and how often clients
+// sent events nobody handles, up to 256 names. Use EventCoverage or
+// ReportUnused to find handlers that no client exercises anymore and
+// client events that no handler serves. Starting tracking again restarts
+// the counts; namespaces not tracking pay for it with an atomic load per
+// event.
+func (ns *Namespace) TrackCoverage(enabled bool) {
+	if !enabled {
+		ns.coverage.Store(nil)
+		return
+	}
+	ns.coverage.Store(&eventCoverage{
+		since:   time.Now(),
+		handled: make(map[string]*eventCounter),
+		unknown: make(map[string]*eventCounter),
+	})
+}
+
+// countEvent counts an event received in the namespace, handled or not.
+func (ns *Namespace) countEvent(event string, handled bool) {
+	cov := ns.coverage.Load()
+	if cov == nil {
+		return
+	}
+	counts := cov.unknown
+	if handled {
+		counts = cov.handled
+	}
+	cov.mu.RLock()
+	ctr := counts[event]
+	cov.mu.RUnlock()
+	if ctr == nil {
+		cov.mu.Lock()
+		if ctr = counts[event]; ctr == nil {
+			if !handled && len(counts) >= maxUnknownEvents {
+				cov.mu.Unlock()
+				cov.unknownDropped.Add(1)
+				return
+			}
+			ctr = &eventCounter{}
+			counts[event] = ctr
+		}
+		cov.mu.Unlock()
+	}
+	ctr.n.Add(1)
+	ctr.last.Store(time.Now().UnixNano())
+}
+
+// EventCoverage returns the namespace's event counts since TrackCoverage
+// started them, or the zero EventCoverage if it is not tracking.
+func (ns *Namespace) EventCoverage() EventCoverage {
+	cov := ns.coverage.Load()
+	if cov == nil {
+		return EventCoverage{}
+	}
+	t := ns.handlers.Load()
+	out := EventCoverage{
+		Since:          cov.since,
+		Handled:        make([]EventCount, 0, len(t.byEvent)),
+		UnknownDropped: cov.unknownDropped.Load(),
+	}
+	cov.mu.RLock()
+	for event := range t.byEvent {
+		out.Handled = append(out.Handled, cov.handled[event].count(event))
+	}
+	for event, ctr := range cov.unknown {
+		out.Unknown = append(out.Unknown, ctr.count(event))
+	}
+	cov.mu.RUnlock()
+	sort.Slice(out.Handled, func(i, j int) bool { return out.Handled[i].Event < out.Handled[j].Event })
+	sort.Slice(out.Unknown, func(i, j int) bool {
+		a, b := out.Unknown[i], out.Unknown[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Event < b.Event
+	})
+	return out
+}
+
+// count returns the counts of event, which ctr counts, if ctr is not nil.
+func (ctr *eventCounter) count(event string) EventCount {
+	ec := EventCount{Event: event}
+	if ctr == nil {
+		return ec
+	}
+	ec.Count = ctr.n.Load()
+	if last := ctr.last.Load(); last != 0 {
+		ec.Last = time.Unix(0, last)
+	}
+	return ec
+}
+
+// ReportUnused summarizes ns's event coverage in a line for periodic
+// logging: the events with a handler that were not handled in the last
+// since, and the events without one received in that time. It returns ""
+// if there are none, or if ns is not tracking coverage.
+//
+//	if r := sockx.ReportUnused(ns, 24*time.Hour); r != "" {
+//		log.Print(r)
+//	}
+func ReportUnused(ns *Namespace, since time.Duration) string {
+	cov := ns.EventCoverage()
+	if cov.Since.IsZero() {
+		return ""
+	}
+	cutoff := time.Now().Add(-since)
+	var unused, unknown []string
+	for _, ec := range cov.Handled {
+		switch {
+		case ec.Last.IsZero():
+			unused = append(unused, ec.Event+" (never)")
+		case ec.Last.Before(cutoff):
+			unused = append(unused, fmt.Sprintf("%s (last %s ago)", ec.Event, time.Since(ec.Last).Round(time.Second)))
+		}
+	}
+	for _, ec := range cov.Unknown {
+		if !ec.Last.Before(cutoff) {
+			unknown = append(unknown, fmt.Sprintf("%s (%d times)", ec.Event, ec.Count))
+		}
+	}
+	if len(unused) == 0 && len(unknown) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "sockx: namespace %s, events since %s:", ns.name, cov.Since.Format(time.RFC3339))
+	if len(unused) > 0 {
+		fmt.Fprintf(&b, " %d unused: %s;", len(unused), strings.Join(unused, ", "))
+	}
+	if len(unknown) > 0 {
+		fmt.Fprintf(&b, " %d unhandled: %s;", len(unknown), strings.Join(unknown, ", "))
+	}
+	if cov.UnknownDropped > 0 {
+		fmt.Fprintf(&b, " %d more unhandled not counted;", cov.UnknownDropped)
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+// CoverageHandler returns an HTTP handler reporting, as JSON, the event
+// coverage of the server's namespaces that track it, by namespace name.
+func (s *Server) CoverageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out := make(map[string]coverageReport)
+		for _, ns := range s.namespaceList() {
+			if ns.coverage.Load() == nil {
+				continue
+			}
+			cov := ns.EventCoverage()
+			out[ns.name] = coverageReport{
+				Since:          cov.Since,
+				Handled:        eventCountReports(cov.Handled),
+				Unknown:        eventCountReports(cov.Unknown),
+				UnknownDropped: cov.UnknownDropped,
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+}
+
+type coverageReport struct {
+	Since          time.Time          `json:"since"`
+	Handled        []eventCountReport `json:"handled"`
+	Unknown        []eventCountReport `json:"unknown"`
+	UnknownDropped int64              `json:"unknownDropped,omitempty"`
+}
+
+type eventCountReport struct {
+	Event string     `json:"event"`
+	Count int64      `json:"count"`
+	Last  *time.Time `json:"last,omitempty"`
+}
+
+func eventCountReports(counts []EventCount) []eventCountReport {
+	out := make([]eventCountReport, len(counts))
+	for i, ec := range counts {
+		out[i] = eventCountReport{Event: ec.Event, Count: ec.Count}
+		if !ec.Last.IsZero() {
+			last := ec.Last
+			out[i].Last = &last
+		}
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package sockx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventCoverage(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	for _, event := range []string{"chat", "typing", "old"} {
+		ns.On(event, func(c *Client, data interface{}) {})
+	}
+	s.Of("/other").On("chat", func(c *Client, data interface{}) {})
+	ns.TrackCoverage(true)
+	tc := dial(t, s, "/")
+	for _, event := range []string{"chat", "bogus", "typing", "chat", "bogus", "junk", "bogus"} {
+		tc.emit(event, nil)
+	}
+	waitFor(t, "the events to be counted", func() bool {
+		var n int64
+		cov := ns.EventCoverage()
+		for _, ec := range append(cov.Handled, cov.Unknown...) {
+			n += ec.Count
+		}
+		return n == 7
+	})
+
+	cov := ns.EventCoverage()
+	var got []string
+	for _, ec := range append(cov.Handled, cov.Unknown...) {
+		got = append(got, fmt.Sprintf("%s %d %v", ec.Event, ec.Count, ec.Last.IsZero()))
+	}
+	if want := "[chat 2 false old 0 true typing 1 false bogus 3 false junk 1 false]"; fmt.Sprint(got) != want {
+		t.Fatalf("coverage %v, want %s", got, want)
+	}
+	report := ReportUnused(ns, time.Hour)
+	if want := "1 unused: old (never); 2 unhandled: bogus (3 times), junk (1 times)"; !strings.HasSuffix(report, want) {
+		t.Fatalf("ReportUnused = %q, want it to end in %q", report, want)
+	}
+
+	for i := 0; i < maxUnknownEvents; i++ {
+		ns.countEvent(fmt.Sprint("made-up-", i), false)
+	}
+	if cov := ns.EventCoverage(); len(cov.Unknown) != maxUnknownEvents || cov.UnknownDropped != 2 {
+		t.Fatalf("counted %d unknown names and dropped %d, want %d and 2", len(cov.Unknown), cov.UnknownDropped, maxUnknownEvents)
+	}
+
+	rec := httptest.NewRecorder()
+	s.CoverageHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/coverage", nil))
+	var byNamespace map[string]coverageReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &byNamespace); err != nil {
+		t.Fatal(err)
+	}
+	if len(byNamespace) != 1 || len(byNamespace["/"].Handled) != 3 || byNamespace["/"].UnknownDropped != 2 {
+		t.Fatalf("coverage handler served %s", rec.Body)
+	}
+
+	ns.TrackCoverage(false)
+	if cov := ns.EventCoverage(); !cov.Since.IsZero() || ReportUnused(ns, time.Hour) != "" {
+		t.Fatalf("coverage after tracking stopped: %+v", cov)
+	}
+}
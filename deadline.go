@@ -0,0 +1,111 @@
+package sockx
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// deadlineQueue runs callbacks at their deadlines. The pending deadlines
+// are kept in a heap served by a single timer, so that thousands of them,
+// such as guest sessions or ephemeral flags, cost no goroutine each.
+type deadlineQueue struct {
+	mu    sync.Mutex
+	heap  deadlineHeap
+	timer *time.Timer
+}
+
+// deadline is a callback in a deadlineQueue. fire runs on the queue's
+// timer goroutine, without the queue's lock, and must not block for long.
+type deadline struct {
+	at    time.Time
+	fire  func()
+	index int // in the heap, or -1 when not pending
+}
+
+func newDeadline(fire func()) *deadline {
+	return &deadline{fire: fire, index: -1}
+}
+
+// schedule makes d fire at at, whether or not it is already pending.
+func (q *deadlineQueue) schedule(d *deadline, at time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d.at = at
+	if d.index >= 0 {
+		heap.Fix(&q.heap, d.index)
+	} else {
+		heap.Push(&q.heap, d)
+	}
+	q.armLocked(time.Now())
+}
+
+// cancel stops d from firing, if it is pending.
+func (q *deadlineQueue) cancel(d *deadline) {
+	if d == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if d.index >= 0 {
+		heap.Remove(&q.heap, d.index)
+	}
+}
+
+// pending returns the number of pending deadlines.
+func (q *deadlineQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.heap)
+}
+
+// armLocked sets the timer for the earliest deadline.
+func (q *deadlineQueue) armLocked(now time.Time) {
+	if len(q.heap) == 0 {
+		return
+	}
+	d := q.heap[0].at.Sub(now)
+	if q.timer == nil {
+		q.timer = time.AfterFunc(d, q.run)
+	} else {
+		q.timer.Reset(d)
+	}
+}
+
+// run fires the deadlines that are due.
+func (q *deadlineQueue) run() {
+	now := time.Now()
+	q.mu.Lock()
+	var due []*deadline
+	for len(q.heap) > 0 && !q.heap[0].at.After(now) {
+		due = append(due, heap.Pop(&q.heap).(*deadline))
+	}
+	q.armLocked(now)
+	q.mu.Unlock()
+
+	for _, d := range due {
+		d.fire()
+	}
+}
+
+type deadlineHeap []*deadline
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *deadlineHeap) Push(x interface{}) {
+	d := x.(*deadline)
+	d.index = len(*h)
+	*h = append(*h, d)
+}
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	d := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	d.index = -1
+	return d
+}
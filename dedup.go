@@ -0,0 +1,183 @@
+package sockx
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxDedupIDs caps the message IDs remembered per user or session.
+	maxDedupIDs = 256
+
+	// dedupSweepInterval is how often expired IDs are swept from every
+	// user and session.
+	dedupSweepInterval = 10 * time.Second
+)
+
+// HandlerOption customizes a handler registered with On or OnEvent.
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	idempotent  time.Duration
+	serializeBy func(*Client, interface{}) string
+}
+
+// Idempotent makes the handler run at most once per message ID within
+// window. Clients that may resend an event, for example after
+// reconnecting, set Message.ID; a repeat of an ID already seen is not
+// dispatched, and if the original was acknowledged with Event.Ack the
+// acknowledgement is sent again. IDs are remembered per user for
+// authenticated clients, per resumable session otherwise, and per
+// connection when the namespace has no resumption, so they survive
+// reconnects wherever the client can be recognized. At most 256 IDs are
+// remembered for each, and they are forgotten after window or when the
+// session expires. Events without an ID are always dispatched.
+func Idempotent(window time.Duration) HandlerOption {
+	return func(o *handlerOptions) { o.idempotent = window }
+}
+
+// dedupCache remembers the IDs of events dispatched to Idempotent
+// handlers.
+type dedupCache struct {
+	mu        sync.Mutex
+	sets      map[string]*dedupSet
+	lastSweep time.Time
+}
+
+// dedupSet holds the IDs seen from one user, session or connection, in
+// the order they were first seen.
+type dedupSet struct {
+	byID  map[string]*dedupEntry
+	order []*dedupEntry
+}
+
+type dedupEntry struct {
+	id      string
+	expires time.Time
+	acked   bool
+	ack     interface{}
+	cache   *dedupCache
+}
+
+// see records id for key. It returns the entry for id and whether id had
+// already been seen within its window.
+func (d *dedupCache) see(key, id string, window time.Duration, now time.Time) (e *dedupEntry, dup bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.lastSweep) >= dedupSweepInterval {
+		d.sweepLocked(now)
+	}
+	if d.sets == nil {
+		d.sets = make(map[string]*dedupSet)
+	}
+	set := d.sets[key]
+	if set == nil {
+		set = &dedupSet{byID: make(map[string]*dedupEntry)}
+		d.sets[key] = set
+	}
+	if e := set.byID[id]; e != nil && now.Before(e.expires) {
+		return e, true
+	}
+	if len(set.order) >= maxDedupIDs {
+		set.prune(now)
+		if len(set.order) >= maxDedupIDs {
+			oldest := set.order[0]
+			set.order = set.order[1:]
+			delete(set.byID, oldest.id)
+		}
+	}
+	e = &dedupEntry{id: id, expires: now.Add(window), cache: d}
+	set.byID[id] = e
+	set.order = append(set.order, e)
+	return e, false
+}
+
+// sweepLocked drops expired IDs, and sets left empty, from every key.
+func (d *dedupCache) sweepLocked(now time.Time) {
+	d.lastSweep = now
+	for key, set := range d.sets {
+		if set.prune(now); len(set.order) == 0 {
+			delete(d.sets, key)
+		}
+	}
+}
+
+// prune drops the set's expired IDs.
+func (s *dedupSet) prune(now time.Time) {
+	kept := s.order[:0]
+	for _, e := range s.order {
+		if now.Before(e.expires) {
+			kept = append(kept, e)
+		} else if s.byID[e.id] == e {
+			delete(s.byID, e.id)
+		}
+	}
+	for i := len(kept); i < len(s.order); i++ {
+		s.order[i] = nil
+	}
+	s.order = kept
+}
+
+// forget drops everything remembered for key.
+func (d *dedupCache) forget(key string) {
+	d.mu.Lock()
+	delete(d.sets, key)
+	d.mu.Unlock()
+}
+
+// recordAck remembers the acknowledgement sent for e's event.
+func (e *dedupEntry) recordAck(data interface{}) {
+	e.cache.mu.Lock()
+	e.acked, e.ack = true, data
+	e.cache.mu.Unlock()
+}
+
+// recordedAck returns the acknowledgement recorded for e's event, if any.
+func (e *dedupEntry) recordedAck() (interface{}, bool) {
+	e.cache.mu.Lock()
+	defer e.cache.mu.Unlock()
+	return e.ack, e.acked
+}
+
+// idempotent wraps h so that events repeating a message ID seen within
+// window are not dispatched again.
+func (ns *Namespace) idempotent(window time.Duration, h EventFunc) EventFunc {
+	return func(ev *Event) {
+		if ev.msg.ID == "" {
+			h(ev)
+			return
+		}
+		e, dup := ns.dedup.see(ev.client.dedupKey(), ev.msg.ID, window, time.Now())
+		if dup {
+			if data, ok := e.recordedAck(); ok && ev.msg.Ack != 0 {
+				ev.client.sendAck(ev.msg.Ack, data)
+			}
+			return
+		}
+		ev.seen = e
+		h(ev)
+	}
+}
+
+// dedupKey identifies the client for Idempotent handlers: by user when
+// authenticated, by resume token when the namespace has resumption, and
+// by connection otherwise.
+func (c *Client) dedupKey() string {
+	if uid := c.UserID(); uid != "" {
+		return "user:" + uid
+	}
+	if c.resumeToken != "" {
+		return "session:" + c.resumeToken
+	}
+	return "conn:" + c.id
+}
+
+// releaseDedup forgets the IDs of a disconnected client that can no longer
+// be recognized. IDs of users expire on their own, and those of a saved
+// session when it does.
+func (ns *Namespace) releaseDedup(c *Client, sessionSaved bool) {
+	if c.UserID() != "" || sessionSaved {
+		return
+	}
+	ns.dedup.forget(c.dedupKey())
+}
@@ -0,0 +1,123 @@
+package sockx
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// orderServer serves namespace / with an Idempotent "order" handler
+// counting its runs and acknowledging each with the run number. Clients
+// sign in as their "user" query parameter, if any.
+func orderServer(t *testing.T, window time.Duration) (string, *atomic.Int64) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.OnConnect(func(c *Client) {
+		if user := c.Request().URL.Query().Get("user"); user != "" {
+			c.Authenticate(user, nil)
+		}
+	})
+	var runs atomic.Int64
+	ns.OnEvent("order", func(ev *Event) { ev.Ack(runs.Add(1)) }, Idempotent(window))
+	return serve(t, s, "/"), &runs
+}
+
+// order sends an order with message ID id and returns the acknowledgement.
+func (tc *testConn) order(id string, ack uint64) interface{} {
+	tc.t.Helper()
+	tc.send(Message{Event: "order", ID: id, Ack: ack})
+	msg := tc.expect(EventAck)
+	if msg.Ack != ack {
+		tc.t.Fatalf("ack for %d, want %d", msg.Ack, ack)
+	}
+	return msg.Data
+}
+
+func TestIdempotentHandlerRunsOncePerID(t *testing.T) {
+	url, runs := orderServer(t, time.Minute)
+	tc := dialURL(t, url, nil)
+
+	if got := tc.order("m1", 1); got != 1.0 {
+		t.Fatalf("first ack = %v, want 1", got)
+	}
+	if got := tc.order("m1", 2); got != 1.0 {
+		t.Fatalf("ack of the repeat = %v, want the remembered 1", got)
+	}
+	if got := tc.order("m2", 3); got != 2.0 {
+		t.Fatalf("ack of a new ID = %v, want 2", got)
+	}
+	if got := tc.order("", 4); got != 3.0 {
+		t.Fatalf("ack without an ID = %v, want 3", got)
+	}
+	if got := tc.order("", 5); got != 4.0 {
+		t.Fatalf("ack of a second event without an ID = %v, want 4", got)
+	}
+	if n := runs.Load(); n != 4 {
+		t.Fatalf("handler ran %d times, want 4", n)
+	}
+}
+
+func TestIdempotentWindowExpires(t *testing.T) {
+	const window = 30 * time.Millisecond
+	url, runs := orderServer(t, window)
+	tc := dialURL(t, url, nil)
+	tc.order("m1", 1)
+	time.Sleep(window)
+	if got := tc.order("m1", 2); got != 2.0 {
+		t.Fatalf("ack after the window = %v, want a second run", got)
+	}
+	if n := runs.Load(); n != 2 {
+		t.Fatalf("handler ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotentIDsSurviveReconnectOfUser(t *testing.T) {
+	url, runs := orderServer(t, time.Minute)
+	first := dialURL(t, url+"?user=alice", nil)
+	first.order("m1", 1)
+	first.conn.Close()
+
+	second := dialURL(t, url+"?user=alice", nil)
+	if got := second.order("m1", 2); got != 1.0 {
+		t.Fatalf("ack of the resent order = %v, want the remembered 1", got)
+	}
+	// Anonymous connections are told apart by connection.
+	other := dialURL(t, url, nil)
+	if got := other.order("m1", 3); got != 2.0 {
+		t.Fatalf("ack of another client's ID = %v, want 2", got)
+	}
+	if n := runs.Load(); n != 2 {
+		t.Fatalf("handler ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotentClientJoinsRepeatTheResult(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var responses atomic.Int64
+	ns.EnableClientJoins(func(c *Client, r *Room) interface{} { return responses.Add(1) }, Idempotent(time.Minute))
+	tc := dial(t, s, "/")
+
+	join := func(id string, ack uint64) JoinResult {
+		t.Helper()
+		tc.send(Message{Event: EventJoin, Data: "r", ID: id, Ack: ack})
+		msg := tc.expect(EventAck)
+		var res JoinResult
+		if err := msg.Bind(&res); err != nil || msg.Ack != ack || res.Error != nil {
+			t.Fatalf("join %s answered %+v for ack %d: %v", id, res, msg.Ack, err)
+		}
+		return res
+	}
+	if res := join("j1", 1); res.Room != "r" || res.Data != 1.0 {
+		t.Fatalf("first join = %+v, want r with 1", res)
+	}
+	if res := join("j1", 2); res.Room != "r" || res.Data != 1.0 {
+		t.Fatalf("repeated join = %+v, want the remembered result", res)
+	}
+	if res := join("j2", 3); res.Data != 2.0 {
+		t.Fatalf("join with a new ID = %+v, want 2", res)
+	}
+	if n := responses.Load(); n != 2 {
+		t.Fatalf("responder ran %d times, want 2", n)
+	}
+}
@@ -0,0 +1,82 @@
+package sockx
+
+import (
+	"github.com/gorilla/websocket"
+	"golang.org/x/text/language"
+)
+
+// DetachedOption configures NewDetachedClient.
+type DetachedOption func(*detachedOptions)
+
+type detachedOptions struct {
+	outbox   func(frame []byte)
+	features []Feature
+	locale   language.Tag
+}
+
+// DetachedOutbox hands every frame sent to the client to fn, in order, on
+// a goroutine of the client's own. Without it the frames are discarded.
+func DetachedOutbox(fn func(frame []byte)) DetachedOption {
+	return func(o *detachedOptions) { o.outbox = fn }
+}
+
+// DetachedFeatures enables protocol features for the client, as if it
+// had declared them when connecting.
+func DetachedFeatures(features ...Feature) DetachedOption {
+	return func(o *detachedOptions) { o.features = features }
+}
+
+// DetachedLocale sets the client's locale, used by Localized data.
+func DetachedLocale(tag language.Tag) DetachedOption {
+	return func(o *detachedOptions) { o.locale = tag }
+}
+
+// NewDetachedClient returns a client of ns that has no network connection,
+// for tests and for virtual clients such as bots. It is set up like a
+// connected client, skipping the upgrade policy and connection
+// middleware: it is added to the namespace, the connect hooks run, and it
+// can join rooms, be emitted to and be disconnected. Frames sent to it go
+// to the DetachedOutbox function.
+//
+// Clients must be created by ServeWebSocket or NewDetachedClient; the
+// methods of a Client built by hand panic.
+func NewDetachedClient(ns *Namespace, opts ...DetachedOption) *Client {
+	var o detachedOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	c := newClient(ns, nil, nil)
+	c.locale = o.locale
+	c.negotiate(o.features)
+	ns.addClient(c)
+	ns.server.matchTrace(c)
+	go c.drainDetached(o.outbox)
+	ns.fire(LifecycleEvent{Kind: LifecycleConnect, Client: c})
+	return c
+}
+
+// drainDetached stands in for writePump on a detached client, handing
+// frames to outbox until the client disconnects.
+func (c *Client) drainDetached(outbox func(frame []byte)) {
+	for range c.queue.notify {
+		for {
+			m, closed := c.queue.pop()
+			if m == nil {
+				if closed {
+					return
+				}
+				break
+			}
+			if m.msgType == websocket.CloseMessage {
+				return
+			}
+			c.queue.note(TraceWrite, m, 1, "")
+			if outbox != nil {
+				outbox(m.data)
+			}
+		}
+	}
+}
+
+// detached reports whether c has no network connection.
+func (c *Client) detached() bool { return c.conn == nil }
@@ -0,0 +1,95 @@
+package sockx
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/text/language"
+)
+
+func TestDetachedClientLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var connected *Client
+	ns.OnConnect(func(c *Client) { connected = c })
+	reasons := disconnects(ns)
+	frames := make(chan []byte, 16)
+	c := NewDetachedClient(ns, DetachedOutbox(func(f []byte) { frames <- f }))
+
+	if connected != c || ns.Client(c.ID()) != c || ns.Count() != 1 {
+		t.Fatal("client not set up like a connected one")
+	}
+	if err := c.Join("r"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		ns.EmitTo("r", "tick", i)
+	}
+	for i := 0; i < 3; i++ {
+		var msg Message
+		var v int
+		if err := json.Unmarshal(<-frames, &msg); err != nil || msg.Bind(&v) != nil || v != i {
+			t.Fatalf("frame %d = %+v, %v", i, msg, err)
+		}
+	}
+	if st := c.Stats(); st.HandlersInFlight != 0 || st.EventsQueued != 0 {
+		t.Fatalf("Stats = %+v, want zero", st)
+	}
+
+	c.Disconnect(websocket.CloseNormalClosure, "")
+	select {
+	case r := <-reasons:
+		if r != ReasonServerClosed {
+			t.Fatalf("disconnect reason = %v, want %v", r, ReasonServerClosed)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("disconnect hooks not run")
+	}
+	if ns.Count() != 0 || ns.Room("r") != nil {
+		t.Fatal("client not removed from the namespace and its rooms")
+	}
+	if c.Context().Err() == nil {
+		t.Fatal("context not cancelled on disconnect")
+	}
+	if err := c.Emit("tick", 4); err == nil {
+		t.Fatal("Emit to a disconnected client succeeded")
+	}
+}
+
+func TestDetachedClientOptions(t *testing.T) {
+	s := newTestServer(t)
+	c := NewDetachedClient(s.Of("/"), DetachedFeatures(FeatureAckBatch), DetachedLocale(language.German))
+	if !c.features[FeatureAckBatch] {
+		t.Error("feature not enabled")
+	}
+	if c.Locale() != language.German {
+		t.Errorf("Locale = %v, want de", c.Locale())
+	}
+	// Without an outbox frames are discarded rather than piling up.
+	for i := 0; i < 2*defaultSendQueueSize; i++ {
+		if err := c.Emit("tick", i); err != nil {
+			waitFor(t, "queue to drain", func() bool { return c.Emit("tick", i) == nil })
+		}
+	}
+}
+
+func TestHandBuiltClientFailsFast(t *testing.T) {
+	for name, fn := range map[string]func(c *Client){
+		"Namespace": func(c *Client) { c.Namespace() },
+		"Join":      func(c *Client) { c.Join("r") },
+		"Emit":      func(c *Client) { c.Emit("tick", nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				p := recover()
+				if msg, _ := p.(string); !strings.Contains(msg, "NewDetachedClient") {
+					t.Fatalf("panic = %v, want one pointing to NewDetachedClient", p)
+				}
+			}()
+			fn(&Client{})
+		})
+	}
+}
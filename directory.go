@@ -0,0 +1,317 @@
+package sockx
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events of the room directory protocol.
+const (
+	// EventDirectorySubscribe is sent by a client to follow the
+	// namespace's room directory. Its Data, if a string, is a search
+	// query restricting the subscription to matching rooms. The client is
+	// sent the current directory as a full EventDirectoryUpdate and then
+	// the changes.
+	EventDirectorySubscribe = "sockx:directory-subscribe"
+
+	// EventDirectoryUnsubscribe stops a directory subscription.
+	EventDirectoryUnsubscribe = "sockx:directory-unsubscribe"
+
+	// EventDirectoryUpdate carries a DirectoryUpdate to subscribers.
+	EventDirectoryUpdate = "sockx:directory-update"
+)
+
+// defaultDirectoryInterval is how often directory changes are sent by
+// default.
+const defaultDirectoryInterval = time.Second
+
+// DirectoryEntry describes a listed room. Occupancy counts the room's
+// clients on this server.
+type DirectoryEntry struct {
+	Room      string                 `json:"room"`
+	Occupancy int                    `json:"occupancy"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// DirectoryUpdate is the payload of EventDirectoryUpdate. A Full update
+// lists every listed room matching the subscription; other updates list
+// the rooms that changed and the names of those no longer listed.
+type DirectoryUpdate struct {
+	Full    bool             `json:"full,omitempty"`
+	Rooms   []DirectoryEntry `json:"rooms,omitempty"`
+	Removed []string         `json:"removed,omitempty"`
+}
+
+// ListingOption configures a room's directory listing.
+type ListingOption func(*listing)
+
+type listing struct {
+	listed   bool
+	metadata map[string]interface{}
+	version  uint64 // changes with every SetListing
+}
+
+// Listed sets whether the room appears in the directory.
+func Listed(listed bool) ListingOption {
+	return func(l *listing) { l.listed = listed }
+}
+
+// ListingMetadata sets the metadata shown with the room in the directory.
+// Only what is passed here is ever published, so pass the public subset
+// of the room's data.
+func ListingMetadata(metadata map[string]interface{}) ListingOption {
+	return func(l *listing) {
+		l.metadata = make(map[string]interface{}, len(metadata))
+		for k, v := range metadata {
+			l.metadata[k] = v
+		}
+	}
+}
+
+// directory tracks a namespace's listed rooms and directory subscribers.
+type directory struct {
+	mu       sync.Mutex
+	interval time.Duration
+	listings map[string]*listing
+	subs     map[*Client]string // subscriber to search query
+
+	// published is the last state sent to subscribers; dirty holds the
+	// rooms that may have changed since, until the pending flush.
+	published map[string]publishedEntry
+	dirty     map[string]bool
+	pending   bool
+	versions  uint64
+}
+
+// publishedEntry is what subscribers were last told about a room.
+type publishedEntry struct {
+	occupancy int
+	version   uint64
+}
+
+// SetListing changes how the named room, which may not exist yet, appears
+// in the namespace's directory. Rooms are unlisted until listed with
+// Listed(true); options not given keep their values. Unlisted rooms never
+// appear in the directory or its updates. A listed room stays listed,
+// with an occupancy of zero, while it has no members.
+func (ns *Namespace) SetListing(room string, opts ...ListingOption) {
+	d := &ns.directory
+	d.mu.Lock()
+	l := d.listings[room]
+	if l == nil {
+		l = &listing{}
+	}
+	next := *l
+	for _, opt := range opts {
+		opt(&next)
+	}
+	d.versions++
+	next.version = d.versions
+	if next.listed {
+		if d.listings == nil {
+			d.listings = make(map[string]*listing)
+		}
+		d.listings[room] = &next
+	} else {
+		delete(d.listings, room)
+	}
+	d.mu.Unlock()
+	ns.touchDirectory(room)
+}
+
+// SetDirectoryInterval sets how often directory changes are sent to
+// subscribers. Changes within an interval are combined, so a busy room
+// costs one entry per interval however many clients join and leave it.
+// Defaults to 1s.
+func (ns *Namespace) SetDirectoryInterval(d time.Duration) {
+	ns.directory.mu.Lock()
+	ns.directory.interval = d
+	ns.directory.mu.Unlock()
+}
+
+// Directory returns the namespace's listed rooms, sorted by name.
+func (ns *Namespace) Directory() []DirectoryEntry {
+	return ns.SearchDirectory("")
+}
+
+// SearchDirectory returns the listed rooms whose name contains query,
+// ignoring case, sorted by name.
+func (ns *Namespace) SearchDirectory(query string) []DirectoryEntry {
+	d := &ns.directory
+	d.mu.Lock()
+	names := make([]string, 0, len(d.listings))
+	for name := range d.listings {
+		if matchesQuery(name, query) {
+			names = append(names, name)
+		}
+	}
+	d.mu.Unlock()
+	sort.Strings(names)
+
+	entries := make([]DirectoryEntry, 0, len(names))
+	for _, name := range names {
+		if e, _, ok := ns.directoryEntry(name); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// directoryEntry returns the entry of the named room and the version of
+// its listing, or false if it is not listed.
+func (ns *Namespace) directoryEntry(name string) (e DirectoryEntry, version uint64, ok bool) {
+	occupancy := 0
+	if r := ns.Room(name); r != nil {
+		r.mu.RLock()
+		occupancy = len(r.clients)
+		r.mu.RUnlock()
+	}
+	d := &ns.directory
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l := d.listings[name]
+	if l == nil {
+		return DirectoryEntry{}, 0, false
+	}
+	return DirectoryEntry{Room: name, Occupancy: occupancy, Metadata: l.metadata}, l.version, true
+}
+
+func matchesQuery(name, query string) bool {
+	return query == "" || strings.Contains(strings.ToLower(name), strings.ToLower(query))
+}
+
+// touchDirectory notes that the named room may have changed and schedules
+// a flush if the room is or was listed and someone is subscribed.
+func (ns *Namespace) touchDirectory(room string) {
+	d := &ns.directory
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, was := d.published[room]; d.listings[room] == nil && !was {
+		return
+	}
+	if len(d.subs) == 0 {
+		// Nobody to tell; new subscribers start from a full update.
+		d.published, d.dirty = nil, nil
+		return
+	}
+	if d.dirty == nil {
+		d.dirty = make(map[string]bool)
+	}
+	d.dirty[room] = true
+	if !d.pending {
+		d.pending = true
+		interval := d.interval
+		if interval <= 0 {
+			interval = defaultDirectoryInterval
+		}
+		time.AfterFunc(interval, ns.flushDirectory)
+	}
+}
+
+// flushDirectory sends subscribers the changes since the last flush.
+func (ns *Namespace) flushDirectory() {
+	d := &ns.directory
+	d.mu.Lock()
+	dirty := d.dirty
+	d.dirty, d.pending = nil, false
+	d.mu.Unlock()
+
+	type state struct {
+		entry   DirectoryEntry
+		version uint64
+	}
+	current := make(map[string]state, len(dirty))
+	for name := range dirty {
+		if e, v, ok := ns.directoryEntry(name); ok {
+			current[name] = state{e, v}
+		}
+	}
+
+	var changed []DirectoryEntry
+	var removed []string
+	d.mu.Lock()
+	if d.published == nil {
+		d.published = make(map[string]publishedEntry)
+	}
+	for name := range dirty {
+		cur, listed := current[name]
+		now := publishedEntry{occupancy: cur.entry.Occupancy, version: cur.version}
+		prev, was := d.published[name]
+		switch {
+		case listed && (!was || prev != now):
+			d.published[name] = now
+			changed = append(changed, cur.entry)
+		case !listed && was:
+			delete(d.published, name)
+			removed = append(removed, name)
+		}
+	}
+	subs := make(map[*Client]string, len(d.subs))
+	for c, q := range d.subs {
+		subs[c] = q
+	}
+	d.mu.Unlock()
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Room < changed[j].Room })
+	sort.Strings(removed)
+
+	// Encode once per distinct query.
+	byQuery := make(map[string][]*Client)
+	for c, q := range subs {
+		byQuery[q] = append(byQuery[q], c)
+	}
+	for q, clients := range byQuery {
+		var u DirectoryUpdate
+		for _, e := range changed {
+			if matchesQuery(e.Room, q) {
+				u.Rooms = append(u.Rooms, e)
+			}
+		}
+		for _, name := range removed {
+			if matchesQuery(name, q) {
+				u.Removed = append(u.Removed, name)
+			}
+		}
+		if len(u.Rooms) == 0 && len(u.Removed) == 0 {
+			continue
+		}
+		o := emitOptions{localOnly: true}
+		p, err := ns.encode(Message{Event: EventDirectoryUpdate, Data: u}, o)
+		if err != nil {
+			continue
+		}
+		deliver(ns, clients, p, "", o)
+	}
+}
+
+// handleDirectory handles EventDirectorySubscribe and
+// EventDirectoryUnsubscribe from c.
+func (c *Client) handleDirectory(msg Message) {
+	ns := c.Namespace()
+	d := &ns.directory
+	if msg.Event == EventDirectoryUnsubscribe {
+		d.mu.Lock()
+		delete(d.subs, c)
+		d.mu.Unlock()
+		return
+	}
+	query, _ := msg.Data.(string)
+	d.mu.Lock()
+	if d.subs == nil {
+		d.subs = make(map[*Client]string)
+	}
+	d.subs[c] = query
+	d.mu.Unlock()
+	c.Emit(EventDirectoryUpdate, DirectoryUpdate{Full: true, Rooms: ns.SearchDirectory(query)})
+}
+
+// dropDirectorySubscriber forgets a disconnected subscriber.
+func (ns *Namespace) dropDirectorySubscriber(c *Client) {
+	ns.directory.mu.Lock()
+	delete(ns.directory.subs, c)
+	ns.directory.mu.Unlock()
+}
@@ -0,0 +1,87 @@
+package sockx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDirectoryListsOnlyListedRooms(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	meta := map[string]interface{}{"topic": "general"}
+	ns.SetListing("Lobby", Listed(true), ListingMetadata(meta))
+	ns.SetListing("lobby-2", Listed(true))
+	ns.SetListing("secret", Listed(false))
+	meta["topic"] = "changed"
+	tc := dial(t, s, "/")
+	ns.Client(tc.welcome.ID).Join("Lobby")
+	ns.Client(tc.welcome.ID).Join("secret")
+
+	got := ns.Directory()
+	want := "[{Lobby 1 map[topic:general]} {lobby-2 0 map[]}]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("Directory = %v, want %s", got, want)
+	}
+	if got := ns.SearchDirectory("BY-"); len(got) != 1 || got[0].Room != "lobby-2" {
+		t.Fatalf("SearchDirectory = %v, want lobby-2", got)
+	}
+
+	// Options not given keep their values.
+	ns.SetListing("Lobby", Listed(true))
+	if got := ns.SearchDirectory("lobby"); len(got) != 2 || got[0].Metadata["topic"] != "general" {
+		t.Fatalf("after listing again = %v", got)
+	}
+}
+
+// directoryUpdate reads the next EventDirectoryUpdate.
+func (tc *testConn) directoryUpdate() DirectoryUpdate {
+	tc.t.Helper()
+	var u DirectoryUpdate
+	if err := tc.expect(EventDirectoryUpdate).Bind(&u); err != nil {
+		tc.t.Fatal(err)
+	}
+	return u
+}
+
+func TestDirectorySubscribersGetChanges(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SetDirectoryInterval(10 * time.Millisecond)
+	ns.SetListing("lobby", Listed(true))
+	ns.SetListing("games", Listed(true))
+	sub, member := dial(t, s, "/"), dial(t, s, "/")
+
+	sub.emit(EventDirectorySubscribe, "LOB")
+	if u := sub.directoryUpdate(); !u.Full || fmt.Sprint(u.Rooms) != "[{lobby 0 map[]}]" {
+		t.Fatalf("first update = %+v, want the full directory matching the query", u)
+	}
+
+	c := ns.Client(member.welcome.ID)
+	c.Join("secret")
+	c.Join("games")
+	c.Join("lobby")
+	for {
+		u := sub.directoryUpdate()
+		if u.Full || len(u.Removed) != 0 || len(u.Rooms) != 1 || u.Rooms[0].Room != "lobby" {
+			t.Fatalf("update = %+v, want only lobby", u)
+		}
+		if u.Rooms[0].Occupancy == 1 {
+			break
+		}
+	}
+
+	ns.SetListing("lobby", Listed(false))
+	if u := sub.directoryUpdate(); fmt.Sprint(u.Removed) != "[lobby]" || len(u.Rooms) != 0 {
+		t.Fatalf("update = %+v, want lobby removed", u)
+	}
+
+	sub.emit(EventDirectoryUnsubscribe, nil)
+	waitFor(t, "the unsubscribe", func() bool {
+		ns.directory.mu.Lock()
+		defer ns.directory.mu.Unlock()
+		return len(ns.directory.subs) == 0
+	})
+	ns.SetListing("lobby", Listed(true))
+	sub.expectNone(EventDirectoryUpdate, 50*time.Millisecond)
+}
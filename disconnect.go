@@ -0,0 +1,93 @@
+package sockx
+
+import "github.com/gorilla/websocket"
+
+// DisconnectReason says why a client was disconnected.
+type DisconnectReason int
+
+const (
+	// ReasonTransportClosed means the peer closed the connection or it
+	// failed.
+	ReasonTransportClosed DisconnectReason = iota
+
+	// ReasonServerClosed means the server closed the connection, for
+	// example because the user's session was replaced.
+	ReasonServerClosed
+
+	// ReasonStalled means the write watchdog closed a connection that
+	// stopped accepting writes.
+	ReasonStalled
+
+	// ReasonPingTimeout means the client sent neither a message nor a
+	// pong within Config.PongWait, so the connection was presumed dead.
+	ReasonPingTimeout
+
+	// ReasonNamespaceLeft means the client left a namespace it had
+	// connected to with EventConnect.
+	ReasonNamespaceLeft
+
+	// ReasonGuestExpired means the client did not authenticate within
+	// Config.GuestTTL.
+	ReasonGuestExpired
+
+	// ReasonMessageTooLarge means the client sent a message larger than
+	// Config.MaxMessageSize and was closed with CloseMessageTooBig.
+	ReasonMessageTooLarge
+)
+
+// String returns the reason's name.
+func (r DisconnectReason) String() string {
+	switch r {
+	case ReasonTransportClosed:
+		return "transport closed"
+	case ReasonServerClosed:
+		return "server closed"
+	case ReasonStalled:
+		return "stalled"
+	case ReasonPingTimeout:
+		return "ping timeout"
+	case ReasonNamespaceLeft:
+		return "namespace left"
+	case ReasonGuestExpired:
+		return "guest expired"
+	case ReasonMessageTooLarge:
+		return "message too large"
+	default:
+		return "unknown"
+	}
+}
+
+// Disconnect closes the client's connection from the server, for example
+// to kick it, with a close frame carrying code and reason. Messages still
+// queued for the client are dropped. The client is removed from its
+// namespace and rooms, and the disconnect hooks run with
+// ReasonServerClosed, before Disconnect returns. Reasons longer than a
+// close frame allows are truncated. Calling it again, or on a client that
+// has already disconnected, does nothing.
+func (c *Client) Disconnect(code int, reason string) {
+	final := &outbound{
+		msgType: websocket.CloseMessage,
+		data:    websocket.FormatCloseMessage(code, closeReason(reason)),
+	}
+	if c.parent == nil {
+		c.queue.abort(final)
+	}
+	c.teardown(ReasonServerClosed, final, nil)
+}
+
+// DisconnectHook is called after a client has been removed from its
+// namespace and rooms, so it can broadcast to them without reaching the
+// departed client. Emits to the client itself fail with ErrClientClosed.
+// c.CloseError holds the read or write error that ended the connection,
+// or nil for a clean close.
+type DisconnectHook func(c *Client, reason DisconnectReason)
+
+// OnDisconnect registers h to be called when a client of the namespace
+// disconnects. Hooks run in registration order.
+func (ns *Namespace) OnDisconnect(h DisconnectHook) {
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind == LifecycleDisconnect {
+			h(ev.Client, ev.DisconnectReason)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package sockx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisconnectClosesFromServer(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var reasons []DisconnectReason
+	ns.OnDisconnect(func(c *Client, reason DisconnectReason) { reasons = append(reasons, reason) })
+	tc := dial(t, s, "/")
+	c := ns.Client(tc.welcome.ID)
+	c.Join("r")
+
+	c.Disconnect(4001, "kicked")
+	if len(reasons) != 1 || reasons[0] != ReasonServerClosed {
+		t.Fatalf("disconnect hooks saw %v by the time Disconnect returned", reasons)
+	}
+	if ns.Client(c.ID()) != nil || ns.Room("r") != nil {
+		t.Fatal("client still in its namespace or room")
+	}
+	c.Disconnect(4002, "again")
+	if len(reasons) != 1 {
+		t.Fatalf("second Disconnect ran the hooks again: %v", reasons)
+	}
+	if err := c.Emit("late", nil); err != ErrClientClosed {
+		t.Fatalf("Emit after Disconnect = %v, want %v", err, ErrClientClosed)
+	}
+
+	ce, _ := expectClose(t, tc, "")
+	if ce.Code != 4001 || ce.Text != "kicked" {
+		t.Fatalf("closed with %d %q, want 4001 kicked", ce.Code, ce.Text)
+	}
+}
+
+func TestDisconnectTruncatesLongReason(t *testing.T) {
+	s := newTestServer(t)
+	tc := dial(t, s, "/")
+	s.Of("/").Client(tc.welcome.ID).Disconnect(4001, strings.Repeat("é", 100))
+	ce, _ := expectClose(t, tc, "")
+	if ce.Code != 4001 || len(ce.Text) > 123 || !strings.HasPrefix(strings.Repeat("é", 100), ce.Text) {
+		t.Fatalf("closed with %d %q", ce.Code, ce.Text)
+	}
+}
@@ -0,0 +1,160 @@
+package sockx
+
+import (
+	"sync"
+	"time"
+)
+
+// workerPool runs event handlers on a fixed set of goroutines. Each client
+// has at most Config.MaxHandlerConcurrency jobs in the pool at a time; the
+// rest wait in the client, so a flooding client cannot crowd out others.
+type workerPool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   []poolJob
+	closed bool
+}
+
+// poolJob is an event to dispatch or, if fn is set, a function to run.
+type poolJob struct {
+	ev *Event
+	fn func()
+}
+
+func newWorkerPool(workers int) *workerPool {
+	p := &workerPool{}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) submit(ev *Event) {
+	p.push(poolJob{ev: ev})
+}
+
+// push queues job. Once the pool is closed, job runs on a goroutine of its
+// own instead.
+func (p *workerPool) push(job poolJob) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		go job.run()
+		return
+	}
+	p.jobs = append(p.jobs, job)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+// close stops the workers once they have run the jobs already queued.
+func (p *workerPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+func (p *workerPool) work() {
+	for {
+		p.mu.Lock()
+		for len(p.jobs) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.jobs) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		job := p.jobs[0]
+		p.jobs[0] = poolJob{}
+		p.jobs = p.jobs[1:]
+		p.mu.Unlock()
+		job.run()
+	}
+}
+
+func (job poolJob) run() {
+	if job.fn != nil {
+		job.fn()
+		return
+	}
+	job.ev.client.Namespace().handleEvent(job.ev)
+	job.ev.client.finishEvent()
+}
+
+// runJob runs fn on the worker pool, or on a goroutine of its own if the
+// server has none.
+func (s *Server) runJob(fn func()) {
+	if s.pool == nil {
+		go fn()
+		return
+	}
+	s.pool.push(poolJob{fn: fn})
+}
+
+// dispatch runs ev's handler, either inline or on the server's worker pool.
+func (c *Client) dispatch(ev *Event) {
+	pool := c.server.pool
+	if pool == nil {
+		c.Namespace().handleEvent(ev)
+		return
+	}
+	cfg := c.server.cfg()
+
+	c.dispatchMu.Lock()
+	switch {
+	case c.inFlight < cfg.MaxHandlerConcurrency:
+		c.inFlight++
+		c.dispatchMu.Unlock()
+		pool.submit(ev)
+	case len(c.pending) < cfg.MaxPendingEvents:
+		c.pending = append(c.pending, ev)
+		c.dispatchMu.Unlock()
+	default:
+		c.dispatchMu.Unlock()
+		c.reject(ErrCodeTooManyEvents, "too many pending events, event "+ev.msg.Event+" dropped", 0)
+	}
+}
+
+// finishEvent releases a handler slot, handing it to the client's next
+// pending event if there is one.
+func (c *Client) finishEvent() {
+	c.dispatchMu.Lock()
+	if len(c.pending) == 0 {
+		c.inFlight--
+		c.dispatchMu.Unlock()
+		return
+	}
+	ev := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+	c.dispatchMu.Unlock()
+	c.server.pool.submit(ev)
+}
+
+// dropPending discards events still waiting for a handler slot.
+func (c *Client) dropPending() {
+	c.dispatchMu.Lock()
+	c.pending = nil
+	c.dispatchMu.Unlock()
+}
+
+// ClientStats is a point-in-time view of a client's activity.
+type ClientStats struct {
+	// HandlersInFlight is the number of the client's events being handled.
+	HandlersInFlight int
+	// EventsQueued is the number of events waiting for a handler slot.
+	EventsQueued int
+	// GuestDeadline is when the client will be disconnected unless it
+	// authenticates, or zero; see Config.GuestTTL.
+	GuestDeadline time.Time
+}
+
+// Stats returns the client's current activity counters.
+func (c *Client) Stats() ClientStats {
+	deadline, _ := c.GuestDeadline()
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+	return ClientStats{HandlersInFlight: c.inFlight, EventsQueued: len(c.pending), GuestDeadline: deadline}
+}
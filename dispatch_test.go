@@ -0,0 +1,106 @@
+package sockx
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestFloodingClientDoesNotStarveOthers(t *testing.T) {
+	const floods = 50
+	s := newTestServer(t, WithHandlerWorkers(4), WithHandlerConcurrency(2, floods))
+	ns := s.Of("/")
+	release := make(chan struct{})
+	ns.On("slow", func(c *Client, data interface{}) { <-release })
+	fast := make(chan struct{}, 1)
+	ns.On("fast", func(c *Client, data interface{}) { fast <- struct{}{} })
+
+	flooder := dial(t, s, "/")
+	for i := 0; i < floods; i++ {
+		flooder.emit("slow", i)
+	}
+	fc := ns.Client(flooder.welcome.ID)
+	waitFor(t, "flood queued", func() bool {
+		st := fc.Stats()
+		return st.HandlersInFlight == 2 && st.EventsQueued == floods-2
+	})
+
+	quiet := dial(t, s, "/")
+	quiet.emit("fast", nil)
+	select {
+	case <-fast:
+	case <-time.After(testTimeout):
+		t.Fatal("quiet client's event not handled while another client floods")
+	}
+
+	close(release)
+	waitFor(t, "flood drained", func() bool {
+		st := fc.Stats()
+		return st.HandlersInFlight == 0 && st.EventsQueued == 0
+	})
+}
+
+func TestEventsBeyondPendingLimitAreRejected(t *testing.T) {
+	s := newTestServer(t, WithHandlerWorkers(2), WithHandlerConcurrency(1, 2))
+	ns := s.Of("/")
+	release := make(chan struct{})
+	defer close(release)
+	ns.On("slow", func(c *Client, data interface{}) { <-release })
+	tc := dial(t, s, "/")
+	for i := 0; i < 4; i++ {
+		tc.emit("slow", i)
+	}
+	if code := errorCode(t, tc.expect(EventError)); code != ErrCodeTooManyEvents {
+		t.Fatalf("error code = %s, want %s", code, ErrCodeTooManyEvents)
+	}
+	st := ns.Client(tc.welcome.ID).Stats()
+	if st.HandlersInFlight != 1 || st.EventsQueued != 2 {
+		t.Fatalf("Stats = %+v, want 1 in flight and 2 queued", st)
+	}
+}
+
+func TestHandlerConcurrencyOfOneKeepsOrder(t *testing.T) {
+	const events = 100
+	s := newTestServer(t, WithHandlerWorkers(8), WithHandlerConcurrency(1, events))
+	ns := s.Of("/")
+	got := make(chan float64, events)
+	ns.On("n", func(c *Client, data interface{}) { got <- data.(float64) })
+	tc := dial(t, s, "/")
+	for i := 0; i < events; i++ {
+		tc.emit("n", i)
+	}
+	for want := 0; want < events; want++ {
+		if n := <-got; n != float64(want) {
+			t.Fatalf("handled %v, want %d", n, want)
+		}
+	}
+}
+
+func TestShutdownStopsHandlerWorkers(t *testing.T) {
+	const workers = 32
+	s := NewServer(WithHandlerWorkers(workers))
+	ns := s.Of("/")
+	handled := make(chan struct{}, 1)
+	ns.On("ping", func(c *Client, data interface{}) { handled <- struct{}{} })
+	tc := dial(t, s, "/")
+	tc.emit("ping", nil)
+	<-handled
+	// Goroutines left over from earlier tests may still be exiting, so
+	// count from here rather than from before the server started.
+	running := runtime.NumGoroutine()
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the workers to stop", func() bool { return runtime.NumGoroutine() <= running-workers })
+
+	// Work handed to the stopped pool still runs.
+	done := make(chan struct{})
+	s.runJob(func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("job submitted after shutdown never ran")
+	}
+}
@@ -0,0 +1,298 @@
+package sockx
+
+import (
+	"fmt"
+	"sync"
+)
+
+// EmitOption customizes a single emit.
+type EmitOption func(*emitOptions)
+
+type emitOptions struct {
+	critical    bool
+	localOnly   bool
+	remoteOnly  bool
+	allowLarge  bool
+	coalesce    string
+	correlation string
+	exclude     []*Client // local clients not to deliver to
+	fanoutHeld  bool      // the room's fanout lock is held; see EmitOrdered
+}
+
+func buildEmitOptions(opts []EmitOption) emitOptions {
+	var o emitOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Critical sends the message on the recipients' control lane, which is
+// reserved for protocol traffic and drained ahead of ordinary messages. Use
+// it sparingly for messages that must get through to congested clients; the
+// control lane is small and a full control lane drops the message just like
+// a full normal lane.
+func Critical() EmitOption {
+	return func(o *emitOptions) { o.critical = true }
+}
+
+// LocalOnly delivers the message to clients connected to this server only,
+// without publishing it through the adapter.
+func LocalOnly() EmitOption {
+	return func(o *emitOptions) { o.localOnly = true }
+}
+
+// RemoteOnly publishes the message through the adapter without delivering
+// it to clients connected to this server. Without an adapter the message
+// goes nowhere. A failed publish is returned as the emit's error.
+func RemoteOnly() EmitOption {
+	return func(o *emitOptions) { o.remoteOnly = true }
+}
+
+// Coalesce tags the message with key. If a message with the same key is
+// still waiting, unsent, in a recipient's queue, the new one takes its
+// place, keeping its position, instead of being appended; a slow client
+// gets only the latest value and its queue holds one message per key.
+// Keys are per client and are forgotten once the message is written.
+// Messages sent with Critical coalesce only with other Critical messages,
+// and others only with others. The key is not carried through the
+// adapter, so remote nodes deliver such messages without coalescing.
+func Coalesce(key string) EmitOption {
+	return func(o *emitOptions) { o.coalesce = key }
+}
+
+// AllowLarge exempts the message from the namespace's SetMaxEmitSize
+// limit, for deliberately large payloads.
+func AllowLarge() EmitOption {
+	return func(o *emitOptions) { o.allowLarge = true }
+}
+
+// EmitResult reports the outcome of an emit.
+type EmitResult struct {
+	// Delivered is the number of local clients the message was queued
+	// for.
+	Delivered int
+	// Dropped is the number of local clients whose queue rejected the
+	// message.
+	Dropped int
+	// NotFound reports that the emit had no local recipients at all: the
+	// room, user or namespace had no client on this server.
+	NotFound bool
+
+	// Published reports that the message was handed to the adapter for
+	// the other nodes, under Channel; see ChannelNamer. The adapter does
+	// not confirm delivery there. PublishErr is the *AdapterError of a
+	// publish that failed or was skipped by the adapter breaker. The emit
+	// still succeeds, reaching local clients only, unless it is
+	// RemoteOnly, in which case it also returns PublishErr.
+	Published  bool
+	Channel    string
+	PublishErr error
+}
+
+// String formats the result for logs.
+func (r EmitResult) String() string {
+	s := fmt.Sprintf("delivered %d, dropped %d", r.Delivered, r.Dropped)
+	if r.NotFound {
+		s += ", no local recipients"
+	}
+	switch {
+	case r.Published:
+		s += ", published to " + r.Channel
+	case r.PublishErr != nil:
+		s += ", publish failed: " + r.PublishErr.Error()
+	}
+	return s
+}
+
+// broadcast encodes msg once (once per locale for Localized data) and
+// queues it for every client in recipients.
+func broadcast(ns *Namespace, recipients []*Client, msg Message, o emitOptions) (EmitResult, error) {
+	if len(recipients) == 0 {
+		res := EmitResult{NotFound: true}
+		ns.debugEmit(msg, res)
+		return res, nil
+	}
+	p, err := ns.encode(msg, o)
+	if err != nil {
+		return EmitResult{}, err
+	}
+	res := deliver(ns, recipients, p, msg.Room, o)
+	ns.debugEmit(msg, res)
+	return res, nil
+}
+
+// deliver queues p for every client in recipients. The bytes queued are
+// attributed to room in ns.
+func deliver(ns *Namespace, recipients []*Client, p *payload, room string, o emitOptions) EmitResult {
+	var res EmitResult
+	var sent int64
+	defer ns.holdFanout(room, o)()
+	for _, c := range recipients {
+		m := p.frame(c)
+		err := c.enqueue(m, o.critical)
+		if err == nil {
+			sent += int64(len(m.data))
+		}
+		res.add(err)
+	}
+	ns.bytes.add(room, sent)
+	return res
+}
+
+// coalesceAs tags p's frames with a Coalesce key.
+func (p *payload) coalesceAs(key string) {
+	if p.localized == nil {
+		p.m.key = key
+		return
+	}
+	for _, m := range p.localized.frames {
+		m.key = key
+	}
+}
+
+// payload is an encoded message ready to be queued. Most messages encode to
+// a single frame shared by all recipients; Localized data encodes to one
+// frame per variant and picks one per recipient.
+type payload struct {
+	m         *outbound
+	localized *localizedFrames
+
+	// msg is the message m encodes, in codec.
+	msg   Message
+	codec Codec
+
+	// recoded caches the frames for clients that need them otherwise: in
+	// another codec, or naming their namespace for clients added to it
+	// with EventConnect.
+	recodedMu sync.Mutex
+	recoded   map[recoding]*outbound
+
+	// transform, if set, rewrites the data for each recipient; plain
+	// holds the data it is given, by Localized variant or -1.
+	transform *payloadTransform
+	plain     map[int][]byte
+}
+
+// recoding identifies a frame of a payload as a client needs it.
+type recoding struct {
+	m     *outbound
+	codec Codec
+	ns    string
+}
+
+func newPayload(codec Codec, msg Message) (*payload, error) {
+	if l, ok := msg.Data.(LocalizedData); ok {
+		lf, err := newLocalizedFrames(codec, msg, l)
+		if err != nil {
+			return nil, err
+		}
+		return &payload{localized: lf, codec: codec}, nil
+	}
+	m, err := encodeMessage(codec, msg)
+	if err != nil {
+		return nil, err
+	}
+	return &payload{m: m, msg: msg, codec: codec}, nil
+}
+
+// frame returns the frame to queue for c, or nil if the message cannot be
+// encoded in c's codec or transformed for c. It is not safe for concurrent
+// use.
+func (p *payload) frame(c *Client) *outbound {
+	m, variant := p.m, -1
+	if p.localized != nil {
+		variant = p.localized.index(c.Locale())
+		m = p.localized.frames[variant]
+	}
+	if p.transform != nil {
+		return p.transformed(c, m, variant)
+	}
+	ns := c.muxNamespace()
+	if ns == "" && c.codec == p.codec {
+		return m
+	}
+	return p.recode(m, variant, c.codec, ns)
+}
+
+// recode returns m, the frame of the given Localized variant or -1, in
+// codec and naming the namespace ns, if any, encoding it once.
+func (p *payload) recode(m *outbound, variant int, codec Codec, ns string) *outbound {
+	key := recoding{m: m, codec: codec, ns: ns}
+	p.recodedMu.Lock()
+	defer p.recodedMu.Unlock()
+	if r, ok := p.recoded[key]; ok {
+		return r
+	}
+	var r *outbound
+	if codec == p.codec && isJSON(codec) {
+		r = codec.(JSONCodec).inNamespace(m, ns)
+	} else {
+		msg := p.msg
+		if variant >= 0 {
+			msg = p.localized.msgs[variant]
+		}
+		msg.Namespace = ns
+		var err error
+		if r, err = encodeMessage(codec, msg); err != nil {
+			r = nil
+		} else {
+			r.key = m.key
+		}
+	}
+	if p.recoded == nil {
+		p.recoded = make(map[recoding]*outbound)
+	}
+	p.recoded[key] = r
+	return r
+}
+
+// maxSize returns the size of the largest frame p can produce.
+func (p *payload) maxSize() int {
+	if p.localized == nil {
+		return len(p.m.data)
+	}
+	n := 0
+	for _, m := range p.localized.frames {
+		if len(m.data) > n {
+			n = len(m.data)
+		}
+	}
+	return n
+}
+
+// published records the outcome of publishing a message for room through
+// a.
+func (r *EmitResult) published(a Adapter, ns *Namespace, room string, err error) {
+	if err != nil {
+		r.PublishErr = err
+		return
+	}
+	r.Published = true
+	r.Channel = adapterChannel(a, ns.name, room)
+}
+
+// debugEmit logs the outcome of an emit when Config.DebugEmits is set.
+func (ns *Namespace) debugEmit(msg Message, res EmitResult) {
+	if !ns.server.cfg().DebugEmits {
+		return
+	}
+	target := ns.name
+	if msg.Room != "" {
+		target += " room " + msg.Room
+	}
+	if msg.Correlation != "" {
+		ns.server.logf("emit %q to %s, correlation %s: %v", msg.Event, target, msg.Correlation, res)
+		return
+	}
+	ns.server.logf("emit %q to %s: %v", msg.Event, target, res)
+}
+
+// add records the outcome of queueing to one recipient.
+func (r *EmitResult) add(err error) {
+	if err == nil {
+		r.Delivered++
+	} else {
+		r.Dropped++
+	}
+}
@@ -0,0 +1,154 @@
+package sockx
+
+import (
+	"context"
+	"sync"
+)
+
+// EmitHandle tracks a fan-out started by EmitAsync.
+type EmitHandle struct {
+	total  int
+	cancel chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu  sync.Mutex
+	res EmitResult
+	err error
+}
+
+// EmitAsync is like Emit but queues to recipients in the background and
+// returns immediately. The recipients are the namespace's clients at the
+// time of the call; clients that disconnect before their turn count as
+// dropped. Use it for very large fan-outs that may need to be cancelled.
+func (ns *Namespace) EmitAsync(event string, data interface{}, opts ...EmitOption) *EmitHandle {
+	return broadcastAsync(ns, ns.snapshotClients(), Message{Event: event, Data: data}, buildEmitOptions(opts))
+}
+
+// EmitAsync is like Emit but queues to recipients in the background. See
+// Namespace.EmitAsync. In rooms with a history the message is numbered and
+// recorded before EmitAsync returns, and its recipients are the members at
+// that point.
+func (r *Room) EmitAsync(event string, data interface{}, opts ...EmitOption) *EmitHandle {
+	return broadcastAsync(r.Namespace(), r.snapshot(), Message{Event: event, Room: r.name, Data: data}, buildEmitOptions(opts))
+}
+
+// broadcastAsync publishes msg through the adapter synchronously, like
+// Namespace.emit, and fans it out to recipients in the background, on the
+// server's worker pool if it has one.
+func broadcastAsync(ns *Namespace, recipients []*Client, msg Message, o emitOptions) *EmitHandle {
+	h := &EmitHandle{
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	msg.hops = ns.server.chainHops(msg.hops)
+	if err := ns.checkDepth(msg); err != nil {
+		h.err = err
+		close(h.done)
+		return h
+	}
+	defer ns.server.enterChain(msg.hops)()
+	o.correlate(&msg)
+	ns.stampReceipt(&msg)
+	var p *payload
+	var err error
+	if r := ns.recordingRoom(msg, o); r != nil {
+		// Numbered and recorded like Namespace.emit, so that resuming
+		// clients get the message from the history.
+		p, recipients, err = r.record(msg, o)
+	} else {
+		p, err = ns.encode(msg, o)
+	}
+	if err != nil {
+		h.err = err
+		close(h.done)
+		return h
+	}
+	if a := ns.server.cfg().Adapter; a != nil && !o.localOnly {
+		err := ns.publish(a, msg)
+		h.res.published(a, ns, msg.Room, err)
+		if o.remoteOnly {
+			h.err = err
+		}
+	}
+	published := h.res.Published
+	if o.remoteOnly {
+		ns.debugEmit(msg, h.res)
+		close(h.done)
+		return h
+	}
+	h.total = len(recipients)
+	if len(recipients) == 0 {
+		h.res.NotFound = true
+		if !published {
+			ns.reportUndelivered(msg, h.res)
+		}
+		ns.debugEmit(msg, h.res)
+		close(h.done)
+		return h
+	}
+	ns.server.runJob(func() {
+		defer close(h.done)
+		var sent int64
+		defer func() { ns.bytes.add(msg.Room, sent) }()
+		for _, c := range recipients {
+			select {
+			case <-h.cancel:
+				return
+			default:
+			}
+			m := p.frame(c)
+			release := ns.holdFanout(msg.Room, o)
+			err := c.enqueue(m, o.critical)
+			release()
+			if err == nil {
+				sent += int64(len(m.data))
+			}
+			h.mu.Lock()
+			h.res.add(err)
+			h.mu.Unlock()
+		}
+		res := h.Progress()
+		if !published {
+			ns.reportUndelivered(msg, res)
+		}
+		ns.debugEmit(msg, res)
+	})
+	return h
+}
+
+// Total returns the number of recipients the emit was addressed to.
+func (h *EmitHandle) Total() int { return h.total }
+
+// Done is closed once the fan-out has finished or stopped after Cancel.
+func (h *EmitHandle) Done() <-chan struct{} { return h.done }
+
+// Progress returns the outcome for the recipients processed so far.
+func (h *EmitHandle) Progress() EmitResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.res
+}
+
+// Cancel stops queueing to recipients that have not been processed yet and
+// waits for the fan-out to stop. It returns the outcome for the recipients
+// reached before cancellation; Total minus Delivered and Dropped were never
+// attempted. Cancelling a finished emit is a no-op.
+func (h *EmitHandle) Cancel() EmitResult {
+	h.once.Do(func() { close(h.cancel) })
+	<-h.done
+	return h.Progress()
+}
+
+// Wait blocks until the fan-out completes or ctx is done. It does not
+// cancel the emit when ctx expires. On a server with HandlerWorkers the
+// fan-out waits for a free worker, so handlers should not wait for their
+// own emits without a deadline.
+func (h *EmitHandle) Wait(ctx context.Context) (EmitResult, error) {
+	select {
+	case <-h.done:
+		return h.Progress(), h.err
+	case <-ctx.Done():
+		return h.Progress(), ctx.Err()
+	}
+}
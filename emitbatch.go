@@ -0,0 +1,154 @@
+package sockx
+
+// EmitBatch sends events to this client as a unit, so that it never sees
+// some of them without the others: they are queued together, with no
+// other message between them, or not at all. A client that negotiated
+// FeatureBatch and speaks JSONCodec gets them in one EventBatch frame;
+// others get consecutive frames, and if the send queue cannot hold them
+// all, none is queued and ErrQueueFull is returned.
+//
+// opts apply to every message. If one of them cannot be encoded, its
+// error is returned and nothing is sent.
+func (c *Client) EmitBatch(events []EventData, opts ...EmitOption) error {
+	o := buildEmitOptions(opts)
+	ns := c.Namespace()
+	frames := make([]*outbound, len(events))
+	for i, e := range events {
+		p, err := ns.encode(Message{Event: e.Event, Data: e.Data}, o)
+		if err != nil {
+			return err
+		}
+		if frames[i] = p.frame(c); frames[i] == nil {
+			return errRecode
+		}
+	}
+	n, err := c.enqueueBatch(frames, o.critical)
+	if err != nil {
+		return err
+	}
+	ns.bytes.add("", n)
+	return nil
+}
+
+// EmitBatch sends events to every client in the room, each client getting
+// them as a unit as with Client.EmitBatch. A client whose queue cannot
+// hold the whole batch gets none of it and is counted in the result as
+// Dropped. In rooms with a history the messages are recorded together, so
+// resuming clients get all of them or, if the history no longer reaches
+// back far enough, none.
+//
+// Through the adapter the messages are published one by one, and clients
+// on other nodes receive them as separate emits. opts apply to every
+// message. If one of them cannot be encoded, its error is returned and
+// nothing is sent.
+func (r *Room) EmitBatch(events []EventData, opts ...EmitOption) (EmitResult, error) {
+	o := buildEmitOptions(opts)
+	ns := r.Namespace()
+	if len(events) == 0 {
+		return EmitResult{}, nil
+	}
+	msgs := make([]Message, len(events))
+	for i, e := range events {
+		msgs[i] = Message{Event: e.Event, Room: r.name, Data: e.Data, hops: ns.server.chainHops(0)}
+		if err := ns.checkDepth(msgs[i]); err != nil {
+			return EmitResult{}, err
+		}
+		ns.stampReceipt(&msgs[i])
+	}
+
+	var ps []*payload
+	var clients []*Client
+	if ns.recordingRoom(msgs[0], o) != nil {
+		var err error
+		if ps, clients, err = r.recordAll(msgs, o); err != nil {
+			return EmitResult{}, err
+		}
+	} else {
+		ps = make([]*payload, len(msgs))
+		for i, msg := range msgs {
+			p, err := ns.encode(msg, o)
+			if err != nil {
+				return EmitResult{}, err
+			}
+			ps[i] = p
+		}
+		clients = r.snapshot()
+	}
+
+	defer ns.server.enterChain(msgs[0].hops)()
+	var pub EmitResult
+	if a := ns.server.cfg().Adapter; a != nil && !o.localOnly {
+		var err error
+		for _, msg := range msgs {
+			if err = ns.publish(a, msg); err != nil {
+				break
+			}
+		}
+		pub.published(a, ns, r.name, err)
+	}
+	if o.remoteOnly {
+		ns.debugEmit(msgs[0], pub)
+		return pub, pub.PublishErr
+	}
+	res := deliverBatch(ns, without(clients, o.exclude), ps, r.name, o)
+	res.NotFound = len(clients) == 0
+	res.Published, res.Channel, res.PublishErr = pub.Published, pub.Channel, pub.PublishErr
+	for _, msg := range msgs {
+		if !res.Published {
+			ns.reportUndelivered(msg, res)
+		}
+		ns.debugEmit(msg, res)
+	}
+	return res, nil
+}
+
+// deliverBatch queues ps for every client in recipients as a unit. The
+// bytes queued are attributed to room in ns.
+func deliverBatch(ns *Namespace, recipients []*Client, ps []*payload, room string, o emitOptions) EmitResult {
+	var res EmitResult
+	var sent int64
+	defer ns.holdFanout(room, o)()
+	frames := make([]*outbound, len(ps))
+	for _, c := range recipients {
+		var err error
+		for i, p := range ps {
+			if frames[i] = p.frame(c); frames[i] == nil {
+				err = errRecode
+				break
+			}
+		}
+		if err == nil {
+			var n int64
+			n, err = c.enqueueBatch(frames, o.critical)
+			sent += n
+		}
+		res.add(err)
+	}
+	ns.bytes.add(room, sent)
+	return res
+}
+
+// enqueueBatch queues frames for c as a unit, combined into one EventBatch
+// frame if c supports it, and returns the number of bytes queued.
+func (c *Client) enqueueBatch(frames []*outbound, control bool) (int64, error) {
+	if c.departing.Load() {
+		return 0, ErrClientClosed
+	}
+	if len(frames) > 1 && c.Supports(FeatureBatch) && isJSON(c.codec) {
+		b := c.codec.(JSONCodec).batchFrame(frames)
+		b.room = frames[0].room
+		frames = []*outbound{b}
+	}
+	firstOverflow, err := c.queue.pushAll(frames, control)
+	if firstOverflow {
+		c.notifyOverflow()
+	}
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, m := range frames {
+		n += int64(len(m.data))
+	}
+	return n, nil
+}
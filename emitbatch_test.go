@@ -0,0 +1,111 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var threeEvents = []EventData{{Event: "a"}, {Event: "b"}, {Event: "c"}}
+
+func TestSendQueuePushAllIsAllOrNothing(t *testing.T) {
+	q := newSendQueue(4, false)
+	q.push(frame("x"), false)
+	q.push(frame("y"), false)
+	if _, err := q.pushAll([]*outbound{frame("a"), frame("b"), frame("c")}, false); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("pushAll beyond the free space = %v, want ErrQueueFull", err)
+	}
+	if n := q.normal.len(); n != 2 {
+		t.Fatalf("queue holds %d frames after the rejection, want 2", n)
+	}
+	if _, err := q.pushAll([]*outbound{frame("a"), frame("b")}, false); err != nil {
+		t.Fatalf("pushAll into exactly the free space: %v", err)
+	}
+	if got := fmt.Sprint(drain(q)); got != "[x y a b]" {
+		t.Fatalf("popped %s, want [x y a b]", got)
+	}
+}
+
+// congested returns a detached client of ns whose writer is stuck handing
+// over its first frame, with n more frames queued behind it, and a
+// function releasing the writer.
+func congested(t *testing.T, ns *Namespace, rec *recorder, n int) (*Client, func()) {
+	t.Helper()
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	c := NewDetachedClient(ns, DetachedOutbox(func(f []byte) {
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+		<-release
+		rec.outbox(f)
+	}))
+	c.Emit("stuck", nil)
+	<-entered
+	for i := 0; i < n; i++ {
+		if err := c.Emit("queued", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c, func() { close(release) }
+}
+
+func TestClientEmitBatchRejectedAsAWhole(t *testing.T) {
+	s := newTestServer(t, WithSendQueueSize(4))
+	ns := s.Of("/")
+	rec := &recorder{}
+	c, release := congested(t, ns, rec, 2)
+	if err := c.EmitBatch(threeEvents); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("EmitBatch with room for 2 of 3 = %v, want ErrQueueFull", err)
+	}
+	c.Emit("after", nil)
+	release()
+	waitFor(t, "queued messages delivered", func() bool { return len(rec.received()) >= 4 })
+	for _, ev := range rec.received() {
+		if ev == "a" || ev == "b" || ev == "c" {
+			t.Fatalf("part of a rejected batch delivered: %v", rec.received())
+		}
+	}
+}
+
+func TestRoomEmitBatchIsAtomicPerRecipient(t *testing.T) {
+	s := newTestServer(t, WithSendQueueSize(4))
+	ns := s.Of("/")
+	slow, fast := &recorder{}, &recorder{}
+	c, release := congested(t, ns, slow, 2)
+	c.Join("r")
+	NewDetachedClient(ns, DetachedOutbox(fast.outbox)).Join("r")
+
+	res, err := ns.Room("r").EmitBatch(threeEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Delivered != 1 || res.Dropped != 1 {
+		t.Fatalf("result = %+v, want 1 delivered and 1 dropped", res)
+	}
+	waitFor(t, "batch delivered", func() bool { return len(fast.received()) == 3 })
+	if got := fmt.Sprint(fast.received()); got != "[a b c]" {
+		t.Fatalf("client with room received %s, want [a b c]", got)
+	}
+	c.Emit("after", nil)
+	release()
+	// The congestion notice goes ahead on the control lane.
+	waitFor(t, "queued messages delivered", func() bool { return len(slow.received()) == 5 })
+	if got := fmt.Sprint(slow.received()); got != "[stuck "+EventError+" queued queued after]" {
+		t.Fatalf("congested client received %s, want none of the batch", got)
+	}
+}
+
+func TestEmitBatchUsesOneFrameWithBatching(t *testing.T) {
+	s := newTestServer(t)
+	rec := &recorder{}
+	c := NewDetachedClient(s.Of("/"), DetachedFeatures(FeatureBatch), DetachedOutbox(rec.outbox))
+	if err := c.EmitBatch(threeEvents); err != nil {
+		t.Fatal(err)
+	}
+	c.Emit("after", nil)
+	waitFor(t, "messages delivered", func() bool { return len(rec.received()) == 2 })
+	if got := fmt.Sprint(rec.received()); got != "[sockx:batch after]" {
+		t.Fatalf("received %s, want one batch frame", got)
+	}
+}
@@ -0,0 +1,111 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrPayloadTooLarge is returned by emits whose encoded message exceeds the
+// namespace's SetMaxEmitSize limit.
+var ErrPayloadTooLarge = errors.New("sockx: payload too large")
+
+// ErrorHandler receives errors raised in a namespace. c is nil for errors
+// not tied to a client, such as a server-side broadcast.
+type ErrorHandler func(c *Client, event string, err error)
+
+// OnError registers h to be called for errors raised in the namespace,
+// including those returned by handlers registered with OnE.
+func (ns *Namespace) OnError(h ErrorHandler) {
+	ns.mu.Lock()
+	ns.errorHandlers = append(ns.errorHandlers, h)
+	ns.mu.Unlock()
+}
+
+// OnE registers h for event like On, for handlers that can fail. An error
+// h returns is passed to the OnError hooks with the client and the event,
+// and sent to the client as an EventError if SendHandlerErrors is set.
+func (ns *Namespace) OnE(event string, h EventHandlerE, opts ...HandlerOption) *Subscription {
+	return ns.OnEvent(event, errorEventFunc(h), opts...)
+}
+
+// errorEventFunc adapts an EventHandlerE to an EventFunc.
+func errorEventFunc(h EventHandlerE) EventFunc {
+	return func(ev *Event) {
+		if err := h(ev.client, ev.legacyData()); err != nil {
+			ev.client.Namespace().handlerError(ev.client, ev.msg.Event, err)
+		}
+	}
+}
+
+// SendHandlerErrors makes the errors returned by handlers registered with
+// OnE reach the client that sent the event, as an EventError naming the
+// event. Its code and message are those of an *ErrorData error, and
+// ErrCodeHandlerFailed and the error's text for others.
+func (ns *Namespace) SendHandlerErrors() {
+	ns.mu.Lock()
+	ns.handlerErrors = true
+	ns.mu.Unlock()
+}
+
+// handlerError reports err, returned by the handler of event for c.
+func (ns *Namespace) handlerError(c *Client, event string, err error) {
+	ns.reportError(c, event, err)
+	ns.mu.RLock()
+	send := ns.handlerErrors
+	ns.mu.RUnlock()
+	if !send {
+		return
+	}
+	data := ErrorData{Code: ErrCodeHandlerFailed, Message: err.Error()}
+	var e *ErrorData
+	if errors.As(err, &e) {
+		data = *e
+	}
+	data.Event = event
+	c.sendControl(EventError, data)
+}
+
+func (ns *Namespace) reportError(c *Client, event string, err error) {
+	ns.mu.RLock()
+	handlers := ns.errorHandlers
+	ns.mu.RUnlock()
+	for _, h := range handlers {
+		h(c, event, err)
+	}
+}
+
+// SetMaxEmitSize rejects emits whose encoded message is larger than n
+// bytes with ErrPayloadTooLarge, unless they pass AllowLarge. Rejected
+// emits are reported to OnError and counted in Stats. Zero removes the
+// limit.
+func (ns *Namespace) SetMaxEmitSize(n int) {
+	atomic.StoreInt64(&ns.maxEmitSize, int64(n))
+}
+
+// encode encodes msg and enforces the emit size limit. It fails while the
+// namespace is not ready.
+func (ns *Namespace) encode(msg Message, o emitOptions) (*payload, error) {
+	if !ns.IsReady() {
+		return nil, ErrNamespaceNotReady
+	}
+	o.correlate(&msg)
+	p, err := newPayload(ns.Codec(), msg)
+	if err != nil {
+		return nil, err
+	}
+	limit := atomic.LoadInt64(&ns.maxEmitSize)
+	if limit > 0 && !o.allowLarge {
+		if size := p.maxSize(); int64(size) > limit {
+			atomic.AddInt64(&ns.oversizedEmits, 1)
+			err := fmt.Errorf("%w: %q is %d bytes, limit is %d", ErrPayloadTooLarge, msg.Event, size, limit)
+			ns.reportError(nil, msg.Event, err)
+			return nil, err
+		}
+	}
+	if o.coalesce != "" {
+		p.coalesceAs(o.coalesce)
+	}
+	p.transform = ns.transformFor(msg.Event)
+	return p, nil
+}
@@ -0,0 +1,138 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// errorLog records the errors reported to a namespace's OnError hooks.
+type errorLog struct {
+	mu      sync.Mutex
+	entries []string
+	errs    []error
+}
+
+func (l *errorLog) watch(ns *Namespace) {
+	ns.OnError(func(c *Client, event string, err error) {
+		who := "server"
+		if c != nil {
+			who = "client"
+		}
+		l.mu.Lock()
+		l.entries = append(l.entries, who+" "+event)
+		l.errs = append(l.errs, err)
+		l.mu.Unlock()
+	})
+}
+
+func (l *errorLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprint(l.entries)
+}
+
+func (l *errorLog) last() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return l.errs[len(l.errs)-1]
+}
+
+func TestMaxEmitSizeRejectsLargePayloads(t *testing.T) {
+	a := &countingAdapter{Adapter: NewMemoryBus().Adapter()}
+	s := newTestServer(t, WithAdapter(a))
+	ns := s.Of("/")
+	ns.SetMaxEmitSize(64)
+	var log errorLog
+	log.watch(ns)
+	tc := dial(t, s, "/")
+	c := ns.Client(tc.welcome.ID)
+	c.Join("r")
+	large := strings.Repeat("x", 100)
+
+	if _, err := ns.EmitTo("r", "big", large); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("oversized EmitTo = %v, want %v", err, ErrPayloadTooLarge)
+	}
+	if err := c.Emit("big", large); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("oversized Client.Emit = %v, want %v", err, ErrPayloadTooLarge)
+	}
+	if n := a.published.Load(); n != 0 {
+		t.Fatalf("oversized emit published %d times", n)
+	}
+	if got := ns.Stats().OversizedEmits; got != 2 {
+		t.Fatalf("OversizedEmits = %d, want 2", got)
+	}
+	if got := log.String(); got != "[server big server big]" {
+		t.Fatalf("reported errors = %s", got)
+	}
+	if err := log.last(); !errors.Is(err, ErrPayloadTooLarge) || !strings.Contains(err.Error(), "limit is 64") {
+		t.Fatalf("reported %v", err)
+	}
+
+	if _, err := ns.EmitTo("r", "small", "x"); err != nil {
+		t.Fatalf("small EmitTo: %v", err)
+	}
+	if _, err := ns.EmitTo("r", "big", large, AllowLarge()); err != nil {
+		t.Fatalf("EmitTo with AllowLarge: %v", err)
+	}
+	tc.expect("small")
+	if got := tc.read(); got.Event != "big" || got.Data != large {
+		t.Fatalf("got %s %v, want the large payload", got.Event, got.Data)
+	}
+
+	ns.SetMaxEmitSize(0)
+	if _, err := ns.EmitTo("r", "big", large); err != nil {
+		t.Fatalf("EmitTo without a limit: %v", err)
+	}
+	tc.expect("big")
+}
+
+func TestOnEReportsHandlerErrors(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var log errorLog
+	log.watch(ns)
+	ns.OnE("save", func(c *Client, data interface{}) error {
+		switch data {
+		case "fail":
+			return errors.New("disk full")
+		case "invalid":
+			return &ErrorData{Code: "invalid_name", Message: "bad name"}
+		}
+		return c.Emit("saved", data)
+	})
+	tc := dial(t, s, "/")
+
+	// Errors go to the hooks but not, by default, to the client.
+	tc.emit("save", "fail")
+	tc.emit("save", "ok")
+	if msg := tc.read(); msg.Event != "saved" {
+		t.Fatalf("got %s, want only saved", msg.Event)
+	}
+	if got := log.String(); got != "[client save]" {
+		t.Fatalf("reported errors = %s", got)
+	}
+	if err := log.last(); err == nil || err.Error() != "disk full" {
+		t.Fatalf("reported %v", err)
+	}
+
+	ns.SendHandlerErrors()
+	for _, tt := range []struct{ data, code, message string }{
+		{"fail", ErrCodeHandlerFailed, "disk full"},
+		{"invalid", "invalid_name", "bad name"},
+	} {
+		tc.emit("save", tt.data)
+		var e ErrorData
+		if err := tc.expect(EventError).Bind(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Code != tt.code || e.Message != tt.message || e.Event != "save" {
+			t.Fatalf("error for %s = %+v, want %s: %s for save", tt.data, e, tt.code, tt.message)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package sockx
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is an inbound event being dispatched to a handler, together with
+// its delivery metadata.
+//
+// An Event's payload, Data and Raw, belongs to the handler only while it
+// runs: the frame it was read into is recycled when the handler returns,
+// and Data and Raw return nil from then on. A handler that keeps the
+// Event, for example to finish the work on another goroutine, must call
+// Retain first. Set Config.DebugEvents to make such accesses panic.
+// Replying and acknowledging remain valid after the handler returns.
+type Event struct {
+	client       *Client
+	msg          Message
+	receivedAt   time.Time
+	dispatchedAt time.Time
+	replayed     bool
+	generation   uint64
+
+	// seen is the event's entry in the namespace's Idempotent cache.
+	seen *dedupEntry
+
+	mu      sync.Mutex
+	replies []*outbound
+	flushed bool
+
+	// frame is the pooled buffer the event was read into, and raw its
+	// copy once retained; see Retain.
+	frame    *bytes.Buffer
+	raw      []byte
+	retained bool
+	released bool
+
+	// rawData is the data of an event read from a JSON text frame, which
+	// is decoded into msg.Data only once asked for; see Data.
+	rawData json.RawMessage
+	decoded bool
+}
+
+// EventFunc handles an inbound event. Register it with OnEvent.
+type EventFunc func(ev *Event)
+
+func newEvent(c *Client, msg Message, frame *bytes.Buffer, receivedAt time.Time) *Event {
+	ev := &Event{client: c, msg: msg, frame: frame, receivedAt: receivedAt}
+	if raw, ok := msg.Data.(json.RawMessage); ok {
+		ev.rawData, ev.msg.Data = raw, nil
+	}
+	return ev
+}
+
+// Client returns the client that sent the event.
+func (ev *Event) Client() *Client { return ev.client }
+
+// Name returns the event name.
+func (ev *Event) Name() string { return ev.msg.Event }
+
+// Data returns the decoded event payload. Data received as JSON is decoded
+// on the first call, into the generic values encoding/json produces; use
+// Bind to decode it into a type of your own instead. See Event for how
+// long it is available.
+func (ev *Event) Data() interface{} {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.checkReleasedLocked("Data")
+	ev.decodeDataLocked()
+	return ev.msg.Data
+}
+
+// ID returns the client-supplied message ID, if any. See Idempotent.
+func (ev *Event) ID() string { return ev.msg.ID }
+
+// Room returns the room named in the inbound message, if any.
+func (ev *Event) Room() string { return ev.msg.Room }
+
+// ReceivedAt returns when the frame carrying the event was read from the
+// connection. It carries a monotonic clock reading, so durations measured
+// against it are reliable.
+func (ev *Event) ReceivedAt() time.Time { return ev.receivedAt }
+
+// DispatchedAt returns when the event's handler was started.
+func (ev *Event) DispatchedAt() time.Time { return ev.dispatchedAt }
+
+// Replayed reports whether the event was buffered by BufferUnhandled and
+// replayed when its handler was registered.
+func (ev *Event) Replayed() bool { return ev.replayed }
+
+// HandlerGeneration returns the generation of the handler set the event
+// was dispatched to; see Namespace.HandlerGeneration.
+func (ev *Event) HandlerGeneration() uint64 { return ev.generation }
+
+// legacyData is the data passed to an EventHandler, which has no other way
+// to learn that the event was replayed.
+func (ev *Event) legacyData() interface{} {
+	if ev.replayed {
+		return Replayed{Data: ev.Data(), ReceivedAt: ev.receivedAt}
+	}
+	return ev.Data()
+}
+
+// OnEvent registers h for event, replacing any previous handler. Unlike On,
+// h receives the full Event including its timing metadata.
+func (ns *Namespace) OnEvent(event string, h EventFunc, opts ...HandlerOption) *Subscription {
+	return ns.register(newSubscription(event, ns.wrapHandler(h, opts)))
+}
+
+// register installs s as the handler of its event and replays the events
+// buffered for it.
+func (ns *Namespace) register(s *Subscription) *Subscription {
+	event := s.event
+	ns.mu.Lock()
+	t := ns.handlers.Load().with(event, s)
+	ns.handlers.Store(t)
+	replay := ns.takeUnhandledLocked(func(name string) bool { return name == event })
+	ns.mu.Unlock()
+
+	for _, ev := range replay {
+		ns.replay(ev)
+	}
+	return s
+}
+
+// wrapHandler applies opts to h.
+func (ns *Namespace) wrapHandler(h EventFunc, opts []HandlerOption) EventFunc {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.idempotent > 0 {
+		h = ns.idempotent(o.idempotent, h)
+	}
+	if o.serializeBy != nil {
+		h = ns.serialize(o.serializeBy, h)
+	}
+	return h
+}
+
+// replay dispatches a buffered event to the namespace's handler for it
+// the way live events are dispatched, on the worker pool if the server
+// has one and with the same panic recovery, breaker and accounting.
+func (ns *Namespace) replay(ev *Event) {
+	ev.replayed = true
+	ev.client.dispatch(ev)
+}
+
+// DurationStats aggregates a series of durations.
+type DurationStats struct {
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the average duration, or zero if there were none.
+func (d DurationStats) Mean() time.Duration {
+	if d.Count == 0 {
+		return 0
+	}
+	return d.Total / time.Duration(d.Count)
+}
+
+// durationCounter aggregates observed durations in statShards shards.
+type durationCounter struct {
+	shards [statShards]durationShard
+}
+
+type durationShard struct {
+	count, total, max int64
+	_                 [40]byte // pad to a cache line
+}
+
+func (d *durationCounter) observe(v time.Duration) {
+	sh := &d.shards[statShard()]
+	atomic.AddInt64(&sh.count, 1)
+	atomic.AddInt64(&sh.total, int64(v))
+	for {
+		cur := atomic.LoadInt64(&sh.max)
+		if int64(v) <= cur || atomic.CompareAndSwapInt64(&sh.max, cur, int64(v)) {
+			return
+		}
+	}
+}
+
+func (d *durationCounter) load() DurationStats {
+	var st DurationStats
+	for i := range d.shards {
+		sh := &d.shards[i]
+		st.Count += atomic.LoadInt64(&sh.count)
+		st.Total += time.Duration(atomic.LoadInt64(&sh.total))
+		if m := time.Duration(atomic.LoadInt64(&sh.max)); m > st.Max {
+			st.Max = m
+		}
+	}
+	return st
+}
@@ -0,0 +1,54 @@
+package sockx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventsCarryReceiveAndDispatchTimes(t *testing.T) {
+	const block = 50 * time.Millisecond
+	s := newTestServer(t, WithHandlerWorkers(2), WithHandlerConcurrency(1, 10))
+	ns := s.Of("/")
+	// The event's data is only available while its handler runs.
+	type seen struct {
+		name, room, client   string
+		data                 interface{}
+		received, dispatched time.Time
+		replayed             bool
+	}
+	events := make(chan seen, 2)
+	ns.OnEvent("work", func(ev *Event) {
+		time.Sleep(block)
+		events <- seen{ev.Name(), ev.Room(), ev.Client().ID(), ev.Data(), ev.ReceivedAt(), ev.DispatchedAt(), ev.Replayed()}
+	})
+	tc := dial(t, s, "/")
+	sent := time.Now()
+	tc.send(Message{Event: "work", Room: "r", Data: "first"})
+	tc.send(Message{Event: "work", Room: "r", Data: "second"})
+
+	first, second := <-events, <-events
+	if first.name != "work" || first.room != "r" || first.data != "first" || first.client != tc.welcome.ID {
+		t.Fatalf("first event = %+v", first)
+	}
+	if first.replayed {
+		t.Fatal("live event reported as replayed")
+	}
+	for _, ev := range []seen{first, second} {
+		if ev.received.Before(sent) || ev.dispatched.Before(ev.received) {
+			t.Fatalf("%v received at %v, dispatched at %v, sent at %v", ev.data, ev.received, ev.dispatched, sent)
+		}
+	}
+	// The second event waited for the client's only handler slot.
+	if wait := second.dispatched.Sub(second.received); wait < block/2 {
+		t.Fatalf("second event dispatched %v after it was received, want about %v", wait, block)
+	}
+
+	waitFor(t, "handler times recorded", func() bool { return ns.Stats().HandlerTime.Count == 2 })
+	st := ns.Stats()
+	if st.DispatchDelay.Count != 2 || st.DispatchDelay.Max < block/2 {
+		t.Fatalf("DispatchDelay = %+v", st.DispatchDelay)
+	}
+	if st.HandlerTime.Mean() < block {
+		t.Fatalf("HandlerTime = %+v, mean %v", st.HandlerTime, st.HandlerTime.Mean())
+	}
+}
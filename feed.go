@@ -0,0 +1,183 @@
+package sockx
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MembershipChangeType classifies a MembershipChange.
+type MembershipChangeType int
+
+const (
+	// ChangeJoin: the client joined the room, including by migration.
+	ChangeJoin MembershipChangeType = iota
+
+	// ChangeLeave: the client left the room, including by migration.
+	ChangeLeave
+
+	// ChangeKick: the server removed the client from the room.
+	ChangeKick
+
+	// ChangeDisconnect: the client left the room by disconnecting.
+	ChangeDisconnect
+)
+
+// String returns the change type's name.
+func (t MembershipChangeType) String() string {
+	switch t {
+	case ChangeJoin:
+		return "join"
+	case ChangeLeave:
+		return "leave"
+	case ChangeKick:
+		return "kick"
+	case ChangeDisconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// MembershipChange records a client joining or leaving a room.
+type MembershipChange struct {
+	Namespace string
+	Room      string
+	ClientID  string
+	UserID    string
+	Type      MembershipChangeType
+	Time      time.Time
+}
+
+// FeedOption configures a membership feed.
+type FeedOption func(*membershipFeed)
+
+// FeedBlock makes a full feed block membership operations until the
+// consumer catches up or cancels the feed. By default changes that do not
+// fit in the buffer are dropped and counted in MembershipFeedDrops.
+func FeedBlock() FeedOption {
+	return func(f *membershipFeed) { f.block = true }
+}
+
+type membershipFeed struct {
+	ch    chan MembershipChange
+	block bool
+
+	// mu is held for reading while sending so that cancel can close ch
+	// once no send is in progress.
+	mu   sync.RWMutex
+	done chan struct{}
+	once sync.Once
+}
+
+// feeds holds a server's membership feeds.
+type feeds struct {
+	mu    sync.RWMutex
+	list  []*membershipFeed
+	drops int64
+}
+
+// MembershipFeed returns a channel of every room membership change on this
+// server, sent after the change has been applied, and a function that
+// cancels the feed and closes the channel. Cancelling never interferes with
+// membership operations, and is safe to call more than once.
+func (s *Server) MembershipFeed(buffer int, opts ...FeedOption) (<-chan MembershipChange, func()) {
+	if buffer < 0 {
+		buffer = 0
+	}
+	f := &membershipFeed{
+		ch:   make(chan MembershipChange, buffer),
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	s.feeds.mu.Lock()
+	s.feeds.list = append(s.feeds.list, f)
+	s.feeds.mu.Unlock()
+	return f.ch, func() { s.feeds.cancel(f) }
+}
+
+// MembershipFeedDrops returns how many changes have been dropped by full
+// membership feeds.
+func (s *Server) MembershipFeedDrops() int64 {
+	return atomic.LoadInt64(&s.feeds.drops)
+}
+
+func (fs *feeds) cancel(f *membershipFeed) {
+	f.once.Do(func() {
+		close(f.done)
+		fs.mu.Lock()
+		for i, g := range fs.list {
+			if g == f {
+				fs.list = append(fs.list[:i:i], fs.list[i+1:]...)
+				break
+			}
+		}
+		fs.mu.Unlock()
+
+		f.mu.Lock()
+		close(f.ch)
+		f.mu.Unlock()
+	})
+}
+
+// publish sends ch to every feed and reports whether there were any.
+func (fs *feeds) publish(ch MembershipChange) bool {
+	fs.mu.RLock()
+	list := fs.list
+	fs.mu.RUnlock()
+	for _, f := range list {
+		if !f.send(ch) {
+			atomic.AddInt64(&fs.drops, 1)
+		}
+	}
+	return len(list) > 0
+}
+
+// send delivers ch to the feed, reporting false if it was dropped.
+func (f *membershipFeed) send(ch MembershipChange) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	select {
+	case <-f.done:
+		return true
+	default:
+	}
+	if f.block {
+		select {
+		case f.ch <- ch:
+		case <-f.done:
+		}
+		return true
+	}
+	select {
+	case f.ch <- ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// membershipChange converts a join or leave lifecycle event.
+func membershipChange(ns *Namespace, ev LifecycleEvent) MembershipChange {
+	t := ChangeJoin
+	if ev.Kind == LifecycleLeave {
+		switch ev.MembershipReason {
+		case MembershipKicked:
+			t = ChangeKick
+		case MembershipDisconnected:
+			t = ChangeDisconnect
+		default:
+			t = ChangeLeave
+		}
+	}
+	return MembershipChange{
+		Namespace: ns.name,
+		Room:      ev.Room,
+		ClientID:  ev.Client.id,
+		UserID:    ev.Client.UserID(),
+		Type:      t,
+		Time:      time.Now(),
+	}
+}
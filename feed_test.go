@@ -0,0 +1,109 @@
+package sockx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// nextChange returns the next change on feed.
+func nextChange(t *testing.T, feed <-chan MembershipChange) MembershipChange {
+	t.Helper()
+	select {
+	case ch := <-feed:
+		return ch
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for a membership change")
+		return MembershipChange{}
+	}
+}
+
+func TestMembershipFeedReportsChanges(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/chat")
+	ns.OnConnect(func(c *Client) { c.Authenticate("alice", nil) })
+	feed, cancel := s.MembershipFeed(10)
+	defer cancel()
+	tc := dial(t, s, "/chat")
+	c := ns.Client(tc.welcome.ID)
+
+	c.Join("a")
+	c.Leave("a")
+	c.Join("b")
+	ns.Room("b").Clear(MembershipKicked)
+	c.Join("c")
+	tc.conn.Close()
+
+	var got []string
+	for _, want := range []string{"a join", "a leave", "b join", "b kick", "c join", "c disconnect"} {
+		ch := nextChange(t, feed)
+		if ch.Namespace != "/chat" || ch.ClientID != c.ID() || ch.UserID != "alice" || ch.Time.IsZero() {
+			t.Fatalf("change %s = %+v", want, ch)
+		}
+		got = append(got, ch.Room+" "+ch.Type.String())
+	}
+	if want := "[a join a leave b join b kick c join c disconnect]"; fmt.Sprint(got) != want {
+		t.Fatalf("changes = %v, want %s", got, want)
+	}
+}
+
+func TestMembershipFeedDropsWhenFull(t *testing.T) {
+	s := newTestServer(t)
+	feed, cancel := s.MembershipFeed(1)
+	tc := dial(t, s, "/")
+	c := s.Of("/").Client(tc.welcome.ID)
+	c.Join("a")
+	c.Join("b")
+	if n := s.MembershipFeedDrops(); n != 1 {
+		t.Fatalf("MembershipFeedDrops = %d, want 1", n)
+	}
+	if ch := nextChange(t, feed); ch.Room != "a" {
+		t.Fatalf("kept the change for %s, want a", ch.Room)
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-feed; ok {
+		t.Fatal("feed still open after cancel")
+	}
+	if err := c.Join("c"); err != nil {
+		t.Fatalf("Join after the feed was cancelled: %v", err)
+	}
+}
+
+func TestMembershipFeedBlockWaitsForConsumer(t *testing.T) {
+	s := newTestServer(t)
+	feed, cancel := s.MembershipFeed(0, FeedBlock())
+	tc := dial(t, s, "/")
+	c := s.Of("/").Client(tc.welcome.ID)
+
+	joined := make(chan error, 1)
+	go func() { joined <- c.Join("a") }()
+	select {
+	case err := <-joined:
+		t.Fatalf("Join returned %v before the change was consumed", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if ch := nextChange(t, feed); ch.Room != "a" {
+		t.Fatalf("change for %s, want a", ch.Room)
+	}
+	if err := <-joined; err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelling releases a blocked membership operation.
+	go func() { joined <- c.Join("b") }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-joined:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Join still blocked after cancel")
+	}
+	if n := s.MembershipFeedDrops(); n != 0 {
+		t.Fatalf("blocking feed dropped %d changes", n)
+	}
+}
@@ -0,0 +1,133 @@
+package sockx
+
+import (
+	"sort"
+	"time"
+)
+
+// EventFlag is broadcast to a room when one of its members raises or
+// lowers an ephemeral flag; see Room.SetEphemeralFlag.
+const EventFlag = "sockx:flag"
+
+// FlagData is the payload of EventFlag.
+type FlagData struct {
+	ClientID string `json:"clientId"`
+	UserID   string `json:"userId,omitempty"`
+	Flag     string `json:"flag"`
+	Set      bool   `json:"set"`
+}
+
+// flagEntry is a raised flag, lowered at until unless refreshed.
+type flagEntry struct {
+	until  time.Time
+	expiry *deadline
+}
+
+// SetEphemeralFlag raises flag, such as "typing", for c, a member of the
+// room, for ttl. Setting it again before then refreshes it for another
+// ttl. The room is told with EventFlag when the flag goes up and when it
+// comes down, because it expired, was cleared with ClearEphemeralFlag or c
+// left the room, but not when it is refreshed. Flags appear in the room's
+// snapshot for joining clients. Like presence, they are tracked per
+// server and not published through the adapter. A ttl of zero or less
+// clears the flag. It returns ErrNotMember if c is not in the room.
+func (r *Room) SetEphemeralFlag(c *Client, flag string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return r.ClearEphemeralFlag(c, flag)
+	}
+	r.mu.Lock()
+	if _, ok := r.clients[c]; !ok {
+		r.mu.Unlock()
+		return ErrNotMember
+	}
+	e := r.flags[c][flag]
+	raised := e == nil
+	if raised {
+		e = &flagEntry{}
+		e.expiry = newDeadline(func() { r.expireFlag(c, flag, e) })
+		if r.flags == nil {
+			r.flags = make(map[*Client]map[string]*flagEntry)
+		}
+		if r.flags[c] == nil {
+			r.flags[c] = make(map[string]*flagEntry)
+		}
+		r.flags[c][flag] = e
+	}
+	e.until = time.Now().Add(ttl)
+	c.server.deadlines.schedule(e.expiry, e.until)
+	r.mu.Unlock()
+
+	if raised {
+		r.announceFlag(c, flag, true)
+	}
+	return nil
+}
+
+// ClearEphemeralFlag lowers flag for c ahead of its expiry. Clearing a
+// flag that is not raised does nothing. It returns ErrNotMember if c is
+// not in the room.
+func (r *Room) ClearEphemeralFlag(c *Client, flag string) error {
+	r.mu.Lock()
+	if _, ok := r.clients[c]; !ok {
+		r.mu.Unlock()
+		return ErrNotMember
+	}
+	e := r.flags[c][flag]
+	if e != nil {
+		r.lowerFlagLocked(c, flag)
+	}
+	r.mu.Unlock()
+
+	if e != nil {
+		r.announceFlag(c, flag, false)
+	}
+	return nil
+}
+
+// EphemeralFlags returns the flags c has raised in the room, sorted.
+func (r *Room) EphemeralFlags(c *Client) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return flagNames(r.flags[c])
+}
+
+// expireFlag lowers a flag whose time is up, unless it was refreshed or
+// cleared in the meantime.
+func (r *Room) expireFlag(c *Client, flag string, e *flagEntry) {
+	r.mu.Lock()
+	if r.flags[c][flag] != e || time.Now().Before(e.until) {
+		r.mu.Unlock()
+		return
+	}
+	r.lowerFlagLocked(c, flag)
+	r.mu.Unlock()
+	r.announceFlag(c, flag, false)
+}
+
+// lowerFlagLocked forgets c's flag. r.mu must be held.
+func (r *Room) lowerFlagLocked(c *Client, flag string) {
+	c.server.deadlines.cancel(r.flags[c][flag].expiry)
+	delete(r.flags[c], flag)
+	if len(r.flags[c]) == 0 {
+		delete(r.flags, c)
+	}
+}
+
+// announceFlag tells the room's members that c raised or lowered flag.
+func (r *Room) announceFlag(c *Client, flag string, set bool) {
+	data := FlagData{ClientID: c.id, UserID: c.UserID(), Flag: flag, Set: set}
+	msg := Message{Event: EventFlag, Room: r.name, Data: data}
+	r.Namespace().emit(msg, r.snapshot, emitOptions{localOnly: true})
+}
+
+func flagNames(flags map[string]*flagEntry) []string {
+	if len(flags) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(flags))
+	for flag := range flags {
+		names = append(names, flag)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,90 @@
+package sockx
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EventGuestExpiring warns a guest client, one without a user identity,
+// that it will be disconnected at the time in its GuestExpiringData
+// unless it authenticates first. See Config.GuestTTL.
+const EventGuestExpiring = "sockx:guest-expiring"
+
+// GuestExpiringData is the payload of EventGuestExpiring.
+type GuestExpiringData struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// guestWarning is how long before a guest session ends the client is
+// warned, or half the session for shorter ones.
+const guestWarning = time.Minute
+
+// WithGuestTTL sets GuestTTL.
+func WithGuestTTL(d time.Duration) Option {
+	return func(c *Config) { c.GuestTTL = d }
+}
+
+// GuestDeadline returns when the client will be disconnected for not
+// authenticating, and false if it is not a guest on the clock.
+func (c *Client) GuestDeadline() (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.guestExpiry == nil {
+		return time.Time{}, false
+	}
+	return c.guestUntil, true
+}
+
+// startGuestClock gives c, if it has no user identity, Config.GuestTTL to
+// authenticate.
+func (s *Server) startGuestClock(c *Client) {
+	ttl := s.cfg().GuestTTL
+	if ttl <= 0 || c.UserID() != "" {
+		return
+	}
+	now := time.Now()
+	until := now.Add(ttl)
+	var warning, expiry *deadline
+	warning = newDeadline(func() {
+		c.mu.Lock()
+		current := c.guestWarning == warning
+		c.guestWarning = nil
+		c.mu.Unlock()
+		if current {
+			c.sendControl(EventGuestExpiring, GuestExpiringData{ExpiresAt: until})
+		}
+	})
+	expiry = newDeadline(func() {
+		c.mu.Lock()
+		current := c.guestExpiry == expiry
+		if current {
+			c.guestWarning, c.guestExpiry = nil, nil
+		}
+		c.mu.Unlock()
+		if current {
+			c.disconnectFor(ReasonGuestExpired, websocket.ClosePolicyViolation, "guest session expired")
+		}
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.cancelGuestClockLocked(c)
+	c.guestWarning, c.guestExpiry, c.guestUntil = warning, expiry, until
+	s.deadlines.schedule(warning, until.Add(-min(guestWarning, ttl/2)))
+	s.deadlines.schedule(expiry, until)
+}
+
+// stopGuestClock cancels c's guest session deadline, if any.
+func (s *Server) stopGuestClock(c *Client) {
+	c.mu.Lock()
+	s.cancelGuestClockLocked(c)
+	c.mu.Unlock()
+}
+
+// cancelGuestClockLocked cancels c's guest deadlines. c.mu must be held.
+func (s *Server) cancelGuestClockLocked(c *Client) {
+	s.deadlines.cancel(c.guestWarning)
+	s.deadlines.cancel(c.guestExpiry)
+	c.guestWarning, c.guestExpiry = nil, nil
+}
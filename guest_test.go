@@ -0,0 +1,51 @@
+package sockx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestGuestsMustAuthenticateWithinTTL(t *testing.T) {
+	const ttl = 300 * time.Millisecond
+	s := newTestServer(t, WithGuestTTL(ttl))
+	ns := s.Of("/")
+	reasons := make(chan DisconnectReason, 2)
+	ns.OnDisconnect(func(c *Client, reason DisconnectReason) { reasons <- reason })
+	start := time.Now()
+	guest, member := dial(t, s, "/"), dial(t, s, "/")
+
+	until, ok := guest.client(ns).GuestDeadline()
+	if !ok || until.Before(start.Add(ttl)) || until.After(time.Now().Add(ttl)) {
+		t.Fatalf("GuestDeadline = %v %v, want %s from connecting", until, ok, ttl)
+	}
+	c := member.client(ns)
+	c.Authenticate("alice", nil)
+	if _, ok := c.GuestDeadline(); ok {
+		t.Fatal("authenticated client still on the guest clock")
+	}
+
+	var warning GuestExpiringData
+	if err := guest.expect(EventGuestExpiring).Bind(&warning); err != nil {
+		t.Fatal(err)
+	}
+	if !warning.ExpiresAt.Equal(until) {
+		t.Fatalf("warned of expiry at %v, want %v", warning.ExpiresAt, until)
+	}
+	ce, _ := expectClose(t, guest, EventGuestExpiring)
+	if ce.Code != websocket.ClosePolicyViolation || ce.Text != "guest session expired" {
+		t.Fatalf("guest closed with %d %q", ce.Code, ce.Text)
+	}
+	if elapsed := time.Since(start); elapsed < ttl {
+		t.Fatalf("guest disconnected after %s, before its TTL", elapsed)
+	}
+	if reason := <-reasons; reason != ReasonGuestExpired {
+		t.Fatalf("disconnect reason %v, want %v", reason, ReasonGuestExpired)
+	}
+
+	member.expectNone(EventGuestExpiring, ttl)
+	if ns.Client(member.welcome.ID) == nil {
+		t.Fatal("authenticated client disconnected")
+	}
+}
@@ -0,0 +1,214 @@
+package sockx
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// reservedPrefix starts the names of the events of the sockx protocol.
+const reservedPrefix = "sockx:"
+
+// handlerTable is an immutable snapshot of a namespace's handler set: its
+// event handlers, OnAny and OnUnhandled hooks and connection middleware.
+// Registration builds a new table from the current one and publishes it
+// atomically, so registering handlers while events are being dispatched
+// is safe and each event sees a consistent table.
+type handlerTable struct {
+	byEvent map[string]*Subscription
+
+	// The slices are never appended to in place; see appendTo.
+	any        []AnyHandler
+	unhandled  []AnyHandler
+	middleware []Middleware
+
+	// generation numbers the table; every change produces the next one.
+	generation uint64
+}
+
+// Subscription identifies the registration of a handler, to remove it
+// with Namespace.Off.
+type Subscription struct {
+	event string
+	fn    EventFunc
+
+	// removed is set by Off, after which fn no longer calls the handler.
+	removed atomic.Bool
+}
+
+func newSubscription(event string, h EventFunc) *Subscription {
+	s := &Subscription{event: event}
+	s.fn = func(ev *Event) {
+		if !s.removed.Load() {
+			h(ev)
+		}
+	}
+	return s
+}
+
+// Event returns the event the handler was registered for.
+func (s *Subscription) Event() string { return s.event }
+
+func (t *handlerTable) lookup(event string) EventFunc {
+	if s := t.byEvent[event]; s != nil {
+		return s.fn
+	}
+	return nil
+}
+
+// with returns a copy of t with s registered for event, or event's
+// handler removed if s is nil.
+func (t *handlerTable) with(event string, s *Subscription) *handlerTable {
+	byEvent := make(map[string]*Subscription, len(t.byEvent)+1)
+	for name, sub := range t.byEvent {
+		byEvent[name] = sub
+	}
+	if s != nil {
+		byEvent[event] = s
+	} else {
+		delete(byEvent, event)
+	}
+	next := t.next()
+	next.byEvent = byEvent
+	return next
+}
+
+// next returns a copy of t with the next generation, sharing t's handlers.
+func (t *handlerTable) next() *handlerTable {
+	next := *t
+	next.generation++
+	return &next
+}
+
+// appendTo returns s with v appended, leaving s's array alone so that
+// older tables sharing it are unaffected.
+func appendTo[T any](s []T, v T) []T {
+	return append(s[:len(s):len(s)], v)
+}
+
+// updateHandlers replaces the namespace's handler table with the result
+// of fn applied to a copy of it.
+func (ns *Namespace) updateHandlers(fn func(t *handlerTable)) {
+	ns.mu.Lock()
+	t := ns.handlers.Load().next()
+	fn(t)
+	ns.handlers.Store(t)
+	ns.mu.Unlock()
+}
+
+// Off removes the handler registered for event by the call that returned
+// s. It does nothing if the handler has since been replaced or removed.
+// Events already being handled finish, but from the time Off returns the
+// handler is not called again, even for events dispatched before.
+func (ns *Namespace) Off(event string, s *Subscription) {
+	if s == nil {
+		return
+	}
+	ns.mu.Lock()
+	t := ns.handlers.Load()
+	if t.byEvent[event] == s {
+		ns.handlers.Store(t.with(event, nil))
+		s.removed.Store(true)
+	}
+	ns.mu.Unlock()
+}
+
+// RemoveAllListeners removes the handler of event, whichever call
+// registered it, as Off does.
+func (ns *Namespace) RemoveAllListeners(event string) {
+	ns.mu.Lock()
+	t := ns.handlers.Load()
+	if s := t.byEvent[event]; s != nil {
+		ns.handlers.Store(t.with(event, nil))
+		s.removed.Store(true)
+	}
+	ns.mu.Unlock()
+}
+
+// Registry collects the handlers of a new handler set for
+// ReplaceHandlers.
+type Registry struct {
+	ns *Namespace
+	t  handlerTable
+}
+
+// On registers h for event in the new set, like Namespace.On.
+func (reg *Registry) On(event string, h EventHandler, opts ...HandlerOption) *Subscription {
+	return reg.OnEvent(event, func(ev *Event) { h(ev.client, ev.legacyData()) }, opts...)
+}
+
+// OnE registers h for event in the new set, like Namespace.OnE.
+func (reg *Registry) OnE(event string, h EventHandlerE, opts ...HandlerOption) *Subscription {
+	return reg.OnEvent(event, errorEventFunc(h), opts...)
+}
+
+// OnWithAck registers h for event in the new set, like
+// Namespace.OnWithAck.
+func (reg *Registry) OnWithAck(event string, h AckHandler, opts ...HandlerOption) *Subscription {
+	return reg.OnEvent(event, ackEventFunc(h), opts...)
+}
+
+// OnEvent registers h for event in the new set, like Namespace.OnEvent.
+func (reg *Registry) OnEvent(event string, h EventFunc, opts ...HandlerOption) *Subscription {
+	s := newSubscription(event, reg.ns.wrapHandler(h, opts))
+	reg.t.byEvent[event] = s
+	return s
+}
+
+// OnAny registers h for every event in the new set, like Namespace.OnAny.
+func (reg *Registry) OnAny(h AnyHandler) {
+	reg.t.any = append(reg.t.any, h)
+}
+
+// OnUnhandled registers h for events without a handler in the new set,
+// like Namespace.OnUnhandled.
+func (reg *Registry) OnUnhandled(h AnyHandler) {
+	reg.t.unhandled = append(reg.t.unhandled, h)
+}
+
+// Use appends mw to the new set's connection middleware, like
+// Namespace.Use.
+func (reg *Registry) Use(mw Middleware) {
+	reg.t.middleware = append(reg.t.middleware, mw)
+}
+
+// ReplaceHandlers swaps the namespace's entire handler set for the one
+// registered by build, atomically: event handlers, OnAny and OnUnhandled
+// hooks and connection middleware. Every event is dispatched to either
+// the old set or the new one, never a mix, and events already dispatched
+// finish on the old set; connections are vetted by either set's
+// middleware. build runs before the swap, off the dispatch path. Handlers
+// for the reserved "sockx:" events, such as the one installed by
+// EnableClientJoins, are carried over unless build replaces them. Buffered
+// unhandled events that the new set handles are replayed to it in the
+// order they arrived. It returns the new set's generation; see
+// HandlerGeneration.
+func (ns *Namespace) ReplaceHandlers(build func(reg *Registry)) uint64 {
+	reg := &Registry{ns: ns, t: handlerTable{byEvent: make(map[string]*Subscription)}}
+	build(reg)
+
+	ns.mu.Lock()
+	old := ns.handlers.Load()
+	t := &reg.t
+	for name, fn := range old.byEvent {
+		if _, ok := t.byEvent[name]; !ok && strings.HasPrefix(name, reservedPrefix) {
+			t.byEvent[name] = fn
+		}
+	}
+	t.generation = old.generation + 1
+	ns.handlers.Store(t)
+	replay := ns.takeUnhandledLocked(func(event string) bool { return t.byEvent[event] != nil })
+	ns.mu.Unlock()
+
+	for _, ev := range replay {
+		ns.replay(ev)
+	}
+	return t.generation
+}
+
+// HandlerGeneration returns the generation of the namespace's current
+// handler set. It starts at zero and grows with every On, OnEvent, Off,
+// RemoveAllListeners, OnAny, OnUnhandled, Use and ReplaceHandlers call
+// that changes it.
+func (ns *Namespace) HandlerGeneration() uint64 {
+	return ns.handlers.Load().generation
+}
@@ -0,0 +1,304 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReplaceHandlersUnderLoadNeitherDropsNorDuplicates(t *testing.T) {
+	const clients, events, swaps = 4, 300, 100
+	s := newTestServer(t, WithHandlerWorkers(4), func(c *Config) { c.MaxPendingEvents = clients * events })
+	ns := s.Of("/")
+
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	anyVersion := make(map[string]int)
+	mixed := 0
+	install := func(version int) {
+		ns.ReplaceHandlers(func(reg *Registry) {
+			reg.OnAny(func(c *Client, event string, data interface{}) {
+				mu.Lock()
+				anyVersion[data.(string)] = version
+				mu.Unlock()
+			})
+			reg.On("work", func(c *Client, data interface{}) {
+				id := data.(string)
+				mu.Lock()
+				handled[id]++
+				if anyVersion[id] != version {
+					mixed++
+				}
+				mu.Unlock()
+			})
+		})
+	}
+	install(0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		tc := dial(t, s, "/")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				tc.emit("work", fmt.Sprintf("%d-%d", i, j))
+			}
+		}(i)
+	}
+	for v := 1; v <= swaps; v++ {
+		install(v)
+	}
+	wg.Wait()
+	waitFor(t, "every event handled", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == clients*events
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for id, n := range handled {
+		if n != 1 {
+			t.Errorf("event %s handled %d times", id, n)
+		}
+	}
+	if mixed > 0 {
+		t.Errorf("%d events saw the OnAny hook of one handler set and the handler of another", mixed)
+	}
+	if g := ns.HandlerGeneration(); g != swaps+1 {
+		t.Errorf("HandlerGeneration = %d, want %d", g, swaps+1)
+	}
+}
+
+func TestReplaceHandlersReplaysInArrivalOrder(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.BufferUnhandled(16)
+	tc := dial(t, s, "/")
+	for i, event := range []string{"a", "b", "a", "c", "b"} {
+		tc.emit(event, i)
+	}
+	waitFor(t, "events buffered", func() bool {
+		ns.mu.RLock()
+		defer ns.mu.RUnlock()
+		return len(ns.unhandled) == 5
+	})
+
+	var order []int
+	record := func(ev *Event) {
+		if !ev.Replayed() {
+			t.Errorf("event %s not flagged as replayed", ev.Name())
+		}
+		var n int
+		ev.Bind(&n)
+		order = append(order, n)
+	}
+	ns.ReplaceHandlers(func(reg *Registry) {
+		reg.OnEvent("a", record)
+		reg.OnEvent("b", record)
+		reg.OnEvent("c", record)
+	})
+	if fmt.Sprint(order) != "[0 1 2 3 4]" {
+		t.Fatalf("replay order = %v, want arrival order", order)
+	}
+}
+
+func TestReplaceHandlersSwapsHooksAndMiddleware(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	url := serve(t, s, "/")
+	var mu sync.Mutex
+	var calls []string
+	note := func(what string) {
+		mu.Lock()
+		calls = append(calls, what)
+		mu.Unlock()
+	}
+	ns.OnAny(func(c *Client, event string, data interface{}) { note("old any") })
+	ns.OnUnhandled(func(c *Client, event string, data interface{}) { note("old unhandled") })
+	ns.Use(func(c *Client, r *http.Request) error { return nil })
+
+	ns.ReplaceHandlers(func(reg *Registry) {
+		reg.OnAny(func(c *Client, event string, data interface{}) { note("new any") })
+		reg.OnUnhandled(func(c *Client, event string, data interface{}) { note("new unhandled") })
+		reg.Use(func(c *Client, r *http.Request) error {
+			if r.Header.Get("X-Version") != "2" {
+				return errors.New("upgrade your client")
+			}
+			return nil
+		})
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("connection refused with %v, want the new middleware's policy violation", err)
+	}
+	conn.Close()
+	tc := dialURL(t, url, http.Header{"X-Version": {"2"}})
+	tc.emit("nobody-handles-this", nil)
+	waitFor(t, "hooks called", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(calls) == 2
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(calls) != "[new any new unhandled]" {
+		t.Fatalf("hooks called = %v, want only the new set's", calls)
+	}
+}
+
+func TestConcurrentRegistrationDuringDispatch(t *testing.T) {
+	const clients, events = 4, 300
+	s := newTestServer(t, WithHandlerWorkers(4), func(c *Config) { c.MaxPendingEvents = clients * events })
+	ns := s.Of("/")
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	note := func(data interface{}) {
+		mu.Lock()
+		seen[data.(string)]++
+		mu.Unlock()
+	}
+	ns.OnUnhandled(func(c *Client, event string, data interface{}) { note(data) })
+	stop := make(chan struct{})
+	var churn sync.WaitGroup
+	churn.Add(2)
+	go func() {
+		defer churn.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// Off also stops events already dispatched to the handler, so
+			// only replacements keep every event accounted for.
+			ns.On("work", func(c *Client, data interface{}) { note(data) })
+			ns.OnEvent("work", func(ev *Event) { note(ev.Data()) })
+		}
+	}()
+	go func() {
+		defer churn.Done()
+		// Hooks and middleware add up, so add a bounded number.
+		for i := 0; i < 200; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			ns.Use(func(c *Client, r *http.Request) error { return nil })
+			ns.OnAny(func(c *Client, event string, data interface{}) {})
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		tc := dial(t, s, "/")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				tc.emit("work", fmt.Sprintf("%d-%d", i, j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	waitFor(t, "every event handled or reported unhandled", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen) == clients*events
+	})
+	close(stop)
+	churn.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("event %s seen %d times", id, n)
+		}
+	}
+}
+
+func TestOffWithStaleSubscriptionKeepsNewerHandler(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	old := ns.On("chat", func(c *Client, data interface{}) {})
+	handled := make(chan struct{}, 1)
+	ns.On("chat", func(c *Client, data interface{}) { handled <- struct{}{} })
+	ns.Off("chat", old)
+	tc := dial(t, s, "/")
+	tc.emit("chat", nil)
+	select {
+	case <-handled:
+	case <-time.After(testTimeout):
+		t.Fatal("Off with a replaced subscription removed the newer handler")
+	}
+}
+
+func TestHandlerNotCalledAfterOffReturns(t *testing.T) {
+	// The client's events run one at a time, so those after the first are
+	// dispatched after the first handler's Off has returned.
+	s := newTestServer(t, WithHandlerWorkers(4), WithHandlerConcurrency(1, 1000))
+	ns := s.Of("/")
+	calls := 0
+	var sub *Subscription
+	sub = ns.On("work", func(c *Client, data interface{}) {
+		calls++
+		ns.Off("work", sub)
+	})
+	tc := dial(t, s, "/")
+	for i := 0; i < 100; i++ {
+		tc.emit("work", i)
+	}
+	synced := make(chan struct{})
+	ns.On("sync", func(c *Client, data interface{}) { close(synced) })
+	tc.emit("sync", nil)
+	<-synced
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want once before Off", calls)
+	}
+}
+
+func TestRemoveAllListenersRemovesAnyRegistration(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	handled := make(chan string, 4)
+	unhandled := make(chan string, 4)
+	ns.OnUnhandled(func(c *Client, event string, data interface{}) { unhandled <- fmt.Sprint(event, data) })
+	old := ns.On("chat", func(c *Client, data interface{}) { handled <- fmt.Sprint("old", data) })
+	ns.OnWithAck("chat", func(c *Client, data interface{}) interface{} {
+		handled <- fmt.Sprint("ack", data)
+		return nil
+	})
+	tc := dial(t, s, "/")
+
+	ns.RemoveAllListeners("chat")
+	ns.RemoveAllListeners("never-registered")
+	tc.emit("chat", 1)
+	if got := <-unhandled; got != "chat1" {
+		t.Fatalf("unhandled %s, want chat1", got)
+	}
+
+	// A subscription from before does not remove the next handler.
+	ns.On("chat", func(c *Client, data interface{}) { handled <- fmt.Sprint("new", data) })
+	ns.Off("chat", old)
+	tc.emit("chat", 2)
+	if got := <-handled; got != "new2" {
+		t.Fatalf("handled %s, want new2", got)
+	}
+	if len(handled) != 0 || len(unhandled) != 0 {
+		t.Fatalf("removed handlers still ran: %d handled, %d unhandled", len(handled), len(unhandled))
+	}
+}
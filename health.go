@@ -0,0 +1,89 @@
+package sockx
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// HealthHandler returns an HTTP handler reporting the server's health as
+// JSON. The status is "degraded" while the adapter's breaker is not
+// closed and "ok" otherwise; the response code is 200 in both cases, since
+// a degraded server still serves its own clients. While the server warms
+// up, the status is "warming_up" unless degraded, and the report shows the
+// warm-up's progress; see Config.WarmUp. The report also counts
+// connections by each client label in use and, with an adapter, messages
+// received from other nodes by their zone and node ID.
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ah := s.AdapterHealth()
+		out := healthReport{Status: "ok", Node: s.NodeID(), Labels: s.cfg().Labels, Connections: s.connectionLabels()}
+		if ah.Configured {
+			if ah.State != BreakerClosed {
+				out.Status = "degraded"
+			}
+			out.Adapter = &adapterReport{
+				State:      ah.State.String(),
+				Failures:   ah.Failures,
+				Skipped:    ah.Skipped,
+				Recoveries: ah.Recoveries,
+				Received:   s.ReceivedByZone(),
+				FromNodes:  s.ReceivedByNode(),
+			}
+			if ah.LastError != nil {
+				out.Adapter.LastError = ah.LastError.Error()
+				t := ah.LastFailure
+				out.Adapter.LastFailure = &t
+			}
+		}
+		if wu := s.WarmUpStatus(); wu.Configured {
+			if wu.Active && out.Status == "ok" {
+				out.Status = "warming_up"
+			}
+			out.WarmUp = &warmUpReport{
+				Active:           wu.Active,
+				ElapsedSeconds:   wu.Elapsed.Seconds(),
+				RemainingSeconds: wu.Remaining.Seconds(),
+				Accepted:         wu.Accepted,
+				Rejected:         wu.Rejected,
+			}
+			if !wu.Started.IsZero() {
+				out.WarmUp.Started = &wu.Started
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+}
+
+type healthReport struct {
+	Status      string                    `json:"status"`
+	Node        string                    `json:"node"`
+	Labels      map[string]string         `json:"labels,omitempty"`
+	Connections map[string]map[string]int `json:"connections"`
+	Adapter     *adapterReport            `json:"adapter,omitempty"`
+	WarmUp      *warmUpReport             `json:"warmUp,omitempty"`
+}
+
+type warmUpReport struct {
+	Active           bool       `json:"active"`
+	Started          *time.Time `json:"started,omitempty"`
+	ElapsedSeconds   float64    `json:"elapsedSeconds"`
+	RemainingSeconds float64    `json:"remainingSeconds,omitempty"`
+	Accepted         int64      `json:"accepted"`
+	Rejected         int64      `json:"rejected"`
+}
+
+type adapterReport struct {
+	State       string     `json:"state"`
+	Failures    int64      `json:"failures"`
+	Skipped     int64      `json:"skipped"`
+	Recoveries  int64      `json:"recoveries"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+
+	// Received counts messages from other nodes by their zone, and
+	// FromNodes by their node ID.
+	Received  map[string]int64 `json:"received,omitempty"`
+	FromNodes map[string]int64 `json:"fromNodes,omitempty"`
+}
@@ -0,0 +1,55 @@
+package sockx
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// heartbeatServer serves namespace / with a fast heartbeat. Disconnect
+// reasons are sent on the returned channel.
+func heartbeatServer(t *testing.T) (*Server, <-chan DisconnectReason) {
+	s := newTestServer(t, WithHeartbeat(10*time.Millisecond, 50*time.Millisecond))
+	reasons := make(chan DisconnectReason, 1)
+	s.Of("/").OnDisconnect(func(c *Client, reason DisconnectReason) { reasons <- reason })
+	return s, reasons
+}
+
+func TestHeartbeatDropsSilentConnection(t *testing.T) {
+	s, reasons := heartbeatServer(t)
+	dial(t, s, "/") // never reads again, so never answers a ping
+	select {
+	case reason := <-reasons:
+		if reason != ReasonPingTimeout {
+			t.Fatalf("disconnected for %s, want %s", reason, ReasonPingTimeout)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("silent connection never dropped")
+	}
+}
+
+func TestHeartbeatKeepsAnsweringConnection(t *testing.T) {
+	s, reasons := heartbeatServer(t)
+	tc := dial(t, s, "/")
+	var pings atomic.Int64
+	tc.conn.SetPingHandler(func(data string) error {
+		pings.Add(1)
+		return tc.conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(testTimeout))
+	})
+	// Reading lets the connection answer pings, and nothing else arrives.
+	go tc.conn.ReadMessage()
+
+	select {
+	case reason := <-reasons:
+		t.Fatalf("answering connection disconnected for %s", reason)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if n := pings.Load(); n < 5 {
+		t.Fatalf("%d pings in 200ms, want one every 10ms", n)
+	}
+	if n := s.Of("/").Stats().Clients; n != 1 {
+		t.Fatalf("%d clients, want 1", n)
+	}
+}
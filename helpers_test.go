@@ -0,0 +1,144 @@
+package sockx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testTimeout bounds every wait in the tests.
+const testTimeout = 5 * time.Second
+
+// newTestServer returns a server shut down when the test ends.
+func newTestServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	s := NewServer(opts...)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s
+}
+
+// serve serves the namespace of s over HTTP for the duration of the test
+// and returns its WebSocket URL.
+func serve(t testing.TB, s *Server, namespace string) string {
+	t.Helper()
+	ts := httptest.NewServer(s.ServeWebSocket(namespace))
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+// testConn is a raw WebSocket connection to a server, speaking JSON.
+type testConn struct {
+	t       testing.TB
+	conn    *websocket.Conn
+	welcome WelcomeData
+}
+
+// dial connects to the namespace of s and reads the welcome.
+func dial(t testing.TB, s *Server, namespace string) *testConn {
+	t.Helper()
+	return dialURL(t, serve(t, s, namespace), nil)
+}
+
+// dialURL connects to url with header and reads the welcome.
+func dialURL(t testing.TB, url string, header http.Header) *testConn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	tc := &testConn{t: t, conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	msg := tc.expect(EventWelcome)
+	if err := msg.Bind(&tc.welcome); err != nil {
+		t.Fatalf("welcome: %v", err)
+	}
+	return tc
+}
+
+// send writes msg.
+func (tc *testConn) send(msg Message) {
+	tc.t.Helper()
+	data, msgType, err := JSONCodec{}.Marshal(msg)
+	if err != nil {
+		tc.t.Fatalf("encoding %s: %v", msg.Event, err)
+	}
+	if err := tc.conn.WriteMessage(msgType, data); err != nil {
+		tc.t.Fatalf("sending %s: %v", msg.Event, err)
+	}
+}
+
+// emit sends event with data.
+func (tc *testConn) emit(event string, data interface{}) {
+	tc.t.Helper()
+	tc.send(Message{Event: event, Data: data})
+}
+
+// read returns the next message, failing the test if none arrives in
+// time.
+func (tc *testConn) read() Message {
+	tc.t.Helper()
+	msg, err := tc.next(testTimeout)
+	if err != nil {
+		tc.t.Fatalf("reading: %v", err)
+	}
+	return msg
+}
+
+// next returns the next message arriving within d.
+func (tc *testConn) next(d time.Duration) (Message, error) {
+	tc.conn.SetReadDeadline(time.Now().Add(d))
+	msgType, data, err := tc.conn.ReadMessage()
+	if err != nil {
+		return Message{}, err
+	}
+	var msg Message
+	err = JSONCodec{}.Unmarshal(data, msgType, &msg)
+	return msg, err
+}
+
+// expect skips messages until one named event arrives and returns it.
+func (tc *testConn) expect(event string) Message {
+	tc.t.Helper()
+	for {
+		if msg := tc.read(); msg.Event == event {
+			return msg
+		}
+	}
+}
+
+// expectNone fails the test if a message named event arrives within d.
+// The read timing out breaks the connection, so it must be tc's last read.
+func (tc *testConn) expectNone(event string, d time.Duration) {
+	tc.t.Helper()
+	deadline := time.Now().Add(d)
+	for {
+		msg, err := tc.next(time.Until(deadline))
+		if err != nil {
+			return
+		}
+		if msg.Event == event {
+			tc.t.Fatalf("unexpected %s: %+v", event, msg)
+		}
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after testTimeout.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,85 @@
+package sockx
+
+import "sync"
+
+// roomHistory numbers a room's messages and keeps the most recent ones.
+type roomHistory struct {
+	mu      sync.Mutex
+	size    int
+	seq     uint64
+	entries []historyEntry
+}
+
+type historyEntry struct {
+	seq uint64
+	p   *payload
+}
+
+// EnableHistory keeps the last n messages emitted to each room of the
+// namespace created from now on, and stamps room messages with a per-room
+// sequence number in Message.Seq. Clients resuming a session with
+// EnableResume use the numbers to catch up on what they missed. History is
+// kept per server and dropped with the room.
+func (ns *Namespace) EnableHistory(n int) {
+	ns.mu.Lock()
+	ns.historySize = n
+	ns.mu.Unlock()
+}
+
+// recordingRoom returns the room whose history msg goes into, if any.
+func (ns *Namespace) recordingRoom(msg Message, o emitOptions) *Room {
+	if msg.Room == "" || o.remoteOnly {
+		return nil
+	}
+	if r := ns.Room(msg.Room); r != nil && r.history != nil {
+		return r
+	}
+	return nil
+}
+
+// record numbers msg, encodes it and appends it to the room's history. It
+// returns the payload and the room's members at that point.
+func (r *Room) record(msg Message, o emitOptions) (*payload, []*Client, error) {
+	ps, clients, err := r.recordAll([]Message{msg}, o)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ps[0], clients, nil
+}
+
+// recordAll is record for consecutive messages. If one of them cannot be
+// encoded, none is recorded.
+func (r *Room) recordAll(msgs []Message, o emitOptions) ([]*payload, []*Client, error) {
+	h := r.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ps := make([]*payload, len(msgs))
+	for i, msg := range msgs {
+		msg.Seq = h.seq + 1 + uint64(i)
+		p, err := r.Namespace().encode(msg, o)
+		if err != nil {
+			return nil, nil, err
+		}
+		ps[i] = p
+	}
+	for _, p := range ps {
+		h.seq++
+		if len(h.entries) == h.size {
+			copy(h.entries, h.entries[1:])
+			h.entries = h.entries[:len(h.entries)-1]
+		}
+		h.entries = append(h.entries, historyEntry{seq: h.seq, p: p})
+	}
+	return ps, r.snapshot(), nil
+}
+
+// sinceLocked returns the entries after seq and whether any messages after
+// seq have already been dropped from the history. h.mu must be held.
+func (h *roomHistory) sinceLocked(seq uint64) (entries []historyEntry, gap bool) {
+	for i, e := range h.entries {
+		if e.seq > seq {
+			return h.entries[i:], e.seq > seq+1
+		}
+	}
+	return nil, h.seq > seq && len(h.entries) == 0
+}
@@ -0,0 +1,134 @@
+package sockx
+
+import (
+	"errors"
+	"sort"
+)
+
+// EventJoin is sent by a client to join a room, when the namespace has
+// client joins enabled. Its Data is the room name, or an object with a
+// "room" field. A request carrying an Ack ID is answered with an EventAck
+// with the same ID whose Data is a JoinResult.
+const EventJoin = "sockx:join"
+
+var errJoinNoRoom = errors.New("sockx: join request names no room")
+
+// RoomSnapshot describes a room to a client that has just joined it.
+type RoomSnapshot struct {
+	Room string `json:"room"`
+
+	// Members are the IDs of the room's other clients on this server.
+	Members []string `json:"members,omitempty"`
+
+	// Users are the users present in the room, when presence is enabled.
+	Users []string `json:"users,omitempty"`
+
+	// Flags are the ephemeral flags raised by the room's members on this
+	// server, by client ID; see Room.SetEphemeralFlag.
+	Flags map[string][]string `json:"flags,omitempty"`
+
+	// Seq is the sequence number of the room's latest message, when
+	// history is enabled. It is the cursor to resume the room from.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// JoinResult answers an EventJoin. Error is set when the join was refused,
+// and then the snapshot holds the room name only. Data is what the
+// namespace's JoinResponder contributed.
+type JoinResult struct {
+	RoomSnapshot
+	Data  interface{} `json:"data,omitempty"`
+	Error *ErrorData  `json:"error,omitempty"`
+}
+
+// JoinResponder returns application data, such as room metadata, to send
+// to a client that has just joined r with EventJoin.
+type JoinResponder func(c *Client, r *Room) interface{}
+
+// EnableClientJoins lets clients join rooms of the namespace themselves
+// with EventJoin, and answers each request with the room's snapshot so
+// that no follow-up request is needed. Joins go through Client.Join, so
+// the room guard and the join rate limit apply. respond, if not nil, adds
+// its data to every successful join's result. opts apply to the join
+// handler; with Idempotent, a repeated request is answered with the
+// result of the original.
+func (ns *Namespace) EnableClientJoins(respond JoinResponder, opts ...HandlerOption) {
+	ns.OnEvent(EventJoin, func(ev *Event) {
+		c := ev.Client()
+		room := joinRoomName(ev.Data())
+		res := JoinResult{RoomSnapshot: RoomSnapshot{Room: room}}
+		err := errJoinNoRoom
+		if room != "" {
+			if err = c.Join(room); errors.Is(err, ErrAlreadyJoined) {
+				// Answer a repeated request with the snapshot again.
+				err = nil
+			}
+		}
+		var r *Room
+		if err == nil {
+			// A hook may have removed the client or dropped the room.
+			r = c.Namespace().Room(room)
+			if r == nil {
+				err = ErrClientClosed
+			}
+		}
+		switch {
+		case errors.Is(err, ErrClientClosed):
+			return
+		case err == nil:
+			res.RoomSnapshot = r.SnapshotForJoin(c)
+			if respond != nil {
+				res.Data = respond(c, r)
+			}
+		case errors.Is(err, ErrRateLimited):
+			res.Error = &ErrorData{Code: ErrCodeRateLimited, Message: err.Error()}
+		case err == errJoinNoRoom:
+			res.Error = &ErrorData{Code: ErrCodeBadMessage, Message: err.Error()}
+		default:
+			res.Error = &ErrorData{Code: ErrCodeForbidden, Message: err.Error()}
+		}
+		ev.Ack(res)
+	}, opts...)
+}
+
+func joinRoomName(data interface{}) string {
+	switch d := data.(type) {
+	case string:
+		return d
+	case map[string]interface{}:
+		name, _ := d["room"].(string)
+		return name
+	}
+	return ""
+}
+
+// SnapshotForJoin describes the room to c, which has just joined it: the
+// room's other members, the users present if presence is enabled, the
+// members' ephemeral flags, and the latest history sequence number if
+// history is enabled.
+func (r *Room) SnapshotForJoin(c *Client) RoomSnapshot {
+	snap := RoomSnapshot{Room: r.name}
+	for _, m := range r.snapshot() {
+		if m != c {
+			snap.Members = append(snap.Members, m.id)
+		}
+	}
+	r.mu.RLock()
+	for user := range r.users {
+		snap.Users = append(snap.Users, user)
+	}
+	for m, flags := range r.flags {
+		if snap.Flags == nil {
+			snap.Flags = make(map[string][]string, len(r.flags))
+		}
+		snap.Flags[m.id] = flagNames(flags)
+	}
+	r.mu.RUnlock()
+	sort.Strings(snap.Users)
+	if h := r.history; h != nil {
+		h.mu.Lock()
+		snap.Seq = h.seq
+		h.mu.Unlock()
+	}
+	return snap
+}
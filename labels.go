@@ -0,0 +1,144 @@
+package sockx
+
+import (
+	"errors"
+	"sync"
+)
+
+// LabelZone is the label holding a client's or server's availability zone.
+const LabelZone = "zone"
+
+// maxClientLabels caps the labels of a client, so that aggregating by
+// label stays cheap.
+const maxClientLabels = 8
+
+// ErrTooManyLabels is returned by SetLabel when the client already has the
+// maximum number of labels.
+var ErrTooManyLabels = errors.New("sockx: too many labels")
+
+// SetLabel sets a topology label on the client, such as the zone or load
+// balancer it connected through, typically from an OnConnect hook.
+// Connection counts can be broken down by label with ConnectionsByLabel.
+// A client has at most 8 labels; an empty value removes the label.
+func (c *Client) SetLabel(key, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if value == "" {
+		delete(c.labels, key)
+		return nil
+	}
+	if _, ok := c.labels[key]; !ok && len(c.labels) >= maxClientLabels {
+		return ErrTooManyLabels
+	}
+	if c.labels == nil {
+		c.labels = make(map[string]string)
+	}
+	c.labels[key] = value
+	return nil
+}
+
+// Label returns the value of the client's label key, or "" if unset.
+func (c *Client) Label(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.labels[key]
+}
+
+// Labels returns a copy of the client's labels.
+func (c *Client) Labels() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]string, len(c.labels))
+	for k, v := range c.labels {
+		out[k] = v
+	}
+	return out
+}
+
+// SetZone sets the client's LabelZone label.
+func (c *Client) SetZone(zone string) error { return c.SetLabel(LabelZone, zone) }
+
+// Zone returns the client's LabelZone label.
+func (c *Client) Zone() string { return c.Label(LabelZone) }
+
+// WithLabels sets Labels.
+func WithLabels(labels map[string]string) Option {
+	return func(c *Config) { c.Labels = labels }
+}
+
+// ConnectionsByLabel counts the server's connections by the value of their
+// label key, across namespaces. Connections without the label are counted
+// under the empty value.
+func (s *Server) ConnectionsByLabel(key string) map[string]int {
+	out := make(map[string]int)
+	for _, ns := range s.namespaceList() {
+		ns.mu.RLock()
+		for c := range ns.clients {
+			out[c.Label(key)]++
+		}
+		ns.mu.RUnlock()
+	}
+	return out
+}
+
+// connectionLabels counts the server's connections by every label key in
+// use.
+func (s *Server) connectionLabels() map[string]map[string]int {
+	out := make(map[string]map[string]int)
+	for _, ns := range s.namespaceList() {
+		ns.mu.RLock()
+		for c := range ns.clients {
+			for k, v := range c.Labels() {
+				if out[k] == nil {
+					out[k] = make(map[string]int)
+				}
+				out[k][v]++
+			}
+		}
+		ns.mu.RUnlock()
+	}
+	return out
+}
+
+// originTraffic counts the messages received from the adapter by an
+// attribute of the node that published them.
+type originTraffic struct {
+	mu sync.Mutex
+	m  map[string]int64
+}
+
+func (z *originTraffic) add(origin string) {
+	z.mu.Lock()
+	if z.m == nil {
+		z.m = make(map[string]int64)
+	}
+	z.m[origin]++
+	z.mu.Unlock()
+}
+
+// ReceivedByZone returns the number of messages received from other nodes
+// through the adapter, by the LabelZone label of the publishing server.
+// Messages from servers without a zone are counted under the empty key.
+// Comparing the keys with the server's own zone measures cross-zone
+// broadcast volume.
+func (s *Server) ReceivedByZone() map[string]int64 {
+	return s.received.snapshot()
+}
+
+// ReceivedByNode returns the number of messages received from other nodes
+// through the adapter, by the NodeID of the publishing server, showing
+// how traffic is balanced between nodes. Messages from servers that do
+// not stamp a NodeID are counted under the empty key.
+func (s *Server) ReceivedByNode() map[string]int64 {
+	return s.fromNodes.snapshot()
+}
+
+func (z *originTraffic) snapshot() map[string]int64 {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	out := make(map[string]int64, len(z.m))
+	for k, v := range z.m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package sockx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNodeIDIsAnnounced(t *testing.T) {
+	s := newTestServer(t, WithNodeID("node-a"))
+	if id := s.NodeID(); id != "node-a" {
+		t.Fatalf("NodeID = %q, want node-a", id)
+	}
+	if tc := dial(t, s, "/"); tc.welcome.Node != "node-a" {
+		t.Fatalf("welcome node = %q, want node-a", tc.welcome.Node)
+	}
+	rec := httptest.NewRecorder()
+	s.HealthHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	var report struct{ Node string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || report.Node != "node-a" {
+		t.Fatalf("health report %s: %v", rec.Body, err)
+	}
+
+	a, b := newTestServer(t), newTestServer(t)
+	if a.NodeID() == "" || a.NodeID() == b.NodeID() {
+		t.Fatalf("default node IDs %q and %q", a.NodeID(), b.NodeID())
+	}
+}
+
+func TestAdapterTrafficIsAttributedToNodes(t *testing.T) {
+	bus := NewMemoryBus()
+	a := newTestServer(t, WithAdapter(bus.Adapter()), WithNodeID("a"))
+	b := newTestServer(t, WithAdapter(bus.Adapter()), WithNodeID("b"))
+	ta, tb := dial(t, a, "/"), dial(t, b, "/")
+
+	a.Of("/").Emit("news", 1)
+	a.Of("/").Emit("news", 2)
+	for _, tc := range []*testConn{ta, tb} {
+		if msg := tc.expect("news"); msg.OriginNode != "" || msg.Origin != nil {
+			t.Fatalf("client sent the origin: %+v", msg)
+		}
+		tc.expect("news")
+	}
+	if got := fmt.Sprint(b.ReceivedByNode()); got != "map[a:2]" {
+		t.Fatalf("b received by node %s, want map[a:2]", got)
+	}
+	if got := a.ReceivedByNode(); len(got) != 0 {
+		t.Fatalf("a received its own messages: %v", got)
+	}
+
+	// Messages the adapter echoes back to their own node are dropped.
+	a.handleRemote("/", "", Message{Event: "echo", OriginNode: "a"})
+	if got := a.ReceivedByNode(); len(got) != 0 {
+		t.Fatalf("a counted its own echo: %v", got)
+	}
+	ta.expectNone("echo", 50*time.Millisecond)
+}
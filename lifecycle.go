@@ -0,0 +1,137 @@
+package sockx
+
+// LifecycleKind identifies a lifecycle event.
+type LifecycleKind int
+
+const (
+	// LifecycleConnect: Client has connected to the namespace.
+	LifecycleConnect LifecycleKind = iota
+
+	// LifecycleDisconnect: Client has disconnected for DisconnectReason.
+	LifecycleDisconnect
+
+	// LifecycleJoin: Client has joined Room for MembershipReason.
+	LifecycleJoin
+
+	// LifecycleLeave: Client has left Room for MembershipReason.
+	LifecycleLeave
+
+	// LifecycleRoomCreated: Room has been created.
+	LifecycleRoomCreated
+
+	// LifecycleRoomDestroyed: Room has been dropped.
+	LifecycleRoomDestroyed
+
+	// LifecycleAdapterRecovered: the server's adapter is reachable again
+	// after its breaker opened. Emits made during the outage reached local
+	// clients only, and messages from other nodes were lost, so state
+	// shared across nodes may need reconciling. Fired in every namespace.
+	LifecycleAdapterRecovered
+
+	// LifecycleDrainStarted: Server.Shutdown has begun. New connections
+	// are refused, and the clients are disconnected once the hooks return,
+	// so what the hooks emit to them is still delivered. Fired in every
+	// namespace.
+	LifecycleDrainStarted
+)
+
+// String returns the kind's name.
+func (k LifecycleKind) String() string {
+	switch k {
+	case LifecycleConnect:
+		return "connect"
+	case LifecycleDisconnect:
+		return "disconnect"
+	case LifecycleJoin:
+		return "join"
+	case LifecycleLeave:
+		return "leave"
+	case LifecycleRoomCreated:
+		return "room created"
+	case LifecycleRoomDestroyed:
+		return "room destroyed"
+	case LifecycleAdapterRecovered:
+		return "adapter recovered"
+	case LifecycleDrainStarted:
+		return "drain started"
+	default:
+		return "unknown"
+	}
+}
+
+// LifecycleEvent describes something that happened in a namespace. Kind
+// determines which of the other fields are set.
+type LifecycleEvent struct {
+	Kind   LifecycleKind
+	Client *Client
+	Room   string
+
+	MembershipReason MembershipReason
+	DisconnectReason DisconnectReason
+
+	// Err is the transport error behind a LifecycleDisconnect, or nil for
+	// a clean close; see Client.CloseError.
+	Err error
+}
+
+// LifecycleHook observes lifecycle events.
+type LifecycleHook func(ev LifecycleEvent)
+
+// OnLifecycle registers h to be called for every lifecycle event of the
+// namespace. Hooks run synchronously, after the change is complete and
+// outside the namespace's locks, in registration order.
+func (ns *Namespace) OnLifecycle(h LifecycleHook) {
+	ns.mu.Lock()
+	ns.lifecycleHooks = append(ns.lifecycleHooks, h)
+	ns.mu.Unlock()
+}
+
+// OnConnect registers h to be called when a client connects to the
+// namespace.
+func (ns *Namespace) OnConnect(h func(c *Client)) {
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind == LifecycleConnect {
+			h(ev.Client)
+		}
+	})
+}
+
+func (ns *Namespace) fire(ev LifecycleEvent) {
+	ns.mu.RLock()
+	hooks := ns.lifecycleHooks
+	ns.mu.RUnlock()
+	for _, h := range hooks {
+		h(ev)
+	}
+	ns.traceLifecycle(ev)
+	switch ev.Kind {
+	case LifecycleJoin, LifecycleLeave:
+		ch := membershipChange(ns, ev)
+		if ns.server.feeds.publish(ch) {
+			ns.logMembership(ch)
+		}
+		ns.touchDirectory(ev.Room)
+	case LifecycleRoomCreated:
+		ns.touchDirectory(ev.Room)
+	case LifecycleRoomDestroyed:
+		ns.touchDirectory(ev.Room)
+		ns.startArchive(ev.Room)
+	case LifecycleDisconnect:
+		ns.dropDirectorySubscriber(ev.Client)
+	}
+}
+
+func (ns *Namespace) fireMembership(kind LifecycleKind, c *Client, room string, reason MembershipReason) {
+	ns.fire(LifecycleEvent{Kind: kind, Client: c, Room: room, MembershipReason: reason})
+}
+
+func (ns *Namespace) fireRoom(kind LifecycleKind, room string) {
+	ns.fire(LifecycleEvent{Kind: kind, Room: room})
+}
+
+// fireAll fires ev in every namespace of the server.
+func (s *Server) fireAll(ev LifecycleEvent) {
+	for _, ns := range s.namespaceList() {
+		ns.fire(ev)
+	}
+}
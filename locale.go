@@ -0,0 +1,142 @@
+package sockx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is the variant Localized data falls back to when no variant
+// matches a client's locale. If there is no variant for DefaultLocale
+// either, the variant whose key sorts first is used.
+var DefaultLocale = language.English
+
+// LocalizedData holds per-locale variants of a payload. Create it with
+// Localized and pass it as the data of an emit.
+type LocalizedData struct {
+	variants map[string]interface{}
+}
+
+// Localized returns emit data that is resolved per recipient: each client
+// receives the variant that best matches its locale (see Client.SetLocale),
+// falling back through parent locales ("de-AT" to "de") and then to
+// DefaultLocale. Keys are BCP 47 tags such as "en", "de" or "pt-BR".
+//
+// Broadcasts encode each variant once and share it among the recipients
+// that resolve to it. Only the top-level data of an emit is resolved.
+func Localized(variants map[string]interface{}) LocalizedData {
+	return LocalizedData{variants: variants}
+}
+
+// MarshalJSON encodes the fallback variant, for when LocalizedData ends up
+// somewhere it is not resolved per recipient.
+func (l LocalizedData) MarshalJSON() ([]byte, error) {
+	keys := l.orderedKeys(nil)
+	if len(keys) == 0 {
+		return []byte("null"), nil
+	}
+	return json.Marshal(l.variants[keys[0]])
+}
+
+// orderedKeys returns the variant keys with the fallback variant first. tags,
+// if non-nil, must hold the parsed tag of each key.
+func (l LocalizedData) orderedKeys(tags map[string]language.Tag) []string {
+	keys := make([]string, 0, len(l.variants))
+	for k := range l.variants {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		tag, ok := tags[k]
+		if !ok {
+			tag, _ = language.Parse(k)
+		}
+		if tag == DefaultLocale {
+			keys[0], keys[i] = keys[i], keys[0]
+			break
+		}
+	}
+	return keys
+}
+
+// localizedFrames holds one encoded frame per variant, and the message it
+// encodes, and resolves clients' locales to them, caching each resolution.
+type localizedFrames struct {
+	matcher language.Matcher
+	frames  []*outbound
+	msgs    []Message
+	cache   map[language.Tag]int
+}
+
+func newLocalizedFrames(codec Codec, msg Message, l LocalizedData) (*localizedFrames, error) {
+	if len(l.variants) == 0 {
+		return nil, fmt.Errorf("sockx: localized data for %q has no variants", msg.Event)
+	}
+	parsed := make(map[string]language.Tag, len(l.variants))
+	for k := range l.variants {
+		tag, err := language.Parse(k)
+		if err != nil {
+			return nil, fmt.Errorf("sockx: localized variant %q: %w", k, err)
+		}
+		parsed[k] = tag
+	}
+	keys := l.orderedKeys(parsed)
+	tags := make([]language.Tag, len(keys))
+	frames := make([]*outbound, len(keys))
+	msgs := make([]Message, len(keys))
+	for i, k := range keys {
+		variant := msg
+		variant.Data = l.variants[k]
+		m, err := encodeMessage(codec, variant)
+		if err != nil {
+			return nil, err
+		}
+		tags[i], frames[i], msgs[i] = parsed[k], m, variant
+	}
+	return &localizedFrames{
+		matcher: language.NewMatcher(tags),
+		frames:  frames,
+		msgs:    msgs,
+		cache:   make(map[language.Tag]int),
+	}, nil
+}
+
+// index returns the index of the variant for locale.
+func (lf *localizedFrames) index(locale language.Tag) int {
+	if i, ok := lf.cache[locale]; ok {
+		return i
+	}
+	// With no confidence the matcher returns index 0, the fallback.
+	_, i, _ := lf.matcher.Match(locale)
+	lf.cache[locale] = i
+	return i
+}
+
+// LocaleFromRequest returns the client's preferred locale from the
+// Accept-Language header of r, or language.Und if there is none. Clients
+// are given this locale when they connect.
+func LocaleFromRequest(r *http.Request) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil || len(tags) == 0 {
+		return language.Und
+	}
+	return tags[0]
+}
+
+// SetLocale sets the locale used to resolve Localized data sent to the
+// client.
+func (c *Client) SetLocale(tag language.Tag) {
+	c.mu.Lock()
+	c.locale = tag
+	c.mu.Unlock()
+}
+
+// Locale returns the client's locale.
+func (c *Client) Locale() language.Tag {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.locale
+}
@@ -0,0 +1,94 @@
+package sockx
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestLocalizedDataFallsBack(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	url := serve(t, s, "/")
+	greeting := Localized(map[string]interface{}{
+		"en": "hello",
+		"de": "hallo",
+		"pt": "olá",
+	})
+	for _, tt := range []struct {
+		accept, want string
+	}{
+		{"de", "hallo"},
+		{"de-AT", "hallo"},
+		{"pt-BR,en;q=0.5", "olá"},
+		{"en-GB", "hello"},
+		{"fr", "hello"},
+		{"", "hello"},
+	} {
+		tc := dialURL(t, url, http.Header{"Accept-Language": {tt.accept}})
+		ns.Client(tc.welcome.ID).Emit("greeting", greeting)
+		if got := tc.expect("greeting").Data; got != tt.want {
+			t.Errorf("Accept-Language %q: got %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestLocalizedDataWithoutDefaultUsesFirstVariant(t *testing.T) {
+	s := newTestServer(t)
+	tc := dial(t, s, "/")
+	c := s.Of("/").Client(tc.welcome.ID)
+	c.SetLocale(language.Japanese)
+	c.Emit("greeting", Localized(map[string]interface{}{"fr": "bonjour", "de": "hallo"}))
+	if got := tc.expect("greeting").Data; got != "hallo" {
+		t.Fatalf("got %v, want the variant sorting first", got)
+	}
+}
+
+func TestLocalizedBroadcastSharesFramesPerVariant(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	locales := []language.Tag{
+		language.German,
+		language.MustParse("de-AT"),
+		language.MustParse("de-CH"),
+		language.English,
+		language.French,
+	}
+	var clients []*Client
+	for _, tag := range locales {
+		clients = append(clients, NewDetachedClient(ns, DetachedLocale(tag)))
+	}
+	p, err := ns.encode(Message{Event: "greeting", Data: Localized(map[string]interface{}{
+		"en": "hello",
+		"de": "hallo",
+	})}, emitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(p.localized.frames); n != 2 {
+		t.Fatalf("encoded %d frames, want one per variant", n)
+	}
+	frames := make(map[*outbound]int)
+	for _, c := range clients {
+		frames[p.frame(c)]++
+	}
+	de, en := p.localized.frames[1], p.localized.frames[0]
+	if frames[de] != 3 || frames[en] != 2 {
+		t.Fatalf("frames shared as %v, want 3 German and 2 fallback recipients", frames)
+	}
+}
+
+func TestLocalizedDataRejectsInvalidVariants(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	NewDetachedClient(ns)
+	for name, data := range map[string]LocalizedData{
+		"empty":   Localized(nil),
+		"bad tag": Localized(map[string]interface{}{"not a tag!": "x"}),
+	} {
+		if _, err := ns.Emit("greeting", data); err == nil {
+			t.Errorf("%s: Emit succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package sockx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrEmitLoop is returned by emits nested deeper than the namespace's
+// emit depth limit, which usually means a handler is re-triggering itself.
+var ErrEmitLoop = errors.New("sockx: emit loop detected")
+
+// defaultMaxEmitDepth is the default limit on nested emits.
+const defaultMaxEmitDepth = 8
+
+// SetMaxEmitDepth sets how many emits may be chained synchronously, each
+// made while dispatching the previous one, before ErrEmitLoop aborts the
+// chain. An emit counts as chained whether a handler makes it through the
+// Event or through the namespace, room or EmitAsync, and so does one made
+// by an adapter or undelivered hook while an emit is in progress. The
+// default is 8; n <= 0 restores it.
+func (ns *Namespace) SetMaxEmitDepth(n int) {
+	if n <= 0 {
+		n = defaultMaxEmitDepth
+	}
+	atomic.StoreInt64(&ns.maxEmitDepth, int64(n))
+}
+
+// Emit sends event to every client in the event's namespace, as a
+// consequence of ev. The emit counts one hop deeper than ev towards the
+// namespace's emit depth limit.
+func (ev *Event) Emit(event string, data interface{}, opts ...EmitOption) (EmitResult, error) {
+	ns := ev.client.Namespace()
+	msg := Message{Event: event, Data: data, hops: ev.msg.hops + 1}
+	return ns.emit(msg, ns.snapshotClients, buildEmitOptions(opts))
+}
+
+// EmitTo sends event to every client in room, as a consequence of ev. See
+// Emit.
+func (ev *Event) EmitTo(room, event string, data interface{}, opts ...EmitOption) (EmitResult, error) {
+	ns := ev.client.Namespace()
+	msg := Message{Event: event, Room: room, Data: data, hops: ev.msg.hops + 1}
+	return ns.emit(msg, ns.roomClients(room), buildEmitOptions(opts))
+}
+
+// emitChains records the hop count of the message each goroutine is
+// dispatching, so that an emit made synchronously inside the dispatch, by a
+// handler, an OnAny hook or an adapter bridging back into the server,
+// counts one hop deeper whichever method makes it.
+type emitChains struct {
+	// active counts the dispatches in progress, so that emits can skip
+	// looking for theirs while there are none.
+	active atomic.Int32
+	hops   sync.Map // goroutine ID -> int
+}
+
+// enterChain records that the current goroutine dispatches a message hops
+// emits deep, until the returned function is called.
+func (s *Server) enterChain(hops int) (exit func()) {
+	ch := &s.chains
+	id := goroutineID()
+	prev, nested := ch.hops.Load(id)
+	ch.hops.Store(id, hops)
+	ch.active.Add(1)
+	return func() {
+		if nested {
+			ch.hops.Store(id, prev)
+		} else {
+			ch.hops.Delete(id)
+		}
+		ch.active.Add(-1)
+	}
+}
+
+// chainHops returns the hop count of a message emitted on the current
+// goroutine: one more than the dispatch in progress, if that is deeper
+// than hops.
+func (s *Server) chainHops(hops int) int {
+	ch := &s.chains
+	if ch.active.Load() == 0 {
+		return hops
+	}
+	if cur, ok := ch.hops.Load(goroutineID()); ok && cur.(int)+1 > hops {
+		return cur.(int) + 1
+	}
+	return hops
+}
+
+// goroutineID returns the ID of the current goroutine, from the header of
+// its stack trace, "goroutine 42 [running]:".
+func goroutineID() uint64 {
+	var buf [32]byte
+	n := runtime.Stack(buf[:], false)
+	var id uint64
+	for _, b := range bytes.TrimPrefix(buf[:n], []byte("goroutine ")) {
+		if b < '0' || b > '9' {
+			break
+		}
+		id = id*10 + uint64(b-'0')
+	}
+	return id
+}
+
+// checkDepth fails emits of messages chained deeper than the limit.
+func (ns *Namespace) checkDepth(msg Message) error {
+	limit := atomic.LoadInt64(&ns.maxEmitDepth)
+	if limit <= 0 {
+		limit = defaultMaxEmitDepth
+	}
+	if int64(msg.hops) <= limit {
+		return nil
+	}
+	atomic.AddInt64(&ns.emitLoops, 1)
+	err := fmt.Errorf("%w: %q is %d emits deep, limit is %d", ErrEmitLoop, msg.Event, msg.hops, limit)
+	ns.reportError(nil, msg.Event, err)
+	return err
+}
@@ -0,0 +1,168 @@
+package sockx
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// bridgeAdapter hands every published message to publish, synchronously,
+// standing in for an application bridge that feeds messages back into the
+// server.
+type bridgeAdapter struct {
+	mu      sync.Mutex
+	publish func(namespace, room string, msg Message)
+}
+
+func (a *bridgeAdapter) Publish(namespace, room string, msg Message) error {
+	a.mu.Lock()
+	fn := a.publish
+	a.mu.Unlock()
+	if fn != nil {
+		fn(namespace, room, msg)
+	}
+	return nil
+}
+
+func (a *bridgeAdapter) Subscribe(func(namespace, room string, msg Message)) {}
+
+func (a *bridgeAdapter) setPublish(fn func(namespace, room string, msg Message)) {
+	a.mu.Lock()
+	a.publish = fn
+	a.mu.Unlock()
+}
+
+// loopErrors collects the ErrEmitLoop errors reported to ns's OnError.
+func loopErrors(ns *Namespace) func() int {
+	var mu sync.Mutex
+	n := 0
+	ns.OnError(func(c *Client, event string, err error) {
+		if errors.Is(err, ErrEmitLoop) {
+			mu.Lock()
+			n++
+			mu.Unlock()
+		}
+	})
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return n
+	}
+}
+
+func TestEmitLoopThroughNamespaceEmitIsDetected(t *testing.T) {
+	for name, reemit := range map[string]func(ns *Namespace, msg Message) error{
+		"Emit": func(ns *Namespace, msg Message) error {
+			_, err := ns.Emit(msg.Event, msg.Data)
+			return err
+		},
+		"EmitTo": func(ns *Namespace, msg Message) error {
+			_, err := ns.EmitTo("room", msg.Event, msg.Data)
+			return err
+		},
+		"EmitAsync": func(ns *Namespace, msg Message) error {
+			return ns.EmitAsync(msg.Event, msg.Data).err
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bridge := &bridgeAdapter{}
+			s := newTestServer(t, WithAdapter(bridge))
+			ns := s.Of("/")
+			loops := loopErrors(ns)
+			var depth int
+			var loopErr error
+			bridge.setPublish(func(namespace, room string, msg Message) {
+				depth++
+				if err := reemit(ns, msg); err != nil && loopErr == nil {
+					loopErr = err
+				}
+			})
+			done := make(chan struct{})
+			ns.On("start", func(c *Client, data interface{}) {
+				defer close(done)
+				ns.Emit("echo", data)
+			})
+			tc := dial(t, s, "/")
+			tc.emit("start", 1)
+			<-done
+
+			if !errors.Is(loopErr, ErrEmitLoop) {
+				t.Fatalf("loop ended with %v, want ErrEmitLoop", loopErr)
+			}
+			if depth != defaultMaxEmitDepth {
+				t.Errorf("loop published %d times, want %d", depth, defaultMaxEmitDepth)
+			}
+			if n := ns.Stats().EmitLoops; n != 1 {
+				t.Errorf("EmitLoops = %d, want 1", n)
+			}
+			if n := loops(); n != 1 {
+				t.Errorf("OnError saw %d loops, want 1", n)
+			}
+		})
+	}
+}
+
+func TestEmitLoopThroughOnAnyIsDetected(t *testing.T) {
+	bridge := &bridgeAdapter{}
+	s := newTestServer(t, WithAdapter(bridge))
+	ns := s.Of("/")
+	var loopErr error
+	bridge.setPublish(func(namespace, room string, msg Message) {
+		if _, err := ns.Emit(msg.Event, msg.Data); err != nil && loopErr == nil {
+			loopErr = err
+		}
+	})
+	done := make(chan struct{})
+	ns.OnAny(func(c *Client, event string, data interface{}) {
+		defer close(done)
+		ns.Emit(event, data)
+	})
+	tc := dial(t, s, "/")
+	tc.emit("anything", 1)
+	<-done
+	if !errors.Is(loopErr, ErrEmitLoop) {
+		t.Fatalf("loop ended with %v, want ErrEmitLoop", loopErr)
+	}
+}
+
+func TestEmitChainWithinRaisedLimit(t *testing.T) {
+	bridge := &bridgeAdapter{}
+	s := newTestServer(t, WithAdapter(bridge))
+	ns := s.Of("/")
+	ns.SetMaxEmitDepth(20)
+	loops := loopErrors(ns)
+	hops := 0
+	bridge.setPublish(func(namespace, room string, msg Message) {
+		if hops++; hops < 12 {
+			ns.Emit(msg.Event, msg.Data)
+		}
+	})
+	if _, err := ns.Emit("chain", nil); err != nil {
+		t.Fatal(err)
+	}
+	if hops != 12 || loops() != 0 {
+		t.Fatalf("chain of %d emits with %d loops reported, want 12 and none", hops, loops())
+	}
+}
+
+func TestUnchainedEmitsDoNotAccumulateHops(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SetMaxEmitDepth(1)
+	done := make(chan error, 1)
+	ns.On("start", func(c *Client, data interface{}) {
+		var err error
+		for i := 0; i < 5 && err == nil; i++ {
+			_, err = ns.Emit("tick", i)
+		}
+		done <- err
+	})
+	tc := dial(t, s, "/")
+	tc.emit("start", nil)
+	if err := <-done; err != nil {
+		t.Fatalf("sequential emits from a handler: %v", err)
+	}
+	if _, err := ns.Emit("tick", nil); err != nil {
+		t.Fatalf("emit outside any dispatch: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package sockx
+
+import "errors"
+
+var (
+	// ErrAlreadyJoined is returned by Join when the client is already in
+	// the room.
+	ErrAlreadyJoined = errors.New("sockx: already in room")
+
+	// ErrNotMember is returned by Leave when the client is not in the
+	// room.
+	ErrNotMember = errors.New("sockx: not in room")
+
+	// ErrTooManyRooms is returned by Join when the client is already in
+	// Config.MaxRoomsPerClient rooms.
+	ErrTooManyRooms = errors.New("sockx: too many rooms")
+)
+
+// MembershipReason says why a client joined or left a room.
+type MembershipReason int
+
+const (
+	// MembershipRequested is a Join or Leave call.
+	MembershipRequested MembershipReason = iota
+
+	// MembershipDisconnected is a leave caused by the client disconnecting.
+	MembershipDisconnected
+
+	// MembershipMigrated is a move caused by MigrateRoom.
+	MembershipMigrated
+
+	// MembershipKicked is a leave forced by the server, such as the room
+	// guard rejecting a client after its identity changed.
+	MembershipKicked
+)
+
+// String returns the reason's name.
+func (r MembershipReason) String() string {
+	switch r {
+	case MembershipRequested:
+		return "requested"
+	case MembershipDisconnected:
+		return "disconnected"
+	case MembershipMigrated:
+		return "migrated"
+	case MembershipKicked:
+		return "kicked"
+	default:
+		return "unknown"
+	}
+}
+
+// MembershipHook is called after a client joins or leaves a room.
+type MembershipHook func(c *Client, room string, reason MembershipReason)
+
+// OnJoin registers h to be called after a client joins a room of the
+// namespace.
+func (ns *Namespace) OnJoin(h MembershipHook) {
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind == LifecycleJoin {
+			h(ev.Client, ev.Room, ev.MembershipReason)
+		}
+	})
+}
+
+// OnLeave registers h to be called after a client leaves a room of the
+// namespace. By then the client is out of the room, so broadcasts to it
+// from h do not reach the client. When the leave is caused by the client
+// disconnecting, reason is MembershipDisconnected and the client has left
+// the namespace and all its rooms, and emits to the client itself fail
+// with ErrClientClosed, as in disconnect hooks.
+func (ns *Namespace) OnLeave(h MembershipHook) {
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind == LifecycleLeave {
+			h(ev.Client, ev.Room, ev.MembershipReason)
+		}
+	})
+}
+
+// AllowDuplicateJoins makes Join of a room the client is already in
+// succeed without doing anything, instead of returning ErrAlreadyJoined.
+func (ns *Namespace) AllowDuplicateJoins() {
+	ns.mu.Lock()
+	ns.duplicateJoins = true
+	ns.mu.Unlock()
+}
+
+// duplicateJoin returns the result of a Join of a room the client is
+// already in.
+func (ns *Namespace) duplicateJoin() error {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	if ns.duplicateJoins {
+		return nil
+	}
+	return ErrAlreadyJoined
+}
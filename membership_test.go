@@ -0,0 +1,217 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// hookCounts counts the join and leave hooks fired in ns.
+type hookCounts struct {
+	joins, leaves atomic.Int64
+}
+
+func countHooks(ns *Namespace) *hookCounts {
+	h := &hookCounts{}
+	ns.OnJoin(func(c *Client, room string, reason MembershipReason) { h.joins.Add(1) })
+	ns.OnLeave(func(c *Client, room string, reason MembershipReason) { h.leaves.Add(1) })
+	return h
+}
+
+func TestDuplicateJoinAndLeave(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		allowDup   bool
+		op         func(c *Client) error
+		want       error
+		wantJoins  int64
+		wantLeaves int64
+		wantIn     bool
+	}{
+		{"join twice", false, func(c *Client) error { c.Join("r"); return c.Join("r") }, ErrAlreadyJoined, 1, 0, true},
+		{"join twice allowed", true, func(c *Client) error { c.Join("r"); return c.Join("r") }, nil, 1, 0, true},
+		{"leave unknown room", false, func(c *Client) error { return c.Leave("r") }, ErrNotMember, 0, 0, false},
+		{"leave twice", false, func(c *Client) error { c.Join("r"); c.Leave("r"); return c.Leave("r") }, ErrNotMember, 1, 1, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			ns := s.Of("/")
+			if tt.allowDup {
+				ns.AllowDuplicateJoins()
+			}
+			hooks := countHooks(ns)
+			c := NewDetachedClient(ns)
+			if err := tt.op(c); !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if j, l := hooks.joins.Load(), hooks.leaves.Load(); j != tt.wantJoins || l != tt.wantLeaves {
+				t.Errorf("hooks fired %d joins and %d leaves, want %d and %d", j, l, tt.wantJoins, tt.wantLeaves)
+			}
+			if c.InRoom("r") != tt.wantIn {
+				t.Errorf("InRoom = %v, want %v", c.InRoom("r"), tt.wantIn)
+			}
+			if r := ns.Room("r"); tt.wantIn && (r == nil || r.Size() != 1) {
+				t.Error("room does not hold the client exactly once")
+			}
+		})
+	}
+}
+
+func TestConcurrentDuplicateJoinsAndLeaves(t *testing.T) {
+	const n = 32
+	s := newTestServer(t)
+	ns := s.Of("/")
+	hooks := countHooks(ns)
+	c := NewDetachedClient(ns)
+
+	var joined, left atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := c.Join("r"); {
+			case err == nil:
+				joined.Add(1)
+			case !errors.Is(err, ErrAlreadyJoined):
+				t.Errorf("Join: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if joined.Load() != 1 || hooks.joins.Load() != 1 {
+		t.Fatalf("%d concurrent joins succeeded and %d hooks fired, want 1 each", joined.Load(), hooks.joins.Load())
+	}
+	if size := ns.Room("r").Size(); size != 1 {
+		t.Fatalf("room size = %d, want 1", size)
+	}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := c.Leave("r"); {
+			case err == nil:
+				left.Add(1)
+			case !errors.Is(err, ErrNotMember):
+				t.Errorf("Leave: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if left.Load() != 1 || hooks.leaves.Load() != 1 {
+		t.Fatalf("%d concurrent leaves succeeded and %d hooks fired, want 1 each", left.Load(), hooks.leaves.Load())
+	}
+	if c.InRoom("r") || ns.Room("r") != nil {
+		t.Fatal("client still in the room")
+	}
+}
+
+func TestMaxRoomsPerClient(t *testing.T) {
+	s := newTestServer(t, WithMaxRoomsPerClient(2))
+	c := NewDetachedClient(s.Of("/"))
+	c.Join("a")
+	c.Join("b")
+	if err := c.Join("c"); !errors.Is(err, ErrTooManyRooms) {
+		t.Fatalf("Join beyond the cap = %v, want ErrTooManyRooms", err)
+	}
+	if n := c.RoomCount(); n != 2 {
+		t.Fatalf("RoomCount = %d, want 2", n)
+	}
+	c.Leave("a")
+	if err := c.Join("c"); err != nil {
+		t.Fatalf("Join after leaving a room: %v", err)
+	}
+	if err := s.UpdateConfig(func(cfg *Config) { cfg.MaxRoomsPerClient = 3 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Join("d"); err != nil {
+		t.Fatalf("Join under a raised cap: %v", err)
+	}
+}
+
+func TestRoomsAndLeaveAll(t *testing.T) {
+	const n = 8
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var mu sync.Mutex
+	var hooked []string
+	ns.OnLeave(func(c *Client, room string, reason MembershipReason) {
+		mu.Lock()
+		hooked = append(hooked, room+" "+reason.String())
+		mu.Unlock()
+	})
+	c := NewDetachedClient(ns)
+	for _, room := range []string{"b", "c", "a"} {
+		c.Join(room)
+	}
+	rooms := c.Rooms()
+	if fmt.Sprint(rooms) != "[a b c]" {
+		t.Fatalf("Rooms = %v, want [a b c]", rooms)
+	}
+	rooms[0] = "changed"
+	if c.Rooms()[0] != "a" {
+		t.Fatal("Rooms returned the client's own slice")
+	}
+
+	var wg sync.WaitGroup
+	var left []string
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var got []string
+			if i == 0 {
+				if c.Leave("b") == nil {
+					got = []string{"b"}
+				}
+			} else {
+				got = c.LeaveAll()
+			}
+			mu.Lock()
+			left = append(left, got...)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	sort.Strings(left)
+	sort.Strings(hooked)
+	if fmt.Sprint(left) != "[a b c]" {
+		t.Fatalf("rooms left %v, want each of [a b c] once", left)
+	}
+	want := fmt.Sprintf("[a %[1]s b %[1]s c %[1]s]", MembershipRequested)
+	if fmt.Sprint(hooked) != want {
+		t.Fatalf("leave hooks saw %v, want %s", hooked, want)
+	}
+	if len(c.Rooms()) != 0 || ns.Room("a") != nil {
+		t.Fatal("client still in a room")
+	}
+}
+
+// BenchmarkDisconnect measures tearing down a client in many rooms.
+func BenchmarkDisconnect(b *testing.B) {
+	for _, rooms := range []int{10, 10000} {
+		b.Run(fmt.Sprintf("rooms=%d", rooms), func(b *testing.B) {
+			s := newTestServer(b)
+			ns := s.Of("/")
+			names := make([]string, rooms)
+			for i := range names {
+				names[i] = fmt.Sprint("room-", i)
+			}
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				c := NewDetachedClient(ns)
+				for _, room := range names {
+					c.Join(room)
+				}
+				b.StartTimer()
+				c.Disconnect(websocket.CloseNormalClosure, "")
+			}
+		})
+	}
+}
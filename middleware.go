@@ -0,0 +1,75 @@
+package sockx
+
+import (
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxCloseReason is the longest close reason a close frame can carry.
+const maxCloseReason = 123
+
+// Middleware vets a connection before it is added to a namespace. It is
+// given the client, whose ID is already assigned, and the handshake
+// request. Returning an error refuses the connection.
+type Middleware func(c *Client, r *http.Request) error
+
+// Use appends mw to the namespace's connection middleware. ServeWebSocket
+// runs the middleware in registration order after the WebSocket handshake
+// and before the client is added to the namespace. The first error stops
+// the chain: the connection is closed with a policy-violation close frame
+// carrying the error text, and the client is never registered, so no
+// connect or disconnect hooks run for it.
+//
+// Middleware may attach metadata to the client, such as labels, and may
+// call Authenticate; the identity is indexed and the session policy
+// applied once the client is added, and the welcome message carries the
+// user ID instead of a separate EventAuthenticated.
+func (ns *Namespace) Use(mw Middleware) {
+	ns.updateHandlers(func(t *handlerTable) { t.middleware = appendTo(t.middleware, mw) })
+}
+
+// admit runs the namespace's middleware for c. If one refuses the client,
+// admit closes the connection, releases the client's ID and reports false.
+func (ns *Namespace) admit(c *Client, r *http.Request) bool {
+	err := ns.runMiddleware(c, r)
+	if err == nil {
+		return true
+	}
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, closeReason(err.Error()))
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.server.cfg().WriteTimeout))
+	c.conn.Close()
+	c.server.releaseID(c)
+	return false
+}
+
+// runMiddleware runs the namespace's middleware for c and returns the
+// first error.
+func (ns *Namespace) runMiddleware(c *Client, r *http.Request) error {
+	chain := ns.handlers.Load().middleware
+	if len(chain) == 0 {
+		return nil
+	}
+	c.admitting.Store(true)
+	for _, mw := range chain {
+		if err := mw(c, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeReason truncates s to fit a close frame without splitting a UTF-8
+// sequence.
+func closeReason(s string) string {
+	if len(s) <= maxCloseReason {
+		return s
+	}
+	n := maxCloseReason
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
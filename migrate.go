@@ -0,0 +1,274 @@
+package sockx
+
+import "errors"
+
+// EventMigrated is sent to a client that MigrateRoom moved to another
+// namespace.
+const EventMigrated = "sockx:migrated"
+
+// MigratedData is the payload of EventMigrated.
+type MigratedData struct {
+	Namespace string `json:"namespace"`
+	Room      string `json:"room"`
+}
+
+var (
+	// ErrRoomNotFound is returned by MigrateRoom for a room that does not
+	// exist locally.
+	ErrRoomNotFound = errors.New("sockx: room not found")
+
+	// ErrRoomExists is returned by MigrateRoom when the target namespace
+	// already has a room with the same name.
+	ErrRoomExists = errors.New("sockx: room already exists")
+
+	// ErrForeignNamespace is returned by MigrateRoom when the target
+	// namespace belongs to another server.
+	ErrForeignNamespace = errors.New("sockx: namespace belongs to another server")
+)
+
+// MigrateOption customizes MigrateRoom.
+type MigrateOption func(*migrateOptions)
+
+type migrateOptions struct {
+	rejectUnattached bool
+}
+
+// RejectUnattached makes MigrateRoom remove members that are not attached
+// to the target namespace from the room, instead of moving them to the
+// target namespace.
+func RejectUnattached() MigrateOption {
+	return func(o *migrateOptions) { o.rejectUnattached = true }
+}
+
+// roomRef names a room of a namespace.
+type roomRef struct {
+	ns   *Namespace
+	room string
+}
+
+// MigrateRoom atomically moves the named room and its members to target,
+// which must belong to the same server. Members are attached to target:
+// they leave their other rooms in ns, their events are handled by target's
+// handlers from then on, and they are told with EventMigrated. A member
+// whose connection is in target already, multiplexed with EventConnect,
+// stays in ns and its connection's client in target takes its place in
+// the room. With RejectUnattached the other members are removed from the
+// room instead. Room presence
+// carries over for members that move.
+//
+// Every emit to the room lands in exactly one namespace: emits that
+// started before the move are delivered to the members at the time, and
+// later emits to the room in ns find no room. Once the move is complete,
+// ns reports the room destroyed and its members' leaves, and target
+// reports the room created and the joins of the members that moved, all
+// with MembershipMigrated.
+//
+// Migration is local to this server and is not propagated through the
+// adapter.
+func (ns *Namespace) MigrateRoom(roomName string, target *Namespace, opts ...MigrateOption) error {
+	if target.server != ns.server {
+		return ErrForeignNamespace
+	}
+	if target == ns {
+		if ns.Room(roomName) == nil {
+			return ErrRoomNotFound
+		}
+		return nil
+	}
+	var o migrateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Migrations are serialized so that two namespaces are never locked in
+	// opposite orders.
+	ns.server.migrateMu.Lock()
+	defer ns.server.migrateMu.Unlock()
+
+	ns.mu.Lock()
+	target.mu.Lock()
+	r, ok := ns.rooms[roomName]
+	if !ok {
+		target.mu.Unlock()
+		ns.mu.Unlock()
+		return ErrRoomNotFound
+	}
+	if _, ok := target.rooms[roomName]; ok {
+		target.mu.Unlock()
+		ns.mu.Unlock()
+		return ErrRoomExists
+	}
+	if target.archiving[roomName] != nil {
+		target.mu.Unlock()
+		ns.mu.Unlock()
+		return ErrRoomArchiving
+	}
+	delete(ns.rooms, roomName)
+	r.ns.Store(target)
+	target.rooms[roomName] = r
+
+	r.mu.RLock()
+	members := make([]*Client, 0, len(r.clients))
+	for c := range r.clients {
+		members = append(members, c)
+	}
+	r.mu.RUnlock()
+
+	var moved []migration
+	var dropped, left []*Client
+	var leftRooms, destroyed, arrivals []string
+	departures := make(map[roomRef][]string)
+	for _, c := range members {
+		if sub := c.connectionIn(target); sub != nil && target.clients[sub] {
+			// The connection is in target already: its client there
+			// takes over c's membership.
+			c.mu.Lock()
+			delete(c.rooms, roomName)
+			c.mu.Unlock()
+			sub.mu.Lock()
+			sub.rooms[roomName] = true
+			sub.mu.Unlock()
+			var uid string
+			if target.presence != nil {
+				uid = sub.UserID()
+			}
+			if r.add(sub, uid) {
+				arrivals = append(arrivals, uid)
+			}
+			if _, uid, departed, _, _, _ := r.remove(c, 0); departed {
+				ref := roomRef{target, roomName}
+				departures[ref] = append(departures[ref], uid)
+			}
+			moved = append(moved, migration{from: c, to: sub})
+			continue
+		}
+		if !ns.clients[c] || o.rejectUnattached {
+			// Clients that are disconnecting, or rejected by the option.
+			c.mu.Lock()
+			delete(c.rooms, roomName)
+			c.mu.Unlock()
+			_, uid, departed, _, _, _ := r.remove(c, 0)
+			if departed {
+				ref := roomRef{target, roomName}
+				departures[ref] = append(departures[ref], uid)
+			}
+			dropped = append(dropped, c)
+			continue
+		}
+		ns.attachLocked(c, target)
+		for _, other := range c.leaveAllExcept(roomName) {
+			or, ok := ns.rooms[other]
+			if !ok {
+				continue
+			}
+			removed, uid, departed, _, empty, _ := or.remove(c, 0)
+			if empty {
+				delete(ns.rooms, other)
+				ns.reserveArchiveLocked(or)
+				destroyed = append(destroyed, other)
+			}
+			if departed {
+				ref := roomRef{ns, other}
+				departures[ref] = append(departures[ref], uid)
+			}
+			if removed {
+				left = append(left, c)
+				leftRooms = append(leftRooms, other)
+			}
+		}
+		moved = append(moved, migration{from: c, to: c})
+	}
+	r.mu.RLock()
+	empty := len(r.clients) == 0 && len(r.pending) == 0
+	r.mu.RUnlock()
+	if empty {
+		delete(target.rooms, roomName)
+		target.reserveArchiveLocked(r)
+	}
+	target.mu.Unlock()
+	ns.mu.Unlock()
+
+	for _, uid := range arrivals {
+		target.announcePresence(roomName, uid, true)
+	}
+	for ref, uids := range departures {
+		for _, uid := range uids {
+			ref.ns.announcePresence(ref.room, uid, false)
+		}
+	}
+	for i, c := range left {
+		ns.fireMembership(LifecycleLeave, c, leftRooms[i], MembershipMigrated)
+	}
+	for _, room := range destroyed {
+		ns.fireRoom(LifecycleRoomDestroyed, room)
+	}
+	for _, c := range dropped {
+		ns.fireMembership(LifecycleLeave, c, roomName, MembershipMigrated)
+	}
+	for _, m := range moved {
+		m.from.sendControl(EventMigrated, MigratedData{Namespace: target.name, Room: roomName})
+		ns.fireMembership(LifecycleLeave, m.from, roomName, MembershipMigrated)
+	}
+	ns.fireRoom(LifecycleRoomDestroyed, roomName)
+	target.fireRoom(LifecycleRoomCreated, roomName)
+	for _, m := range moved {
+		target.fireMembership(LifecycleJoin, m.to, roomName, MembershipMigrated)
+	}
+	if empty {
+		target.fireRoom(LifecycleRoomDestroyed, roomName)
+	}
+	return nil
+}
+
+// migration is the move of a member of a migrated room from one client to
+// another: the member itself when it is attached to the target namespace,
+// or its connection's client there.
+type migration struct {
+	from, to *Client
+}
+
+// connectionIn returns the client of c's connection in ns, the connection's
+// own client or one added to it with EventConnect, or nil if it has none.
+func (c *Client) connectionIn(ns *Namespace) *Client {
+	root := c
+	if c.parent != nil {
+		root = c.parent
+	}
+	if root.Namespace() == ns {
+		return root
+	}
+	root.mu.RLock()
+	defer root.mu.RUnlock()
+	for sub := range root.mux {
+		if sub.Namespace() == ns {
+			return sub
+		}
+	}
+	return nil
+}
+
+// attachLocked moves c from ns to target. Both namespaces' mutexes must be
+// held for writing.
+func (ns *Namespace) attachLocked(c *Client, target *Namespace) {
+	uid := c.UserID()
+	ns.deleteClientLocked(c)
+	ns.unindexUserLocked(c, uid)
+	target.insertClientLocked(c)
+	target.indexUserLocked(c, uid)
+	c.ns.Store(target)
+}
+
+// leaveAllExcept removes every room but keep from c's room set and returns
+// the removed names.
+func (c *Client) leaveAllExcept(keep string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var rooms []string
+	for room := range c.rooms {
+		if room != keep {
+			rooms = append(rooms, room)
+			delete(c.rooms, room)
+		}
+	}
+	return rooms
+}
@@ -0,0 +1,129 @@
+package sockx
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connectNamespace connects tc's connection to the namespace name with
+// EventConnect and returns its client ID there.
+func (tc *testConn) connectNamespace(name string) string {
+	tc.t.Helper()
+	tc.emit(EventConnect, name)
+	var res ConnectResult
+	if err := tc.expect(EventConnect).Bind(&res); err != nil || res.Error != nil {
+		tc.t.Fatalf("connecting to %s: %v %+v", name, err, res.Error)
+	}
+	return res.ID
+}
+
+// membershipLog records the joins and leaves of namespaces.
+type membershipLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *membershipLog) watch(ns *Namespace) {
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind != LifecycleJoin && ev.Kind != LifecycleLeave {
+			return
+		}
+		l.mu.Lock()
+		l.events = append(l.events, fmt.Sprintf("%s %s %s %s", ns.Name(), ev.Kind, ev.Room, ev.Client.ID()))
+		l.mu.Unlock()
+	})
+}
+
+func (l *membershipLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprint(l.events)
+}
+
+func TestMigrateRoomAttachesMember(t *testing.T) {
+	s := newTestServer(t)
+	ns, target := s.Of("/"), s.Of("/b")
+	tc := dial(t, s, "/")
+	c := ns.Client(tc.welcome.ID)
+	c.Join("r")
+	c.Join("other")
+	var log membershipLog
+	log.watch(ns)
+	log.watch(target)
+
+	if err := ns.MigrateRoom("r", target); err != nil {
+		t.Fatal(err)
+	}
+	var notice MigratedData
+	if err := tc.expect(EventMigrated).Bind(&notice); err != nil || notice != (MigratedData{Namespace: "/b", Room: "r"}) {
+		t.Fatalf("notice = %+v, %v", notice, err)
+	}
+	if ns.Client(c.ID()) != nil || target.Client(c.ID()) != c || ns.Room("r") != nil {
+		t.Fatal("member not attached to the target namespace")
+	}
+	if rooms := c.Rooms(); len(rooms) != 1 || rooms[0] != "r" {
+		t.Fatalf("rooms after migrating = %v, want [r]", rooms)
+	}
+	id := c.ID()
+	want := fmt.Sprintf("[/ leave other %s / leave r %s /b join r %s]", id, id, id)
+	if got := log.String(); got != want {
+		t.Fatalf("membership changes = %s, want %s", got, want)
+	}
+	target.EmitTo("r", "news", 1)
+	tc.expect("news")
+}
+
+func TestMigrateRoomHandsMembershipToExistingClient(t *testing.T) {
+	s := newTestServer(t)
+	ns, target := s.Of("/"), s.Of("/b")
+	tc := dial(t, s, "/")
+	subID := tc.connectNamespace("/b")
+	c := ns.Client(tc.welcome.ID)
+	c.Join("r")
+	var log membershipLog
+	log.watch(ns)
+	log.watch(target)
+
+	if err := ns.MigrateRoom("r", target); err != nil {
+		t.Fatal(err)
+	}
+	tc.expect(EventMigrated)
+	sub := target.Client(subID)
+	if ns.Client(c.ID()) != c || len(c.Rooms()) != 0 {
+		t.Fatalf("member left %s or kept rooms %v", ns.Name(), c.Rooms())
+	}
+	if members := target.Room("r").Clients(); len(members) != 1 || members[0] != sub {
+		t.Fatalf("target room members = %v, want the connection's client there", members)
+	}
+	want := fmt.Sprintf("[/ leave r %s /b join r %s]", c.ID(), subID)
+	if got := log.String(); got != want {
+		t.Fatalf("membership changes = %s, want %s", got, want)
+	}
+
+	target.EmitTo("r", "news", 1)
+	if msg := tc.expect("news"); msg.Namespace != "/b" {
+		t.Fatalf("news arrived in namespace %q", msg.Namespace)
+	}
+	tc.expectNone("news", 200*time.Millisecond)
+}
+
+func TestMigrateRoomRejectUnattached(t *testing.T) {
+	s := newTestServer(t)
+	ns, target := s.Of("/"), s.Of("/b")
+	tc := dial(t, s, "/")
+	c := ns.Client(tc.welcome.ID)
+	c.Join("r")
+
+	if err := ns.MigrateRoom("r", target, RejectUnattached()); err != nil {
+		t.Fatal(err)
+	}
+	if ns.Client(c.ID()) != c || len(c.Rooms()) != 0 || target.Room("r") != nil {
+		t.Fatalf("unattached member moved: rooms %v", c.Rooms())
+	}
+	if err := ns.MigrateRoom("r", target); err != ErrRoomNotFound {
+		t.Fatalf("migrating a moved room = %v, want ErrRoomNotFound", err)
+	}
+	tc.expectNone(EventMigrated, 200*time.Millisecond)
+}
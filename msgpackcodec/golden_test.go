@@ -0,0 +1,22 @@
+package msgpackcodec_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/NRO04/sockx/msgpackcodec"
+	"github.com/NRO04/sockx/sockxtest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestMessagePackGolden(t *testing.T) {
+	if *update {
+		if err := sockxtest.WriteGolden("testdata", msgpackcodec.MessagePackCodec{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sockxtest.VerifyGolden("testdata", msgpackcodec.MessagePackCodec{}, msgpackcodec.Decode); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+// Package msgpackcodec provides a sockx.Codec that encodes messages as
+// MessagePack, which is smaller and faster to parse than JSON for
+// high-frequency events:
+//
+//	srv := sockx.NewServer(sockx.WithCodec(msgpackcodec.MessagePackCodec{}))
+//
+// Messages are sent as WebSocket binary messages. Their fields have the
+// names of Message's JSON encoding, so a message is a map with the keys
+// "event", "data" and so on. []byte data is encoded as MessagePack bin,
+// and decoded back to []byte, so binary payloads need no special framing.
+// Integers in received data decode to Go integer types rather than to
+// float64 as with JSON, and maps to map[string]interface{}.
+package msgpackcodec
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/NRO04/sockx"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// errTextMessage is returned for text messages, which a MessagePack
+// client does not send.
+var errTextMessage = errors.New("msgpackcodec: text message where MessagePack was expected")
+
+// MessagePackCodec encodes messages as MessagePack. The zero value is
+// ready to use.
+type MessagePackCodec struct{}
+
+// Marshal encodes msg as a MessagePack binary message.
+func (MessagePackCodec) Marshal(msg sockx.Message) ([]byte, int, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(&msg); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), websocket.BinaryMessage, nil
+}
+
+// Unmarshal decodes a MessagePack binary message into msg.
+func (MessagePackCodec) Unmarshal(data []byte, msgType int, msg *sockx.Message) error {
+	if msgType != websocket.BinaryMessage {
+		return errTextMessage
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(msg)
+}
+
+// Decode decodes a MessagePack message into generic values, maps with
+// string keys, slices and scalars, as sockxtest.VerifyGolden compares
+// them.
+func Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,166 @@
+package msgpackcodec_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/msgpackcodec"
+	"github.com/gorilla/websocket"
+)
+
+// testTimeout bounds every wait in the tests.
+const testTimeout = 5 * time.Second
+
+// telemetry is nested data with numbers of several kinds and raw bytes.
+func telemetry() map[string]interface{} {
+	return map[string]interface{}{
+		"sensor": "t-1",
+		"readings": []interface{}{
+			map[string]interface{}{"at": 1700000000, "value": -12.5},
+			map[string]interface{}{"at": 1700000001, "value": 3},
+		},
+		"limits": map[string]interface{}{"min": -40, "max": 85, "big": 1 << 40},
+		"blob":   []byte{0, 1, 2, 0xfe, 0xff},
+	}
+}
+
+// normalize makes decoded values comparable across codecs: numbers become
+// float64, and bytes the base64 strings JSON encodes them as.
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch {
+	case v == nil:
+		return nil
+	case rv.Kind() == reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[k.String()] = normalize(rv.MapIndex(k).Interface())
+		}
+		return m
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		return base64.StdEncoding.EncodeToString(rv.Bytes())
+	case rv.Kind() == reflect.Slice:
+		s := make([]interface{}, rv.Len())
+		for i := range s {
+			s[i] = normalize(rv.Index(i).Interface())
+		}
+		return s
+	case rv.CanInt():
+		return float64(rv.Int())
+	case rv.CanUint():
+		return float64(rv.Uint())
+	case rv.CanFloat():
+		return rv.Float()
+	}
+	return v
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		codec   sockx.Codec
+		msgType int
+	}{
+		{"json", sockx.JSONCodec{}, websocket.TextMessage},
+		{"msgpack", msgpackcodec.MessagePackCodec{}, websocket.BinaryMessage},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			in := sockx.Message{Event: "telemetry", Room: "plant", Data: telemetry(), Ack: 7}
+			data, msgType, err := tt.codec.Marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgType != tt.msgType {
+				t.Fatalf("message type = %d, want %d", msgType, tt.msgType)
+			}
+			var out sockx.Message
+			if err := tt.codec.Unmarshal(data, msgType, &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Event != in.Event || out.Room != in.Room || out.Ack != in.Ack {
+				t.Fatalf("envelope = %+v, want %+v", out, in)
+			}
+			if got, want := normalize(out.Data), normalize(in.Data); !reflect.DeepEqual(got, want) {
+				t.Fatalf("data = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestMessagePackKeepsBytesAndIntegers(t *testing.T) {
+	c := msgpackcodec.MessagePackCodec{}
+	data, msgType, err := c.Marshal(sockx.Message{Event: "e", Data: telemetry()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out sockx.Message
+	if err := c.Unmarshal(data, msgType, &out); err != nil {
+		t.Fatal(err)
+	}
+	m := out.Data.(map[string]interface{})
+	if b, ok := m["blob"].([]byte); !ok || !bytes.Equal(b, []byte{0, 1, 2, 0xfe, 0xff}) {
+		t.Errorf("blob = %#v, want the original []byte", m["blob"])
+	}
+	switch big := m["limits"].(map[string]interface{})["big"].(type) {
+	case int64, uint64:
+		if normalize(big) != float64(1<<40) {
+			t.Errorf("big = %d, want 1<<40", big)
+		}
+	default:
+		t.Errorf("big = %#v, want a 64-bit integer", big)
+	}
+	if err := c.Unmarshal([]byte(`{"event":"e"}`), websocket.TextMessage, &out); err == nil {
+		t.Error("text message accepted")
+	}
+}
+
+func TestNamespaceCodec(t *testing.T) {
+	s := sockx.NewServer()
+	s.Of("/telemetry").SetCodec(msgpackcodec.MessagePackCodec{})
+	s.Of("/telemetry").On("echo", func(c *sockx.Client, data interface{}) { c.Emit("echo", data) })
+	ts := httptest.NewServer(s.ServeWebSocket("/telemetry"))
+	t.Cleanup(func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	codec := msgpackcodec.MessagePackCodec{}
+	read := func() sockx.Message {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(testTimeout))
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg sockx.Message
+		if err := codec.Unmarshal(data, msgType, &msg); err != nil {
+			t.Fatalf("frame not MessagePack: %v", err)
+		}
+		return msg
+	}
+	if msg := read(); msg.Event != sockx.EventWelcome {
+		t.Fatalf("first message = %s, want the welcome", msg.Event)
+	}
+	data, msgType, _ := codec.Marshal(sockx.Message{Event: "echo", Data: telemetry()})
+	if err := conn.WriteMessage(msgType, data); err != nil {
+		t.Fatal(err)
+	}
+	msg := read()
+	if got, want := normalize(msg.Data), normalize(telemetry()); msg.Event != "echo" || !reflect.DeepEqual(got, want) {
+		t.Fatalf("echo = %s %#v, want %#v", msg.Event, got, want)
+	}
+}
@@ -0,0 +1,323 @@
+package sockx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Events of namespace multiplexing, which lets one connection take part
+// in several namespaces of the server.
+const (
+	// EventConnect is sent by a client to connect its connection to
+	// another namespace, named by its Data. The server answers with an
+	// EventConnect whose Namespace is the requested one and whose Data is
+	// a ConnectResult.
+	//
+	// Once connected, messages whose Namespace field names the namespace
+	// are handled there, messages without one in the namespace the
+	// connection was made to, and messages sent to the client in a
+	// namespace it connected to this way carry the namespace's name.
+	// Acknowledgements must name the namespace of the message they answer.
+	EventConnect = "sockx:connect"
+
+	// EventDisconnect leaves a namespace joined with EventConnect, named
+	// by its Namespace field. The server sends it, with the reason as
+	// Data, when it disconnects the client from such a namespace.
+	EventDisconnect = "sockx:disconnect"
+)
+
+// Error codes refusing an EventConnect. ErrCodeUnknownNamespace names a
+// namespace the server does not serve; ErrCodeTooManyNamespaces is sent
+// to a connection in Config.MaxNamespacesPerConnection namespaces already.
+const (
+	ErrCodeUnknownNamespace  = "unknown_namespace"
+	ErrCodeTooManyNamespaces = "too_many_namespaces"
+)
+
+// ErrTooManyNamespaces is reported to the OnError hooks of a connection's
+// namespace when it asks to connect to more namespaces than
+// Config.MaxNamespacesPerConnection allows.
+var ErrTooManyNamespaces = errors.New("sockx: too many namespaces")
+
+// ConnectResult answers an EventConnect. ID is the client ID the
+// connection has in the namespace; Error is set when it was refused.
+type ConnectResult struct {
+	ID    string     `json:"id,omitempty"`
+	Error *ErrorData `json:"error,omitempty"`
+}
+
+var errOriginRejected = errors.New("sockx: origin not allowed")
+
+// route returns the client msg is addressed to: c itself, or the client
+// of the namespace named by msg.Namespace that c connected with
+// EventConnect. It returns nil if the connection is not in that namespace.
+func (c *Client) route(msg Message) *Client {
+	if msg.Namespace == "" || msg.Namespace == c.Namespace().name {
+		return c
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for sub := range c.mux {
+		if sub.Namespace().name == msg.Namespace {
+			return sub
+		}
+	}
+	return nil
+}
+
+// handleMux handles EventConnect and EventDisconnect from c.
+func (c *Client) handleMux(msg Message) {
+	name, _ := msg.Data.(string)
+	if name == "" {
+		name = msg.Namespace
+	}
+	if msg.Event == EventDisconnect {
+		if msg.Namespace == "" {
+			msg.Namespace = name
+		}
+		if sub := c.route(msg); sub != nil && sub != c {
+			sub.teardown(ReasonNamespaceLeft, nil, nil)
+		}
+		return
+	}
+	res := c.connectNamespace(name)
+	m, err := c.encode(Message{Event: EventConnect, Namespace: name, Data: res})
+	if err != nil {
+		return
+	}
+	c.queue.push(m, true)
+}
+
+// connectNamespace adds c's connection to the named namespace, subject to
+// the namespace's upgrade policy and middleware as applied to c's
+// handshake request.
+func (c *Client) connectNamespace(name string) ConnectResult {
+	if sub := c.route(Message{Namespace: name}); sub != nil {
+		return ConnectResult{ID: sub.id}
+	}
+	s := c.server
+	refuse := func(code, message string) ConnectResult {
+		return ConnectResult{Error: &ErrorData{Code: code, Message: message}}
+	}
+	if name == "" {
+		return refuse(ErrCodeBadMessage, "connect request names no namespace")
+	}
+	if s.closing.Load() {
+		return refuse(ErrCodeUnavailable, shutdownReason)
+	}
+	if max := s.cfg().MaxNamespacesPerConnection; max > 0 {
+		c.mu.RLock()
+		n := len(c.mux)
+		c.mu.RUnlock()
+		if n >= max {
+			c.Namespace().reportError(c, EventConnect, ErrTooManyNamespaces)
+			return c.refuseConnect(ErrCodeTooManyNamespaces, "too many namespaces", 0)
+		}
+	}
+	ns, refused := c.connectTarget(name)
+	if refused != nil {
+		return *refused
+	}
+	if !ns.IsReady() {
+		return refuse(ErrCodeUnavailable, "namespace not ready")
+	}
+	if ok, _ := ns.admitConnection(); !ok {
+		return refuse(ErrCodeUnavailable, "namespace temporarily unavailable")
+	}
+	if err := ns.checkHandshake(c.request); err != nil {
+		return refuse(ErrCodeForbidden, err.Error())
+	}
+
+	sub := newClient(ns, c.conn, c.queue)
+	sub.parent = c
+	sub.codec = c.codec
+	sub.locale = c.Locale()
+	sub.realIP = c.realIP
+	sub.request = c.request
+	sub.WithContext(c.Context())
+	c.mu.RLock()
+	sub.features = c.features
+	c.mu.RUnlock()
+	if err := ns.runMiddleware(sub, c.request); err != nil {
+		s.releaseID(sub)
+		return refuse(ErrCodeForbidden, err.Error())
+	}
+
+	others := ns.addClient(sub)
+	c.mu.Lock()
+	closed := c.muxClosed
+	if !closed {
+		if c.mux == nil {
+			c.mux = make(map[*Client]bool)
+		}
+		c.mux[sub] = true
+	}
+	c.mu.Unlock()
+	if closed {
+		// The connection went away while the client was being added.
+		sub.teardown(ReasonTransportClosed, nil, nil)
+		return refuse(ErrCodeUnavailable, "connection closed")
+	}
+	for _, other := range others {
+		other.disconnect(websocket.ClosePolicyViolation, "session replaced")
+	}
+	s.matchTrace(sub)
+	s.startGuestClock(sub)
+	ns.fire(LifecycleEvent{Kind: LifecycleConnect, Client: sub})
+	return ConnectResult{ID: sub.id}
+}
+
+// connectTarget returns the namespace name that c asked to connect to,
+// creating it if allowed: Config.VetoNamespace and NamespaceCreationRate
+// apply to namespaces that do not exist yet. If the connect is refused,
+// the result to answer it with is returned instead.
+func (c *Client) connectTarget(name string) (*Namespace, *ConnectResult) {
+	s := c.server
+	cfg := s.cfg()
+	s.mu.RLock()
+	ns := s.namespaces[name]
+	s.mu.RUnlock()
+	if ns == nil && !cfg.StrictNamespaces {
+		if cfg.VetoNamespace != nil {
+			if err := cfg.VetoNamespace(name, c.request); err != nil {
+				res := c.refuseConnect(ErrCodeForbidden, err.Error(), 0)
+				return nil, &res
+			}
+		}
+		if ok, retry, _ := s.nsCreation.Allow("namespaces", 1); !ok {
+			res := c.refuseConnect(ErrCodeRateLimited, "namespace creation rate exceeded", retry)
+			return nil, &res
+		}
+	}
+	ns, ok := s.namespaceFor(name)
+	if !ok {
+		return nil, &ConnectResult{Error: &ErrorData{Code: ErrCodeUnknownNamespace, Message: "unknown namespace"}}
+	}
+	return ns, nil
+}
+
+// refuseConnect refuses an EventConnect from c that overstepped a limit,
+// with retry advice escalated for the client like other rejections.
+func (c *Client) refuseConnect(code, message string, floor time.Duration) ConnectResult {
+	d := c.server.rejections.reject(c.rateSubject(), floor)
+	return ConnectResult{Error: &ErrorData{Code: code, Message: message, RetryAfterMs: d.Milliseconds()}}
+}
+
+// Namespaces returns the names of the namespaces the client's connection
+// takes part in: the one it was made to, followed by those it connected
+// to with EventConnect, sorted.
+func (c *Client) Namespaces() []string {
+	root := c
+	if c.parent != nil {
+		root = c.parent
+	}
+	root.mu.RLock()
+	names := make([]string, 0, len(root.mux)+1)
+	for sub := range root.mux {
+		names = append(names, sub.Namespace().name)
+	}
+	root.mu.RUnlock()
+	sort.Strings(names)
+	return append([]string{root.Namespace().name}, names...)
+}
+
+// detachMux forgets sub, a client c created with EventConnect, and tells
+// the client if the server disconnected it with the close frame final.
+func (c *Client) detachMux(sub *Client, final *outbound) {
+	c.mu.Lock()
+	delete(c.mux, sub)
+	c.mu.Unlock()
+	if final == nil {
+		return
+	}
+	reason := ""
+	if len(final.data) > 2 {
+		reason = string(final.data[2:])
+	}
+	sub.sendControl(EventDisconnect, reason)
+}
+
+// takeMux removes and returns the clients c created with EventConnect,
+// and stops further ones from being added.
+func (c *Client) takeMux() []*Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	subs := make([]*Client, 0, len(c.mux))
+	for sub := range c.mux {
+		subs = append(subs, sub)
+	}
+	c.mux, c.muxClosed = nil, true
+	return subs
+}
+
+// muxNamespace returns the namespace name to stamp on messages to c: its
+// namespace's if c was created with EventConnect, and "" otherwise.
+func (c *Client) muxNamespace() string {
+	if c.parent == nil {
+		return ""
+	}
+	return c.Namespace().name
+}
+
+// checkHandshake applies the namespace's upgrade policy to r, the
+// handshake of a connection made to another namespace.
+func (ns *Namespace) checkHandshake(r *http.Request) error {
+	p := ns.upgradePolicy.Load()
+	if p == nil {
+		if !ns.server.upgrader.CheckOrigin(r) {
+			return errOriginRejected
+		}
+		return nil
+	}
+	if p.requireClientCert && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return errors.New("client certificate required")
+	}
+	check := p.upgrader.CheckOrigin
+	if check == nil {
+		check = sameOrigin
+	}
+	if !check(r) {
+		return errOriginRejected
+	}
+	return nil
+}
+
+// sameOrigin is the websocket package's default origin check: requests
+// without an Origin header, or whose Origin host matches Host, pass.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// inNamespace returns a copy of the encoded message m that names the
+// namespace ns, for a client that connected to it with EventConnect. m
+// must have been encoded by j.
+func (j JSONCodec) inNamespace(m *outbound, ns string) *outbound {
+	name := j.envelope().quoted[fieldNamespace]
+	field, _ := json.Marshal(ns)
+	var b bytes.Buffer
+	b.Grow(len(m.data) + len(name) + len(field) + 3)
+	b.WriteByte('{')
+	b.Write(name)
+	b.WriteByte(':')
+	b.Write(field)
+	if len(m.data) > 2 {
+		b.WriteByte(',')
+	}
+	b.Write(m.data[1:])
+	tagged := *m
+	tagged.data = b.Bytes()
+	return &tagged
+}
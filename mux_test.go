@@ -0,0 +1,100 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// refusedConnect sends EventConnect for name on tc and returns the error
+// the server refused it with.
+func (tc *testConn) refusedConnect(name string) *ErrorData {
+	tc.t.Helper()
+	tc.emit(EventConnect, name)
+	var res ConnectResult
+	if err := tc.expect(EventConnect).Bind(&res); err != nil {
+		tc.t.Fatal(err)
+	}
+	if res.Error == nil {
+		tc.t.Fatalf("connect to %s accepted as %s", name, res.ID)
+	}
+	return res.Error
+}
+
+func TestMaxNamespacesPerConnection(t *testing.T) {
+	s := newTestServer(t, WithMaxNamespacesPerConnection(2))
+	ns := s.Of("/")
+	var log errorLog
+	log.watch(ns)
+	tc := dial(t, s, "/")
+	a := tc.connectNamespace("/a")
+	tc.connectNamespace("/b")
+
+	e := tc.refusedConnect("/c")
+	if e.Code != ErrCodeTooManyNamespaces || e.RetryAfterMs <= 0 {
+		t.Fatalf("third namespace refused with %+v, want %s and retry advice", e, ErrCodeTooManyNamespaces)
+	}
+	if err := log.last(); !errors.Is(err, ErrTooManyNamespaces) {
+		t.Fatalf("OnError got %v, want %v", err, ErrTooManyNamespaces)
+	}
+	if s.Of("/c").Client(tc.welcome.ID) != nil {
+		t.Fatal("refused connection joined /c")
+	}
+	// Namespaces the connection is in already do not count again.
+	if id := tc.connectNamespace("/a"); id != a {
+		t.Fatalf("reconnecting to /a gave %s, want %s", id, a)
+	}
+
+	want := "[/ /a /b]"
+	if got := fmt.Sprint(ns.Client(tc.welcome.ID).Namespaces()); got != want {
+		t.Fatalf("Namespaces = %s, want %s", got, want)
+	}
+	if got := fmt.Sprint(s.Of("/b").Clients()[0].Namespaces()); got != want {
+		t.Fatalf("Namespaces of the /b client = %s, want %s", got, want)
+	}
+}
+
+func TestNamespaceCreationIsVetoedAndRateLimited(t *testing.T) {
+	s := newTestServer(t,
+		WithNamespaceCreationRate(RateLimit{Rate: 0.01, Burst: 1}),
+		WithNamespaceVeto(func(name string, r *http.Request) error {
+			if strings.HasPrefix(name, "/private") {
+				return fmt.Errorf("%s is private", name)
+			}
+			return nil
+		}))
+	s.Of("/private/ok")
+	tc := dial(t, s, "/")
+
+	if e := tc.refusedConnect("/private/x"); e.Code != ErrCodeForbidden || e.Message != "/private/x is private" {
+		t.Fatalf("vetoed namespace refused with %+v", e)
+	}
+	// The vetoed namespace took no creation token.
+	tc.connectNamespace("/a")
+	if e := tc.refusedConnect("/b"); e.Code != ErrCodeRateLimited || e.RetryAfterMs <= 0 {
+		t.Fatalf("second new namespace refused with %+v, want %s", e, ErrCodeRateLimited)
+	}
+	// Namespaces that exist are neither vetoed nor limited.
+	tc.connectNamespace("/private/ok")
+	for _, created := range s.namespaceList() {
+		if created.Name() == "/b" || created.Name() == "/private/x" {
+			t.Fatalf("refused namespace %s was created", created.Name())
+		}
+	}
+}
+
+func TestMuxClientsShareTheConnectionQueue(t *testing.T) {
+	s := newTestServer(t)
+	tc := dial(t, s, "/")
+	parent := tc.client(s.Of("/"))
+	sub := s.Of("/b").Client(tc.connectNamespace("/b"))
+	if sub.queue != parent.queue {
+		t.Fatal("client of /b has a send queue of its own")
+	}
+	s.Of("/b").Emit("news", 1)
+	if msg := tc.expect("news"); msg.Namespace != "/b" {
+		t.Fatalf("news arrived for namespace %q, want /b", msg.Namespace)
+	}
+}
@@ -0,0 +1,131 @@
+// Package naclbox provides a sockx.PayloadTransformer that seals the data
+// of messages for each recipient with NaCl box, so that only the recipient
+// can read it, even where the transport is terminated by a proxy:
+//
+//	sealer := naclbox.New(serverPrivateKey, naclbox.ClaimKey("boxKey"))
+//	ns.SetPayloadTransformer(sealer.Transform, "dm", "account")
+//
+// The recipient's public key comes from its connection, here from the
+// claim "boxKey" passed to Authenticate. Clients that have no key are
+// skipped. The sealed data is a 24-byte random nonce followed by the
+// box; clients open it with Open, or any NaCl implementation, using the
+// server's public key, and decode the plaintext as JSON.
+package naclbox
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/NRO04/sockx"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// KeySize is the size of NaCl box keys, and NonceSize that of the nonce
+// prefixed to sealed data.
+const (
+	KeySize   = 32
+	NonceSize = 24
+)
+
+var (
+	// ErrNoKey is returned by a KeyFunc for a client without a public key.
+	ErrNoKey = errors.New("naclbox: client has no public key")
+
+	// ErrOpen is returned by Open for data that is not a box sealed for
+	// the given keys.
+	ErrOpen = errors.New("naclbox: cannot open box")
+)
+
+// KeyFunc returns the public key of the recipient c.
+type KeyFunc func(c *sockx.Client) (*[KeySize]byte, error)
+
+// Sealer seals message data with the server's private key for the public
+// key of each recipient.
+type Sealer struct {
+	privateKey   *[KeySize]byte
+	recipientKey KeyFunc
+}
+
+// New returns a Sealer sealing with privateKey, the server's, for the keys
+// recipientKey returns.
+func New(privateKey *[KeySize]byte, recipientKey KeyFunc) *Sealer {
+	return &Sealer{privateKey: privateKey, recipientKey: recipientKey}
+}
+
+// Transform seals data for c. It is a sockx.PayloadTransformer.
+func (s *Sealer) Transform(c *sockx.Client, event string, data []byte) ([]byte, error) {
+	key, err := s.recipientKey(c)
+	if err != nil {
+		return nil, err
+	}
+	var nonce [NonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	return box.Seal(nonce[:], data, &nonce, key, s.privateKey), nil
+}
+
+// Open opens sealed, data sealed by a Sealer, with the sender's public key
+// and the recipient's private key.
+func Open(sealed []byte, senderKey, privateKey *[KeySize]byte) ([]byte, error) {
+	if len(sealed) < NonceSize+box.Overhead {
+		return nil, ErrOpen
+	}
+	var nonce [NonceSize]byte
+	copy(nonce[:], sealed)
+	data, ok := box.Open(nil, sealed[NonceSize:], &nonce, senderKey, privateKey)
+	if !ok {
+		return nil, ErrOpen
+	}
+	return data, nil
+}
+
+// ClaimKey returns a KeyFunc reading the recipient's key from its claim
+// name, which holds the key as a *[32]byte, a 32-byte []byte, or a string
+// of the standard base64 encoding of one.
+func ClaimKey(name string) KeyFunc {
+	return func(c *sockx.Client) (*[KeySize]byte, error) {
+		return parseKey(c.Claims()[name])
+	}
+}
+
+// LabelKey returns a KeyFunc reading the recipient's key from its label
+// name, in the standard base64 encoding.
+func LabelKey(name string) KeyFunc {
+	return func(c *sockx.Client) (*[KeySize]byte, error) {
+		return parseKey(c.Label(name))
+	}
+}
+
+func parseKey(v interface{}) (*[KeySize]byte, error) {
+	var raw []byte
+	switch v := v.(type) {
+	case *[KeySize]byte:
+		if v == nil {
+			return nil, ErrNoKey
+		}
+		return v, nil
+	case []byte:
+		raw = v
+	case string:
+		if v == "" {
+			return nil, ErrNoKey
+		}
+		var err error
+		if raw, err = base64.StdEncoding.DecodeString(v); err != nil {
+			return nil, fmt.Errorf("naclbox: bad public key: %w", err)
+		}
+	case nil:
+		return nil, ErrNoKey
+	default:
+		return nil, fmt.Errorf("naclbox: public key of type %T", v)
+	}
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("naclbox: public key of %d bytes, want %d", len(raw), KeySize)
+	}
+	key := new([KeySize]byte)
+	copy(key[:], raw)
+	return key, nil
+}
@@ -0,0 +1,181 @@
+package naclbox_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/naclbox"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// testTimeout bounds every wait in the tests.
+const testTimeout = 5 * time.Second
+
+// newServer returns a server shut down when the test ends.
+func newServer(t *testing.T) *sockx.Server {
+	s := sockx.NewServer()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s
+}
+
+type keyPair struct{ public, private *[naclbox.KeySize]byte }
+
+func newKeyPair(t *testing.T) keyPair {
+	t.Helper()
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPair{pub, priv}
+}
+
+// recipient is a detached client collecting the messages sent to it.
+type recipient struct {
+	client *sockx.Client
+	msgs   chan sockx.Message
+}
+
+func newRecipient(t *testing.T, ns *sockx.Namespace, claims map[string]interface{}) *recipient {
+	t.Helper()
+	r := &recipient{msgs: make(chan sockx.Message, 16)}
+	r.client = sockx.NewDetachedClient(ns, sockx.DetachedOutbox(func(frame []byte) {
+		var msg sockx.Message
+		json.Unmarshal(frame, &msg)
+		r.msgs <- msg
+	}))
+	if claims != nil {
+		if err := r.client.Authenticate(r.client.ID(), claims); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.client.Join("r")
+	return r
+}
+
+// next returns the next message event, skipping others.
+func (r *recipient) next(t *testing.T, event string) sockx.Message {
+	t.Helper()
+	for {
+		select {
+		case msg := <-r.msgs:
+			if msg.Event == event {
+				return msg
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("no %s message", event)
+		}
+	}
+}
+
+// sealed decodes the base64 data of msg.
+func sealed(t *testing.T, msg sockx.Message) []byte {
+	t.Helper()
+	s, _ := msg.Data.(string)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("data %v is not base64: %v", msg.Data, err)
+	}
+	return b
+}
+
+func TestSealedPerRecipient(t *testing.T) {
+	server, alice, bob := newKeyPair(t), newKeyPair(t), newKeyPair(t)
+	ns := newServer(t).Of("/")
+	ns.SetPayloadTransformer(naclbox.New(server.private, naclbox.ClaimKey("boxKey")).Transform, "dm")
+	var mu sync.Mutex
+	var errs []error
+	ns.OnError(func(c *sockx.Client, event string, err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+
+	a := newRecipient(t, ns, map[string]interface{}{"boxKey": alice.public})
+	b := newRecipient(t, ns, map[string]interface{}{"boxKey": base64.StdEncoding.EncodeToString(bob.public[:])})
+	anon := newRecipient(t, ns, nil)
+	res, err := ns.Room("r").Emit("dm", map[string]string{"text": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Delivered != 2 || res.Dropped != 1 {
+		t.Fatalf("result = %+v, want 2 delivered and the keyless client dropped", res)
+	}
+	mu.Lock()
+	if len(errs) != 1 || !errors.Is(errs[0], naclbox.ErrNoKey) {
+		t.Errorf("errors reported = %v, want ErrNoKey", errs)
+	}
+	mu.Unlock()
+
+	boxA, boxB := sealed(t, a.next(t, "dm")), sealed(t, b.next(t, "dm"))
+	if bytes.Equal(boxA, boxB) {
+		t.Fatal("both recipients got the same ciphertext")
+	}
+	for _, tt := range []struct {
+		name  string
+		box   []byte
+		owner keyPair
+	}{{"alice", boxA, alice}, {"bob", boxB, bob}} {
+		plain, err := naclbox.Open(tt.box, server.public, tt.owner.private)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(plain) != `{"text":"secret"}` {
+			t.Fatalf("%s opened %s", tt.name, plain)
+		}
+	}
+	if _, err := naclbox.Open(boxA, server.public, bob.private); !errors.Is(err, naclbox.ErrOpen) {
+		t.Fatalf("bob opening alice's box = %v, want ErrOpen", err)
+	}
+
+	// Events outside the allow-list are sent as is, to every member.
+	ns.Room("r").Emit("public", "hello")
+	for _, r := range []*recipient{a, b, anon} {
+		if msg := r.next(t, "public"); msg.Data != "hello" {
+			t.Fatalf("public data = %v, want it unsealed", msg.Data)
+		}
+	}
+}
+
+func TestRecipientKeys(t *testing.T) {
+	key := newKeyPair(t).public
+	c := sockx.NewDetachedClient(newServer(t).Of("/"))
+	for _, tt := range []struct {
+		name  string
+		claim interface{}
+		ok    bool
+	}{
+		{"array", key, true},
+		{"bytes", key[:], true},
+		{"base64", base64.StdEncoding.EncodeToString(key[:]), true},
+		{"missing", nil, false},
+		{"short", key[:16], false},
+		{"not base64", "!!", false},
+		{"wrong type", 42, false},
+	} {
+		c.Authenticate("u", map[string]interface{}{"boxKey": tt.claim})
+		got, err := naclbox.ClaimKey("boxKey")(c)
+		if tt.ok && (err != nil || *got != *key) {
+			t.Errorf("%s: key %v, %v", tt.name, got, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+
+	c.SetLabel("boxKey", base64.StdEncoding.EncodeToString(key[:]))
+	if got, err := naclbox.LabelKey("boxKey")(c); err != nil || *got != *key {
+		t.Fatalf("LabelKey = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,500 @@
+package sockx
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Namespace is an isolated set of event handlers, clients and rooms.
+type Namespace struct {
+	name   string
+	server *Server
+
+	// handlers is the current dispatch table. Tables are immutable and
+	// replaced wholesale under mu, so dispatch reads them without locking
+	// and sees either the old or the new set, never a partial update.
+	handlers atomic.Pointer[handlerTable]
+
+	mu      sync.RWMutex
+	clients map[*Client]bool
+	byID    map[string]*Client
+	rooms   map[string]*Room
+	users   map[string]map[*Client]bool
+
+	// clientView caches the view of clients snapshots share; it is
+	// cleared whenever clients changes. See Snapshot.
+	clientView atomic.Pointer[clientView]
+
+	sessionPolicy  SessionPolicy
+	roomGuard      RoomGuard
+	duplicateJoins bool
+	undelivered    []UndeliveredHandler
+
+	unhandled    []*Event
+	unhandledMax int
+
+	bytes byteCounters
+
+	breaker         breaker
+	handlerFailures int64
+	dispatchDelay   durationCounter
+	handlerTime     durationCounter
+
+	maxEmitSize    int64
+	maxMessageSize int64
+	oversizedEmits int64
+	errorHandlers  []ErrorHandler
+	panicHandlers  []PanicHandler
+	panicErrors    bool
+	handlerErrors  bool
+
+	selectorBudget    int64
+	slowSelectorHooks []SlowSelectorHook
+
+	// archiver archives destroyed rooms; archiving holds the rooms being
+	// archived, whose names are reserved meanwhile.
+	archiver  *archiveConfig
+	archiving map[string]*archiveJob
+
+	presence *presenceConfig
+	orders   map[string]DeliveryPolicy
+
+	lifecycleHooks []LifecycleHook
+	stalled        int64
+
+	maxEmitDepth int64
+	emitLoops    int64
+	droppedAcks  int64
+
+	historySize int
+	resumeTTL   time.Duration
+	sessions    map[string]*session
+
+	dedup        dedupCache
+	serial       serialQueues
+	receiptRooms map[string]ReceiptOptions
+	directory    directory
+
+	upgradePolicy atomic.Pointer[upgradePolicy]
+	coverage      atomic.Pointer[eventCoverage]
+	codec         atomic.Pointer[Codec]
+	transform     atomic.Pointer[payloadTransform]
+
+	// readiness is set while a namespace created by OfSetup is not ready.
+	readiness atomic.Pointer[readiness]
+}
+
+func newNamespace(s *Server, name string) *Namespace {
+	ns := &Namespace{
+		name:    name,
+		server:  s,
+		clients: make(map[*Client]bool),
+		byID:    make(map[string]*Client),
+		rooms:   make(map[string]*Room),
+		users:   make(map[string]map[*Client]bool),
+	}
+	ns.handlers.Store(&handlerTable{})
+	return ns
+}
+
+// Name returns the namespace name, e.g. "/chat".
+func (ns *Namespace) Name() string { return ns.name }
+
+// On registers the handler for event, replacing any previous handler. If
+// BufferUnhandled is enabled, buffered events with this name are replayed to
+// h before On returns. The returned Subscription removes h with Off.
+func (ns *Namespace) On(event string, h EventHandler, opts ...HandlerOption) *Subscription {
+	return ns.OnEvent(event, func(ev *Event) { h(ev.client, ev.legacyData()) }, opts...)
+}
+
+// Emit sends event to every client in the namespace.
+func (ns *Namespace) Emit(event string, data interface{}, opts ...EmitOption) (EmitResult, error) {
+	return ns.emit(Message{Event: event, Data: data}, ns.snapshotClients, buildEmitOptions(opts))
+}
+
+// EmitTo sends event to every client in room. Emitting to a room that does
+// not exist locally delivers nothing locally and is not an error.
+func (ns *Namespace) EmitTo(room, event string, data interface{}, opts ...EmitOption) (EmitResult, error) {
+	return ns.emit(Message{Event: event, Room: room, Data: data}, ns.roomClients(room), buildEmitOptions(opts))
+}
+
+// EmitExcept sends event to every client in the namespace except those in
+// exclude. Clients on other nodes all receive it.
+func (ns *Namespace) EmitExcept(event string, data interface{}, exclude ...*Client) (EmitResult, error) {
+	return ns.emit(Message{Event: event, Data: data}, ns.snapshotClients, emitOptions{exclude: exclude})
+}
+
+// emit publishes msg through the server's adapter, if any, and delivers it
+// to the local clients returned by recipients, as selected by o. A failed
+// publish is only returned for RemoteOnly emits; otherwise it is reported
+// in the result, and the emit degrades to local delivery.
+func (ns *Namespace) emit(msg Message, recipients func() []*Client, o emitOptions) (EmitResult, error) {
+	msg.hops = ns.server.chainHops(msg.hops)
+	if err := ns.checkDepth(msg); err != nil {
+		return EmitResult{}, err
+	}
+	defer ns.server.enterChain(msg.hops)()
+	o.correlate(&msg)
+	ns.stampReceipt(&msg)
+	var p *payload
+	var err error
+	if r := ns.recordingRoom(msg, o); r != nil {
+		// The message is numbered and recorded, and its recipients fixed,
+		// in one step so that resuming clients get it exactly once.
+		var clients []*Client
+		if p, clients, err = r.record(msg, o); err != nil {
+			return EmitResult{}, err
+		}
+		recipients = func() []*Client { return clients }
+	} else if p, err = ns.encode(msg, o); err != nil {
+		return EmitResult{}, err
+	}
+	var pubErr error
+	var pub EmitResult
+	if a := ns.server.cfg().Adapter; a != nil && !o.localOnly {
+		pubErr = ns.publish(a, msg)
+		pub.published(a, ns, msg.Room, pubErr)
+	}
+	if o.remoteOnly {
+		ns.debugEmit(msg, pub)
+		return pub, pubErr
+	}
+	clients := recipients()
+	res := deliver(ns, without(clients, o.exclude), p, msg.Room, o)
+	res.NotFound = len(clients) == 0
+	res.Published, res.Channel, res.PublishErr = pub.Published, pub.Channel, pub.PublishErr
+	if !res.Published {
+		ns.reportUndelivered(msg, res)
+	}
+	ns.debugEmit(msg, res)
+	return res, nil
+}
+
+// snapshotClients returns the namespace's clients in the namespace's
+// delivery order.
+func (ns *Namespace) snapshotClients() []*Client {
+	ns.mu.RLock()
+	clients := make([]*Client, 0, len(ns.clients))
+	for c := range ns.clients {
+		clients = append(clients, c)
+	}
+	policy := ns.orders[""]
+	ns.mu.RUnlock()
+	policy.apply(clients, func(c *Client) uint64 { return c.seq })
+	return clients
+}
+
+// without returns clients less those in exclude, reusing clients' array.
+func without(clients, exclude []*Client) []*Client {
+	if len(exclude) == 0 {
+		return clients
+	}
+	kept := clients[:0]
+	for _, c := range clients {
+		excluded := false
+		for _, x := range exclude {
+			if c == x {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// roomClients returns a function snapshotting the named room's members.
+func (ns *Namespace) roomClients(room string) func() []*Client {
+	return func() []*Client {
+		if r := ns.Room(room); r != nil {
+			return r.snapshot()
+		}
+		return nil
+	}
+}
+
+// Room returns the named room, or nil if no client has joined it.
+func (ns *Namespace) Room(name string) *Room {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	return ns.rooms[name]
+}
+
+// addClient adds c to the namespace and indexes the identity middleware
+// gave it, if any. Under SessionSingle it returns the user's other
+// connections, which the caller must disconnect.
+func (ns *Namespace) addClient(c *Client) []*Client {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.insertClientLocked(c)
+	c.admitting.Store(false)
+	userID := c.UserID()
+	if userID == "" {
+		return nil
+	}
+	var others []*Client
+	if ns.sessionPolicy == SessionSingle {
+		for other := range ns.users[userID] {
+			others = append(others, other)
+		}
+	}
+	ns.indexUserLocked(c, userID)
+	return others
+}
+
+func (ns *Namespace) removeClient(c *Client) {
+	ns.mu.Lock()
+	ns.deleteClientLocked(c)
+	ns.unindexUserLocked(c, c.UserID())
+	ns.mu.Unlock()
+}
+
+// insertClientLocked adds c to the namespace's clients and indexes it by
+// ID. Should two clients ever share an ID, the first keeps it in the
+// index. ns.mu must be held for writing.
+func (ns *Namespace) insertClientLocked(c *Client) {
+	ns.clients[c] = true
+	if _, taken := ns.byID[c.id]; !taken {
+		ns.byID[c.id] = c
+	}
+	ns.clientView.Store(nil)
+}
+
+// deleteClientLocked removes c from the namespace's clients and from the
+// ID index, unless the ID is indexed for another client. ns.mu must be
+// held for writing.
+func (ns *Namespace) deleteClientLocked(c *Client) {
+	delete(ns.clients, c)
+	if ns.byID[c.id] == c {
+		delete(ns.byID, c.id)
+	}
+	ns.clientView.Store(nil)
+}
+
+// Client returns the connected client of the namespace with the given ID,
+// or nil if there is none.
+func (ns *Namespace) Client(id string) *Client {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	return ns.byID[id]
+}
+
+// Clients returns the namespace's connected clients, by ID. The slice is a
+// copy the caller may keep.
+func (ns *Namespace) Clients() []*Client {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	return append([]*Client(nil), ns.clientViewLocked().clients...)
+}
+
+// Count returns the number of clients connected to the namespace.
+func (ns *Namespace) Count() int {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	return len(ns.clients)
+}
+
+// joinRoom adds c to the named room, creating the room if needed. It fails
+// once c has been removed from the namespace.
+func (ns *Namespace) joinRoom(name string, c *Client) error {
+	j, err := ns.addToRoom(name, c)
+	if err != nil {
+		return err
+	}
+	ns.joined(j)
+	return nil
+}
+
+// roomJoin describes a completed addToRoom for joined.
+type roomJoin struct {
+	c       *Client
+	room    *Room
+	userID  string
+	created bool
+	arrived bool
+}
+
+// addToRoom does the work of joinRoom without announcing the join, so
+// callers can act under locks that announcing would take.
+func (ns *Namespace) addToRoom(name string, c *Client) (roomJoin, error) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if !ns.clients[c] {
+		return roomJoin{}, ErrClientClosed
+	}
+	r, ok := ns.rooms[name]
+	if !ok {
+		if ns.archiving[name] != nil {
+			return roomJoin{}, ErrRoomArchiving
+		}
+		r = newRoom(ns, name)
+		ns.rooms[name] = r
+	}
+	var uid string
+	if ns.presence != nil {
+		uid = c.UserID()
+	}
+	return roomJoin{c: c, room: r, userID: uid, created: !ok, arrived: r.add(c, uid)}, nil
+}
+
+// joined announces a join made by addToRoom.
+func (ns *Namespace) joined(j roomJoin) {
+	name := j.room.name
+	if j.created {
+		ns.fireRoom(LifecycleRoomCreated, name)
+	}
+	if j.arrived {
+		ns.announcePresence(name, j.userID, true)
+	}
+	ns.fireMembership(LifecycleJoin, j.c, name, MembershipRequested)
+}
+
+// leaveRoom removes c from the named room for reason and drops the room
+// once empty.
+func (ns *Namespace) leaveRoom(name string, c *Client, reason MembershipReason) {
+	ns.leaveRooms([]string{name}, c, reason)
+}
+
+// roomLeave describes the removal of a client from one room.
+type roomLeave struct {
+	room                           string
+	r                              *Room
+	userID                         string
+	removed, departed, held, empty bool
+	flags                          []string
+}
+
+// leaveRooms removes c from the named rooms for reason and drops the rooms
+// left empty. The namespace is locked once for all of them, and each room
+// once, so that clients in many rooms are torn down quickly. Presence holds
+// back leaves caused by c disconnecting for its grace period, both the
+// presence broadcast and the leave hooks.
+func (ns *Namespace) leaveRooms(names []string, c *Client, reason MembershipReason) {
+	leaves := make([]roomLeave, 0, len(names))
+	ns.mu.Lock()
+	var grace time.Duration
+	if reason == MembershipDisconnected && ns.presence != nil {
+		grace = ns.presence.grace
+	}
+	for _, name := range names {
+		r, ok := ns.rooms[name]
+		if !ok {
+			continue
+		}
+		l := roomLeave{room: name, r: r}
+		l.removed, l.userID, l.departed, l.held, l.empty, l.flags = r.remove(c, grace)
+		if l.empty {
+			delete(ns.rooms, name)
+			ns.reserveArchiveLocked(r)
+		}
+		leaves = append(leaves, l)
+	}
+	ns.mu.Unlock()
+
+	for _, l := range leaves {
+		for _, flag := range l.flags {
+			l.r.announceFlag(c, flag, false)
+		}
+		if l.departed {
+			ns.announcePresence(l.room, l.userID, false)
+		}
+		if l.removed && !l.held {
+			ns.fireMembership(LifecycleLeave, c, l.room, reason)
+		}
+		if l.empty {
+			ns.fireRoom(LifecycleRoomDestroyed, l.room)
+		}
+	}
+}
+
+func (ns *Namespace) handleEvent(ev *Event) {
+	if ns.holdEvent(ev) {
+		return
+	}
+	defer ns.server.enterChain(ev.msg.hops)()
+	c := ev.client
+	admitted, probe, retry := ns.admitEvent()
+	if !admitted {
+		c.reject(ErrCodeUnavailable, "namespace "+ns.name+" is temporarily unavailable", retry)
+		return
+	}
+	// Once buffered, ev belongs to the goroutine that replays it.
+	replayed := ev.replayed
+	t := ns.handlers.Load()
+	var h EventFunc
+	if replayed {
+		// Catch-all handlers saw the event when it was buffered.
+		if h = t.lookup(ev.msg.Event); h != nil {
+			ev.generation = t.generation
+		}
+	} else {
+		ns.callAny(t.any, ev)
+		if h = c.takeHandler(ev); h == nil {
+			h = ns.lookupHandler(t, ev)
+		}
+	}
+	ns.countEvent(ev.msg.Event, h != nil)
+	if h == nil {
+		if probe {
+			ns.releaseProbe()
+		}
+		if replayed {
+			// The handler was removed again before the event got to it.
+			ev.release()
+			return
+		}
+		ns.callAny(t.unhandled, ev)
+		return
+	}
+	ns.recordEvent(!ns.runHandler(h, ev), probe)
+}
+
+// lookupHandler returns the handler for ev in t. When there is none and
+// BufferUnhandled is enabled, ev is buffered for replay.
+func (ns *Namespace) lookupHandler(t *handlerTable, ev *Event) EventFunc {
+	if h := t.lookup(ev.msg.Event); h != nil {
+		ev.generation = t.generation
+		return h
+	}
+	ns.mu.RLock()
+	buffering := ns.unhandledMax > 0
+	ns.mu.RUnlock()
+	if !buffering {
+		return nil
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	// A handler may have been registered since the lookup above.
+	t = ns.handlers.Load()
+	h := t.lookup(ev.msg.Event)
+	if h == nil {
+		ns.bufferUnhandledLocked(ev)
+	}
+	ev.generation = t.generation
+	return h
+}
+
+// runHandler calls h, flushes its replies and recovers from a panic in h.
+// It reports whether h returned normally. Dispatch delay and handler time
+// are recorded in the namespace stats.
+func (ns *Namespace) runHandler(h EventFunc, ev *Event) (ok bool) {
+	ev.dispatchedAt = time.Now()
+	if !ev.receivedAt.IsZero() {
+		ns.dispatchDelay.observe(ev.dispatchedAt.Sub(ev.receivedAt))
+	}
+	defer func() {
+		ns.handlerTime.observe(time.Since(ev.dispatchedAt))
+		ev.flushReplies()
+		ev.release()
+		if p := recover(); p != nil {
+			atomic.AddInt64(&ns.handlerFailures, 1)
+			ns.server.logf("handler for %q in %s panicked: %v", ev.msg.Event, ns.name, p)
+			ns.handlePanic(ev.client, ev.msg.Event, p)
+		}
+	}()
+	h(ev)
+	return true
+}
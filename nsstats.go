@@ -0,0 +1,69 @@
+package sockx
+
+import "sync/atomic"
+
+// NamespaceStats is a point-in-time view of a namespace.
+type NamespaceStats struct {
+	Clients int
+	Rooms   int
+
+	// HandlerFailures counts handler runs that panicked.
+	HandlerFailures int64
+
+	// OversizedEmits counts emits rejected by SetMaxEmitSize.
+	OversizedEmits int64
+
+	// DispatchDelay measures the time from reading an event's frame to
+	// starting its handler; HandlerTime measures handler run time.
+	DispatchDelay DurationStats
+	HandlerTime   DurationStats
+
+	Breaker      BreakerState
+	BreakerTrips int64
+
+	// StalledDisconnects counts clients disconnected by the write
+	// watchdog.
+	StalledDisconnects int64
+
+	// EmitLoops counts emits aborted with ErrEmitLoop.
+	EmitLoops int64
+
+	// DroppedAcks counts answers to client requests, such as handler
+	// replies to EmitWithAck, dropped because the client's send queue
+	// was full.
+	DroppedAcks int64
+
+	// WarmUp is the progress of the server's warm-up, which limits the
+	// connections of all its namespaces.
+	WarmUp WarmUpStatus
+
+	// SerialQueues lists the keys of SerializeBy handlers with events
+	// waiting, the most waiting first and up to 10: the hot keys whose
+	// events contend.
+	SerialQueues []SerialQueueStats
+}
+
+// Stats returns the namespace's current counters.
+func (ns *Namespace) Stats() NamespaceStats {
+	ns.mu.RLock()
+	st := NamespaceStats{
+		Clients:            len(ns.clients),
+		Rooms:              len(ns.rooms),
+		HandlerFailures:    atomic.LoadInt64(&ns.handlerFailures),
+		OversizedEmits:     atomic.LoadInt64(&ns.oversizedEmits),
+		DispatchDelay:      ns.dispatchDelay.load(),
+		HandlerTime:        ns.handlerTime.load(),
+		StalledDisconnects: atomic.LoadInt64(&ns.stalled),
+		EmitLoops:          atomic.LoadInt64(&ns.emitLoops),
+		DroppedAcks:        atomic.LoadInt64(&ns.droppedAcks),
+		WarmUp:             ns.server.WarmUpStatus(),
+	}
+	ns.mu.RUnlock()
+
+	st.SerialQueues = ns.serialStats()
+
+	ns.breaker.mu.Lock()
+	st.Breaker, st.BreakerTrips = ns.breaker.state, ns.breaker.trips
+	ns.breaker.mu.Unlock()
+	return st
+}
@@ -0,0 +1,74 @@
+package sockx
+
+import "sync/atomic"
+
+// Once registers h for event, like On, to be called for the next
+// occurrence of event only, after which it is removed. If events arrive
+// concurrently only one of them reaches h; the others find no handler
+// once it is removed. The returned Subscription removes h with Off
+// before it runs.
+func (ns *Namespace) Once(event string, h EventHandler, opts ...HandlerOption) *Subscription {
+	var s *Subscription
+	var fired atomic.Bool
+	s = newSubscription(event, ns.wrapHandler(func(ev *Event) {
+		if !fired.CompareAndSwap(false, true) {
+			return
+		}
+		ns.Off(event, s)
+		h(ev.client, ev.legacyData())
+	}, opts))
+	return ns.register(s)
+}
+
+// Once registers h to be called for the next occurrence of event from this
+// client only, such as the credentials a handshake expects first. It takes
+// precedence over the namespace's handler for that one event, which
+// handles the client's later ones. Calling Once again for the same event
+// replaces h. The returned Subscription removes h with Off
+// before it runs.
+func (c *Client) Once(event string, h EventHandler) *Subscription {
+	s := newSubscription(event, func(ev *Event) { h(ev.client, ev.legacyData()) })
+	c.mu.Lock()
+	if c.handlers == nil {
+		c.handlers = make(map[string]*Subscription)
+	}
+	c.handlers[event] = s
+	c.mu.Unlock()
+	return s
+}
+
+// Off removes the handler registered for event by the Client.Once call
+// that returned s, if it has not run yet.
+func (c *Client) Off(event string, s *Subscription) {
+	if s == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.handlers[event] == s {
+		delete(c.handlers, event)
+		s.removed.Store(true)
+	}
+	c.mu.Unlock()
+}
+
+// takeHandler removes and returns the client's own handler for ev, if it
+// has one.
+func (c *Client) takeHandler(ev *Event) EventFunc {
+	c.mu.RLock()
+	none := len(c.handlers) == 0
+	c.mu.RUnlock()
+	if none {
+		return nil
+	}
+	c.mu.Lock()
+	s := c.handlers[ev.msg.Event]
+	if s != nil {
+		delete(c.handlers, ev.msg.Event)
+	}
+	c.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	ev.generation = c.Namespace().HandlerGeneration()
+	return s.fn
+}
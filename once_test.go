@@ -0,0 +1,87 @@
+package sockx
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOnceRunsForFirstEventOnly(t *testing.T) {
+	s := newTestServer(t, WithHandlerWorkers(8))
+	ns := s.Of("/")
+	var calls atomic.Int64
+	ns.Once("ready", func(c *Client, data interface{}) { calls.Add(1) })
+	synced := make(chan struct{}, 2)
+	ns.On("sync", func(c *Client, data interface{}) { synced <- struct{}{} })
+	conns := []*testConn{dial(t, s, "/"), dial(t, s, "/")}
+
+	for i := 0; i < 20; i++ {
+		for _, tc := range conns {
+			tc.emit("ready", i)
+		}
+	}
+	for _, tc := range conns {
+		tc.emit("sync", nil)
+		<-synced
+	}
+	waitFor(t, "the handlers to finish", func() bool {
+		for _, tc := range conns {
+			if tc.client(ns).Stats().HandlersInFlight > 0 {
+				return false
+			}
+		}
+		return true
+	})
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("Once handler called %d times, want 1", n)
+	}
+}
+
+func TestOnceRemovedBeforeItRuns(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	unhandled := make(chan string, 1)
+	ns.OnUnhandled(func(c *Client, event string, data interface{}) { unhandled <- event })
+	sub := ns.Once("ready", func(c *Client, data interface{}) { t.Error("removed Once handler ran") })
+	ns.Off("ready", sub)
+	tc := dial(t, s, "/")
+	tc.emit("ready", nil)
+	if got := <-unhandled; got != "ready" {
+		t.Fatalf("unhandled %s, want ready", got)
+	}
+}
+
+func TestClientOncePrecedesNamespaceHandler(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	handled := make(chan string, 4)
+	ns.On("auth", func(c *Client, data interface{}) { handled <- fmt.Sprint("namespace ", data) })
+	first, other := dial(t, s, "/"), dial(t, s, "/")
+	c := first.client(ns)
+	c.Once("auth", func(c *Client, data interface{}) { handled <- fmt.Sprint("replaced ", data) })
+	c.Once("auth", func(c *Client, data interface{}) { handled <- fmt.Sprint("client ", data) })
+	removed := other.client(ns).Once("auth", func(c *Client, data interface{}) { handled <- "removed" })
+	other.client(ns).Off("auth", removed)
+
+	first.emit("auth", 1)
+	first.emit("auth", 2)
+	var got []string
+	for i := 0; i < 2; i++ {
+		got = append(got, <-handled)
+	}
+	other.emit("auth", 3)
+	got = append(got, <-handled)
+	if want := "[client 1 namespace 2 namespace 3]"; fmt.Sprint(got) != want {
+		t.Fatalf("handled %v, want %s", got, want)
+	}
+}
+
+// client returns the server side of tc in ns.
+func (tc *testConn) client(ns *Namespace) *Client {
+	tc.t.Helper()
+	c := ns.Client(tc.welcome.ID)
+	if c == nil {
+		tc.t.Fatalf("no client %s in %s", tc.welcome.ID, ns.Name())
+	}
+	return c
+}
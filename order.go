@@ -0,0 +1,79 @@
+package sockx
+
+import (
+	"math/rand/v2"
+	"sort"
+)
+
+// DeliveryOrder is the order in which a broadcast queues its message to the
+// recipients.
+type DeliveryOrder int
+
+const (
+	// MapOrder queues in Go map iteration order, which is unspecified. It
+	// is the default and the cheapest.
+	MapOrder DeliveryOrder = iota
+	// ByJoinTime queues to the longest-standing member first: by join
+	// time for rooms and by connection time for namespace-wide emits.
+	ByJoinTime
+	// ByID queues in ascending client ID order.
+	ByID
+	// RandomEachEmit queues in a fresh random order on every emit.
+	RandomEachEmit
+)
+
+// DeliveryPolicy orders the recipients of a broadcast. The order is the
+// order in which the message is queued to each recipient's send queue;
+// since every client has its own writer, it is the order in which clients
+// get their copy, not a guarantee about when they read it.
+type DeliveryPolicy struct {
+	Order DeliveryOrder
+
+	// Rotate starts each emit at a random position in the ByJoinTime or
+	// ByID order and wraps around, so the relative order is kept but the
+	// same client is not always first.
+	Rotate bool
+}
+
+// SetDeliveryPolicy sets the delivery order for emits to room, or for
+// namespace-wide emits if room is empty. The policy outlives the room, so
+// it can be set before anyone joins.
+func (ns *Namespace) SetDeliveryPolicy(room string, p DeliveryPolicy) {
+	ns.mu.Lock()
+	if p == (DeliveryPolicy{}) {
+		delete(ns.orders, room)
+	} else {
+		if ns.orders == nil {
+			ns.orders = make(map[string]DeliveryPolicy)
+		}
+		ns.orders[room] = p
+	}
+	ns.mu.Unlock()
+}
+
+func (ns *Namespace) deliveryPolicy(room string) DeliveryPolicy {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	return ns.orders[room]
+}
+
+// apply reorders clients in place. joinSeq returns the join sequence number
+// used by ByJoinTime.
+func (p DeliveryPolicy) apply(clients []*Client, joinSeq func(*Client) uint64) {
+	switch p.Order {
+	case ByJoinTime:
+		sort.Slice(clients, func(i, j int) bool { return joinSeq(clients[i]) < joinSeq(clients[j]) })
+	case ByID:
+		sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	case RandomEachEmit:
+		rand.Shuffle(len(clients), func(i, j int) { clients[i], clients[j] = clients[j], clients[i] })
+		return
+	default:
+		return
+	}
+	if p.Rotate && len(clients) > 1 {
+		k := rand.IntN(len(clients))
+		rotated := append(clients[k:len(clients):len(clients)], clients[:k]...)
+		copy(clients, rotated)
+	}
+}
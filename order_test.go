@@ -0,0 +1,133 @@
+package sockx
+
+import (
+	"sort"
+	"testing"
+)
+
+// ids returns the IDs of clients, in order.
+func ids(clients []*Client) []string {
+	s := make([]string, len(clients))
+	for i, c := range clients {
+		s[i] = c.ID()
+	}
+	return s
+}
+
+// isRotation reports whether got is want rotated.
+func isRotation(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for k := range want {
+		ok := true
+		for i := range want {
+			if got[i] != want[(i+k)%len(want)] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRoomDeliveryByJoinTime(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SetDeliveryPolicy("r", DeliveryPolicy{Order: ByJoinTime})
+	var joined []*Client
+	for i := 0; i < 8; i++ {
+		joined = append(joined, NewDetachedClient(ns))
+	}
+	// Join in an order that differs from the connection order.
+	for _, i := range []int{5, 2, 7, 0, 3, 6, 1, 4} {
+		joined[i].Join("r")
+	}
+	want := ids([]*Client{joined[5], joined[2], joined[7], joined[0], joined[3], joined[6], joined[1], joined[4]})
+	for i := 0; i < 5; i++ {
+		if got := ids(ns.Room("r").snapshot()); !equalIDs(got, want) {
+			t.Fatalf("delivery order %v, want join order %v", got, want)
+		}
+	}
+}
+
+func TestNamespaceDeliveryByConnectionTime(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SetDeliveryPolicy("", DeliveryPolicy{Order: ByJoinTime})
+	var want []string
+	for i := 0; i < 8; i++ {
+		want = append(want, NewDetachedClient(ns).ID())
+	}
+	if got := ids(ns.snapshotClients()); !equalIDs(got, want) {
+		t.Fatalf("delivery order %v, want connection order %v", got, want)
+	}
+}
+
+func TestDeliveryByIDWithRotation(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var want []string
+	for i := 0; i < 8; i++ {
+		c := NewDetachedClient(ns)
+		c.Join("r")
+		want = append(want, c.ID())
+	}
+	sort.Strings(want)
+
+	ns.SetDeliveryPolicy("r", DeliveryPolicy{Order: ByID})
+	if got := ids(ns.Room("r").snapshot()); !equalIDs(got, want) {
+		t.Fatalf("delivery order %v, want %v", got, want)
+	}
+
+	ns.SetDeliveryPolicy("r", DeliveryPolicy{Order: ByID, Rotate: true})
+	firsts := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		got := ids(ns.Room("r").snapshot())
+		if !isRotation(got, want) {
+			t.Fatalf("rotated order %v does not keep the relative order of %v", got, want)
+		}
+		firsts[got[0]] = true
+	}
+	if len(firsts) < 2 {
+		t.Fatal("rotation always starts with the same client")
+	}
+}
+
+func TestRandomDeliveryReachesEveryone(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SetDeliveryPolicy("", DeliveryPolicy{Order: RandomEachEmit})
+	var want []string
+	for i := 0; i < 8; i++ {
+		want = append(want, NewDetachedClient(ns).ID())
+	}
+	sort.Strings(want)
+	orders := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		got := ids(ns.snapshotClients())
+		orders[got[0]+got[1]] = true
+		sort.Strings(got)
+		if !equalIDs(got, want) {
+			t.Fatalf("random order %v lost or duplicated recipients", got)
+		}
+	}
+	if len(orders) < 2 {
+		t.Fatal("random order never changes")
+	}
+}
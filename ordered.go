@@ -0,0 +1,53 @@
+package sockx
+
+// EventData is one message of an EmitOrdered batch.
+type EventData struct {
+	Event string
+	Data  interface{}
+}
+
+// EmitOrdered sends events to every client in the room as one batch: each
+// client gets them in the given order, with no other broadcast to the
+// room queued between them. Emits to the room, including those received
+// from other nodes, wait while the batch is being queued, so a large room
+// or a long batch holds up the room's other traffic for the time it takes
+// to queue the whole batch to every member; messages to single clients
+// and namespace-wide emits are not held up and may still fall between the
+// batch's messages. Order across nodes is as good as the adapter's.
+//
+// Undelivered and error hooks run while the batch holds the room, so they
+// must not emit to it themselves.
+//
+// opts apply to every message. EmitOrdered stops at the first message
+// that cannot be encoded and returns its error along with the results of
+// the messages already sent, one per message.
+func (r *Room) EmitOrdered(events []EventData, opts ...EmitOption) ([]EmitResult, error) {
+	o := buildEmitOptions(opts)
+	o.fanoutHeld = true
+	r.fanout.Lock()
+	defer r.fanout.Unlock()
+	results := make([]EmitResult, 0, len(events))
+	for _, e := range events {
+		res, err := r.Namespace().emit(Message{Event: e.Event, Room: r.name, Data: e.Data}, r.snapshot, o)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// holdFanout keeps EmitOrdered batches of the named room from starting
+// until the returned function is called, unless o says the caller is the
+// batch. It is cheap for rooms without batches.
+func (ns *Namespace) holdFanout(room string, o emitOptions) (release func()) {
+	if room == "" || o.fanoutHeld {
+		return func() {}
+	}
+	r := ns.Room(room)
+	if r == nil {
+		return func() {}
+	}
+	r.fanout.RLock()
+	return r.fanout.RUnlock
+}
@@ -0,0 +1,110 @@
+package sockx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder collects the events of the frames sent to detached clients.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) outbox(frame []byte) {
+	var msg Message
+	json.Unmarshal(frame, &msg)
+	r.mu.Lock()
+	r.events = append(r.events, msg.Event)
+	r.mu.Unlock()
+}
+
+func (r *recorder) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func TestEmitOrderedIsNotInterleaved(t *testing.T) {
+	const members, batchers, batches, plain = 4, 8, 20, 50
+	s := newTestServer(t, WithSendQueueSize(4096))
+	ns := s.Of("/")
+	recorders := make([]*recorder, members)
+	for i := range recorders {
+		recorders[i] = &recorder{}
+		NewDetachedClient(ns, DetachedOutbox(recorders[i].outbox)).Join("game")
+	}
+	room := ns.Room("game")
+
+	var wg sync.WaitGroup
+	for b := 0; b < batchers; b++ {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			for i := 0; i < batches; i++ {
+				var events []EventData
+				for j := 0; j < 3; j++ {
+					events = append(events, EventData{Event: fmt.Sprintf("batch-%d-%d-%d", b, i, j)})
+				}
+				if _, err := room.EmitOrdered(events); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(b)
+	}
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < plain; i++ {
+				if i%2 == 0 {
+					room.Emit("plain", i)
+				} else {
+					ns.EmitTo("game", "plain", i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	const total = batchers*batches*3 + 4*plain
+	for i, r := range recorders {
+		waitFor(t, "every message delivered", func() bool { return len(r.received()) == total })
+		events := r.received()
+		for k, ev := range events {
+			if !strings.HasSuffix(ev, "-0") {
+				continue
+			}
+			prefix := strings.TrimSuffix(ev, "-0")
+			if k+2 >= len(events) || events[k+1] != prefix+"-1" || events[k+2] != prefix+"-2" {
+				t.Fatalf("client %d: batch %s interleaved: %v", i, prefix, events[k:])
+			}
+		}
+	}
+}
+
+func TestEmitOrderedStopsAtEncodingError(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	rec := &recorder{}
+	NewDetachedClient(ns, DetachedOutbox(rec.outbox)).Join("r")
+	results, err := ns.Room("r").EmitOrdered([]EventData{
+		{Event: "a"},
+		{Event: "b", Data: make(chan int)},
+		{Event: "c"},
+	})
+	if err == nil {
+		t.Fatal("no error for data that cannot be encoded")
+	}
+	if len(results) != 1 || results[0].Delivered != 1 {
+		t.Fatalf("results = %+v, want the first message's only", results)
+	}
+	waitFor(t, "first message delivered", func() bool { return len(rec.received()) == 1 })
+	if got := rec.received(); got[0] != "a" {
+		t.Fatalf("received %v, want [a]", got)
+	}
+}
@@ -0,0 +1,74 @@
+package sockx
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SetCheckOrigin replaces the server's origin check, Config.CheckOrigin,
+// with check, for handshakes that start after the call. Handshakes whose
+// request check rejects get a 403 before the upgrade. Nil accepts every
+// origin. Namespaces with an UpgradePolicy use the policy's check instead.
+func (s *Server) SetCheckOrigin(check func(r *http.Request) bool) {
+	if check == nil {
+		check = allowAnyOrigin
+	}
+	s.originCheck.Store(&check)
+}
+
+// SetAllowedOrigins restricts the server's handshakes to pages served from
+// the given hosts, such as "example.com" or "example.com:8443", or from
+// their subdomains with a pattern such as "*.example.com", which does not
+// match example.com itself. Matching ignores case and the scheme. Requests
+// without an Origin header, which browsers always send, and same-origin
+// requests are accepted too. It replaces any check set with
+// SetCheckOrigin.
+func (s *Server) SetAllowedOrigins(origins []string) {
+	patterns := make([]string, len(origins))
+	for i, o := range origins {
+		patterns[i] = strings.ToLower(o)
+	}
+	s.SetCheckOrigin(func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		host := strings.ToLower(u.Host)
+		for _, p := range patterns {
+			if originMatches(p, host) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// originMatches reports whether host, an Origin's host with an optional
+// port, matches pattern. A pattern without a port matches any port.
+func originMatches(pattern, host string) bool {
+	if !strings.Contains(pattern, ":") {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// checkOrigin is the server upgrader's CheckOrigin.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	return (*s.originCheck.Load())(r)
+}
+
+func allowAnyOrigin(r *http.Request) bool { return true }
@@ -0,0 +1,67 @@
+package sockx
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAllowedOrigins(t *testing.T) {
+	s := newTestServer(t)
+	s.SetAllowedOrigins([]string{"app.example.com", "*.Example.org", "api.example.net:8443"})
+	url := serve(t, s, "/")
+	self := "http://" + strings.TrimPrefix(url, "ws://")
+
+	for _, tt := range []struct {
+		origin string
+		want   int
+	}{
+		{"https://app.example.com", http.StatusSwitchingProtocols},
+		{"https://APP.example.com:3000", http.StatusSwitchingProtocols},
+		{"https://chat.example.org", http.StatusSwitchingProtocols},
+		{"https://a.b.example.org", http.StatusSwitchingProtocols},
+		{"https://api.example.net:8443", http.StatusSwitchingProtocols},
+		{self, http.StatusSwitchingProtocols},
+		{"", http.StatusSwitchingProtocols},
+		{"https://example.org", http.StatusForbidden},
+		{"https://evilexample.org", http.StatusForbidden},
+		{"https://app.example.com.evil.test", http.StatusForbidden},
+		{"https://api.example.net", http.StatusForbidden},
+		{"https://evil.test", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	} {
+		var header http.Header
+		if tt.origin != "" {
+			header = http.Header{"Origin": {tt.origin}}
+		}
+		if code, _ := handshake(t, url, header); code != tt.want {
+			t.Errorf("Origin %q: status %d, want %d", tt.origin, code, tt.want)
+		}
+	}
+}
+
+func TestSetCheckOrigin(t *testing.T) {
+	s := newTestServer(t)
+	url := serve(t, s, "/")
+	evil := http.Header{"Origin": {"https://evil.test"}}
+	if code, _ := handshake(t, url, evil); code != http.StatusSwitchingProtocols {
+		t.Fatalf("default check: status %d, want 101", code)
+	}
+
+	var seen string
+	s.SetCheckOrigin(func(r *http.Request) bool {
+		seen = r.Header.Get("Origin")
+		return r.Header.Get("X-Allowed") == "yes"
+	})
+	if code, _ := handshake(t, url, evil); code != http.StatusForbidden || seen != "https://evil.test" {
+		t.Fatalf("custom check: status %d with Origin %q seen, want 403", code, seen)
+	}
+	if code, _ := handshake(t, url, http.Header{"X-Allowed": {"yes"}}); code != http.StatusSwitchingProtocols {
+		t.Fatalf("custom check accepting: status %d, want 101", code)
+	}
+
+	s.SetCheckOrigin(nil)
+	if code, _ := handshake(t, url, evil); code != http.StatusSwitchingProtocols {
+		t.Fatalf("nil check: status %d, want 101", code)
+	}
+}
@@ -0,0 +1,44 @@
+package sockx
+
+// PanicHandler is called with the value a handler of event panicked with
+// while handling a message from c. The panic is recovered and the
+// connection stays open.
+type PanicHandler func(c *Client, event string, value interface{})
+
+// OnPanic registers h to be called when one of the namespace's event
+// handlers panics, for example to report the panic to an error tracker.
+// Panics are logged and counted in NamespaceStats.HandlerFailures whether
+// or not a handler is registered. Hooks run in registration order, on the
+// goroutine of the handler that panicked.
+func (ns *Namespace) OnPanic(h PanicHandler) {
+	ns.mu.Lock()
+	ns.panicHandlers = append(ns.panicHandlers, h)
+	ns.mu.Unlock()
+}
+
+// SendPanicErrors makes a client whose event made a handler panic get an
+// EventError with ErrCodeInternal, so that it does not wait for a reply
+// that will never come. The panic value is not sent.
+func (ns *Namespace) SendPanicErrors() {
+	ns.mu.Lock()
+	ns.panicErrors = true
+	ns.mu.Unlock()
+}
+
+// handlePanic reports that the handler of event panicked with value
+// while handling a message from c.
+func (ns *Namespace) handlePanic(c *Client, event string, value interface{}) {
+	ns.mu.RLock()
+	handlers, send := ns.panicHandlers, ns.panicErrors
+	ns.mu.RUnlock()
+	for _, h := range handlers {
+		h(c, event, value)
+	}
+	if send && c != nil {
+		c.sendControl(EventError, ErrorData{
+			Code:    ErrCodeInternal,
+			Message: "internal error handling event " + event,
+			Event:   event,
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package sockx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPanickingHandlerKeepsConnection(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"read loop", nil},
+		{"worker pool", []Option{WithHandlerWorkers(4)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.opts...)
+			ns := s.Of("/")
+			type report struct {
+				c     *Client
+				event string
+				value interface{}
+			}
+			reports := make(chan report, 4)
+			ns.OnPanic(func(c *Client, event string, value interface{}) { reports <- report{c, event, value} })
+			ns.SendPanicErrors()
+			ns.On("boom", func(c *Client, data interface{}) { panic("kaboom") })
+			ns.On("ping", func(c *Client, data interface{}) { c.Emit("pong", data) })
+			tc := dial(t, s, "/")
+
+			tc.emit("boom", nil)
+			select {
+			case r := <-reports:
+				if r.c.ID() != tc.welcome.ID || r.event != "boom" || r.value != "kaboom" {
+					t.Fatalf("panic reported as %s %s %v", r.c.ID(), r.event, r.value)
+				}
+			case <-time.After(testTimeout):
+				t.Fatal("panic not reported")
+			}
+			var e ErrorData
+			if err := tc.expect(EventError).Bind(&e); err != nil || e.Code != ErrCodeInternal || e.Event != "boom" {
+				t.Fatalf("error = %+v, %v; want %s for boom", e, err, ErrCodeInternal)
+			}
+			for i := 0; i < 3; i++ {
+				tc.emit("ping", i)
+				if msg := tc.expect("pong"); msg.Data != float64(i) {
+					t.Fatalf("pong %v, want %d", msg.Data, i)
+				}
+			}
+			if n := ns.Stats().HandlerFailures; n != 1 {
+				t.Fatalf("HandlerFailures = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestPanicErrorsAreOptIn(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.On("boom", func(c *Client, data interface{}) { panic("kaboom") })
+	ns.On("ping", func(c *Client, data interface{}) { c.Emit("pong", nil) })
+	tc := dial(t, s, "/")
+	tc.emit("boom", nil)
+	tc.emit("ping", nil)
+	for msg := tc.read(); msg.Event != "pong"; msg = tc.read() {
+		if msg.Event == EventError {
+			t.Fatalf("error sent without SendPanicErrors: %+v", msg)
+		}
+	}
+}
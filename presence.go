@@ -0,0 +1,125 @@
+package sockx
+
+import "time"
+
+// Presence events broadcast to a room when presence is enabled.
+const (
+	EventPresenceJoin  = "sockx:presence-join"
+	EventPresenceLeave = "sockx:presence-leave"
+)
+
+// PresenceData is the payload of presence events.
+type PresenceData struct {
+	UserID string `json:"userId"`
+}
+
+// PresenceHook is called when a user becomes present in, or departs from,
+// a room.
+type PresenceHook func(room, userID string, present bool)
+
+type presenceConfig struct {
+	grace time.Duration
+	hooks []PresenceHook
+}
+
+// pendingLeave is the leave of a disconnected client held back for the
+// presence grace period.
+type pendingLeave struct {
+	client *Client
+	timer  *time.Timer
+}
+
+// EnablePresence tracks which users are in each room of the namespace and
+// broadcasts EventPresenceJoin when a user's first connection joins a room
+// and EventPresenceLeave when its last one leaves. Only authenticated
+// clients count, under the user ID they had when they joined the room.
+//
+// When a connection drops, the leave is held back for grace: if the user
+// rejoins the room within that window (typically after reconnecting) no
+// presence events are sent at all, and the dropped connection's leave is
+// not reported to OnLeave and OnLifecycle hooks; otherwise it is reported
+// when the window ends. The room is kept alive during the
+// window even if the departed user was its last member. Explicit Leaves are
+// never delayed. Presence is tracked per server and not published through
+// the adapter.
+//
+// EnablePresence must be called before clients join rooms.
+func (ns *Namespace) EnablePresence(grace time.Duration) {
+	ns.mu.Lock()
+	if ns.presence == nil {
+		ns.presence = &presenceConfig{}
+	}
+	ns.presence.grace = grace
+	ns.mu.Unlock()
+}
+
+// OnPresenceChange registers h to be called on presence changes, after the
+// corresponding event has been broadcast. It enables presence if needed.
+func (ns *Namespace) OnPresenceChange(h PresenceHook) {
+	ns.mu.Lock()
+	if ns.presence == nil {
+		ns.presence = &presenceConfig{}
+	}
+	ns.presence.hooks = append(ns.presence.hooks, h)
+	ns.mu.Unlock()
+}
+
+// announcePresence broadcasts a presence change and runs the hooks.
+func (ns *Namespace) announcePresence(room, userID string, present bool) {
+	event := EventPresenceLeave
+	if present {
+		event = EventPresenceJoin
+	}
+	msg := Message{Event: event, Room: room, Data: PresenceData{UserID: userID}}
+	ns.emit(msg, ns.roomClients(room), emitOptions{localOnly: true})
+
+	var hooks []PresenceHook
+	ns.mu.RLock()
+	if ns.presence != nil {
+		// A migrated room can carry presence into a namespace without it.
+		hooks = ns.presence.hooks
+	}
+	ns.mu.RUnlock()
+	for _, h := range hooks {
+		h(room, userID, present)
+	}
+}
+
+// holdLeaveLocked schedules the departure of userID, whose connection c
+// left, after grace. r.mu must be held.
+func (r *Room) holdLeaveLocked(c *Client, userID string, grace time.Duration) {
+	if r.pending == nil {
+		r.pending = make(map[string]*pendingLeave)
+	}
+	pl := &pendingLeave{client: c}
+	r.pending[userID] = pl
+	pl.timer = time.AfterFunc(grace, func() { r.Namespace().expireLeave(r, userID, pl) })
+}
+
+// expireLeave completes a pending leave whose grace period ended, unless
+// the user came back in the meantime.
+func (ns *Namespace) expireLeave(r *Room, userID string, pl *pendingLeave) {
+	ns.mu.Lock()
+	r.mu.Lock()
+	if r.pending[userID] != pl {
+		r.mu.Unlock()
+		ns.mu.Unlock()
+		return
+	}
+	delete(r.pending, userID)
+	delete(r.users, userID)
+	empty := len(r.clients) == 0 && len(r.pending) == 0
+	r.mu.Unlock()
+	destroyed := empty && ns.rooms[r.name] == r
+	if destroyed {
+		delete(ns.rooms, r.name)
+		ns.reserveArchiveLocked(r)
+	}
+	ns.mu.Unlock()
+
+	ns.announcePresence(r.name, userID, false)
+	ns.fireMembership(LifecycleLeave, pl.client, r.name, MembershipDisconnected)
+	if destroyed {
+		ns.fireRoom(LifecycleRoomDestroyed, r.name)
+	}
+}
@@ -0,0 +1,80 @@
+package sockx
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// presenceRoom sets up namespace / with presence and the given grace, its
+// clients signing in as alice and joining room r on connect. It returns
+// the URL and a log of the namespace's leaves and presence changes.
+func presenceRoom(t *testing.T, grace time.Duration) (*Namespace, string, func() []string) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.EnablePresence(grace)
+	ns.OnConnect(func(c *Client) {
+		c.Authenticate("alice", nil)
+		c.Join("r")
+	})
+	var mu sync.Mutex
+	var log []string
+	record := func(s string) {
+		mu.Lock()
+		log = append(log, s)
+		mu.Unlock()
+	}
+	ns.OnLeave(func(c *Client, room string, reason MembershipReason) {
+		record(fmt.Sprintf("leave %s %s", room, reason))
+	})
+	ns.OnPresenceChange(func(room, userID string, present bool) {
+		record(fmt.Sprintf("present %s %s %v", room, userID, present))
+	})
+	return ns, serve(t, s, "/"), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), log...)
+	}
+}
+
+func TestPresenceGraceHoldsLeaveHooksUntilExpiry(t *testing.T) {
+	const grace = 200 * time.Millisecond
+	ns, url, log := presenceRoom(t, grace)
+	tc := dialURL(t, url, nil)
+	awaitClients(t, ns, 1)
+	dropped := time.Now()
+	tc.conn.Close()
+	awaitClients(t, ns, 0)
+
+	if got := log(); len(got) != 1 || got[0] != "present r alice true" {
+		t.Fatalf("during the grace period: %v, want only the arrival", got)
+	}
+	waitFor(t, "the held leave", func() bool { return len(log()) == 3 })
+	if held := time.Since(dropped); held < grace {
+		t.Fatalf("leave reported after %v, within the grace period", held)
+	}
+	want := fmt.Sprint([]string{"present r alice true", "present r alice false", "leave r " + MembershipDisconnected.String()})
+	if got := fmt.Sprint(log()); got != want {
+		t.Fatalf("log = %s, want %s", got, want)
+	}
+	if ns.Room("r") != nil {
+		t.Fatal("room kept after the grace period")
+	}
+}
+
+func TestPresenceReconnectWithinGraceDropsLeave(t *testing.T) {
+	const grace = 300 * time.Millisecond
+	ns, url, log := presenceRoom(t, grace)
+	tc := dialURL(t, url, nil)
+	awaitClients(t, ns, 1)
+	tc.conn.Close()
+	awaitClients(t, ns, 0)
+	dialURL(t, url, nil)
+	waitFor(t, "the rejoin", func() bool { return ns.Room("r") != nil && ns.Room("r").Size() == 1 })
+
+	time.Sleep(2 * grace)
+	if got := log(); len(got) != 1 || got[0] != "present r alice true" {
+		t.Fatalf("log = %v, want only the first arrival", got)
+	}
+}
@@ -0,0 +1,103 @@
+package sockx
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ProtocolVersion is the version of the wire protocol spoken by this
+// package. It is announced in EventWelcome. Within a version, messages
+// only gain fields: fields are never renamed or removed, nor their values
+// changed, so clients ignoring unknown fields keep working.
+// sockxtest.VerifyGolden checks a codec's encoding against this policy.
+const ProtocolVersion = 1
+
+// EventHello is an optional handshake message. A client may send it as its
+// very first message to declare the protocol features it supports; the
+// server answers with an EventHello listing the features enabled for the
+// connection.
+const EventHello = "sockx:hello"
+
+// FeaturesQueryParam is the query parameter of the upgrade request that
+// declares client features at upgrade time, as a comma-separated list, for
+// clients that cannot send a hello first. The features enabled are listed
+// in the welcome's Enabled.
+const FeaturesQueryParam = "sockx_features"
+
+// Feature names an optional protocol extension. The server only uses an
+// extension with clients that declared it, so clients that never send a
+// hello get the base protocol.
+type Feature string
+
+// supportedFeatures lists the extensions this server implements.
+var supportedFeatures []Feature
+
+// HelloData is the payload of EventHello in both directions.
+type HelloData struct {
+	Protocol int       `json:"protocol"`
+	Features []Feature `json:"features,omitempty"`
+}
+
+// errHelloNotFirst is reported when a client sends EventHello after other
+// messages.
+var errHelloNotFirst = errors.New("hello must be the first message")
+
+// Supports reports whether the client negotiated feature f.
+func (c *Client) Supports(f Feature) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.features[f]
+}
+
+// negotiate enables the features in declared that the server supports and
+// returns them.
+func (c *Client) negotiate(declared []Feature) []Feature {
+	enabled := make([]Feature, 0, len(declared))
+	features := make(map[Feature]bool, len(declared))
+	for _, f := range declared {
+		for _, s := range supportedFeatures {
+			if f == s && !features[f] {
+				features[f] = true
+				enabled = append(enabled, f)
+			}
+		}
+	}
+	c.mu.Lock()
+	c.features = features
+	c.mu.Unlock()
+	return enabled
+}
+
+// featuresFromRequest returns the features declared in r's query string.
+func featuresFromRequest(r *http.Request) []Feature {
+	v := r.URL.Query().Get(FeaturesQueryParam)
+	if v == "" {
+		return nil
+	}
+	var features []Feature
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			features = append(features, Feature(f))
+		}
+	}
+	return features
+}
+
+// handleHello negotiates features from a hello message and answers it.
+func (c *Client) handleHello(msg Message) error {
+	var hello HelloData
+	if msg.Data != nil {
+		b, err := json.Marshal(msg.Data)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &hello); err != nil {
+			return err
+		}
+	}
+	enabled := c.negotiate(hello.Features)
+	c.sendControl(EventHello, HelloData{Protocol: ProtocolVersion, Features: enabled})
+	return nil
+}
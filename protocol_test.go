@@ -0,0 +1,71 @@
+package sockx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWelcomeAnnouncesProtocol(t *testing.T) {
+	s := newTestServer(t)
+	tc := dial(t, s, "/")
+	w := tc.welcome
+	if w.Protocol != ProtocolVersion {
+		t.Fatalf("welcome protocol = %d, want %d", w.Protocol, ProtocolVersion)
+	}
+	if got := fmt.Sprint(w.Features); !strings.Contains(got, string(FeatureBatch)) || !strings.Contains(got, string(FeatureAckBatch)) {
+		t.Fatalf("welcome features = %s", got)
+	}
+	if len(w.Enabled) != 0 {
+		t.Fatalf("features enabled without being declared: %v", w.Enabled)
+	}
+	if s.Of("/").Client(w.ID).Supports(FeatureBatch) {
+		t.Fatal("undeclared feature supported")
+	}
+}
+
+func TestFeaturesDeclaredAtUpgrade(t *testing.T) {
+	s := newTestServer(t)
+	url := serve(t, s, "/") + "?" + FeaturesQueryParam + "=batch,%20unknown,batch"
+	tc := dialURL(t, url, nil)
+	if got := fmt.Sprint(tc.welcome.Enabled); got != "[batch]" {
+		t.Fatalf("enabled = %s, want [batch]", got)
+	}
+	c := s.Of("/").Client(tc.welcome.ID)
+	if !c.Supports(FeatureBatch) || c.Supports(FeatureAckBatch) {
+		t.Fatal("Supports disagrees with the welcome")
+	}
+}
+
+func TestHelloNegotiatesFeatures(t *testing.T) {
+	s := newTestServer(t)
+	tc := dial(t, s, "/")
+	tc.emit(EventHello, HelloData{Protocol: ProtocolVersion, Features: []Feature{FeatureAckBatch, "unknown"}})
+	var hello HelloData
+	if err := tc.expect(EventHello).Bind(&hello); err != nil {
+		t.Fatal(err)
+	}
+	if hello.Protocol != ProtocolVersion || fmt.Sprint(hello.Features) != "[acks]" {
+		t.Fatalf("hello = %+v, want protocol %d with [acks]", hello, ProtocolVersion)
+	}
+	if !s.Of("/").Client(tc.welcome.ID).Supports(FeatureAckBatch) {
+		t.Fatal("negotiated feature not supported")
+	}
+}
+
+func TestHelloMustBeFirst(t *testing.T) {
+	s := newTestServer(t)
+	tc := dial(t, s, "/")
+	tc.emit("chat", "hi")
+	tc.emit(EventHello, HelloData{Protocol: ProtocolVersion, Features: []Feature{FeatureBatch}})
+	var e ErrorData
+	if err := tc.expect(EventError).Bind(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != ErrCodeBadMessage || e.Message != errHelloNotFirst.Error() {
+		t.Fatalf("error = %+v, want %s: %v", e, ErrCodeBadMessage, errHelloNotFirst)
+	}
+	if s.Of("/").Client(tc.welcome.ID).Supports(FeatureBatch) {
+		t.Fatal("late hello enabled a feature")
+	}
+}
@@ -0,0 +1,130 @@
+package sockx
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// WithTrustedProxies trusts the given proxies, as CIDRs or single
+// addresses, to report the client's address in the Forwarded,
+// X-Forwarded-For or X-Real-IP headers. Headers from any other peer are
+// ignored. It panics if an entry cannot be parsed.
+func WithTrustedProxies(cidrs ...string) Option {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, s := range cidrs {
+		p, err := parsePrefix(s)
+		if err != nil {
+			panic("sockx: invalid trusted proxy " + s + ": " + err.Error())
+		}
+		prefixes = append(prefixes, p)
+	}
+	return func(c *Config) { c.TrustedProxies = append(c.TrustedProxies, prefixes...) }
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// RealIP returns the client's IP address: the address of the direct peer,
+// or the address reported by a trusted proxy. It is the address used for
+// IP rate limits and logs.
+func (c *Client) RealIP() string { return c.realIP }
+
+// realIP determines the client address of r. When the direct peer is a
+// trusted proxy, the forwarding chain is walked from the nearest hop and
+// the first untrusted address is the client.
+func (s *Server) realIP(r *http.Request) string {
+	peer := hostOnly(r.RemoteAddr)
+	if !s.trusted(peer) {
+		return peer
+	}
+	chain := forwardedFor(r.Header)
+	if len(chain) == 0 {
+		chain = splitList(r.Header.Values("X-Forwarded-For"))
+	}
+	if len(chain) == 0 {
+		if ip := parseIP(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		return peer
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseIP(chain[i])
+		if ip == "" {
+			// An unparsable hop cannot be trusted past.
+			break
+		}
+		if i == 0 || !s.trusted(ip) {
+			return ip
+		}
+	}
+	return peer
+}
+
+func (s *Server) trusted(ip string) bool {
+	a, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	a = a.Unmap()
+	for _, p := range s.cfg().TrustedProxies {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the for= values of RFC 7239 Forwarded headers,
+// nearest hop last.
+func forwardedFor(h http.Header) []string {
+	var chain []string
+	for _, elem := range splitList(h.Values("Forwarded")) {
+		for _, pair := range strings.Split(elem, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(k, "for") {
+				chain = append(chain, strings.Trim(v, `"`))
+			}
+		}
+	}
+	return chain
+}
+
+// splitList splits comma-separated header values.
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// parseIP extracts the address from a forwarding hop, which may carry a
+// port and, for IPv6, brackets. It returns "" for anything else, such as
+// obfuscated Forwarded identifiers.
+func parseIP(hop string) string {
+	hop = strings.TrimSpace(hop)
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	hop = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+	a, err := netip.ParseAddr(hop)
+	if err != nil {
+		return ""
+	}
+	return a.Unmap().String()
+}
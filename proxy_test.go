@@ -0,0 +1,80 @@
+package sockx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	s := newTestServer(t, WithTrustedProxies("10.0.0.0/8", "192.0.2.1", "2001:db8::/32"))
+	for _, tt := range []struct {
+		name   string
+		peer   string
+		header http.Header
+		want   string
+	}{
+		{"no proxy", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"spoofed XFF from untrusted peer", "203.0.113.7:1234",
+			http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "203.0.113.7"},
+		{"spoofed X-Real-IP from untrusted peer", "203.0.113.7:1234",
+			http.Header{"X-Real-Ip": {"1.2.3.4"}}, "203.0.113.7"},
+		{"spoofed Forwarded from untrusted peer", "203.0.113.7:1234",
+			http.Header{"Forwarded": {"for=1.2.3.4"}}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:80",
+			http.Header{"X-Forwarded-For": {"198.51.100.9"}}, "198.51.100.9"},
+		{"multi-hop XFF through trusted proxies", "10.1.2.3:80",
+			http.Header{"X-Forwarded-For": {"198.51.100.9, 10.9.9.9", "192.0.2.1"}}, "198.51.100.9"},
+		{"client-forged hop before an untrusted one", "10.1.2.3:80",
+			http.Header{"X-Forwarded-For": {"1.2.3.4, 198.51.100.9"}}, "198.51.100.9"},
+		{"every hop trusted", "10.1.2.3:80",
+			http.Header{"X-Forwarded-For": {"10.5.5.5, 10.6.6.6"}}, "10.5.5.5"},
+		{"unparsable hop", "10.1.2.3:80",
+			http.Header{"X-Forwarded-For": {"1.2.3.4, unknown"}}, "10.1.2.3"},
+		{"Forwarded preferred over XFF", "10.1.2.3:80",
+			http.Header{"Forwarded": {"for=198.51.100.7;proto=https"}, "X-Forwarded-For": {"1.2.3.4"}}, "198.51.100.7"},
+		{"Forwarded with IPv6 client", "10.1.2.3:80",
+			http.Header{"Forwarded": {`for="[2001:db9::17]:4711"`}}, "2001:db9::17"},
+		{"Forwarded with obfuscated hop", "10.1.2.3:80",
+			http.Header{"Forwarded": {"for=_hidden, for=198.51.100.9"}}, "198.51.100.9"},
+		{"X-Real-IP", "10.1.2.3:80",
+			http.Header{"X-Real-Ip": {"198.51.100.9"}}, "198.51.100.9"},
+		{"IPv4-mapped trusted peer", "[::ffff:10.1.2.3]:80",
+			http.Header{"X-Forwarded-For": {"198.51.100.9"}}, "198.51.100.9"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.peer
+		for k, v := range tt.header {
+			r.Header[k] = v
+		}
+		if got := s.realIP(r); got != tt.want {
+			t.Errorf("%s: realIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientRealIPFromHandshake(t *testing.T) {
+	header := http.Header{"X-Forwarded-For": {"198.51.100.9"}}
+	for name, tt := range map[string]struct {
+		opts []Option
+		want string
+	}{
+		"untrusted": {nil, "127.0.0.1"},
+		"trusted":   {[]Option{WithTrustedProxies("127.0.0.1")}, "198.51.100.9"},
+	} {
+		s := newTestServer(t, tt.opts...)
+		tc := dialURL(t, serve(t, s, "/"), header)
+		if got := s.Of("/").Client(tc.welcome.ID).RealIP(); got != tt.want {
+			t.Errorf("%s: RealIP = %s, want %s", name, got, tt.want)
+		}
+	}
+}
+
+func TestWithTrustedProxiesPanicsOnInvalidEntry(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	WithTrustedProxies("not-an-ip")
+}
@@ -0,0 +1,520 @@
+package sockx
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultSendQueueSize is the capacity of a client's normal lane.
+	defaultSendQueueSize = 256
+
+	// controlQueueSize is the capacity of a client's control lane. It is
+	// also the longest run of control frames writePump will write while
+	// normal frames are waiting, which bounds how long the normal lane can
+	// be starved.
+	controlQueueSize = 16
+)
+
+// outbound is a single encoded frame waiting in a client's send queue.
+type outbound struct {
+	// msgType is the websocket message type; zero means TextMessage.
+	msgType int
+	data    []byte
+
+	// room is the room the frame was emitted to, used by fair queuing.
+	room string
+
+	// key is the frame's Coalesce key, if any.
+	key string
+
+	// correlation is the Correlation of the frame's message, for traces.
+	correlation string
+}
+
+// frameQueue is a fixed-capacity queue of outbound frames.
+type frameQueue interface {
+	len() int
+	full() bool
+	space() int
+	push(m *outbound)
+	pop() *outbound
+
+	// replace puts m in the place of the queued frame old. It reports
+	// false if old is not queued.
+	replace(old, m *outbound) bool
+}
+
+// ring is a fixed-capacity FIFO of outbound frames.
+type ring struct {
+	buf  []*outbound
+	head int
+	n    int
+}
+
+func newRing(capacity int) ring {
+	return ring{buf: make([]*outbound, capacity)}
+}
+
+func (r *ring) len() int   { return r.n }
+func (r *ring) full() bool { return r.n == len(r.buf) }
+func (r *ring) space() int { return len(r.buf) - r.n }
+
+func (r *ring) push(m *outbound) {
+	r.buf[(r.head+r.n)%len(r.buf)] = m
+	r.n++
+}
+
+func (r *ring) pop() *outbound {
+	m := r.buf[r.head]
+	r.buf[r.head] = nil
+	r.head = (r.head + 1) % len(r.buf)
+	r.n--
+	return m
+}
+
+func (r *ring) replace(old, m *outbound) bool {
+	for i := 0; i < r.n; i++ {
+		if j := (r.head + i) % len(r.buf); r.buf[j] == old {
+			r.buf[j] = m
+			return true
+		}
+	}
+	return false
+}
+
+// fairRing is a fixed-capacity queue that keeps a FIFO per room and pops
+// from the rooms in turn, so a busy room cannot delay a quiet one by more
+// than one frame per round. Frames without a room form a queue of their
+// own.
+type fairRing struct {
+	size   int
+	n      int
+	rooms  map[string]*roomFrames
+	active []*roomFrames // rooms with frames, in turn order
+	next   int
+}
+
+type roomFrames struct {
+	room   string
+	frames []*outbound
+}
+
+func newFairRing(capacity int) *fairRing {
+	return &fairRing{size: capacity, rooms: make(map[string]*roomFrames)}
+}
+
+func (f *fairRing) len() int   { return f.n }
+func (f *fairRing) full() bool { return f.n == f.size }
+func (f *fairRing) space() int { return f.size - f.n }
+
+func (f *fairRing) push(m *outbound) {
+	rf := f.rooms[m.room]
+	if rf == nil {
+		rf = &roomFrames{room: m.room}
+		f.rooms[m.room] = rf
+		f.active = append(f.active, rf)
+	}
+	rf.frames = append(rf.frames, m)
+	f.n++
+}
+
+func (f *fairRing) pop() *outbound {
+	rf := f.active[f.next]
+	m := rf.frames[0]
+	rf.frames[0] = nil
+	rf.frames = rf.frames[1:]
+	f.n--
+	if len(rf.frames) == 0 {
+		delete(f.rooms, rf.room)
+		f.active = append(f.active[:f.next], f.active[f.next+1:]...)
+	} else {
+		f.next++
+	}
+	if f.next >= len(f.active) {
+		f.next = 0
+	}
+	return m
+}
+
+// replace keeps m in old's position, whatever m's room. old may itself
+// have replaced a frame of another room, so every room is searched.
+func (f *fairRing) replace(old, m *outbound) bool {
+	for _, rf := range f.active {
+		for i, queued := range rf.frames {
+			if queued == old {
+				rf.frames[i] = m
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendQueue is a client's outbound queue. It has two lanes: the normal lane
+// carries application messages and the control lane carries protocol
+// messages (welcome, errors, ...) and messages emitted with Critical. The
+// control lane is drained first so a congested client still receives them,
+// but never for more than controlQueueSize frames in a row while normal
+// frames are pending.
+//
+// With fair queuing the normal lane is drained round-robin across the
+// rooms its frames were emitted to. Frames of one room keep their order,
+// but frames of different rooms may be written in a different order than
+// they were emitted.
+//
+// A frame carrying a Coalesce key replaces the frame with the same key
+// already waiting in its lane, if any, instead of being appended.
+type sendQueue struct {
+	mu      sync.Mutex
+	size    int
+	normal  frameQueue
+	control ring
+	streak  int // consecutive control frames popped while normal was non-empty
+
+	// overflowed is set when the normal lane rejects a frame and cleared
+	// once it drains, so the congestion notice is sent once per episode.
+	overflowed bool
+
+	// final is written after both lanes drain once the queue is closed,
+	// typically a close frame.
+	final  *outbound
+	closed bool
+	notify chan struct{}
+
+	// drainedAt is when the queue was last empty or last had a frame
+	// popped, for detecting writers that make no progress.
+	drainedAt time.Time
+
+	// While holding, normal frames are parked in held instead of the
+	// normal lane, except those pushed with pushThrough.
+	holding bool
+	held    ring
+
+	// keyed indexes the queued frames that carry a Coalesce key, per
+	// lane, so a newer frame with the same key can take their place.
+	keyed map[laneKey]*outbound
+
+	// trace is set while the connection is traced; see
+	// Server.TraceClient.
+	trace atomic.Pointer[clientTrace]
+}
+
+// laneKey identifies a Coalesce key in one lane of a send queue.
+type laneKey struct {
+	lane frameQueue
+	key  string
+}
+
+func newSendQueue(size int, fair bool) *sendQueue {
+	q := &sendQueue{
+		size:    size,
+		control: newRing(controlQueueSize),
+		notify:  make(chan struct{}, 1),
+	}
+	if fair {
+		q.normal = newFairRing(size)
+	} else {
+		r := newRing(size)
+		q.normal = &r
+	}
+	return q
+}
+
+// push appends m to the selected lane. When the normal lane rejects m it
+// also reports whether this rejection started a new overflow episode.
+func (q *sendQueue) push(m *outbound, control bool) (firstOverflow bool, err error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		q.note(TraceDrop, m, 1, "client closed")
+		return false, ErrClientClosed
+	}
+	lane := q.laneLocked(control)
+	if q.coalesce(lane, m) {
+		q.mu.Unlock()
+		q.note(TraceEnqueue, m, 1, "replaced the frame with key "+m.key)
+		return false, nil
+	}
+	if lane.full() {
+		firstOverflow = q.overflowLocked(control)
+		q.mu.Unlock()
+		q.note(TraceDrop, m, 1, "queue full")
+		return firstOverflow, ErrQueueFull
+	}
+	if q.normal.len() == 0 && q.control.len() == 0 {
+		q.drainedAt = time.Now()
+	}
+	q.pushLane(lane, m)
+	q.mu.Unlock()
+	q.signal()
+	q.note(TraceEnqueue, m, 1, "")
+	return false, nil
+}
+
+// pushAll appends ms to the selected lane as a unit, with no other frame
+// between them, or rejects them all if the lane cannot hold them all. They
+// take their place at the end of the lane even if they carry a Coalesce
+// key, but may still be replaced by later frames with the same key.
+func (q *sendQueue) pushAll(ms []*outbound, control bool) (firstOverflow bool, err error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		q.noteAll(TraceDrop, ms, "client closed")
+		return false, ErrClientClosed
+	}
+	lane := q.laneLocked(control)
+	if lane.space() < len(ms) {
+		firstOverflow = q.overflowLocked(control)
+		q.mu.Unlock()
+		q.noteAll(TraceDrop, ms, "queue full")
+		return firstOverflow, ErrQueueFull
+	}
+	if q.normal.len() == 0 && q.control.len() == 0 {
+		q.drainedAt = time.Now()
+	}
+	for _, m := range ms {
+		q.pushLane(lane, m)
+	}
+	q.mu.Unlock()
+	q.signal()
+	q.noteAll(TraceEnqueue, ms, "")
+	return false, nil
+}
+
+// laneLocked returns the lane a frame pushed with control goes to.
+func (q *sendQueue) laneLocked(control bool) frameQueue {
+	switch {
+	case control:
+		return &q.control
+	case q.holding:
+		return &q.held
+	}
+	return q.normal
+}
+
+// overflowLocked records that a lane rejected a frame and reports whether
+// this started a new overflow episode of the normal lane.
+func (q *sendQueue) overflowLocked(control bool) bool {
+	if control || q.overflowed {
+		return false
+	}
+	q.overflowed = true
+	return true
+}
+
+// coalesce puts m in the place of the frame with the same Coalesce key
+// queued in lane, if there is one, and reports whether it did.
+func (q *sendQueue) coalesce(lane frameQueue, m *outbound) bool {
+	if m.key == "" {
+		return false
+	}
+	k := laneKey{lane, m.key}
+	old, ok := q.keyed[k]
+	if !ok || !lane.replace(old, m) {
+		return false
+	}
+	q.keyed[k] = m
+	return true
+}
+
+// pushLane appends m to lane, indexing its Coalesce key.
+func (q *sendQueue) pushLane(lane frameQueue, m *outbound) {
+	lane.push(m)
+	if m.key == "" {
+		return
+	}
+	if q.keyed == nil {
+		q.keyed = make(map[laneKey]*outbound)
+	}
+	q.keyed[laneKey{lane, m.key}] = m
+}
+
+// popLane removes the next frame of lane, dropping its Coalesce key from
+// the index.
+func (q *sendQueue) popLane(lane frameQueue) *outbound {
+	m := lane.pop()
+	if m.key != "" {
+		k := laneKey{lane, m.key}
+		if q.keyed[k] == m {
+			delete(q.keyed, k)
+		}
+	}
+	return m
+}
+
+// pop removes the next frame to write, preferring the control lane. When
+// nothing is queued it returns nil and whether the queue has been closed, in
+// which case the writer should stop.
+func (q *sendQueue) pop() (m *outbound, closed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.control.len() > 0 || q.normal.len() > 0 {
+		q.drainedAt = time.Now()
+	}
+	if q.control.len() > 0 && (q.normal.len() == 0 || q.streak < controlQueueSize) {
+		if q.normal.len() > 0 {
+			q.streak++
+		}
+		return q.popLane(&q.control), false
+	}
+	if q.normal.len() > 0 {
+		q.streak = 0
+		m = q.popLane(q.normal)
+		if q.normal.len() == 0 {
+			q.overflowed = false
+		}
+		return m, false
+	}
+	if q.final != nil {
+		m, q.final = q.final, nil
+		return m, false
+	}
+	return nil, q.closed
+}
+
+// close rejects further pushes. Frames already queued, followed by final if
+// non-nil, can still be popped.
+func (q *sendQueue) close(final *outbound) {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		q.final = final
+	}
+	q.mu.Unlock()
+	q.signal()
+}
+
+// abort closes the queue like close, but drops the frames already queued
+// so that final is the next frame written.
+func (q *sendQueue) abort(final *outbound) {
+	q.mu.Lock()
+	dropped := 0
+	if !q.closed {
+		q.closed = true
+		q.final = final
+		dropped = q.control.len() + q.normal.len() + q.held.len()
+		for q.control.len() > 0 {
+			q.control.pop()
+		}
+		for q.normal.len() > 0 {
+			q.normal.pop()
+		}
+		for q.held.len() > 0 {
+			q.held.pop()
+		}
+		q.keyed = nil
+	}
+	q.mu.Unlock()
+	q.signal()
+	q.note(TraceDrop, nil, dropped, "queue discarded")
+}
+
+// hold parks normal frames pushed from now on until release.
+func (q *sendQueue) hold() {
+	q.mu.Lock()
+	if !q.holding {
+		q.holding = true
+		q.held = newRing(q.size)
+	}
+	q.mu.Unlock()
+}
+
+// pushThrough queues m on the normal lane even while holding.
+func (q *sendQueue) pushThrough(m *outbound) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		q.note(TraceDrop, m, 1, "client closed")
+		return ErrClientClosed
+	}
+	if q.coalesce(q.normal, m) {
+		q.mu.Unlock()
+		q.note(TraceEnqueue, m, 1, "replaced the frame with key "+m.key)
+		return nil
+	}
+	if q.normal.full() {
+		q.mu.Unlock()
+		q.note(TraceDrop, m, 1, "queue full")
+		return ErrQueueFull
+	}
+	if q.normal.len() == 0 && q.control.len() == 0 {
+		q.drainedAt = time.Now()
+	}
+	q.pushLane(q.normal, m)
+	q.mu.Unlock()
+	q.signal()
+	q.note(TraceEnqueue, m, 1, "")
+	return nil
+}
+
+// release moves the held frames to the normal lane, dropping those that
+// no longer fit, and stops holding. It returns the number dropped.
+func (q *sendQueue) release() (dropped int) {
+	q.mu.Lock()
+	if !q.holding {
+		q.mu.Unlock()
+		return 0
+	}
+	for q.held.len() > 0 {
+		m := q.popLane(&q.held)
+		if q.coalesce(q.normal, m) {
+			continue
+		}
+		if q.normal.full() {
+			dropped++
+			continue
+		}
+		if q.normal.len() == 0 && q.control.len() == 0 {
+			q.drainedAt = time.Now()
+		}
+		q.pushLane(q.normal, m)
+	}
+	q.holding = false
+	q.held = ring{}
+	q.mu.Unlock()
+	q.signal()
+	q.note(TraceDrop, nil, dropped, "held frames did not fit")
+	return dropped
+}
+
+// stalledSince returns when the queue last made progress if frames are
+// waiting, or the zero time if it is empty.
+func (q *sendQueue) stalledSince() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.normal.len() == 0 && q.control.len() == 0 {
+		return time.Time{}
+	}
+	return q.drainedAt
+}
+
+// depth returns the number of frames queued.
+func (q *sendQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.control.len() + q.normal.len() + q.held.len()
+}
+
+// note records, if the connection is traced, n frames that kind affected:
+// m, if known, when n is one.
+func (q *sendQueue) note(kind TraceKind, m *outbound, n int, detail string) {
+	if t := q.trace.Load(); t != nil && n > 0 {
+		t.traceFrames(kind, m, n, q.depth(), detail)
+	}
+}
+
+// noteAll is note for the frames ms.
+func (q *sendQueue) noteAll(kind TraceKind, ms []*outbound, detail string) {
+	if len(ms) > 0 {
+		q.note(kind, ms[0], len(ms), detail)
+	}
+}
+
+func (q *sendQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
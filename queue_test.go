@@ -0,0 +1,184 @@
+package sockx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func frame(s string) *outbound { return &outbound{data: []byte(s)} }
+
+func roomFrame(room, s string) *outbound { return &outbound{data: []byte(s), room: room} }
+
+func TestSendQueueControlLaneBypassesFullNormalLane(t *testing.T) {
+	q := newSendQueue(2, false)
+	for i := 0; i < 2; i++ {
+		if _, err := q.push(frame(fmt.Sprint("n", i)), false); err != nil {
+			t.Fatalf("push %d: %v", i, err)
+		}
+	}
+	first, err := q.push(frame("n2"), false)
+	if !errors.Is(err, ErrQueueFull) || !first {
+		t.Fatalf("push to full lane = %v, %v; want first overflow, ErrQueueFull", first, err)
+	}
+	if first, _ := q.push(frame("n3"), false); first {
+		t.Error("second rejection reported as a new overflow episode")
+	}
+	if _, err := q.push(frame("c0"), true); err != nil {
+		t.Fatalf("control push with normal lane full: %v", err)
+	}
+	if m, _ := q.pop(); string(m.data) != "c0" {
+		t.Errorf("first frame popped = %s, want the control frame", m.data)
+	}
+}
+
+func TestSendQueueNormalLaneNotStarved(t *testing.T) {
+	q := newSendQueue(8, false)
+	for i := 0; i < 3; i++ {
+		q.push(frame(fmt.Sprint("n", i)), false)
+	}
+	// Keep the control lane full while popping: normal frames must still
+	// come out at least once every controlQueueSize control frames.
+	run, normals := 0, 0
+	for i := 0; normals < 3; i++ {
+		for {
+			if _, err := q.push(frame("c"), true); err != nil {
+				break
+			}
+		}
+		m, _ := q.pop()
+		if m.data[0] == 'n' {
+			if run > controlQueueSize {
+				t.Fatalf("%d control frames written ahead of a normal frame, want at most %d", run, controlQueueSize)
+			}
+			if want := fmt.Sprint("n", normals); string(m.data) != want {
+				t.Fatalf("normal frame %s out of order, want %s", m.data, want)
+			}
+			normals++
+			run = 0
+			continue
+		}
+		run++
+		if i > 10*controlQueueSize {
+			t.Fatal("normal lane starved")
+		}
+	}
+}
+
+func TestCongestedClientReceivesQueueFullError(t *testing.T) {
+	s := newTestServer(t, WithSendQueueSize(4))
+	ns := s.Of("/")
+	release := make(chan struct{})
+	frames := make(chan []byte, 64)
+	c := NewDetachedClient(ns, DetachedOutbox(func(f []byte) {
+		<-release
+		frames <- f
+	}))
+	for i := 0; i < 10; i++ {
+		c.Emit("tick", i)
+	}
+	if err := c.Emit("tick", 10); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Emit to congested client = %v, want ErrQueueFull", err)
+	}
+	if err := c.Emit("alert", "critical", Critical()); err != nil {
+		t.Fatalf("critical Emit to congested client: %v", err)
+	}
+	close(release)
+
+	var sawError, sawAlert bool
+	for !sawError || !sawAlert {
+		var msg Message
+		if err := json.Unmarshal(<-frames, &msg); err != nil {
+			t.Fatal(err)
+		}
+		switch msg.Event {
+		case EventError:
+			var e ErrorData
+			msg.Bind(&e)
+			if e.Code != ErrCodeQueueFull {
+				t.Errorf("error code = %s, want %s", e.Code, ErrCodeQueueFull)
+			}
+			sawError = true
+		case "alert":
+			sawAlert = true
+		}
+	}
+}
+
+func TestFairQueueTakesRoomsInTurn(t *testing.T) {
+	q := newSendQueue(256, true)
+	for i := 0; i < 200; i++ {
+		q.push(roomFrame("chatty", fmt.Sprint("c", i)), false)
+	}
+	q.push(roomFrame("quiet", "q0"), false)
+	q.push(roomFrame("quiet", "q1"), false)
+
+	var order []string
+	for {
+		m, _ := q.pop()
+		if m == nil {
+			break
+		}
+		order = append(order, string(m.data))
+	}
+	if len(order) != 202 {
+		t.Fatalf("popped %d frames, want 202", len(order))
+	}
+	if order[1] != "q0" || order[3] != "q1" {
+		t.Fatalf("quiet frames popped at %v, want in turn with the chatty room", order[:4])
+	}
+	next := 0
+	for _, f := range order {
+		if f[0] == 'c' {
+			if want := fmt.Sprint("c", next); f != want {
+				t.Fatalf("chatty frame %s out of order, want %s", f, want)
+			}
+			next++
+		}
+	}
+}
+
+func TestFairQueueKeepsControlPriority(t *testing.T) {
+	q := newSendQueue(8, true)
+	q.push(roomFrame("a", "n0"), false)
+	q.push(frame("c0"), true)
+	if m, _ := q.pop(); string(m.data) != "c0" {
+		t.Fatalf("first frame popped = %s, want the control frame", m.data)
+	}
+}
+
+// BenchmarkQuietRoomLatency measures how many frames are written ahead of
+// a quiet room's message queued behind a chatty room's backlog, with and
+// without fair queuing.
+func BenchmarkQuietRoomLatency(b *testing.B) {
+	const backlog = 100
+	for _, fair := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fair=%v", fair), func(b *testing.B) {
+			q := newSendQueue(backlog+1, fair)
+			ahead := make([]int, 0, b.N)
+			for i := 0; i < b.N; i++ {
+				burst := i % backlog
+				for j := 0; j < burst; j++ {
+					q.push(roomFrame("chatty", "c"), false)
+				}
+				q.push(roomFrame("quiet", "q"), false)
+				for j := 0; j < backlog-burst; j++ {
+					q.push(roomFrame("chatty", "c"), false)
+				}
+				for n := 0; ; n++ {
+					m, _ := q.pop()
+					if m == nil {
+						break
+					}
+					if m.room == "quiet" {
+						ahead = append(ahead, n)
+					}
+				}
+			}
+			sort.Ints(ahead)
+			b.ReportMetric(float64(ahead[len(ahead)*99/100]), "p99-frames-ahead")
+		})
+	}
+}
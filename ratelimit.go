@@ -0,0 +1,225 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when an operation exceeds a configured rate
+// limit.
+var ErrRateLimited = errors.New("sockx: rate limited")
+
+// RateLimiter decides whether n more units may be spent against key. It
+// returns how long to wait before retrying when they may not. Limiters
+// backed by an external store (Redis, ...) let limits hold across nodes; if
+// one returns an error the operation is allowed and a warning is logged.
+type RateLimiter interface {
+	Allow(key string, n int) (ok bool, retryAfter time.Duration, err error)
+}
+
+// RateLimit permits Rate units per second with bursts of up to Burst. A
+// zero Rate means unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits configures the limits sockx enforces per subject: the user ID
+// for authenticated clients and the remote IP otherwise, so limits survive
+// reconnects.
+type RateLimits struct {
+	// Events limits inbound events of any name.
+	Events RateLimit
+	// PerEvent limits inbound events by name.
+	PerEvent map[string]RateLimit
+	// Joins limits Client.Join calls.
+	Joins RateLimit
+	// Bytes limits inbound bytes.
+	Bytes RateLimit
+}
+
+// Rate limit key kinds. Keys have the form "<kind>:<subject>", where the
+// per-event kind is "event/" followed by the query-escaped event name.
+const (
+	RateKindEvents = "events"
+	RateKindEvent  = "event/"
+	RateKindJoins  = "joins"
+	RateKindBytes  = "bytes"
+)
+
+// Limit returns the limit that applies to key. Custom RateLimiters can use
+// it to enforce the same limits as the built-in one.
+func (l RateLimits) Limit(key string) RateLimit {
+	kind, _, _ := strings.Cut(key, ":")
+	switch {
+	case kind == RateKindEvents:
+		return l.Events
+	case kind == RateKindJoins:
+		return l.Joins
+	case kind == RateKindBytes:
+		return l.Bytes
+	case strings.HasPrefix(kind, RateKindEvent):
+		name, err := url.QueryUnescape(kind[len(RateKindEvent):])
+		if err != nil {
+			return RateLimit{}
+		}
+		return l.PerEvent[name]
+	}
+	return RateLimit{}
+}
+
+// validate rejects negative rates and bursts.
+func (l RateLimits) validate() error {
+	check := func(name string, lim RateLimit) error {
+		if lim.Rate < 0 || lim.Burst < 0 {
+			return fmt.Errorf("%w: negative rate limit %s %+v", ErrInvalidConfig, name, lim)
+		}
+		return nil
+	}
+	if err := check("Events", l.Events); err != nil {
+		return err
+	}
+	if err := check("Joins", l.Joins); err != nil {
+		return err
+	}
+	if err := check("Bytes", l.Bytes); err != nil {
+		return err
+	}
+	for event, lim := range l.PerEvent {
+		if err := check("PerEvent["+strconv.Quote(event)+"]", lim); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l RateLimits) enabled() bool {
+	return l.Events.Rate > 0 || l.Joins.Rate > 0 || l.Bytes.Rate > 0 || len(l.PerEvent) > 0
+}
+
+// TokenBucketLimiter is the default in-memory RateLimiter. It keeps a token
+// bucket per key; idle buckets are discarded once they would be full.
+type TokenBucketLimiter struct {
+	limit func(key string) RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// sweepEvery is how many Allow calls pass between sweeps of idle buckets.
+const sweepEvery = 1024
+
+// NewTokenBucketLimiter returns a limiter that applies limit(key) to each
+// key, typically RateLimits.Limit.
+func NewTokenBucketLimiter(limit func(key string) RateLimit) *TokenBucketLimiter {
+	return &TokenBucketLimiter{limit: limit, buckets: make(map[string]*bucket)}
+}
+
+// Allow implements RateLimiter. It never returns an error.
+func (l *TokenBucketLimiter) Allow(key string, n int) (bool, time.Duration, error) {
+	lim := l.limit(key)
+	if lim.Rate <= 0 {
+		return true, 0, nil
+	}
+	burst := float64(lim.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweepLocked(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * lim.Rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if need := float64(n); b.tokens < need {
+		return false, time.Duration((need - b.tokens) / lim.Rate * float64(time.Second)), nil
+	}
+	b.tokens -= float64(n)
+	return true, 0, nil
+}
+
+func (l *TokenBucketLimiter) sweepLocked(now time.Time) {
+	for key, b := range l.buckets {
+		lim := l.limit(key)
+		if lim.Rate <= 0 || b.tokens+now.Sub(b.last).Seconds()*lim.Rate >= float64(lim.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// WithRateLimits enforces limits using the server's RateLimiter.
+func WithRateLimits(limits RateLimits) Option {
+	return func(c *Config) { c.RateLimits = limits }
+}
+
+// WithRateLimiter replaces the in-memory TokenBucketLimiter, e.g. with one
+// shared by every node.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(c *Config) { c.RateLimiter = l }
+}
+
+// rateSubject identifies who a client's limits are charged to.
+func (c *Client) rateSubject() string {
+	if uid := c.UserID(); uid != "" {
+		return "user:" + uid
+	}
+	if c.realIP != "" {
+		return "ip:" + c.realIP
+	}
+	return "client:" + c.id
+}
+
+// allow charges n units of kind to the client. It fails open when the
+// limiter errors.
+func (c *Client) allow(kind string, lim RateLimit, n int) (bool, time.Duration) {
+	if lim.Rate <= 0 {
+		return true, 0
+	}
+	s := c.server
+	key := kind + ":" + c.rateSubject()
+	ok, retryAfter, err := s.cfg().RateLimiter.Allow(key, n)
+	if err != nil {
+		s.logf("rate limiter failed for %q, allowing: %v", key, err)
+		return true, 0
+	}
+	return ok, retryAfter
+}
+
+// allowInbound applies the byte, event and per-event limits to an inbound
+// message of size bytes.
+func (c *Client) allowInbound(msg Message, size int) (bool, time.Duration) {
+	limits := &c.server.cfg().RateLimits
+	if ok, retry := c.allow(RateKindBytes, limits.Bytes, size); !ok {
+		return false, retry
+	}
+	if ok, retry := c.allow(RateKindEvents, limits.Events, 1); !ok {
+		return false, retry
+	}
+	if lim, ok := limits.PerEvent[msg.Event]; ok {
+		return c.allow(RateKindEvent+url.QueryEscape(msg.Event), lim, 1)
+	}
+	return true, 0
+}
@@ -0,0 +1,113 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubLimiter denies keys starting with deny and records every key it is
+// asked about. A non-nil err fails every call.
+type stubLimiter struct {
+	deny string
+	err  error
+
+	mu   sync.Mutex
+	keys []string
+}
+
+func (l *stubLimiter) Allow(key string, n int) (bool, time.Duration, error) {
+	l.mu.Lock()
+	l.keys = append(l.keys, key)
+	l.mu.Unlock()
+	if l.err != nil {
+		return false, 0, l.err
+	}
+	if l.deny != "" && strings.HasPrefix(key, l.deny) {
+		return false, 2 * time.Second, nil
+	}
+	return true, 0, nil
+}
+
+func (l *stubLimiter) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprint(l.keys)
+}
+
+// limitedServer serves namespace / with limits enforced by l, its clients
+// signing in as alice. Handled events are sent on the returned channel.
+func limitedServer(t *testing.T, l RateLimiter) (*Server, <-chan string) {
+	limits := RateLimits{
+		Events:   RateLimit{Rate: 100, Burst: 100},
+		PerEvent: map[string]RateLimit{"chat msg": {Rate: 1, Burst: 1}},
+	}
+	s := newTestServer(t, WithRateLimits(limits), WithRateLimiter(l))
+	ns := s.Of("/")
+	ns.OnConnect(func(c *Client) { c.Authenticate("alice", nil) })
+	handled := make(chan string, 10)
+	for _, event := range []string{"chat msg", "other"} {
+		event := event
+		ns.On(event, func(c *Client, data interface{}) { handled <- event })
+	}
+	return s, handled
+}
+
+func TestRateLimiterRejectsEvents(t *testing.T) {
+	l := &stubLimiter{deny: RateKindEvent}
+	s, handled := limitedServer(t, l)
+	tc := dial(t, s, "/")
+
+	tc.emit("chat msg", "hi")
+	var e ErrorData
+	if err := tc.expect(EventError).Bind(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != ErrCodeRateLimited || e.RetryAfterMs < 2000 {
+		t.Fatalf("error = %+v, want %s retrying after at least 2s", e, ErrCodeRateLimited)
+	}
+	tc.emit("other", nil)
+	if got := <-handled; got != "other" {
+		t.Fatalf("handled %q, want only other", got)
+	}
+
+	want := "[events:user:alice event/chat+msg:user:alice events:user:alice]"
+	if got := l.String(); got != want {
+		t.Fatalf("limiter keys = %s, want %s", got, want)
+	}
+	limits := s.cfg().RateLimits
+	if lim := limits.Limit("event/chat+msg:user:alice"); lim.Rate != 1 {
+		t.Fatalf("Limit of the per-event key = %+v", lim)
+	}
+	if lim := limits.Limit("joins:user:alice"); lim.Rate != 0 {
+		t.Fatalf("Limit of an unconfigured kind = %+v", lim)
+	}
+}
+
+func TestRateLimiterFailsOpen(t *testing.T) {
+	s, handled := limitedServer(t, &stubLimiter{err: errors.New("store down")})
+	tc := dial(t, s, "/")
+	tc.emit("chat msg", "hi")
+	select {
+	case <-handled:
+	case <-time.After(testTimeout):
+		t.Fatal("event dropped while the limiter failed")
+	}
+}
+
+func TestTokenBucketLimitsJoins(t *testing.T) {
+	s := newTestServer(t, WithRateLimits(RateLimits{Joins: RateLimit{Rate: 0.001, Burst: 2}}))
+	tc := dial(t, s, "/")
+	c := s.Of("/").Client(tc.welcome.ID)
+	for _, room := range []string{"a", "b"} {
+		if err := c.Join(room); err != nil {
+			t.Fatalf("Join %s within the burst: %v", room, err)
+		}
+	}
+	if err := c.Join("c"); err != ErrRateLimited {
+		t.Fatalf("Join beyond the burst = %v, want %v", err, ErrRateLimited)
+	}
+}
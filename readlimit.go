@@ -0,0 +1,48 @@
+package sockx
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrMessageTooLarge is the CloseError of a client that sent a message
+// larger than its namespace's limit; see Config.MaxMessageSize.
+var ErrMessageTooLarge = errors.New("sockx: message too large")
+
+// SetMaxMessageSize sets the size in bytes of the largest message the
+// namespace's clients may send, overriding Config.MaxMessageSize, for
+// endpoints that accept large uploads. A negative n removes the limit and
+// zero goes back to Config.MaxMessageSize. Connections apply it before
+// reading their next message. A connection that joins the namespace with
+// EventConnect keeps the limit of the namespace it connected to.
+func (ns *Namespace) SetMaxMessageSize(n int64) {
+	atomic.StoreInt64(&ns.maxMessageSize, n)
+}
+
+// messageLimit returns the namespace's message size limit, or zero for
+// none.
+func (ns *Namespace) messageLimit() int64 {
+	n := atomic.LoadInt64(&ns.maxMessageSize)
+	if n == 0 {
+		n = ns.server.cfg().MaxMessageSize
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// setReadLimit makes the connection refuse messages over n bytes, with no
+// limit for zero.
+func (c *Client) setReadLimit(n int64) {
+	c.readLimit = n
+	c.conn.SetReadLimit(n)
+}
+
+// refreshReadLimit applies a limit changed with SetMaxMessageSize or
+// UpdateConfig since the connection read its last message.
+func (c *Client) refreshReadLimit() {
+	if n := c.Namespace().messageLimit(); n != c.readLimit {
+		c.setReadLimit(n)
+	}
+}
@@ -0,0 +1,133 @@
+package sockx
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrNamespaceNotReady is returned by emits on a namespace that is still
+// being set up.
+var ErrNamespaceNotReady = errors.New("sockx: namespace not ready")
+
+// defaultReadyQueue bounds the connections and events held for a namespace
+// that is not ready yet.
+const defaultReadyQueue = 64
+
+// SetupOption customizes how OfSetup treats traffic that arrives before
+// the namespace is ready.
+type SetupOption func(*readiness)
+
+// QueueUntilReady holds up to n connections and n events arriving before
+// the namespace is ready and lets them through once it is. Traffic beyond
+// that is rejected. It is the default, with n = 64.
+func QueueUntilReady(n int) SetupOption {
+	return func(r *readiness) { r.queue = n }
+}
+
+// RejectUntilReady rejects connections and events arriving before the
+// namespace is ready.
+func RejectUntilReady() SetupOption {
+	return func(r *readiness) { r.queue = 0 }
+}
+
+// readiness gates a namespace created by OfSetup until Ready is called.
+type readiness struct {
+	queue   int
+	ready   chan struct{}
+	waiting int64
+	held    []*Event // guarded by the namespace's mu
+}
+
+// OfSetup returns the named namespace, creating it with setup if needed.
+// A namespace created this way is not ready until setup returns: until
+// then connections and client events are queued or rejected as selected by
+// opts, and emits fail with ErrNamespaceNotReady. setup may call Ready
+// itself to open the namespace early.
+func (s *Server) OfSetup(name string, setup func(ns *Namespace), opts ...SetupOption) *Namespace {
+	s.mu.Lock()
+	if ns, ok := s.namespaces[name]; ok {
+		s.mu.Unlock()
+		return ns
+	}
+	ns := newNamespace(s, name)
+	r := &readiness{queue: defaultReadyQueue, ready: make(chan struct{})}
+	for _, opt := range opts {
+		opt(r)
+	}
+	ns.readiness.Store(r)
+	s.namespaces[name] = ns
+	s.mu.Unlock()
+
+	setup(ns)
+	ns.Ready()
+	return ns
+}
+
+// Ready marks the namespace ready, letting queued connections and events
+// through. Namespaces created by Of are ready from the start. Calling
+// Ready again has no effect.
+func (ns *Namespace) Ready() {
+	r := ns.readiness.Load()
+	if r == nil {
+		return
+	}
+	ns.mu.Lock()
+	held := r.held
+	r.held = nil
+	ns.readiness.Store(nil)
+	ns.mu.Unlock()
+	close(r.ready)
+
+	for _, ev := range held {
+		ev.client.dispatch(ev)
+	}
+}
+
+// IsReady reports whether the namespace is ready.
+func (ns *Namespace) IsReady() bool {
+	return ns.readiness.Load() == nil
+}
+
+// awaitReady blocks a connection attempt until the namespace is ready. It
+// reports false if the attempt is rejected or abandoned.
+func (ns *Namespace) awaitReady(req *http.Request) bool {
+	r := ns.readiness.Load()
+	if r == nil {
+		return true
+	}
+	defer atomic.AddInt64(&r.waiting, -1)
+	if atomic.AddInt64(&r.waiting, 1) > int64(r.queue) {
+		return false
+	}
+	select {
+	case <-r.ready:
+		return true
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+// holdEvent queues ev if the namespace is not ready. It reports whether ev
+// was held or, when the queue is full, rejected; false means the namespace
+// is ready and ev should be handled now.
+func (ns *Namespace) holdEvent(ev *Event) bool {
+	if ns.readiness.Load() == nil {
+		return false
+	}
+	ns.mu.Lock()
+	r := ns.readiness.Load()
+	if r == nil {
+		ns.mu.Unlock()
+		return false
+	}
+	held := len(r.held) < r.queue
+	if held {
+		r.held = append(r.held, ev)
+	}
+	ns.mu.Unlock()
+	if !held {
+		ev.client.reject(ErrCodeUnavailable, "namespace "+ns.name+" is not ready", 0)
+	}
+	return true
+}
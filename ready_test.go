@@ -0,0 +1,125 @@
+package sockx
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// setupInBackground creates namespace name of s with OfSetup, blocking its
+// setup until release is called. Tests must defer
+// release: connections waiting for the namespace hold up the test
+// server's Close.
+func setupInBackground(t *testing.T, s *Server, name string, opts ...SetupOption) (release func()) {
+	t.Helper()
+	gate := make(chan struct{})
+	go s.OfSetup(name, func(ns *Namespace) { <-gate }, opts...)
+	waitFor(t, "namespace created", func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.namespaces[name] != nil
+	})
+	var once sync.Once
+	return func() { once.Do(func() { close(gate) }) }
+}
+
+// waiting returns the number of connections waiting for ns to be ready.
+func waiting(ns *Namespace) int64 {
+	if r := ns.readiness.Load(); r != nil {
+		return atomic.LoadInt64(&r.waiting)
+	}
+	return 0
+}
+
+func TestEmitsFailUntilNamespaceIsReady(t *testing.T) {
+	s := newTestServer(t)
+	var during error
+	ns := s.OfSetup("/app", func(ns *Namespace) {
+		_, during = ns.Emit("hello", nil)
+	})
+	if !errors.Is(during, ErrNamespaceNotReady) {
+		t.Fatalf("emit during setup = %v, want ErrNamespaceNotReady", during)
+	}
+	if !ns.IsReady() {
+		t.Fatal("namespace not ready after setup")
+	}
+	if _, err := ns.Emit("hello", nil); err != nil {
+		t.Fatalf("emit after setup: %v", err)
+	}
+}
+
+func TestConnectionsDuringSlowSetupAreQueued(t *testing.T) {
+	const clients = 8
+	s := newTestServer(t)
+	handled := make(chan struct{}, clients)
+	release := setupInBackground(t, s, "/app")
+	defer release()
+	ns := s.Of("/app")
+	url := serve(t, s, "/app")
+
+	type dialed struct {
+		conn *websocket.Conn
+		err  error
+	}
+	results := make(chan dialed, clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+			results <- dialed{conn, err}
+		}()
+	}
+	waitFor(t, "connections queued", func() bool { return waiting(ns) == clients })
+
+	// Handlers registered at the end of setup see every queued client's
+	// events.
+	ns.On("hello", func(c *Client, data interface{}) { handled <- struct{}{} })
+	release()
+	for i := 0; i < clients; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("queued connection failed: %v", r.err)
+		}
+		tc := &testConn{t: t, conn: r.conn}
+		t.Cleanup(func() { r.conn.Close() })
+		tc.expect(EventWelcome)
+		tc.emit("hello", nil)
+	}
+	for i := 0; i < clients; i++ {
+		<-handled
+	}
+}
+
+func TestConnectionsBeyondReadyQueueAreRejected(t *testing.T) {
+	s := newTestServer(t)
+	release := setupInBackground(t, s, "/app", QueueUntilReady(1))
+	defer release()
+	ns := s.Of("/app")
+	url := serve(t, s, "/app")
+	go websocket.DefaultDialer.Dial(url, nil)
+	waitFor(t, "first connection queued", func() bool { return waiting(ns) == 1 })
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("connection beyond the queue accepted")
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("response = %v, want 503", resp)
+	}
+}
+
+func TestRejectUntilReady(t *testing.T) {
+	s := newTestServer(t)
+	release := setupInBackground(t, s, "/app", RejectUntilReady())
+	defer release()
+	url := serve(t, s, "/app")
+	if _, _, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+		t.Fatal("connection accepted before the namespace was ready")
+	}
+	release()
+	waitFor(t, "namespace ready", s.Of("/app").IsReady)
+	dialURL(t, url, nil)
+}
@@ -0,0 +1,268 @@
+package sockx
+
+import (
+	"sync"
+	"time"
+)
+
+// Events of the read receipts protocol.
+const (
+	// EventSeen is sent by a client that has displayed a room message.
+	// Its Room is the room and its Data the message's ID.
+	EventSeen = "sockx:seen"
+
+	// EventReceiptUpdate is broadcast to a room with receipt broadcasts
+	// enabled. Its Data is a list of ReceiptUpdate.
+	EventReceiptUpdate = "sockx:receipt-update"
+)
+
+const (
+	defaultReceiptMessages = 256
+	defaultReceiptAge      = 10 * time.Minute
+)
+
+// ReceiptOptions configures read receipts for a room.
+type ReceiptOptions struct {
+	// MaxMessages is how many of the room's latest messages receipts are
+	// kept for. Defaults to 256.
+	MaxMessages int
+
+	// MaxAge is how long after a message was sent receipts are kept for
+	// it. Defaults to 10 minutes.
+	MaxAge time.Duration
+
+	// TrackReaders keeps who has seen each message, and not just how
+	// many, and includes them in receipt updates.
+	TrackReaders bool
+
+	// BroadcastEvery enables EventReceiptUpdate broadcasts, sent at most
+	// once per interval with the messages whose receipts changed. Zero
+	// disables them.
+	BroadcastEvery time.Duration
+}
+
+// Receipts reports who has seen a room message. Readers are user IDs for
+// authenticated clients and client IDs otherwise, in the order they saw
+// the message; they are only set with TrackReaders.
+type Receipts struct {
+	MessageID string
+	Count     int
+	Readers   []string
+}
+
+// ReceiptUpdate is one entry of an EventReceiptUpdate payload.
+type ReceiptUpdate struct {
+	ID      string   `json:"id"`
+	Count   int      `json:"count"`
+	Readers []string `json:"readers,omitempty"`
+}
+
+// EnableReceipts turns on read receipts for the named room, which may not
+// exist yet. Every message emitted to the room is given an ID in
+// Message.ID if it has none, clients report the messages they have seen
+// with EventSeen, and the counts are available from Room.Receipts. Rooms
+// without receipts ignore EventSeen. Receipts are tracked per server and
+// are dropped with the room.
+func (ns *Namespace) EnableReceipts(room string, opts ReceiptOptions) {
+	if opts.MaxMessages <= 0 {
+		opts.MaxMessages = defaultReceiptMessages
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = defaultReceiptAge
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.receiptRooms == nil {
+		ns.receiptRooms = make(map[string]ReceiptOptions)
+	}
+	ns.receiptRooms[room] = opts
+	if r, ok := ns.rooms[room]; ok {
+		r.receipts.Store(newRoomReceipts(opts))
+	}
+}
+
+// Receipts returns the receipts of the room message with the given ID, or
+// false if the room has no receipts enabled or the message is unknown or
+// has expired.
+func (r *Room) Receipts(messageID string) (Receipts, bool) {
+	rr := r.receipts.Load()
+	if rr == nil {
+		return Receipts{}, false
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.expireLocked(time.Now())
+	m := rr.byID[messageID]
+	if m == nil {
+		return Receipts{}, false
+	}
+	res := Receipts{MessageID: messageID, Count: m.count}
+	if rr.opts.TrackReaders {
+		res.Readers = append([]string(nil), m.order...)
+	}
+	return res, true
+}
+
+// roomReceipts holds a room's receipts.
+type roomReceipts struct {
+	opts ReceiptOptions
+
+	mu      sync.Mutex
+	byID    map[string]*receipt
+	order   []*receipt // by send time
+	dirty   []*receipt
+	pending bool // a broadcast is scheduled
+}
+
+type receipt struct {
+	id      string
+	sent    time.Time
+	count   int
+	readers map[string]bool
+	order   []string
+	dirty   bool
+}
+
+func newRoomReceipts(opts ReceiptOptions) *roomReceipts {
+	return &roomReceipts{opts: opts, byID: make(map[string]*receipt)}
+}
+
+// track starts keeping receipts for a message sent to the room.
+func (rr *roomReceipts) track(id string, now time.Time) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if _, ok := rr.byID[id]; ok {
+		return
+	}
+	rr.expireLocked(now)
+	if len(rr.order) >= rr.opts.MaxMessages {
+		rr.dropLocked(1)
+	}
+	m := &receipt{id: id, sent: now, readers: make(map[string]bool)}
+	rr.byID[id] = m
+	rr.order = append(rr.order, m)
+}
+
+// expireLocked drops the messages older than MaxAge.
+func (rr *roomReceipts) expireLocked(now time.Time) {
+	n := 0
+	for n < len(rr.order) && now.Sub(rr.order[n].sent) > rr.opts.MaxAge {
+		n++
+	}
+	rr.dropLocked(n)
+}
+
+// dropLocked drops the n oldest messages.
+func (rr *roomReceipts) dropLocked(n int) {
+	for _, m := range rr.order[:n] {
+		delete(rr.byID, m.id)
+	}
+	rr.order = append(rr.order[:0], rr.order[n:]...)
+}
+
+// see records that reader has seen the message. It reports whether a
+// receipt broadcast has to be scheduled.
+func (rr *roomReceipts) see(id, reader string) (schedule bool) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.expireLocked(time.Now())
+	m := rr.byID[id]
+	if m == nil || m.readers[reader] {
+		return false
+	}
+	m.readers[reader] = true
+	m.count++
+	if rr.opts.TrackReaders {
+		m.order = append(m.order, reader)
+	}
+	if rr.opts.BroadcastEvery <= 0 {
+		return false
+	}
+	if !m.dirty {
+		m.dirty = true
+		rr.dirty = append(rr.dirty, m)
+	}
+	schedule = !rr.pending
+	rr.pending = true
+	return schedule
+}
+
+// takeUpdates returns the updates for the messages changed since the last
+// broadcast.
+func (rr *roomReceipts) takeUpdates() []ReceiptUpdate {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	updates := make([]ReceiptUpdate, 0, len(rr.dirty))
+	for _, m := range rr.dirty {
+		m.dirty = false
+		if rr.byID[m.id] != m {
+			continue // expired meanwhile
+		}
+		u := ReceiptUpdate{ID: m.id, Count: m.count}
+		if rr.opts.TrackReaders {
+			u.Readers = append([]string(nil), m.order...)
+		}
+		updates = append(updates, u)
+	}
+	rr.dirty, rr.pending = nil, false
+	return updates
+}
+
+// stampReceipt gives msg an ID and tracks it, if msg goes to a room with
+// receipts enabled.
+func (ns *Namespace) stampReceipt(msg *Message) {
+	if msg.Room == "" {
+		return
+	}
+	r := ns.Room(msg.Room)
+	if r == nil {
+		return
+	}
+	rr := r.receipts.Load()
+	if rr == nil {
+		return
+	}
+	if msg.ID == "" {
+		msg.ID = ns.server.newID()
+	}
+	rr.track(msg.ID, time.Now())
+}
+
+// handleSeen records an EventSeen from c.
+func (c *Client) handleSeen(msg Message) {
+	id, _ := msg.Data.(string)
+	if id == "" || !c.InRoom(msg.Room) {
+		return
+	}
+	r := c.Namespace().Room(msg.Room)
+	if r == nil {
+		return
+	}
+	rr := r.receipts.Load()
+	if rr == nil {
+		return
+	}
+	reader := c.UserID()
+	if reader == "" {
+		reader = c.id
+	}
+	if rr.see(id, reader) {
+		time.AfterFunc(rr.opts.BroadcastEvery, func() { r.broadcastReceipts(rr) })
+	}
+}
+
+// broadcastReceipts sends the pending receipt updates to the room's local
+// members. Updates are not recorded in the room's history.
+func (r *Room) broadcastReceipts(rr *roomReceipts) {
+	updates := rr.takeUpdates()
+	if len(updates) == 0 {
+		return
+	}
+	ns := r.Namespace()
+	o := emitOptions{localOnly: true}
+	p, err := ns.encode(Message{Event: EventReceiptUpdate, Room: r.name, Data: updates}, o)
+	if err != nil {
+		return
+	}
+	deliver(ns, r.snapshot(), p, r.name, o)
+}
@@ -0,0 +1,85 @@
+package sockx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seen reports the room message with ID id as seen.
+func (tc *testConn) seen(room, id string) {
+	tc.t.Helper()
+	tc.send(Message{Event: EventSeen, Room: room, Data: id})
+}
+
+func TestReadReceiptsCountAndBroadcastReaders(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.EnableReceipts("r", ReceiptOptions{TrackReaders: true, BroadcastEvery: 20 * time.Millisecond})
+	a, b, outsider := dial(t, s, "/"), dial(t, s, "/"), dial(t, s, "/")
+	ns.Client(a.welcome.ID).Authenticate("alice", nil)
+	ns.Client(a.welcome.ID).Join("r")
+	ns.Client(b.welcome.ID).Join("r")
+
+	ns.EmitTo("r", "chat", "hi")
+	id := a.expect("chat").ID
+	if id == "" || b.expect("chat").ID != id {
+		t.Fatalf("room message IDs %q", id)
+	}
+	count := func() int {
+		rc, _ := ns.Room("r").Receipts(id)
+		return rc.Count
+	}
+	a.seen("r", id)
+	a.seen("r", id)
+	outsider.seen("r", id)
+	waitFor(t, "alice's receipt", func() bool { return count() == 1 })
+	b.seen("r", id)
+	waitFor(t, "both receipts", func() bool { return count() == 2 })
+	rc, _ := ns.Room("r").Receipts(id)
+	if want := fmt.Sprint([]string{"alice", b.welcome.ID}); fmt.Sprint(rc.Readers) != want {
+		t.Fatalf("readers = %v, want %s", rc.Readers, want)
+	}
+	for _, tc := range []*testConn{a, b} {
+		for {
+			var updates []ReceiptUpdate
+			if err := tc.expect(EventReceiptUpdate).Bind(&updates); err != nil {
+				t.Fatal(err)
+			}
+			if len(updates) != 1 || updates[0].ID != id {
+				t.Fatalf("updates = %+v", updates)
+			}
+			if updates[0].Count == 2 {
+				break
+			}
+		}
+	}
+}
+
+func TestReadReceiptsKeepLatestMessages(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.EnableReceipts("r", ReceiptOptions{MaxMessages: 1})
+	tc := dial(t, s, "/")
+	ns.Client(tc.welcome.ID).Join("r")
+	ns.Client(tc.welcome.ID).Join("plain")
+
+	ns.EmitTo("r", "chat", 1)
+	ns.EmitTo("r", "chat", 2)
+	ns.EmitTo("plain", "chat", 3)
+	first, second, plain := tc.expect("chat").ID, tc.expect("chat").ID, tc.expect("chat")
+	if plain.ID != "" {
+		t.Fatalf("message to a room without receipts got ID %q", plain.ID)
+	}
+	if _, ok := ns.Room("r").Receipts(first); ok {
+		t.Fatal("receipts kept beyond MaxMessages")
+	}
+	tc.seen("r", second)
+	waitFor(t, "the receipt", func() bool {
+		rc, ok := ns.Room("r").Receipts(second)
+		return ok && rc.Count == 1 && rc.Readers == nil
+	})
+	if _, ok := ns.Room("plain").Receipts(plain.ID); ok {
+		t.Fatal("receipts for a room without them")
+	}
+}
@@ -0,0 +1,131 @@
+// Package redisadapter provides a sockx.Adapter that connects the servers
+// of several nodes through Redis pub/sub, so that emits reach clients
+// connected to any of them:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	srv := sockx.NewServer(sockx.WithAdapter(redisadapter.New(rdb)))
+//
+// Messages are published as JSON to a channel per namespace and room,
+// named after them under a prefix, "sockx:" by default, and every node
+// subscribes to the channels under the prefix. Their data crosses as
+// JSON: other nodes deliver it as the values encoding/json decodes, and
+// []byte data as a base64 string. Messages a node receives are delivered
+// to its local clients only, and those it published itself are dropped,
+// so nothing is published twice.
+package redisadapter
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/NRO04/sockx"
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultPrefix starts the channels of the default adapter.
+const defaultPrefix = "sockx:"
+
+// Option configures an Adapter.
+type Option func(*Adapter)
+
+// WithPrefix sets the prefix of the adapter's channels, to keep several
+// deployments sharing a Redis apart. Nodes connected to each other must
+// use the same prefix.
+func WithPrefix(prefix string) Option {
+	return func(a *Adapter) { a.prefix = prefix }
+}
+
+var _ sockx.Closer = (*Adapter)(nil)
+
+// Adapter is a sockx.Adapter publishing through Redis.
+type Adapter struct {
+	client redis.UniversalClient
+	prefix string
+
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+}
+
+// envelope is a message as published, with the namespace and room it was
+// emitted to.
+type envelope struct {
+	Namespace string        `json:"namespace"`
+	Room      string        `json:"room,omitempty"`
+	Msg       sockx.Message `json:"msg"`
+}
+
+// New returns an adapter publishing through client. The client's own
+// settings, such as its timeouts and retries, apply to publishes; its
+// subscription reconnects by itself when the connection drops.
+func New(client redis.UniversalClient, opts ...Option) *Adapter {
+	a := &Adapter{client: client, prefix: defaultPrefix}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Channel returns the channel messages emitted to room in namespace are
+// published to: the prefix and the namespace name, followed by "#" and
+// the room for room emits. It implements sockx.ChannelNamer.
+func (a *Adapter) Channel(namespace, room string) string {
+	if room == "" {
+		return a.prefix + namespace
+	}
+	return a.prefix + namespace + "#" + room
+}
+
+// Publish publishes msg to the other nodes.
+func (a *Adapter) Publish(namespace, room string, msg sockx.Message) error {
+	payload, err := json.Marshal(envelope{Namespace: namespace, Room: room, Msg: msg})
+	if err != nil {
+		return err
+	}
+	return a.client.Publish(context.Background(), a.Channel(namespace, room), payload).Err()
+}
+
+// Subscribe subscribes to the channels under the adapter's prefix and
+// hands the messages published there to handler, one at a time, replacing
+// any previous subscription.
+func (a *Adapter) Subscribe(handler func(namespace, room string, msg sockx.Message)) {
+	ps := a.client.PSubscribe(context.Background(), a.prefix+"*")
+	a.mu.Lock()
+	prev := a.pubsub
+	a.pubsub = ps
+	a.mu.Unlock()
+	if prev != nil {
+		prev.Close()
+	}
+	go a.receive(ps, handler)
+}
+
+// receive delivers the messages of ps to handler until ps is closed.
+// Messages that are not envelopes, published under the prefix by
+// something else, are skipped.
+func (a *Adapter) receive(ps *redis.PubSub, handler func(namespace, room string, msg sockx.Message)) {
+	for m := range ps.Channel() {
+		if !strings.HasPrefix(m.Channel, a.prefix) {
+			continue
+		}
+		var env envelope
+		if err := json.Unmarshal([]byte(m.Payload), &env); err != nil || env.Namespace == "" {
+			continue
+		}
+		handler(env.Namespace, env.Room, env.Msg)
+	}
+}
+
+// Close ends the adapter's subscription. It does not close the client.
+// It implements sockx.Closer, so Server.Shutdown calls it.
+func (a *Adapter) Close(ctx context.Context) error {
+	a.mu.Lock()
+	ps := a.pubsub
+	a.pubsub = nil
+	a.mu.Unlock()
+	if ps == nil {
+		return nil
+	}
+	return ps.Close()
+}
@@ -0,0 +1,199 @@
+package redisadapter_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/client"
+	"github.com/NRO04/sockx/redisadapter"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testTimeout bounds every wait in the tests.
+const testTimeout = 5 * time.Second
+
+// node is a server connected to the others through Redis, serving
+// namespace /.
+type node struct {
+	srv *sockx.Server
+	url string
+}
+
+// newNode starts a server publishing through the Redis at addr and waits
+// for its subscription, counted by mr, to be in place.
+func newNode(t *testing.T, mr *miniredis.Miniredis, opts ...redisadapter.Option) *node {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	subs := mr.PubSubNumPat()
+	a := redisadapter.New(rdb, opts...)
+	srv := sockx.NewServer(sockx.WithAdapter(a))
+	ts := httptest.NewServer(srv.ServeWebSocket("/"))
+	t.Cleanup(func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	deadline := time.Now().Add(testTimeout)
+	for mr.PubSubNumPat() == subs {
+		if time.Now().After(deadline) {
+			t.Fatal("adapter did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return &node{srv: srv, url: "ws" + strings.TrimPrefix(ts.URL, "http")}
+}
+
+// dial connects to n and returns the connection with a channel receiving
+// the data of its event messages.
+func (n *node) dial(t *testing.T, event string) (*client.Conn, chan interface{}) {
+	t.Helper()
+	c, err := client.Dial(n.url, client.WithTimeout(testTimeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	got := make(chan interface{}, 16)
+	c.On(event, func(data interface{}) { got <- data })
+	return c, got
+}
+
+// expect returns the next data received on got.
+func expect(t *testing.T, got chan interface{}, who string) interface{} {
+	t.Helper()
+	select {
+	case data := <-got:
+		return data
+	case <-time.After(testTimeout):
+		t.Fatalf("%s received nothing", who)
+		return nil
+	}
+}
+
+// expectNone fails if got receives anything for a while.
+func expectNone(t *testing.T, got chan interface{}, who string) {
+	t.Helper()
+	select {
+	case data := <-got:
+		t.Fatalf("%s received %v more than once", who, data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBroadcastReachesEveryNodeOnce(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, b := newNode(t, mr), newNode(t, mr)
+	_, onA := a.dial(t, "news")
+	_, onB := b.dial(t, "news")
+
+	if _, err := a.srv.Of("/").Emit("news", map[string]interface{}{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	for who, got := range map[string]chan interface{}{"client of A": onA, "client of B": onB} {
+		data, ok := expect(t, got, who).(map[string]interface{})
+		if !ok || data["n"] != 1.0 {
+			t.Fatalf("%s received %v, want {n: 1}", who, data)
+		}
+	}
+	// A drops its own message when Redis hands it back.
+	expectNone(t, onA, "client of A")
+	expectNone(t, onB, "client of B")
+}
+
+func TestRoomEmitReachesMembersOnOtherNode(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, b := newNode(t, mr), newNode(t, mr)
+	member, onMember := b.dial(t, "chat")
+	_, onOther := b.dial(t, "chat")
+	if err := b.srv.Of("/").Client(member.ID()).Join("r"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.srv.Of("/").EmitTo("r", "chat", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if data := expect(t, onMember, "room member"); data != "hi" {
+		t.Fatalf("room member received %v, want hi", data)
+	}
+	expectNone(t, onMember, "room member")
+	select {
+	case data := <-onOther:
+		t.Fatalf("client outside the room received %v", data)
+	default:
+	}
+}
+
+func TestPrefixesKeepDeploymentsApart(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := newNode(t, mr, redisadapter.WithPrefix("blue:"))
+	b := newNode(t, mr, redisadapter.WithPrefix("green:"))
+	_, onB := b.dial(t, "news")
+
+	if _, err := a.srv.Of("/").Emit("news", "blue only"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-onB:
+		t.Fatalf("node of another deployment received %v", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestForeignPublishesAreSkipped(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := newNode(t, mr)
+	_, onA := a.dial(t, "news")
+	mr.Publish("sockx:/", "not an envelope")
+	if _, err := newNode(t, mr).srv.Of("/").Emit("news", "real"); err != nil {
+		t.Fatal(err)
+	}
+	if data := expect(t, onA, "client of A"); data != "real" {
+		t.Fatalf("client received %v, want real", data)
+	}
+}
+
+func TestShutdownClosesSubscription(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, b := newNode(t, mr), newNode(t, mr)
+	_, onB := b.dial(t, "news")
+	subs := mr.PubSubNumPat()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := b.srv.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(testTimeout)
+	for mr.PubSubNumPat() != subs-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pattern subscriptions after shutdown, want %d", mr.PubSubNumPat(), subs-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := a.srv.Of("/").Emit("news", "after"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-onB:
+		t.Fatalf("node that shut down received %v", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestChannelNames(t *testing.T) {
+	a := redisadapter.New(redis.NewClient(&redis.Options{}), redisadapter.WithPrefix("app:"))
+	for _, tt := range []struct{ namespace, room, want string }{
+		{"/", "", "app:/"},
+		{"/chat", "lobby", "app:/chat#lobby"},
+	} {
+		if got := a.Channel(tt.namespace, tt.room); got != tt.want {
+			t.Errorf("Channel(%q, %q) = %q, want %q", tt.namespace, tt.room, got, tt.want)
+		}
+	}
+}
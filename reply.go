@@ -0,0 +1,82 @@
+package sockx
+
+import "bytes"
+
+// EventBatch carries several messages in one frame to clients that
+// negotiated FeatureBatch. Its data is an array of ordinary messages, to be
+// handled in order.
+const EventBatch = "sockx:batch"
+
+// FeatureBatch lets the server combine several messages into one
+// EventBatch frame.
+const FeatureBatch Feature = "batch"
+
+func init() {
+	supportedFeatures = append(supportedFeatures, FeatureBatch)
+}
+
+// Reply queues event for the client that sent ev. Replies made while the
+// handler runs are held back and flushed together once it returns, as a
+// single EventBatch frame if the client negotiated FeatureBatch and speaks
+// JSONCodec, and as consecutive frames otherwise. Replies made after the handler returned,
+// and Critical replies, are sent right away.
+//
+// Encoding errors, including ErrPayloadTooLarge, are returned immediately;
+// errors queueing the flushed frames are not reported.
+func (ev *Event) Reply(event string, data interface{}, opts ...EmitOption) error {
+	c := ev.client
+	o := buildEmitOptions(opts)
+	p, err := c.Namespace().encode(Message{Event: event, Data: data}, o)
+	if err != nil {
+		return err
+	}
+	m := p.frame(c)
+	if m == nil {
+		return errRecode
+	}
+
+	ev.mu.Lock()
+	if ev.flushed || o.critical {
+		ev.mu.Unlock()
+		return c.send(m, o.critical)
+	}
+	ev.replies = append(ev.replies, m)
+	ev.mu.Unlock()
+	return nil
+}
+
+// flushReplies sends the replies held back while the handler ran.
+func (ev *Event) flushReplies() {
+	ev.mu.Lock()
+	replies := ev.replies
+	ev.replies, ev.flushed = nil, true
+	ev.mu.Unlock()
+
+	c := ev.client
+	if len(replies) > 1 && c.Supports(FeatureBatch) && isJSON(c.codec) {
+		c.send(c.codec.(JSONCodec).batchFrame(replies), false)
+		return
+	}
+	for _, m := range replies {
+		c.send(m, false)
+	}
+}
+
+// batchFrame combines messages encoded by j into one EventBatch frame.
+func (j JSONCodec) batchFrame(frames []*outbound) *outbound {
+	env := j.envelope()
+	var b bytes.Buffer
+	b.WriteByte('{')
+	b.Write(env.quoted[fieldEvent])
+	b.WriteString(`:"` + EventBatch + `",`)
+	b.Write(env.quoted[fieldData])
+	b.WriteString(":[")
+	for i, m := range frames {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(m.data)
+	}
+	b.WriteString("]}")
+	return &outbound{data: b.Bytes()}
+}
@@ -0,0 +1,114 @@
+package sockx
+
+import (
+	"fmt"
+	"testing"
+)
+
+// dialFeatures connects to the namespace of s declaring features.
+func dialFeatures(t testing.TB, s *Server, namespace string, features ...Feature) *testConn {
+	t.Helper()
+	url := serve(t, s, namespace) + "?" + FeaturesQueryParam + "="
+	for i, f := range features {
+		if i > 0 {
+			url += ","
+		}
+		url += string(f)
+	}
+	return dialURL(t, url, nil)
+}
+
+// replyThrice registers a handler for "ask" that replies three times.
+func replyThrice(ns *Namespace) {
+	ns.OnEvent("ask", func(ev *Event) {
+		for i := 0; i < 3; i++ {
+			ev.Reply("answer", i)
+		}
+	})
+}
+
+func TestRepliesAreBatchedForClientsThatNegotiated(t *testing.T) {
+	s := newTestServer(t)
+	replyThrice(s.Of("/"))
+	tc := dialFeatures(t, s, "/", FeatureBatch)
+	tc.emit("ask", nil)
+	var batch []Message
+	if err := tc.expect(EventBatch).Bind(&batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 3 {
+		t.Fatalf("batch of %d messages, want 3", len(batch))
+	}
+	for i, msg := range batch {
+		if msg.Event != "answer" || msg.Data != float64(i) {
+			t.Fatalf("batch[%d] = %s %v, want answer %d", i, msg.Event, msg.Data, i)
+		}
+	}
+}
+
+func TestRepliesAreSentSeparatelyWithoutBatching(t *testing.T) {
+	s := newTestServer(t)
+	replyThrice(s.Of("/"))
+	tc := dial(t, s, "/")
+	tc.emit("ask", nil)
+	for i := 0; i < 3; i++ {
+		msg := tc.read()
+		if msg.Event != "answer" || msg.Data != float64(i) {
+			t.Fatalf("frame %d = %s %v, want answer %d", i, msg.Event, msg.Data, i)
+		}
+	}
+}
+
+func TestRepliesAfterHandlerReturnsAreSentRightAway(t *testing.T) {
+	s := newTestServer(t)
+	later := make(chan *Event, 1)
+	s.Of("/").OnEvent("ask", func(ev *Event) { later <- ev })
+	tc := dialFeatures(t, s, "/", FeatureBatch)
+	tc.emit("ask", nil)
+	ev := <-later
+	// The handler may not have returned yet; wait for the flush.
+	waitFor(t, "replies flushed", func() bool {
+		ev.mu.Lock()
+		defer ev.mu.Unlock()
+		return ev.flushed
+	})
+	if err := ev.Reply("answer", "late"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := tc.read(); msg.Event != "answer" || msg.Data != "late" {
+		t.Fatalf("got %s %v, want the late answer on its own", msg.Event, msg.Data)
+	}
+}
+
+// BenchmarkReplies measures the frames written per handled event with and
+// without reply batching.
+func BenchmarkReplies(b *testing.B) {
+	for _, batched := range []bool{false, true} {
+		b.Run(fmt.Sprintf("batched=%v", batched), func(b *testing.B) {
+			s := newTestServer(b)
+			replyThrice(s.Of("/"))
+			var tc *testConn
+			if batched {
+				tc = dialFeatures(b, s, "/", FeatureBatch)
+			} else {
+				tc = dial(b, s, "/")
+			}
+			frames := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tc.emit("ask", nil)
+				for got := 0; got < 3; frames++ {
+					msg := tc.read()
+					if msg.Event == EventBatch {
+						var batch []Message
+						msg.Bind(&batch)
+						got += len(batch)
+					} else {
+						got++
+					}
+				}
+			}
+			b.ReportMetric(float64(frames)/float64(b.N), "frames/op")
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package sockx
+
+import "net/http"
+
+// handshakeRequest returns a copy of r, the handshake request of a
+// connection, to be kept for the connection's life. It has no body.
+func handshakeRequest(r *http.Request) *http.Request {
+	req := r.Clone(r.Context())
+	req.Body = http.NoBody
+	req.GetBody = nil
+	req.ContentLength = 0
+	return req
+}
+
+// Request returns the handshake request of the client's connection, with
+// its URL, headers, cookies, remote address and TLS state as they were at
+// the upgrade, for handlers that need them after connection middleware
+// ran. Its body is not kept: reading it returns nothing. It must not be
+// modified. Clients created by NewDetachedClient have no request and
+// return nil.
+func (c *Client) Request() *http.Request { return c.request }
+
+// Query returns the first value of the handshake request's query
+// parameter key, or "" if there is none.
+func (c *Client) Query(key string) string {
+	if c.request == nil {
+		return ""
+	}
+	return c.request.URL.Query().Get(key)
+}
+
+// Cookie returns the handshake request's cookie named name, or
+// http.ErrNoCookie if there is none.
+func (c *Client) Cookie(name string) (*http.Cookie, error) {
+	if c.request == nil {
+		return nil, http.ErrNoCookie
+	}
+	return c.request.Cookie(name)
+}
@@ -0,0 +1,71 @@
+package sockx
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientKeepsHandshakeRequest(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	connected := make(chan *Client, 1)
+	ns.OnConnect(func(c *Client) { connected <- c })
+	header := http.Header{
+		"Authorization": {"Bearer t0ken"},
+		"Cookie":        {"session=xyz; theme=dark"},
+	}
+	dialURL(t, serve(t, s, "/")+"?room=lobby&room=other&v=2", header)
+	c := <-connected
+
+	if got := c.Query("room"); got != "lobby" {
+		t.Errorf("Query(room) = %q, want the first value", got)
+	}
+	if got := c.Query("missing"); got != "" {
+		t.Errorf("Query(missing) = %q", got)
+	}
+	if ck, err := c.Cookie("session"); err != nil || ck.Value != "xyz" {
+		t.Errorf("Cookie(session) = %v, %v", ck, err)
+	}
+	if _, err := c.Cookie("missing"); !errors.Is(err, http.ErrNoCookie) {
+		t.Errorf("Cookie(missing) = %v, want ErrNoCookie", err)
+	}
+	r := c.Request()
+	if r.Header.Get("Authorization") != "Bearer t0ken" || !strings.HasPrefix(r.RemoteAddr, "127.0.0.1:") || r.TLS != nil {
+		t.Errorf("request = %s %v %v", r.RemoteAddr, r.Header, r.TLS)
+	}
+	if body, err := io.ReadAll(r.Body); err != nil || len(body) != 0 {
+		t.Errorf("body = %q, %v; want it not retained", body, err)
+	}
+}
+
+func TestHandshakeRequestDropsBody(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?a=1", strings.NewReader("secret"))
+	r.Header.Set("X-Test", "before")
+	req := handshakeRequest(r)
+	r.Header.Set("X-Test", "after")
+
+	if body, _ := io.ReadAll(req.Body); len(body) != 0 || req.ContentLength != 0 || req.GetBody != nil {
+		t.Fatalf("copy keeps a body: %q, length %d", body, req.ContentLength)
+	}
+	if req.Header.Get("X-Test") != "before" || req.URL.Query().Get("a") != "1" {
+		t.Fatalf("copy shares the original's state: %v %v", req.Header, req.URL)
+	}
+	if body, _ := io.ReadAll(r.Body); string(body) != "secret" {
+		t.Fatalf("original body = %q, want it untouched", body)
+	}
+}
+
+func TestDetachedClientHasNoRequest(t *testing.T) {
+	s := newTestServer(t)
+	c := NewDetachedClient(s.Of("/"))
+	if c.Request() != nil || c.Query("a") != "" {
+		t.Fatal("detached client has a request")
+	}
+	if _, err := c.Cookie("session"); !errors.Is(err, http.ErrNoCookie) {
+		t.Fatalf("Cookie = %v, want ErrNoCookie", err)
+	}
+}
@@ -0,0 +1,189 @@
+package sockx
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventResumeComplete is sent to a client once its session has been
+// resumed and missed room messages replayed. Live messages follow it.
+const EventResumeComplete = "sockx:resume-complete"
+
+// Query parameters a reconnecting client uses to resume its session.
+// ResumeCursorParam is repeated once per room, as "seq:room" with the
+// sequence number of the last message received from the room.
+const (
+	ResumeTokenParam  = "sockx_resume"
+	ResumeCursorParam = "sockx_cursor"
+)
+
+// ResumeData is the payload of EventResumeComplete.
+type ResumeData struct {
+	Rooms []ResumedRoom `json:"rooms"`
+}
+
+// ResumedRoom reports how one room of a resumed session was restored.
+// History is false for rooms without history, which are rejoined without
+// replay. Gap reports that some missed messages were no longer in the
+// history, and Denied that the room could not be rejoined, because the
+// room guard refused it or the room is being archived.
+type ResumedRoom struct {
+	Room     string `json:"room"`
+	Replayed int    `json:"replayed"`
+	History  bool   `json:"history"`
+	Gap      bool   `json:"gap,omitempty"`
+	Denied   bool   `json:"denied,omitempty"`
+}
+
+// session is what is kept of a disconnected client for resumption.
+type session struct {
+	rooms []string
+	timer *time.Timer
+}
+
+// EnableResume lets clients that lose their connection resume their
+// session within ttl. Each client gets a resume token in EventWelcome; a
+// client reconnecting with it in the sockx_resume query parameter gets its
+// rooms back, with the messages it missed replayed from rooms that have
+// history (see EnableHistory) before any live message, followed by
+// EventResumeComplete. The user identity is not restored and must be
+// re-established.
+func (ns *Namespace) EnableResume(ttl time.Duration) {
+	ns.mu.Lock()
+	ns.resumeTTL = ttl
+	if ns.sessions == nil {
+		ns.sessions = make(map[string]*session)
+	}
+	ns.mu.Unlock()
+}
+
+// resumeToken returns a token for a new connection, reusing the one in r
+// when it is being resumed, and the session it resumes if any.
+func (ns *Namespace) resumeToken(r *http.Request) (string, *session) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.resumeTTL <= 0 {
+		return "", nil
+	}
+	if token := r.URL.Query().Get(ResumeTokenParam); token != "" {
+		if sess, ok := ns.sessions[token]; ok {
+			delete(ns.sessions, token)
+			sess.timer.Stop()
+			return token, sess
+		}
+	}
+	return ns.server.newID() + ns.server.newID(), nil
+}
+
+// saveSession keeps a disconnected client's rooms for resumption. It
+// reports whether the namespace has resumption enabled for the client.
+func (ns *Namespace) saveSession(c *Client, rooms []string) bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.resumeTTL <= 0 || c.resumeToken == "" {
+		return false
+	}
+	token := c.resumeToken
+	sess := &session{rooms: rooms}
+	sess.timer = time.AfterFunc(ns.resumeTTL, func() {
+		ns.mu.Lock()
+		expired := ns.sessions[token] == sess
+		if expired {
+			delete(ns.sessions, token)
+		}
+		ns.mu.Unlock()
+		if expired {
+			ns.dedup.forget("session:" + token)
+		}
+	})
+	ns.sessions[token] = sess
+	return true
+}
+
+// cursorsFromRequest parses the resume cursors in r.
+func cursorsFromRequest(r *http.Request) map[string]uint64 {
+	cursors := make(map[string]uint64)
+	for _, v := range r.URL.Query()[ResumeCursorParam] {
+		seq, room, ok := strings.Cut(v, ":")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(seq, 10, 64); err == nil {
+			cursors[room] = n
+		}
+	}
+	return cursors
+}
+
+// resume rejoins the rooms of sess, replaying what the client missed.
+// Live messages are held back until EventResumeComplete has been queued.
+func (c *Client) resume(sess *session, cursors map[string]uint64) {
+	c.queue.hold()
+	defer c.queue.release()
+
+	ns := c.Namespace()
+	report := ResumeData{Rooms: make([]ResumedRoom, 0, len(sess.rooms))}
+	for _, room := range sess.rooms {
+		rr := ResumedRoom{Room: room}
+		if ns.checkRoomGuard(c, room) != nil {
+			rr.Denied = true
+			report.Rooms = append(report.Rooms, rr)
+			continue
+		}
+		if err := c.rejoin(ns, &rr, cursors); err == ErrClientClosed {
+			return
+		} else if err != nil {
+			rr.Denied = true
+		}
+		report.Rooms = append(report.Rooms, rr)
+	}
+	if m, err := c.encode(Message{Event: EventResumeComplete, Data: report}); err == nil {
+		c.queue.pushThrough(m)
+	}
+}
+
+// rejoin adds the client to rr.Room and replays the room's history after
+// its cursor. Joining and replaying happen under the history lock, so
+// every message is either replayed or delivered live, never both.
+func (c *Client) rejoin(ns *Namespace, rr *ResumedRoom, cursors map[string]uint64) error {
+	c.mu.Lock()
+	c.rooms[rr.Room] = true
+	c.mu.Unlock()
+
+	r := ns.Room(rr.Room)
+	if r == nil || r.history == nil {
+		return c.rejoined(rr.Room, ns.joinRoom(rr.Room, c))
+	}
+	h := r.history
+	h.mu.Lock()
+	j, err := ns.addToRoom(rr.Room, c)
+	if err == nil && j.room == r {
+		rr.History = true
+		if seq, ok := cursors[rr.Room]; ok {
+			var entries []historyEntry
+			entries, rr.Gap = h.sinceLocked(seq)
+			for _, e := range entries {
+				if m := e.p.frame(c); m != nil && c.queue.pushThrough(m) == nil {
+					rr.Replayed++
+				}
+			}
+		}
+	}
+	h.mu.Unlock()
+	if err == nil {
+		ns.joined(j)
+	}
+	return c.rejoined(rr.Room, err)
+}
+
+// rejoined undoes the bookkeeping of a failed rejoin.
+func (c *Client) rejoined(room string, err error) error {
+	if err != nil {
+		c.mu.Lock()
+		delete(c.rooms, room)
+		c.mu.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package sockx
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// resumableRoom sets up namespace / with history and resumption, its
+// clients joining room r on connect. A detached member keeps r, and its
+// history, alive while no connection is in it.
+func resumableRoom(t *testing.T) (*Namespace, string) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.EnableHistory(16)
+	ns.EnableResume(time.Minute)
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind == LifecycleConnect && !ev.Client.detached() {
+			ev.Client.Join("r")
+		}
+	})
+	NewDetachedClient(ns).Join("r")
+	return ns, serve(t, s, "/")
+}
+
+// awaitClients waits until ns has n clients.
+func awaitClients(t *testing.T, ns *Namespace, n int) {
+	waitFor(t, fmt.Sprintf("%d clients", n), func() bool { return ns.Stats().Clients == n })
+}
+
+func TestResumeReplaysMissedMessagesInOrder(t *testing.T) {
+	ns, base := resumableRoom(t)
+	tc := dialURL(t, base, nil)
+	awaitClients(t, ns, 2)
+	ns.EmitTo("r", "msg", 1)
+	last := tc.expect("msg").Seq
+	tc.conn.Close()
+	awaitClients(t, ns, 1)
+
+	ns.EmitTo("r", "msg", 2)
+	h := ns.Room("r").EmitAsync("msg", 3)
+	if _, err := h.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ns.Room("r").Emit("msg", 4)
+
+	q := url.Values{}
+	q.Set(ResumeTokenParam, tc.welcome.ResumeToken)
+	q.Add(ResumeCursorParam, fmt.Sprintf("%d:r", last))
+	resumed := dialURL(t, base+"/?"+q.Encode(), nil)
+	if !resumed.welcome.Resumed {
+		t.Fatal("session not resumed")
+	}
+	for want := 2; want <= 4; want++ {
+		msg := resumed.read()
+		if msg.Event != "msg" {
+			t.Fatalf("got %s before the missed messages", msg.Event)
+		}
+		var n int
+		msg.Bind(&n)
+		if n != want || msg.Seq != last+uint64(want-1) {
+			t.Fatalf("replayed message %d with seq %d, want %d with seq %d", n, msg.Seq, want, last+uint64(want-1))
+		}
+	}
+	var done ResumeData
+	if err := resumed.expect(EventResumeComplete).Bind(&done); err != nil {
+		t.Fatal(err)
+	}
+	if len(done.Rooms) != 1 || done.Rooms[0].Replayed != 3 || !done.Rooms[0].History || done.Rooms[0].Gap {
+		t.Fatalf("resume report = %+v, want 3 replayed from r without gap", done.Rooms)
+	}
+	ns.EmitTo("r", "msg", 5)
+	if msg := resumed.expect("msg"); msg.Seq != last+4 {
+		t.Fatalf("live message after resume has seq %d, want %d", msg.Seq, last+4)
+	}
+}
+
+func TestRoomEmitAsyncIsNumbered(t *testing.T) {
+	ns, base := resumableRoom(t)
+	tc := dialURL(t, base, nil)
+	awaitClients(t, ns, 2)
+	ns.EmitTo("r", "msg", 1)
+	first := tc.expect("msg").Seq
+	ns.Room("r").EmitAsync("msg", 2)
+	if seq := tc.expect("msg").Seq; seq != first+1 {
+		t.Fatalf("EmitAsync message seq = %d, want %d", seq, first+1)
+	}
+}
+
+func TestResumeCompletesWithRoomBeingArchived(t *testing.T) {
+	ns, base := resumableRoom(t)
+	archiving := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	ns.OnRoomArchive(func(ctx context.Context, a RoomArchive) error {
+		close(archiving)
+		<-release
+		return nil
+	})
+	tc := dialURL(t, base, nil)
+	awaitClients(t, ns, 2)
+	if err := ns.Client(tc.welcome.ID).Join("a"); err != nil {
+		t.Fatal(err)
+	}
+	tc.conn.Close()
+	<-archiving
+
+	q := url.Values{}
+	q.Set(ResumeTokenParam, tc.welcome.ResumeToken)
+	resumed := dialURL(t, base+"/?"+q.Encode(), nil)
+	var done ResumeData
+	if err := resumed.expect(EventResumeComplete).Bind(&done); err != nil {
+		t.Fatal(err)
+	}
+	denied := make(map[string]bool)
+	for _, rr := range done.Rooms {
+		denied[rr.Room] = rr.Denied
+	}
+	if len(done.Rooms) != 2 || !denied["a"] || denied["r"] {
+		t.Fatalf("resume report = %+v, want a denied and r rejoined", done.Rooms)
+	}
+	ns.EmitTo("r", "msg", 1)
+	resumed.expect("msg")
+}
@@ -0,0 +1,124 @@
+package sockx
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxPooledFrame is the largest frame buffer returned to framePool, so that
+// one huge message does not keep its buffer alive forever.
+const maxPooledFrame = 64 << 10
+
+// framePool recycles the buffers inbound frames are read into.
+var framePool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readFrame reads the next message from the connection into a pooled
+// buffer and returns it with the message type. The caller owns the buffer
+// and should hand it back with putFrame once done with it.
+func (c *Client) readFrame() (int, *bytes.Buffer, error) {
+	msgType, r, err := c.conn.NextReader()
+	if err != nil {
+		return 0, nil, readError(err)
+	}
+	if c.readLimit > 0 {
+		// The connection's own limit counts the bytes on the wire, which
+		// a compressed message may inflate far beyond.
+		r = io.LimitReader(r, c.readLimit+1)
+	}
+	buf := framePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if _, err := buf.ReadFrom(r); err != nil {
+		putFrame(buf)
+		return 0, nil, readError(err)
+	}
+	if c.readLimit > 0 && int64(buf.Len()) > c.readLimit {
+		putFrame(buf)
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseMessageTooBig, ""),
+			time.Now().Add(c.server.cfg().WriteTimeout))
+		return 0, nil, ErrMessageTooLarge
+	}
+	return msgType, buf, nil
+}
+
+// readError reports the websocket package's ErrReadLimit, after which it
+// has sent CloseMessageTooBig, as ErrMessageTooLarge.
+func readError(err error) error {
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return ErrMessageTooLarge
+	}
+	return err
+}
+
+func putFrame(buf *bytes.Buffer) {
+	if buf != nil && buf.Cap() <= maxPooledFrame {
+		framePool.Put(buf)
+	}
+}
+
+// Raw returns the frame that carried the event, as received. It shares a
+// pooled buffer and is only valid until the handler returns, unless the
+// handler called Retain.
+func (ev *Event) Raw() []byte {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.checkReleasedLocked("Raw")
+	if ev.frame != nil {
+		return ev.frame.Bytes()
+	}
+	return ev.raw
+}
+
+// Retain keeps the event's payload usable after the handler returns, by
+// copying the frame out of its pooled buffer, and returns ev. Handlers
+// must call it before storing the Event or its Raw bytes anywhere that
+// outlives them; otherwise Data and Raw return nil once the handler
+// returns, or panic with Config.DebugEvents set. Calling it after the
+// handler returned is too late and has no effect, or panics in debug
+// mode.
+func (ev *Event) Retain() *Event {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.checkReleasedLocked("Retain")
+	if ev.retained || ev.released {
+		return ev
+	}
+	ev.retained = true
+	if b, ok := ev.msg.Data.([]byte); ok {
+		ev.msg.Data = append([]byte(nil), b...)
+	}
+	if ev.frame != nil {
+		ev.raw = append([]byte(nil), ev.frame.Bytes()...)
+		putFrame(ev.frame)
+		ev.frame = nil
+	}
+	return ev
+}
+
+// release invalidates the event's payload once its handler has returned,
+// recycling the frame buffer, unless the handler retained it.
+func (ev *Event) release() {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.retained || ev.released {
+		return
+	}
+	ev.released = true
+	putFrame(ev.frame)
+	ev.frame, ev.raw = nil, nil
+	ev.msg.Data, ev.rawData = nil, nil
+}
+
+// checkReleasedLocked panics if the event was released and the server is
+// in DebugEvents mode. ev.mu must be held.
+func (ev *Event) checkReleasedLocked(method string) {
+	if !ev.released || !ev.client.server.cfg().DebugEvents {
+		return
+	}
+	panic("sockx: Event." + method + " called on event " + ev.msg.Event +
+		" after its handler returned; call Event.Retain in the handler to keep the event")
+}
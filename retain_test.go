@@ -0,0 +1,96 @@
+package sockx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stashEvents registers a "keep" handler storing its event, retained if
+// retain is set, and a "check" handler passing the stored event to check.
+// With one handler per client at a time, "check" runs after the "keep"
+// handler has returned and its event has been released.
+func stashEvents(t *testing.T, retain bool, check func(kept *Event), opts ...Option) *testConn {
+	t.Helper()
+	s := newTestServer(t, append([]Option{WithHandlerConcurrency(1, 100)}, opts...)...)
+	ns := s.Of("/")
+	var kept *Event
+	ns.OnEvent("keep", func(ev *Event) {
+		if retain {
+			ev.Retain()
+		}
+		kept = ev
+	})
+	done := make(chan struct{})
+	ns.OnEvent("check", func(ev *Event) {
+		defer close(done)
+		check(kept)
+	})
+	tc := dial(t, s, "/")
+	tc.emit("keep", map[string]interface{}{"text": "hello"})
+	// Reuse the pooled buffers with frames of other sizes and contents.
+	for i := 0; i < 20; i++ {
+		tc.emit("noise", strings.Repeat(fmt.Sprint(i), 100*i))
+	}
+	tc.emit("check", nil)
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("check handler not called")
+	}
+	return tc
+}
+
+func TestRetainedEventOutlivesHandler(t *testing.T) {
+	stashEvents(t, true, func(kept *Event) {
+		var v struct{ Text string }
+		if err := kept.Bind(&v); err != nil || v.Text != "hello" {
+			t.Errorf("Bind = %+v, %v; want hello", v, err)
+		}
+		if got := fmt.Sprint(kept.Data()); got != "map[text:hello]" {
+			t.Errorf("Data = %s, want map[text:hello]", got)
+		}
+		if raw := string(kept.Raw()); !strings.Contains(raw, `"keep"`) || !strings.Contains(raw, `"hello"`) {
+			t.Errorf("Raw = %s, want the original frame", raw)
+		}
+	}, WithDebugEvents())
+}
+
+func TestUnretainedEventIsReleased(t *testing.T) {
+	stashEvents(t, false, func(kept *Event) {
+		if d := kept.Data(); d != nil {
+			t.Errorf("Data after release = %v, want nil", d)
+		}
+		if raw := kept.Raw(); raw != nil {
+			t.Errorf("Raw after release = %q, want nil", raw)
+		}
+		if kept.Name() != "keep" {
+			t.Errorf("Name after release = %q, want keep", kept.Name())
+		}
+	})
+}
+
+func TestUnretainedEventPanicsInDebugMode(t *testing.T) {
+	for _, access := range []struct {
+		method string
+		fn     func(ev *Event)
+	}{
+		{"Data", func(ev *Event) { ev.Data() }},
+		{"Raw", func(ev *Event) { ev.Raw() }},
+		{"Bind", func(ev *Event) { ev.Bind(new(interface{})) }},
+		{"Retain", func(ev *Event) { ev.Retain() }},
+	} {
+		t.Run(access.method, func(t *testing.T) {
+			stashEvents(t, false, func(kept *Event) {
+				defer func() {
+					p := recover()
+					if msg, _ := p.(string); !strings.Contains(msg, "Event."+access.method) || !strings.Contains(msg, "Retain") {
+						t.Errorf("panic = %v, want one naming %s and Retain", p, access.method)
+					}
+				}()
+				access.fn(kept)
+			}, WithDebugEvents())
+		})
+	}
+}
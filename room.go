@@ -0,0 +1,209 @@
+package sockx
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Room is a named group of clients within a namespace.
+type Room struct {
+	name string
+	ns   atomic.Pointer[Namespace]
+
+	mu sync.RWMutex
+	// clients maps each member to its join sequence number, which orders
+	// members by join time.
+	clients map[*Client]uint64
+	joins   uint64
+
+	// members caches the view of clients snapshots share; it is cleared
+	// whenever clients changes. See Namespace.Snapshot.
+	members atomic.Pointer[roomView]
+
+	// Presence state, used when the namespace has presence enabled. users
+	// counts each user's connections in the room, plus one for a pending
+	// leave; memberUser records the user ID each client joined as.
+	users      map[string]int
+	memberUser map[*Client]string
+	pending    map[string]*pendingLeave
+
+	// history is set when the namespace has history enabled.
+	history *roomHistory
+
+	// receipts is set when the room has receipts enabled.
+	receipts atomic.Pointer[roomReceipts]
+
+	// flags holds the members' raised ephemeral flags.
+	flags map[*Client]map[string]*flagEntry
+
+	// fanout is held exclusively by EmitOrdered and shared by the other
+	// emits to the room while they queue.
+	fanout sync.RWMutex
+
+	// createdAt and the membership log are kept for OnRoomArchive.
+	createdAt              time.Time
+	membershipLog          []MembershipChange
+	membershipLogTruncated bool
+}
+
+func newRoom(ns *Namespace, name string) *Room {
+	r := &Room{
+		name:      name,
+		clients:   make(map[*Client]uint64),
+		createdAt: time.Now(),
+	}
+	r.ns.Store(ns)
+	if ns.historySize > 0 {
+		r.history = &roomHistory{size: ns.historySize}
+	}
+	if opts, ok := ns.receiptRooms[name]; ok {
+		r.receipts.Store(newRoomReceipts(opts))
+	}
+	return r
+}
+
+// Name returns the room name.
+func (r *Room) Name() string { return r.name }
+
+// Namespace returns the namespace the room belongs to. It changes if the
+// room is migrated with MigrateRoom.
+func (r *Room) Namespace() *Namespace { return r.ns.Load() }
+
+// Size returns the number of clients in the room. With presence enabled,
+// users whose leave is pending their grace period are not counted.
+func (r *Room) Size() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.clients)
+}
+
+// Has reports whether c is in the room.
+func (r *Room) Has(c *Client) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.clients[c]
+	return ok
+}
+
+// Clients returns the clients in the room, longest-standing member first.
+// The slice is a copy the caller may keep; it does not follow later joins
+// and leaves. Like Size and Has, it may be called from handlers, including
+// while they emit to the room. To query several rooms at one instant, use
+// Namespace.Snapshot.
+func (r *Room) Clients() []*Client {
+	r.mu.RLock()
+	clients := make([]*Client, 0, len(r.clients))
+	for c := range r.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return r.clients[clients[i]] < r.clients[clients[j]] })
+	r.mu.RUnlock()
+	return clients
+}
+
+// ClientIDs returns the IDs of the clients in the room, in the order of
+// Clients.
+func (r *Room) ClientIDs() []string {
+	clients := r.Clients()
+	ids := make([]string, len(clients))
+	for i, c := range clients {
+		ids[i] = c.id
+	}
+	return ids
+}
+
+// Emit sends event to every client in the room.
+func (r *Room) Emit(event string, data interface{}, opts ...EmitOption) (EmitResult, error) {
+	return r.Namespace().emit(Message{Event: event, Room: r.name, Data: data}, r.snapshot, buildEmitOptions(opts))
+}
+
+// EmitExcept sends event to every client in the room except those in
+// exclude, whether or not they are members.
+func (r *Room) EmitExcept(event string, data interface{}, exclude ...*Client) (EmitResult, error) {
+	return r.Namespace().emit(Message{Event: event, Room: r.name, Data: data}, r.snapshot, emitOptions{exclude: exclude})
+}
+
+// snapshot returns the room's members in the room's delivery order.
+func (r *Room) snapshot() []*Client {
+	policy := r.Namespace().deliveryPolicy(r.name)
+	r.mu.RLock()
+	clients := make([]*Client, 0, len(r.clients))
+	var seqs map[*Client]uint64
+	if policy.Order == ByJoinTime {
+		seqs = make(map[*Client]uint64, len(r.clients))
+	}
+	for c, seq := range r.clients {
+		clients = append(clients, c)
+		if seqs != nil {
+			seqs[c] = seq
+		}
+	}
+	r.mu.RUnlock()
+	policy.apply(clients, func(c *Client) uint64 { return seqs[c] })
+	return clients
+}
+
+// add inserts c, counting it towards the presence of userID if non-empty.
+// It reports whether userID has just become present in the room; a user
+// returning within a pending leave's grace period is not.
+func (r *Room) add(c *Client, userID string) (arrived bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.joins++
+	r.clients[c] = r.joins
+	r.members.Store(nil)
+	if userID == "" {
+		return false
+	}
+	if r.users == nil {
+		r.users = make(map[string]int)
+		r.memberUser = make(map[*Client]string)
+	}
+	r.memberUser[c] = userID
+	if pl, ok := r.pending[userID]; ok {
+		// The pending leave's slot becomes this connection.
+		pl.timer.Stop()
+		delete(r.pending, userID)
+		return false
+	}
+	r.users[userID]++
+	return r.users[userID] == 1
+}
+
+// remove deletes c, reporting whether it was a member. If c was its user's
+// last connection in the room, the user departs, or with a positive grace a
+// pending leave keeps the user present until the grace period ends; held
+// reports that c's leave is announced then, if the user is not back. empty
+// reports whether the room has neither members nor pending leaves and can
+// be dropped. flags are the ephemeral flags c had raised, now lowered.
+func (r *Room) remove(c *Client, grace time.Duration) (removed bool, userID string, departed, held, empty bool, flags []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[c]; !ok {
+		return false, "", false, false, len(r.clients) == 0 && len(r.pending) == 0, nil
+	}
+	delete(r.clients, c)
+	r.members.Store(nil)
+	flags = flagNames(r.flags[c])
+	for _, flag := range flags {
+		r.lowerFlagLocked(c, flag)
+	}
+	userID = r.memberUser[c]
+	if userID != "" {
+		delete(r.memberUser, c)
+		r.users[userID]--
+		if r.users[userID] == 0 {
+			if grace > 0 {
+				r.users[userID] = 1
+				r.holdLeaveLocked(c, userID, grace)
+				held = true
+			} else {
+				delete(r.users, userID)
+				departed = true
+			}
+		}
+	}
+	return true, userID, departed, held, len(r.clients) == 0 && len(r.pending) == 0, flags
+}
@@ -0,0 +1,46 @@
+package sockx
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRoomMembers(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.On("who", func(c *Client, data interface{}) {
+		r := c.Namespace().Room("r")
+		r.Emit("members", fmt.Sprint(r.Size(), " ", r.Has(c), " ", r.ClientIDs()))
+	})
+	conns := []*testConn{dial(t, s, "/"), dial(t, s, "/"), dial(t, s, "/")}
+	a, b, c := conns[0].client(ns), conns[1].client(ns), conns[2].client(ns)
+	c.Join("r")
+	a.Join("r")
+	b.Join("r")
+	b.Leave("r")
+
+	r := ns.Room("r")
+	if n := r.Size(); n != 2 {
+		t.Fatalf("Size = %d, want 2", n)
+	}
+	if !r.Has(a) || r.Has(b) {
+		t.Fatalf("Has(a) = %v, Has(b) = %v", r.Has(a), r.Has(b))
+	}
+	members := r.Clients()
+	if len(members) != 2 || members[0] != c || members[1] != a {
+		t.Fatalf("Clients = %v, want c then a", members)
+	}
+	members[0] = nil
+	if r.Clients()[0] != c {
+		t.Fatal("Clients returned the room's own slice")
+	}
+
+	conns[0].emit("who", nil)
+	want := fmt.Sprint("2 true ", []string{c.ID(), a.ID()})
+	for _, tc := range []*testConn{conns[0], conns[2]} {
+		var got string
+		if err := tc.expect("members").Bind(&got); err != nil || got != want {
+			t.Fatalf("members = %q (%v), want %q", got, err, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package sockx
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// defaultSelectorBudget is how long a Selector may run before the
+// namespace's slow selector hooks are called.
+const defaultSelectorBudget = 5 * time.Millisecond
+
+// ClientInfo is a view of a client taken for a Selector. It is a copy, so
+// reading it takes no locks and it does not change if the client does.
+type ClientInfo struct {
+	// Client is the client described, to be returned by the selector.
+	Client *Client
+
+	ID     string
+	UserID string
+	Rooms  []string // sorted
+	Labels map[string]string
+	Locale language.Tag
+	RealIP string
+
+	claims map[string]interface{}
+}
+
+// Claim returns the claim key passed to Authenticate, or nil.
+func (ci *ClientInfo) Claim(key string) interface{} {
+	return ci.claims[key]
+}
+
+// Selector picks the recipients of a Broadcast among snapshot, for
+// recipient selection that rooms and users cannot express, such as
+// geographic proximity or a consistent-hash subset. It runs on the
+// emitting goroutine with no locks held and must not block; one that takes
+// longer than the namespace's selector budget is reported to the
+// OnSlowSelector hooks. Clients it returns that are not in snapshot are
+// ignored, as are repeats.
+type Selector func(snapshot []*ClientInfo) []*Client
+
+// SlowSelectorHook is called when a Selector for event took longer than
+// the namespace's selector budget.
+type SlowSelectorHook func(event string, took time.Duration)
+
+// Broadcast sends event to the local clients of the namespace that
+// selector picks, for example:
+//
+//	ns.Broadcast(func(snapshot []*sockx.ClientInfo) []*sockx.Client {
+//		var near []*sockx.Client
+//		for _, ci := range snapshot {
+//			if ci.Labels[sockx.LabelZone] == zone {
+//				near = append(near, ci.Client)
+//			}
+//		}
+//		return near
+//	}, "alert", data)
+//
+// Only clients on this server are considered: the message is not published
+// through the adapter, since the other nodes cannot run the selector.
+func (ns *Namespace) Broadcast(selector Selector, event string, data interface{}, opts ...EmitOption) (EmitResult, error) {
+	return ns.broadcastSelected(ns.snapshotClients(), selector, Message{Event: event, Data: data}, buildEmitOptions(opts))
+}
+
+// SetSelectorBudget sets how long a Selector may run before it is
+// reported as slow. Defaults to 5ms; zero restores the default.
+func (ns *Namespace) SetSelectorBudget(d time.Duration) {
+	atomic.StoreInt64(&ns.selectorBudget, int64(d))
+}
+
+// OnSlowSelector registers h to be called when a Selector overruns the
+// namespace's selector budget. Without hooks, slow selectors are logged.
+func (ns *Namespace) OnSlowSelector(h SlowSelectorHook) {
+	ns.mu.Lock()
+	ns.slowSelectorHooks = append(ns.slowSelectorHooks, h)
+	ns.mu.Unlock()
+}
+
+// broadcastSelected delivers msg to the clients selector picks among
+// candidates.
+func (ns *Namespace) broadcastSelected(candidates []*Client, selector Selector, msg Message, o emitOptions) (EmitResult, error) {
+	snapshot := make([]*ClientInfo, len(candidates))
+	for i, c := range candidates {
+		snapshot[i] = c.info()
+	}
+	start := time.Now()
+	picked := selector(snapshot)
+	ns.checkSelectorTime(msg.Event, time.Since(start))
+
+	allowed := make(map[*Client]bool, len(candidates))
+	for _, c := range candidates {
+		allowed[c] = true
+	}
+	recipients := make([]*Client, 0, len(picked))
+	for _, c := range picked {
+		if allowed[c] {
+			recipients = append(recipients, c)
+			delete(allowed, c)
+		}
+	}
+	return broadcast(ns, recipients, msg, o)
+}
+
+// checkSelectorTime reports a selector for event that took too long.
+func (ns *Namespace) checkSelectorTime(event string, took time.Duration) {
+	budget := time.Duration(atomic.LoadInt64(&ns.selectorBudget))
+	if budget <= 0 {
+		budget = defaultSelectorBudget
+	}
+	if took <= budget {
+		return
+	}
+	ns.mu.RLock()
+	hooks := ns.slowSelectorHooks
+	ns.mu.RUnlock()
+	if len(hooks) == 0 {
+		ns.server.logf("selector for %q in %s took %v, budget is %v", event, ns.name, took, budget)
+		return
+	}
+	for _, h := range hooks {
+		h(event, took)
+	}
+}
+
+// info returns a ClientInfo describing c.
+func (c *Client) info() *ClientInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ci := &ClientInfo{
+		Client: c,
+		ID:     c.id,
+		UserID: c.userID,
+		Rooms:  make([]string, 0, len(c.rooms)),
+		Locale: c.locale,
+		RealIP: c.realIP,
+		claims: c.claims,
+	}
+	for room := range c.rooms {
+		ci.Rooms = append(ci.Rooms, room)
+	}
+	sort.Strings(ci.Rooms)
+	if len(c.labels) > 0 {
+		ci.Labels = make(map[string]string, len(c.labels))
+		for k, v := range c.labels {
+			ci.Labels[k] = v
+		}
+	}
+	return ci
+}
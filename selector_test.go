@@ -0,0 +1,67 @@
+package sockx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBroadcastDeliversToSelectedClients(t *testing.T) {
+	a := &countingAdapter{Adapter: NewMemoryBus().Adapter()}
+	s := newTestServer(t, WithAdapter(a))
+	ns := s.Of("/")
+	gold, plain := dial(t, s, "/"), dial(t, s, "/")
+	c := ns.Client(gold.welcome.ID)
+	c.Authenticate("alice", map[string]interface{}{"tier": "gold"})
+	c.Join("z")
+	c.Join("a")
+	stranger := s.Of("/other").Client(dial(t, s, "/other").welcome.ID)
+
+	var seen []string
+	res, err := ns.Broadcast(func(snapshot []*ClientInfo) []*Client {
+		var picked []*Client
+		for _, ci := range snapshot {
+			if ci.Claim("tier") == "gold" {
+				seen = append(seen, fmt.Sprintf("%v %s %v", ci.ID == gold.welcome.ID, ci.UserID, ci.Rooms))
+				picked = append(picked, ci.Client, ci.Client)
+			}
+		}
+		return append(picked, stranger)
+	}, "offer", "50%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[true alice [a z]]"; fmt.Sprint(seen) != want {
+		t.Fatalf("selector saw %v, want %s", seen, want)
+	}
+	if res.Delivered != 1 {
+		t.Fatalf("delivered to %d clients, want 1", res.Delivered)
+	}
+	if n := a.published.Load(); n != 0 {
+		t.Fatalf("Broadcast published %d messages", n)
+	}
+	gold.expect("offer")
+	plain.expectNone("offer", 50*time.Millisecond)
+}
+
+func TestSlowSelectorIsReported(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SetSelectorBudget(time.Millisecond)
+	slow := make(chan string, 2)
+	ns.OnSlowSelector(func(event string, took time.Duration) {
+		slow <- fmt.Sprint(event, " ", took >= 5*time.Millisecond)
+	})
+
+	ns.Broadcast(func([]*ClientInfo) []*Client { return nil }, "fast", nil)
+	ns.Broadcast(func([]*ClientInfo) []*Client {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}, "slow", nil)
+	if got := <-slow; got != "slow true" {
+		t.Fatalf("reported %s, want the slow selector", got)
+	}
+	if len(slow) != 0 {
+		t.Fatalf("fast selector reported as %s", <-slow)
+	}
+}
@@ -0,0 +1,132 @@
+package sockx
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	// maxSerialQueue caps the events waiting for one key of a SerializeBy
+	// handler.
+	maxSerialQueue = 1024
+
+	// maxSerialQueueStats is how many keys NamespaceStats lists.
+	maxSerialQueueStats = 10
+)
+
+// SerializeBy makes the handler run for one event at a time per key, as
+// key returns it for the event's client and data: events with the same
+// key, from any of the namespace's clients, are handled strictly one after
+// the other, while events with different keys run concurrently as usual.
+// It takes the place of the mutex maps handlers mutating per-entity state,
+// such as a game or a document, would otherwise keep. An empty key is not
+// serialized.
+//
+// An event whose key is busy waits in the key's queue, without holding a
+// worker or one of its client's handler slots, and is handed to the worker
+// pool when its turn comes; a key's queue goes away as soon as it is
+// empty. A key's events run in the order they reach the handler: for one
+// client, the order they were sent, unless HandlerWorkers run up to
+// MaxHandlerConcurrency of its events at once. At most 1024 events wait
+// per key; further ones are rejected with ErrCodeTooManyEvents. The keys
+// with events waiting are listed in the namespace's Stats.
+func SerializeBy(key func(c *Client, data interface{}) string) HandlerOption {
+	return func(o *handlerOptions) { o.serializeBy = key }
+}
+
+// serialKey is a key of a SerializeBy handler of event.
+type serialKey struct {
+	event, key string
+}
+
+// serialQueues holds the keys of the namespace's SerializeBy handlers that
+// have an event running, with the events waiting for it.
+type serialQueues struct {
+	mu     sync.Mutex
+	queues map[serialKey][]*Event
+}
+
+// SerialQueueStats is the queue of a key of a SerializeBy handler.
+type SerialQueueStats struct {
+	Event   string
+	Key     string
+	Waiting int
+}
+
+// serialize applies SerializeBy to h.
+func (ns *Namespace) serialize(keyOf func(*Client, interface{}) string, h EventFunc) EventFunc {
+	return func(ev *Event) {
+		k := serialKey{ev.msg.Event, keyOf(ev.client, ev.Data())}
+		if k.key == "" {
+			h(ev)
+			return
+		}
+		q := &ns.serial
+		q.mu.Lock()
+		waiting, busy := q.queues[k]
+		if !busy {
+			if q.queues == nil {
+				q.queues = make(map[serialKey][]*Event)
+			}
+			q.queues[k] = nil
+			q.mu.Unlock()
+			defer ns.nextSerial(k, h)
+			h(ev)
+			return
+		}
+		if len(waiting) >= maxSerialQueue {
+			q.mu.Unlock()
+			ev.client.reject(ErrCodeTooManyEvents, "too many events waiting for "+k.key+", event "+k.event+" dropped", 0)
+			return
+		}
+		// The event outlives this call, which ends its first dispatch.
+		ev.Retain()
+		q.queues[k] = append(waiting, ev)
+		q.mu.Unlock()
+	}
+}
+
+// nextSerial ends the run of k's current event and hands the next one
+// waiting, if any, to the worker pool to be run by h.
+func (ns *Namespace) nextSerial(k serialKey, h EventFunc) {
+	q := &ns.serial
+	q.mu.Lock()
+	waiting := q.queues[k]
+	if len(waiting) == 0 {
+		delete(q.queues, k)
+		q.mu.Unlock()
+		return
+	}
+	next := waiting[0]
+	waiting[0] = nil
+	q.queues[k] = waiting[1:]
+	q.mu.Unlock()
+
+	ns.server.runJob(func() {
+		next.mu.Lock()
+		next.flushed = false
+		next.mu.Unlock()
+		ns.runHandler(func(ev *Event) {
+			defer ns.nextSerial(k, h)
+			h(ev)
+		}, next)
+	})
+}
+
+// serialStats returns the keys with the most events waiting.
+func (ns *Namespace) serialStats() []SerialQueueStats {
+	q := &ns.serial
+	q.mu.Lock()
+	var st []SerialQueueStats
+	for k, waiting := range q.queues {
+		if len(waiting) > 0 {
+			st = append(st, SerialQueueStats{Event: k.event, Key: k.key, Waiting: len(waiting)})
+		}
+	}
+	q.mu.Unlock()
+	sort.Slice(st, func(i, j int) bool { return st[i].Waiting > st[j].Waiting })
+	if len(st) > maxSerialQueueStats {
+		st = st[:maxSerialQueueStats]
+	}
+	return st
+}
@@ -0,0 +1,119 @@
+package sockx
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gameKey serializes events by their "game" field.
+func gameKey(c *Client, data interface{}) string {
+	m, _ := data.(map[string]interface{})
+	g, _ := m["game"].(string)
+	return g
+}
+
+func TestSerializeByKeepsKeyOrder(t *testing.T) {
+	const clients, events = 8, 50
+	s := newTestServer(t, WithHandlerWorkers(8), WithHandlerConcurrency(1, 1000))
+	ns := s.Of("/")
+	var running atomic.Int32
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	done := make(chan struct{}, clients*events)
+	ns.On("move", func(c *Client, data interface{}) {
+		if running.Add(1) > 1 {
+			t.Error("two events of one key ran at once")
+		}
+		time.Sleep(50 * time.Microsecond)
+		m := data.(map[string]interface{})
+		mu.Lock()
+		seen[c.ID()] = append(seen[c.ID()], int(m["seq"].(float64)))
+		mu.Unlock()
+		running.Add(-1)
+		done <- struct{}{}
+	}, SerializeBy(gameKey))
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		tc := dial(t, s, "/")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				tc.emit("move", map[string]interface{}{"game": "g1", "seq": j})
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < clients*events; i++ {
+		select {
+		case <-done:
+		case <-time.After(testTimeout):
+			t.Fatalf("%d of %d events handled", i, clients*events)
+		}
+	}
+	for id, seqs := range seen {
+		for j, seq := range seqs {
+			if seq != j {
+				t.Fatalf("client %s: events handled in order %v", id, seqs)
+			}
+		}
+	}
+	waitFor(t, "idle key queue to go away", func() bool {
+		ns.serial.mu.Lock()
+		defer ns.serial.mu.Unlock()
+		return len(ns.serial.queues) == 0
+	})
+}
+
+func TestSerializeByRunsKeysConcurrently(t *testing.T) {
+	s := newTestServer(t, WithHandlerWorkers(4))
+	ns := s.Of("/")
+	started := map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})}
+	ns.On("move", func(c *Client, data interface{}) {
+		me := gameKey(c, data)
+		other := map[string]string{"a": "b", "b": "a"}[me]
+		close(started[me])
+		select {
+		case <-started[other]:
+		case <-time.After(testTimeout):
+			t.Errorf("key %s ran alone", me)
+		}
+	}, SerializeBy(gameKey))
+	dial(t, s, "/").emit("move", map[string]string{"game": "a"})
+	dial(t, s, "/").emit("move", map[string]string{"game": "b"})
+	for _, ch := range started {
+		select {
+		case <-ch:
+		case <-time.After(testTimeout):
+			t.Fatal("handler not called")
+		}
+	}
+}
+
+func TestSerializeByQueueStats(t *testing.T) {
+	s := newTestServer(t, WithHandlerWorkers(4))
+	ns := s.Of("/")
+	release := make(chan struct{})
+	handled := make(chan struct{}, 16)
+	ns.On("move", func(c *Client, data interface{}) {
+		<-release
+		handled <- struct{}{}
+	}, SerializeBy(gameKey))
+	tc := dial(t, s, "/")
+	for i := 0; i < 5; i++ {
+		tc.emit("move", map[string]string{"game": "hot"})
+	}
+	tc.emit("move", map[string]string{"game": "cold"})
+
+	want := fmt.Sprint([]SerialQueueStats{{Event: "move", Key: "hot", Waiting: 4}})
+	waitFor(t, "hot key listed", func() bool { return fmt.Sprint(ns.Stats().SerialQueues) == want })
+	close(release)
+	for i := 0; i < 6; i++ {
+		<-handled
+	}
+	waitFor(t, "queues drained", func() bool { return len(ns.Stats().SerialQueues) == 0 })
+}
@@ -0,0 +1,266 @@
+package sockx
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Server hosts namespaces and upgrades HTTP requests to WebSocket
+// connections.
+type Server struct {
+	config   atomic.Pointer[Config]
+	configMu sync.Mutex
+	upgrader websocket.Upgrader
+	pool     *workerPool
+
+	// originCheck is the upgrader's current origin check.
+	originCheck atomic.Pointer[func(r *http.Request) bool]
+
+	rejections *rejectionTracker
+	nsCreation *TokenBucketLimiter
+	migrateMu  sync.Mutex
+	feeds      feeds
+	adapter    adapterBreaker
+	received   originTraffic // by zone
+	fromNodes  originTraffic // by node ID
+
+	// randMu serializes reads of the configured Rand source. ackSeq
+	// allocates ack IDs; they are unique per server, so one ID can be
+	// shared by every recipient of a broadcast.
+	randMu sync.Mutex
+	ackSeq uint64
+
+	// ids indexes connected clients by ID, keeping IDs unique.
+	idMu sync.Mutex
+	ids  map[string]*Client
+
+	// closing is set by Shutdown, which also closes done to stop the
+	// server's background goroutines.
+	closing atomic.Bool
+	done    chan struct{}
+
+	// live holds the clients whose writer is running, for Shutdown to
+	// wait on; liveChanged is signaled when one finishes.
+	liveMu      sync.Mutex
+	live        map[*Client]bool
+	liveChanged chan struct{}
+
+	// announce logs the registered namespaces on the first connection
+	// attempt in strict mode.
+	announce sync.Once
+
+	// warmUp limits connections while the server warms up; see
+	// Config.WarmUp.
+	warmUp warmUp
+
+	// deadlines runs the server's timed work, such as the end of guest
+	// sessions; see Config.GuestTTL.
+	deadlines deadlineQueue
+
+	// traces holds the connections traced with TraceClient.
+	traces tracing
+
+	// chains holds the hop counts of the dispatches in progress, for
+	// emit loop detection.
+	chains emitChains
+
+	mu         sync.RWMutex
+	namespaces map[string]*Namespace
+}
+
+// NewServer returns a Server configured by opts. Unless configured
+// otherwise it accepts connections from any origin. It panics if the
+// configuration is invalid; see NewServerWithOptions.
+func NewServer(opts ...Option) *Server {
+	s, err := NewServerWithOptions(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// NewServerWithOptions is like NewServer but returns an error wrapping
+// ErrInvalidConfig, instead of panicking, if a setting is out of range.
+func NewServerWithOptions(opts ...Option) (*Server, error) {
+	var cfg Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	cfg.setDefaults()
+
+	s := &Server{
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:    cfg.ReadBufferSize,
+			WriteBufferSize:   cfg.WriteBufferSize,
+			HandshakeTimeout:  cfg.HandshakeTimeout,
+			EnableCompression: cfg.EnableCompression,
+		},
+		namespaces:  make(map[string]*Namespace),
+		rejections:  newRejectionTracker(cfg.Backoff),
+		done:        make(chan struct{}),
+		ids:         make(map[string]*Client),
+		live:        make(map[*Client]bool),
+		liveChanged: make(chan struct{}, 1),
+	}
+	if cfg.RateLimiter == nil {
+		// Look limits up through the server so UpdateConfig reaches
+		// existing buckets.
+		cfg.RateLimiter = NewTokenBucketLimiter(func(key string) RateLimit {
+			return s.cfg().RateLimits.Limit(key)
+		})
+	}
+	s.nsCreation = NewTokenBucketLimiter(func(string) RateLimit {
+		return s.cfg().NamespaceCreationRate
+	})
+	if p := cfg.WarmUp; p.Rate > 0 {
+		s.warmUp.limiter = NewTokenBucketLimiter(func(string) RateLimit {
+			return RateLimit{Rate: p.Rate, Burst: p.Burst}
+		})
+	}
+	s.upgrader.CheckOrigin = s.checkOrigin
+	s.SetCheckOrigin(cfg.CheckOrigin)
+	s.config.Store(&cfg)
+	if cfg.NodeID == "" {
+		cfg.NodeID = s.newID()
+	}
+	if cfg.HandlerWorkers > 0 {
+		s.pool = newWorkerPool(cfg.HandlerWorkers)
+	}
+	if cfg.Adapter != nil {
+		cfg.Adapter.Subscribe(s.handleRemote)
+	}
+	if cfg.StallTimeout > 0 {
+		go s.watchdog()
+	}
+	return s, nil
+}
+
+// NodeID returns the server's Config.NodeID.
+func (s *Server) NodeID() string { return s.cfg().NodeID }
+
+// logf logs a message attributed to the server's node.
+func (s *Server) logf(format string, args ...interface{}) {
+	log.Printf("sockx: node %s: "+format, append([]interface{}{s.NodeID()}, args...)...)
+}
+
+// namespaceList returns the server's namespaces.
+func (s *Server) namespaceList() []*Namespace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*Namespace, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		list = append(list, ns)
+	}
+	return list
+}
+
+// Of returns the namespace with the given name, creating it if needed.
+func (s *Server) Of(name string) *Namespace {
+	s.mu.RLock()
+	ns, ok := s.namespaces[name]
+	s.mu.RUnlock()
+	if ok {
+		return ns
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ns, ok = s.namespaces[name]; !ok {
+		ns = newNamespace(s, name)
+		s.namespaces[name] = ns
+	}
+	return ns
+}
+
+// ServeWebSocket returns an http.HandlerFunc that upgrades requests and
+// attaches the resulting clients to the named namespace. The namespace is
+// created on first use unless Config.StrictNamespaces is set, in which
+// case connections to a namespace with nothing registered on it are
+// refused.
+func (s *Server) ServeWebSocket(namespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.closing.Load() {
+			http.Error(w, shutdownReason, http.StatusServiceUnavailable)
+			return
+		}
+		if ok, retry := s.admitWarmUp(); !ok {
+			refuseWarmUp(w, retry)
+			return
+		}
+		ns, ok := s.namespaceFor(namespace)
+		if !ok {
+			refuseNamespace(w, r, &s.upgrader)
+			return
+		}
+		if !ns.awaitReady(r) {
+			s.rejectHTTP(w, r, http.StatusServiceUnavailable, "namespace not ready", 0)
+			return
+		}
+		if ok, retry := ns.admitConnection(); !ok {
+			s.rejectHTTP(w, r, http.StatusServiceUnavailable, "namespace temporarily unavailable", retry)
+			return
+		}
+		conn := s.upgrade(ns, w, r)
+		if conn == nil {
+			return
+		}
+
+		c := newClient(ns, conn, nil)
+		c.setReadLimit(ns.messageLimit())
+		c.locale = LocaleFromRequest(r)
+		c.realIP = s.realIP(r)
+		c.request = handshakeRequest(r)
+		c.WithContext(r.Context())
+		enabled := c.negotiate(featuresFromRequest(r))
+		if !ns.admit(c, r) {
+			return
+		}
+		token, sess := ns.resumeToken(r)
+		c.resumeToken = token
+		s.trackConn(c)
+		others := ns.addClient(c)
+		s.matchTrace(c)
+
+		go c.writePump()
+		if s.closing.Load() {
+			// Shutdown swept the namespaces before the client was added.
+			c.disconnect(websocket.CloseGoingAway, shutdownReason)
+			return
+		}
+		c.sendControl(EventWelcome, WelcomeData{
+			ID:          c.id,
+			Protocol:    ProtocolVersion,
+			Features:    supportedFeatures,
+			Enabled:     enabled,
+			ResumeToken: token,
+			Resumed:     sess != nil,
+			UserID:      c.UserID(),
+			Node:        s.NodeID(),
+		})
+		for _, other := range others {
+			other.disconnect(websocket.ClosePolicyViolation, "session replaced")
+		}
+		s.startGuestClock(c)
+		ns.fire(LifecycleEvent{Kind: LifecycleConnect, Client: c})
+		if sess != nil {
+			c.resume(sess, cursorsFromRequest(r))
+		}
+		c.readPump()
+	}
+}
+
+// hostOnly strips the port from a host:port address.
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,183 @@
+package sockx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrServerClosed is returned by a second call to Server.Shutdown or
+// Server.Close.
+var ErrServerClosed = errors.New("sockx: server closed")
+
+// shutdownReason is the close reason sent to clients by Server.Shutdown.
+const shutdownReason = "server shutting down"
+
+// Flusher is implemented by integrations, such as an Adapter, that buffer
+// work which must be written out before the server stops.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Deregisterer is implemented by integrations that advertise this server
+// in registries shared with other nodes, so that the other nodes stop
+// routing to it.
+type Deregisterer interface {
+	Deregister(ctx context.Context) error
+}
+
+// Closer is implemented by integrations that hold connections to close
+// when the server stops.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Shutdown shuts the server down gracefully, in order:
+//
+//  1. Stop intake: new connections are refused with 503,
+//     LifecycleDrainStarted is fired in every namespace, and connected
+//     clients, in every namespace, are disconnected with a going-away
+//     close frame.
+//  2. Drain: wait until every client's queued messages and close frame
+//     have been written and its connection closed, then stop the handler
+//     workers once they have run the events already dispatched.
+//  3. Flush: integrations implementing Flusher write out buffered work.
+//  4. Deregister: integrations implementing Deregisterer remove this node
+//     from shared registries.
+//  5. Close: integrations implementing Closer close their connections.
+//
+// The integrations are the configured Adapter and RateLimiter, checked
+// in that order. Each step is bounded by ctx. Once ctx is done Shutdown
+// closes the connections still draining without further ado, skips the
+// remaining steps and returns ctx's error. Errors from integrations do not
+// stop the shutdown and are returned together.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if !s.closing.CompareAndSwap(false, true) {
+		return ErrServerClosed
+	}
+	close(s.done)
+	s.fireAll(LifecycleEvent{Kind: LifecycleDrainStarted})
+	for _, ns := range s.namespaceList() {
+		for _, c := range ns.snapshotClients() {
+			c.disconnect(websocket.CloseGoingAway, shutdownReason)
+		}
+	}
+	err := s.drain(ctx)
+	if s.pool != nil {
+		s.pool.close()
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	// run calls one integration and reports whether to carry on.
+	run := func(step string, i interface{}, fn func(context.Context) error) bool {
+		err := callBounded(ctx, fn)
+		switch {
+		case err == nil:
+			return true
+		case ctx.Err() != nil:
+			errs = append(errs, ctx.Err())
+			return false
+		default:
+			errs = append(errs, fmt.Errorf("sockx: %s %T: %w", step, i, err))
+			return true
+		}
+	}
+	integrations := s.integrations()
+	for _, i := range integrations {
+		if f, ok := i.(Flusher); ok && !run("flush", i, f.Flush) {
+			return errors.Join(errs...)
+		}
+	}
+	for _, i := range integrations {
+		if d, ok := i.(Deregisterer); ok && !run("deregister", i, d.Deregister) {
+			return errors.Join(errs...)
+		}
+	}
+	for _, i := range integrations {
+		if c, ok := i.(Closer); ok && !run("close", i, c.Close) {
+			return errors.Join(errs...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close calls Shutdown.
+func (s *Server) Close(ctx context.Context) error {
+	return s.Shutdown(ctx)
+}
+
+// drain waits until every connection's writer has finished. Once ctx is
+// done it closes the remaining connections and returns ctx's error.
+func (s *Server) drain(ctx context.Context) error {
+	for {
+		s.liveMu.Lock()
+		n := len(s.live)
+		s.liveMu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-s.liveChanged:
+		case <-ctx.Done():
+			s.liveMu.Lock()
+			for c := range s.live {
+				c.conn.Close()
+			}
+			s.liveMu.Unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+// trackConn records a connection whose writer is about to start.
+func (s *Server) trackConn(c *Client) {
+	s.liveMu.Lock()
+	s.live[c] = true
+	s.liveMu.Unlock()
+}
+
+// untrackConn records that c's writer has finished and its connection is
+// closed.
+func (s *Server) untrackConn(c *Client) {
+	s.liveMu.Lock()
+	delete(s.live, c)
+	s.liveMu.Unlock()
+	select {
+	case s.liveChanged <- struct{}{}:
+	default:
+	}
+}
+
+// integrations returns the configured integrations in shutdown order.
+func (s *Server) integrations() []interface{} {
+	cfg := s.cfg()
+	var list []interface{}
+	if cfg.Adapter != nil {
+		list = append(list, cfg.Adapter)
+	}
+	if cfg.RateLimiter != nil {
+		list = append(list, cfg.RateLimiter)
+	}
+	return list
+}
+
+// callBounded calls fn with ctx and returns its error, or ctx's error if
+// ctx is done first. fn keeps running in the background in that case.
+func callBounded(ctx context.Context, fn func(context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
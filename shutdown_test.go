@@ -0,0 +1,236 @@
+package sockx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// callLog records the calls made to mock integrations, in order.
+type callLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *callLog) add(call string) {
+	l.mu.Lock()
+	l.calls = append(l.calls, call)
+	l.mu.Unlock()
+}
+
+func (l *callLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprint(l.calls)
+}
+
+// mockIntegration implements Flusher, Deregisterer and Closer, logging
+// its calls. block, if set, makes Flush wait for the context instead.
+type mockIntegration struct {
+	name  string
+	log   *callLog
+	block bool
+	err   error
+}
+
+func (m *mockIntegration) Flush(ctx context.Context) error {
+	m.log.add(m.name + " flush")
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return m.err
+}
+
+func (m *mockIntegration) Deregister(ctx context.Context) error {
+	m.log.add(m.name + " deregister")
+	return nil
+}
+
+func (m *mockIntegration) Close(ctx context.Context) error {
+	m.log.add(m.name + " close")
+	return nil
+}
+
+type mockAdapter struct {
+	bridgeAdapter
+	mockIntegration
+}
+
+type mockLimiter struct{ mockIntegration }
+
+func (l *mockLimiter) Allow(key string, n int) (bool, time.Duration, error) { return true, 0, nil }
+
+func TestShutdownCallsIntegrationsInOrder(t *testing.T) {
+	log := &callLog{}
+	a := &mockAdapter{mockIntegration: mockIntegration{name: "adapter", log: log}}
+	l := &mockLimiter{mockIntegration{name: "limiter", log: log}}
+	s := newTestServer(t, WithAdapter(a), WithRateLimiter(l))
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := "[adapter flush limiter flush adapter deregister limiter deregister adapter close limiter close]"
+	if got := log.String(); got != want {
+		t.Fatalf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestShutdownReportsIntegrationErrorsAndCarriesOn(t *testing.T) {
+	log := &callLog{}
+	failure := errors.New("flush failed")
+	a := &mockAdapter{mockIntegration: mockIntegration{name: "adapter", log: log, err: failure}}
+	s := newTestServer(t, WithAdapter(a))
+	if err := s.Shutdown(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("Shutdown = %v, want the flush error", err)
+	}
+	if got := log.String(); got != "[adapter flush adapter deregister adapter close]" {
+		t.Fatalf("calls = %s, want every step despite the error", got)
+	}
+}
+
+func TestShutdownIsBoundedBySlowIntegration(t *testing.T) {
+	log := &callLog{}
+	a := &mockAdapter{mockIntegration: mockIntegration{name: "adapter", log: log, block: true}}
+	s := newTestServer(t, WithAdapter(a))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := s.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Shutdown took %v past its deadline", d)
+	}
+	if got := log.String(); got != "[adapter flush]" {
+		t.Fatalf("calls = %s, want the remaining steps skipped", got)
+	}
+}
+
+func TestShutdownTwice(t *testing.T) {
+	s := newTestServer(t)
+	s.Shutdown(context.Background())
+	if err := s.Shutdown(context.Background()); !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("second Shutdown = %v, want ErrServerClosed", err)
+	}
+}
+
+// expectClose reads from tc until the connection closes and returns the
+// close error, counting the messages named event on the way.
+func expectClose(t *testing.T, tc *testConn, event string) (*websocket.CloseError, int) {
+	t.Helper()
+	n := 0
+	for {
+		msg, err := tc.next(testTimeout)
+		if err == nil {
+			if msg.Event == event {
+				n++
+			}
+			continue
+		}
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) {
+			t.Fatalf("connection ended with %v, want a close frame", err)
+		}
+		return ce, n
+	}
+}
+
+func TestShutdownSendsGoingAwayInEveryNamespace(t *testing.T) {
+	s := newTestServer(t)
+	url := serve(t, s, "/")
+	a, b := dialURL(t, url, nil), dial(t, s, "/chat")
+	s.Of("/").Emit("news", "x")
+	s.Of("/chat").Emit("news", "y")
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []*testConn{a, b} {
+		ce, n := expectClose(t, tc, "news")
+		if n != 1 {
+			t.Errorf("%d messages queued before Shutdown delivered, want 1", n)
+		}
+		if ce.Code != websocket.CloseGoingAway || ce.Text != shutdownReason {
+			t.Errorf("close frame = %d %q, want %d %q", ce.Code, ce.Text, websocket.CloseGoingAway, shutdownReason)
+		}
+	}
+	if n := s.Of("/").Count() + s.Of("/chat").Count(); n != 0 {
+		t.Fatalf("%d clients left after Shutdown returned", n)
+	}
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("dial after Shutdown = %v, want 503", err)
+	}
+}
+
+func TestShutdownFiresDrainStartedInEveryNamespace(t *testing.T) {
+	s := newTestServer(t)
+	a, b := dial(t, s, "/"), dial(t, s, "/chat")
+	var log callLog
+	for _, ns := range []*Namespace{s.Of("/"), s.Of("/chat")} {
+		ns := ns
+		ns.OnLifecycle(func(ev LifecycleEvent) {
+			if ev.Kind == LifecycleDrainStarted {
+				log.add(ns.Name())
+				ns.Emit("bye", nil)
+			}
+		})
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := log.String(); got != "[/ /chat]" && got != "[/chat /]" {
+		t.Fatalf("drain started fired in %s, want every namespace once", got)
+	}
+	for _, tc := range []*testConn{a, b} {
+		if _, n := expectClose(t, tc, "bye"); n != 1 {
+			t.Errorf("%d goodbyes emitted from the hook delivered, want 1", n)
+		}
+	}
+}
+
+func TestShutdownReturnsOnceClientsHaveDrained(t *testing.T) {
+	const chunks = 64
+	s := newTestServer(t, WithWriteTimeout(time.Minute))
+	ns := s.Of("/")
+	tc := dial(t, s, "/")
+	// Queue more than the socket buffers hold, so the writer blocks until
+	// the client reads.
+	chunk := strings.Repeat("x", 64<<10)
+	c := ns.Client(tc.welcome.ID)
+	for i := 0; i < chunks; i++ {
+		if err := c.Emit("bulk", chunk); err != nil {
+			t.Fatalf("emit %d: %v", i, err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the client read its messages", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	ce, n := expectClose(t, tc, "bulk")
+	if n != chunks || ce.Code != websocket.CloseGoingAway {
+		t.Fatalf("client read %d messages and close code %d, want %d and %d", n, ce.Code, chunks, websocket.CloseGoingAway)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Shutdown did not return once the client was gone")
+	}
+	if ns.Count() != 0 {
+		t.Fatalf("%d clients left after Shutdown returned", ns.Count())
+	}
+}
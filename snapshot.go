@@ -0,0 +1,164 @@
+package sockx
+
+import (
+	"sort"
+	"time"
+)
+
+// NamespaceSnapshot is an immutable view of a namespace's clients and room
+// memberships as they all were at one instant, taken by Snapshot. It
+// answers the questions the live API answers room by room, such as how
+// many members each room has, with answers that are consistent with each
+// other.
+//
+// A snapshot is never updated: clients may have joined, left or
+// disconnected since it was taken. The clients in it are the live
+// *Client values, so their own state, such as their user ID or labels, is
+// read as it is now rather than as of the snapshot, and emitting to one
+// that has since disconnected is dropped as usual. A snapshot covers the
+// clients connected to this server only, not those of other nodes.
+type NamespaceSnapshot struct {
+	at      time.Time
+	clients *clientView
+	rooms   map[string]*roomView
+}
+
+// clientView is the immutable set of a namespace's clients, shared by the
+// snapshots taken while it does not change.
+type clientView struct {
+	clients []*Client
+}
+
+// roomView is the immutable membership of a room, shared by the snapshots
+// taken while it does not change. members maps each member to its join
+// sequence number.
+type roomView struct {
+	members map[*Client]uint64
+}
+
+// Snapshot captures the namespace's clients and room memberships at a
+// single instant. Joins, leaves, connections and disconnections wait while
+// it is taken, which copies only what changed since the previous snapshot:
+// the memberships of unchanged rooms, and the client set if unchanged, are
+// shared with it, so taking snapshots repeatedly costs little more than a
+// pass over the room names. See NamespaceSnapshot for how it ages.
+func (ns *Namespace) Snapshot() NamespaceSnapshot {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	snap := NamespaceSnapshot{
+		at:      time.Now(),
+		clients: ns.clientViewLocked(),
+		rooms:   make(map[string]*roomView, len(ns.rooms)),
+	}
+	for name, r := range ns.rooms {
+		snap.rooms[name] = r.view()
+	}
+	return snap
+}
+
+// clientViewLocked returns the view of the namespace's clients, building
+// it if they changed since it was last built. ns.mu must be held.
+func (ns *Namespace) clientViewLocked() *clientView {
+	if v := ns.clientView.Load(); v != nil {
+		return v
+	}
+	v := &clientView{clients: make([]*Client, 0, len(ns.clients))}
+	for c := range ns.clients {
+		v.clients = append(v.clients, c)
+	}
+	sort.Slice(v.clients, func(i, j int) bool { return v.clients[i].id < v.clients[j].id })
+	ns.clientView.Store(v)
+	return v
+}
+
+// view returns the room's membership view, building it if the membership
+// changed since it was last built. Memberships only change with the
+// namespace's mutex held for writing, so the namespace's mutex must be
+// held for the view to be current.
+func (r *Room) view() *roomView {
+	if v := r.members.Load(); v != nil {
+		return v
+	}
+	r.mu.RLock()
+	v := &roomView{members: make(map[*Client]uint64, len(r.clients))}
+	for c, seq := range r.clients {
+		v.members[c] = seq
+	}
+	r.mu.RUnlock()
+	r.members.Store(v)
+	return v
+}
+
+// At returns when the snapshot was taken.
+func (s NamespaceSnapshot) At() time.Time { return s.at }
+
+// Len returns the number of clients in the namespace.
+func (s NamespaceSnapshot) Len() int {
+	if s.clients == nil {
+		return 0
+	}
+	return len(s.clients.clients)
+}
+
+// Clients returns the namespace's clients, by ID.
+func (s NamespaceSnapshot) Clients() []*Client {
+	if s.clients == nil {
+		return nil
+	}
+	return append([]*Client(nil), s.clients.clients...)
+}
+
+// Rooms returns the names of the namespace's rooms, sorted.
+func (s NamespaceSnapshot) Rooms() []string {
+	names := make([]string, 0, len(s.rooms))
+	for name := range s.rooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RoomLen returns the number of members of room, zero if it did not exist.
+func (s NamespaceSnapshot) RoomLen(room string) int {
+	if v := s.rooms[room]; v != nil {
+		return len(v.members)
+	}
+	return 0
+}
+
+// ClientsIn returns the members of room, by join time.
+func (s NamespaceSnapshot) ClientsIn(room string) []*Client {
+	v := s.rooms[room]
+	if v == nil {
+		return nil
+	}
+	clients := make([]*Client, 0, len(v.members))
+	for c := range v.members {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return v.members[clients[i]] < v.members[clients[j]] })
+	return clients
+}
+
+// InRoom reports whether c was a member of room.
+func (s NamespaceSnapshot) InRoom(c *Client, room string) bool {
+	v := s.rooms[room]
+	if v == nil {
+		return false
+	}
+	_, ok := v.members[c]
+	return ok
+}
+
+// RoomsOf returns the names of the rooms c was a member of, sorted. It
+// looks through every room of the snapshot.
+func (s NamespaceSnapshot) RoomsOf(c *Client) []string {
+	var names []string
+	for name, v := range s.rooms {
+		if _, ok := v.members[c]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,90 @@
+package sockx
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestSnapshotIsUnaffectedByLaterChanges(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var clients []*Client
+	for i := 0; i < 3; i++ {
+		clients = append(clients, dial(t, s, "/").client(ns))
+	}
+	a, b, c := clients[0], clients[1], clients[2]
+	c.Join("r")
+	a.Join("r")
+	b.Join("q")
+
+	snap := ns.Snapshot()
+	a.Leave("r")
+	b.Join("r")
+	dial(t, s, "/")
+
+	if n := snap.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3", n)
+	}
+	ids := []string{a.ID(), b.ID(), c.ID()}
+	sort.Strings(ids)
+	var got []string
+	for _, cl := range snap.Clients() {
+		got = append(got, cl.ID())
+	}
+	if fmt.Sprint(got) != fmt.Sprint(ids) {
+		t.Fatalf("Clients = %v, want %v", got, ids)
+	}
+	if got := fmt.Sprint(snap.Rooms()); got != "[q r]" {
+		t.Fatalf("Rooms = %s, want [q r]", got)
+	}
+	if n := snap.RoomLen("r"); n != 2 {
+		t.Fatalf("RoomLen(r) = %d, want 2", n)
+	}
+	if members := snap.ClientsIn("r"); len(members) != 2 || members[0] != c || members[1] != a {
+		t.Fatalf("ClientsIn(r) = %v, want c then a", members)
+	}
+	if !snap.InRoom(a, "r") || snap.InRoom(b, "r") {
+		t.Fatal("InRoom reflects changes made after the snapshot")
+	}
+	if got := fmt.Sprint(snap.RoomsOf(b)); got != "[q]" {
+		t.Fatalf("RoomsOf(b) = %s, want [q]", got)
+	}
+	if snap.RoomLen("none") != 0 || snap.ClientsIn("none") != nil || snap.InRoom(a, "none") {
+		t.Fatal("snapshot reports members of a room that did not exist")
+	}
+	if snap.At().IsZero() {
+		t.Fatal("At not set")
+	}
+
+	var empty NamespaceSnapshot
+	if empty.Len() != 0 || empty.Clients() != nil || len(empty.Rooms()) != 0 {
+		t.Fatal("zero snapshot not empty")
+	}
+}
+
+func TestSnapshotSharesUnchangedViews(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	a := dial(t, s, "/").client(ns)
+	a.Join("still")
+	a.Join("busy")
+
+	first := ns.Snapshot()
+	a.Leave("busy")
+	second := ns.Snapshot()
+	if first.rooms["still"] != second.rooms["still"] {
+		t.Fatal("unchanged room copied")
+	}
+	if first.clients != second.clients {
+		t.Fatal("unchanged client set copied")
+	}
+	if first.RoomLen("busy") != 1 || second.RoomLen("busy") != 0 {
+		t.Fatal("changed room shared between snapshots")
+	}
+
+	dial(t, s, "/")
+	if third := ns.Snapshot(); third.clients == second.clients || third.Len() != 2 {
+		t.Fatal("client set shared after a connection")
+	}
+}
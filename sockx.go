@@ -0,0 +1,168 @@
+// Package sockx is a lightweight, Socket.IO-style real-time server built on
+// gorilla/websocket and net/http. Clients speak a small JSON envelope (see
+// Message) over a plain WebSocket, so any WebSocket client can connect.
+// Other encodings, such as MessagePack, can be plugged in; see Codec.
+//
+// A Server hosts namespaces; each Namespace has its own event handlers,
+// clients and rooms:
+//
+//	srv := sockx.NewServer()
+//	chat := srv.Of("/chat")
+//	chat.On("message", func(c *sockx.Client, data interface{}) {
+//		chat.Emit("message", data)
+//	})
+//	http.HandleFunc("/ws", srv.ServeWebSocket("/chat"))
+package sockx
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// Message is the envelope exchanged with clients in both directions. Ack
+// is set on messages that expect an EventAck reply, and on the reply. Seq
+// numbers the messages of rooms with history; see EnableHistory. ID is an
+// optional client-supplied message ID; see Idempotent. Namespace names the
+// namespace of a message on a connection that joined several; see
+// EventConnect.
+type Message struct {
+	ID        string      `json:"id,omitempty"`
+	Event     string      `json:"event"`
+	Namespace string      `json:"namespace,omitempty"`
+	Room      string      `json:"room,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Ack       uint64      `json:"ack,omitempty"`
+	Seq       uint64      `json:"seq,omitempty"`
+
+	// Correlation ties the message to the request that caused it, such as
+	// an HTTP API call; see Correlation.
+	Correlation string `json:"correlation,omitempty"`
+
+	// Origin carries the publishing server's Labels, and OriginNode its
+	// NodeID, through the adapter. They are never sent to clients.
+	Origin     map[string]string `json:"origin,omitempty"`
+	OriginNode string            `json:"originNode,omitempty"`
+
+	// hops counts the emits chained synchronously to produce this
+	// message, for loop detection. It is never sent to clients.
+	hops int
+}
+
+// EventHandler handles an inbound event from a client.
+type EventHandler func(c *Client, data interface{})
+
+// EventHandlerE handles an inbound event from a client like EventHandler,
+// and returns an error if it fails; see Namespace.OnE.
+type EventHandlerE func(c *Client, data interface{}) error
+
+// Events reserved for the sockx protocol. Application events must not use
+// the "sockx:" prefix.
+const (
+	// EventWelcome is sent to every client right after it connects.
+	EventWelcome = "sockx:welcome"
+
+	// EventError reports a protocol or server-side error to a client.
+	EventError = "sockx:error"
+)
+
+// Error codes carried in EventError payloads.
+const (
+	ErrCodeBadMessage    = "bad_message"
+	ErrCodeQueueFull     = "queue_full"
+	ErrCodeTooManyEvents = "too_many_events"
+	ErrCodeRateLimited   = "rate_limited"
+	ErrCodeUnavailable   = "unavailable"
+	ErrCodeForbidden     = "forbidden"
+	ErrCodeInternal      = "internal"
+	ErrCodeHandlerFailed = "handler_failed"
+)
+
+// ErrorData is the payload of an EventError message. RetryAfterMs is set
+// on rejections and advises how long the client should wait before trying
+// again; it grows with repeated rejections. Event names the event whose
+// handling failed, if any.
+//
+// *ErrorData is also an error, which handlers registered with OnE can
+// return to choose the code sent to the client.
+type ErrorData struct {
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	Event        string `json:"event,omitempty"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"`
+}
+
+func (e *ErrorData) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// WelcomeData is the payload of an EventWelcome message. Features lists
+// the protocol extensions the server supports and Enabled those enabled
+// for the connection by its upgrade request. ResumeToken is set when the
+// namespace has resumption enabled, and Resumed when the connection
+// resumes a previous session. UserID is set when connection middleware
+// authenticated the client.
+type WelcomeData struct {
+	ID          string    `json:"id"`
+	Protocol    int       `json:"protocol"`
+	Features    []Feature `json:"features,omitempty"`
+	Enabled     []Feature `json:"enabled,omitempty"`
+	ResumeToken string    `json:"resumeToken,omitempty"`
+	Resumed     bool      `json:"resumed,omitempty"`
+	UserID      string    `json:"userId,omitempty"`
+	Node        string    `json:"node,omitempty"`
+}
+
+var (
+	// ErrClientClosed is returned when emitting to a disconnected client.
+	ErrClientClosed = errors.New("sockx: client closed")
+
+	// ErrQueueFull is returned when a client's send queue has no room for
+	// another message.
+	ErrQueueFull = errors.New("sockx: send queue full")
+)
+
+// maxIDAttempts bounds how many IDs claimID generates before giving up on
+// finding one not in use.
+const maxIDAttempts = 16
+
+// claimID returns a new client ID not used by any connected client and
+// reserves it for c until releaseID.
+func (s *Server) claimID(c *Client) string {
+	gen := s.cfg().IDGenerator
+	if gen == nil {
+		gen = s.newID
+	}
+	s.idMu.Lock()
+	defer s.idMu.Unlock()
+	for i := 0; i < maxIDAttempts; i++ {
+		id := gen()
+		if _, taken := s.ids[id]; !taken && id != "" {
+			s.ids[id] = c
+			return id
+		}
+	}
+	panic("sockx: ID generator keeps returning IDs already in use")
+}
+
+// releaseID frees the ID of a disconnected client.
+func (s *Server) releaseID(c *Client) {
+	s.idMu.Lock()
+	if s.ids[c.id] == c {
+		delete(s.ids, c.id)
+	}
+	s.idMu.Unlock()
+}
+
+// newID returns a random 16 character hex identifier drawn from the
+// server's Rand source.
+func (s *Server) newID() string {
+	var b [8]byte
+	s.randMu.Lock()
+	_, err := io.ReadFull(s.cfg().Rand, b[:])
+	s.randMu.Unlock()
+	if err != nil {
+		panic("sockx: reading random source failed: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,90 @@
+package sockx
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectedClientsHaveDistinctIDs(t *testing.T) {
+	const clients = 20
+	s := newTestServer(t)
+	url := serve(t, s, "/")
+	ids := make(chan string, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			var msg Message
+			var welcome WelcomeData
+			if err := conn.ReadJSON(&msg); err != nil || msg.Bind(&welcome) != nil {
+				t.Errorf("reading welcome: %v", err)
+				return
+			}
+			ids <- welcome.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	if t.Failed() {
+		return
+	}
+	seen := make(map[string]bool)
+	for id := range ids {
+		if id == "" || seen[id] {
+			t.Fatalf("client ID %q empty or repeated", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != clients {
+		t.Fatalf("%d distinct IDs, want %d", len(seen), clients)
+	}
+}
+
+func TestIDsInUseAreSkipped(t *testing.T) {
+	n := 0
+	// The generator repeats each ID once, as a weak generator might.
+	s := newTestServer(t, WithIDGenerator(func() string {
+		n++
+		return fmt.Sprint("id-", n/2)
+	}))
+	ns := s.Of("/")
+	a, b := NewDetachedClient(ns), NewDetachedClient(ns)
+	if a.ID() == b.ID() {
+		t.Fatalf("two clients got ID %s", a.ID())
+	}
+	if ns.Client(a.ID()) != a || ns.Client(b.ID()) != b {
+		t.Fatal("clients not found by their IDs")
+	}
+}
+
+func TestIDOfDisconnectedClientIsReleased(t *testing.T) {
+	s := newTestServer(t, WithIDGenerator(func() string { return "only" }))
+	ns := s.Of("/")
+	a := NewDetachedClient(ns)
+	a.Disconnect(1000, "")
+	if b := NewDetachedClient(ns); b.ID() != "only" {
+		t.Fatalf("ID of the disconnected client not reused: got %s", b.ID())
+	}
+}
+
+func TestIDGeneratorThatKeepsCollidingPanics(t *testing.T) {
+	s := newTestServer(t, WithIDGenerator(func() string { return "same" }))
+	ns := s.Of("/")
+	NewDetachedClient(ns)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	NewDetachedClient(ns)
+}
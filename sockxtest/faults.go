@@ -0,0 +1,286 @@
+package sockxtest
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Link injects network faults into the connections attached to it. Faults
+// can be changed at any time and apply to reads and writes in progress as
+// well as later ones. The zero value is a healthy link.
+type Link struct {
+	mu      sync.Mutex
+	latency time.Duration
+	dropIn  bool
+	dropOut bool
+	stalled bool
+	resume  chan struct{} // closed when a stall ends
+}
+
+// SetLatency delays every read and write by d.
+func (l *Link) SetLatency(d time.Duration) {
+	l.mu.Lock()
+	l.latency = d
+	l.mu.Unlock()
+}
+
+// Drop silently discards data in either direction: writes report success
+// without sending anything, and incoming data is read and thrown away.
+func (l *Link) Drop(in, out bool) {
+	l.mu.Lock()
+	l.dropIn, l.dropOut = in, out
+	l.mu.Unlock()
+}
+
+// Stall blocks reads and writes until Resume, as a congested or frozen
+// peer would. Blocked calls still honor their deadlines.
+func (l *Link) Stall() {
+	l.mu.Lock()
+	if !l.stalled {
+		l.stalled = true
+		l.resume = make(chan struct{})
+	}
+	l.mu.Unlock()
+}
+
+// Resume ends a stall.
+func (l *Link) Resume() {
+	l.mu.Lock()
+	if l.stalled {
+		l.stalled = false
+		close(l.resume)
+	}
+	l.mu.Unlock()
+}
+
+// Heal removes every fault.
+func (l *Link) Heal() {
+	l.SetLatency(0)
+	l.Drop(false, false)
+	l.Resume()
+}
+
+// wait applies the link's latency and stall to one read or write. It
+// returns a timeout error if deadline passes first and net.ErrClosed if
+// closed is closed.
+func (l *Link) wait(deadline time.Time, closed <-chan struct{}) error {
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		expired = t.C
+	}
+	for {
+		l.mu.Lock()
+		latency, stalled, resume := l.latency, l.stalled, l.resume
+		l.mu.Unlock()
+		if stalled {
+			select {
+			case <-resume:
+				continue
+			case <-expired:
+				return os.ErrDeadlineExceeded
+			case <-closed:
+				return net.ErrClosed
+			}
+		}
+		if latency <= 0 {
+			return nil
+		}
+		t := time.NewTimer(latency)
+		select {
+		case <-t.C:
+			return nil
+		case <-expired:
+			t.Stop()
+			return os.ErrDeadlineExceeded
+		case <-closed:
+			t.Stop()
+			return net.ErrClosed
+		}
+	}
+}
+
+func (l *Link) dropping(in bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if in {
+		return l.dropIn
+	}
+	return l.dropOut
+}
+
+// Conn is a net.Conn whose traffic passes through a Link.
+type Conn struct {
+	net.Conn
+	link *Link
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	closeOnce     sync.Once
+	closed        chan struct{}
+}
+
+// Wrap returns c with the faults of link applied to it.
+func Wrap(c net.Conn, link *Link) *Conn {
+	return &Conn{Conn: c, link: link, closed: make(chan struct{})}
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(p []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		deadline := c.readDeadline
+		c.mu.Unlock()
+		if err := c.link.wait(deadline, c.closed); err != nil {
+			return 0, err
+		}
+		n, err := c.Conn.Read(p)
+		if err != nil || !c.link.dropping(true) {
+			return n, err
+		}
+	}
+}
+
+// Write implements net.Conn.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+	if err := c.link.wait(deadline, c.closed); err != nil {
+		return 0, err
+	}
+	if c.link.dropping(false) {
+		return len(p), nil
+	}
+	return c.Conn.Write(p)
+}
+
+// Close implements net.Conn.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// SetDeadline implements net.Conn.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements net.Conn.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// Dialer returns a WebSocket dialer whose connections pass through link,
+// so a test client sees, and causes the server to see, a degraded network.
+func Dialer(link *Link) *websocket.Dialer {
+	var d net.Dialer
+	return &websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return Wrap(c, link), nil
+		},
+	}
+}
+
+// Listener wraps the connections accepted by a net.Listener, giving each
+// its own Link. Use it as the Listener of an httptest.Server started with
+// Start to degrade the server side of connections.
+type Listener struct {
+	net.Listener
+	links chan *Link
+}
+
+// Listen wraps l. Links of up to 64 accepted connections are buffered for
+// Accepted; later ones are dropped if nobody is receiving.
+func Listen(l net.Listener) *Listener {
+	return &Listener{Listener: l, links: make(chan *Link, 64)}
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	link := new(Link)
+	select {
+	case l.links <- link:
+	default:
+	}
+	return Wrap(c, link), nil
+}
+
+// Accepted delivers the Link of each accepted connection, in order.
+func (l *Listener) Accepted() <-chan *Link { return l.links }
+
+// HalfOpen makes link behave like a half-open TCP connection, such as one
+// whose peer lost power: writes appear to succeed, but nothing arrives in
+// either direction.
+func HalfOpen(link *Link) {
+	link.Drop(true, true)
+}
+
+// HighLatency delays every read and write on link by d.
+func HighLatency(link *Link, d time.Duration) {
+	link.SetLatency(d)
+}
+
+// BurstyStalls stalls link for stall out of every period until the
+// returned function is called, which also resumes the link.
+func BurstyStalls(link *Link, period, stall time.Duration) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		t := time.NewTicker(period)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-done:
+				return
+			}
+			link.Stall()
+			select {
+			case <-time.After(stall):
+				link.Resume()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+			link.Resume()
+		})
+	}
+}
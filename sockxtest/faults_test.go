@@ -0,0 +1,164 @@
+package sockxtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/sockxtest"
+	"github.com/gorilla/websocket"
+)
+
+// disconnects returns a channel receiving the reasons ns's clients
+// disconnect for.
+func disconnects(ns *sockx.Namespace) <-chan sockx.DisconnectReason {
+	reasons := make(chan sockx.DisconnectReason, 16)
+	ns.OnLifecycle(func(ev sockx.LifecycleEvent) {
+		if ev.Kind == sockx.LifecycleDisconnect {
+			reasons <- ev.DisconnectReason
+		}
+	})
+	return reasons
+}
+
+// dialThrough connects to url over link and returns the connection and the
+// client ID from its welcome.
+func dialThrough(t *testing.T, url string, link *sockxtest.Link) (*websocket.Conn, string) {
+	t.Helper()
+	conn, _, err := sockxtest.Dialer(link).Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var msg sockx.Message
+	var welcome sockx.WelcomeData
+	if err := json.Unmarshal([]byte(readFrame(t, conn)), &msg); err != nil || msg.Bind(&welcome) != nil {
+		t.Fatalf("reading welcome: %v", err)
+	}
+	return conn, welcome.ID
+}
+
+// readAll reads conn's frames into a channel until the connection fails.
+// Reading also answers the server's pings.
+func readAll(conn *websocket.Conn) <-chan sockx.Message {
+	frames := make(chan sockx.Message, 256)
+	go func() {
+		defer close(frames)
+		for {
+			var msg sockx.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			frames <- msg
+		}
+	}()
+	return frames
+}
+
+// expectNumbers emits 0..n-1 to id and checks they arrive in order.
+func expectNumbers(t *testing.T, ns *sockx.Namespace, id string, frames <-chan sockx.Message, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := ns.Client(id).Emit("n", i); err != nil {
+			t.Fatalf("Emit %d: %v", i, err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-frames:
+			var v int
+			if msg.Bind(&v); msg.Event != "n" || v != i {
+				t.Fatalf("got %s %s, want n %d", msg.Event, msg.Data, i)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("message %d not delivered", i)
+		}
+	}
+}
+
+func TestHalfOpenClientTimesOut(t *testing.T) {
+	s, url := newServer(t, sockx.WithHeartbeat(50*time.Millisecond, 300*time.Millisecond))
+	reasons := disconnects(s.Of("/"))
+	link := new(sockxtest.Link)
+	dialThrough(t, url, link)
+	sockxtest.HalfOpen(link)
+
+	select {
+	case r := <-reasons:
+		if r != sockx.ReasonPingTimeout {
+			t.Fatalf("disconnect reason = %v, want %v", r, sockx.ReasonPingTimeout)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("half-open connection not detected")
+	}
+}
+
+func TestClientOnSlowLinkStaysConnected(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		degrade func(link *sockxtest.Link) (stop func())
+	}{
+		{"high latency", func(link *sockxtest.Link) func() {
+			sockxtest.HighLatency(link, 20*time.Millisecond)
+			return link.Heal
+		}},
+		{"bursty stalls", func(link *sockxtest.Link) func() {
+			return sockxtest.BurstyStalls(link, 100*time.Millisecond, 40*time.Millisecond)
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			const pongWait = 300 * time.Millisecond
+			s, url := newServer(t, sockx.WithHeartbeat(50*time.Millisecond, pongWait))
+			ns := s.Of("/")
+			reasons := disconnects(ns)
+			link := new(sockxtest.Link)
+			conn, id := dialThrough(t, url, link)
+			stop := tt.degrade(link)
+			defer stop()
+			frames := readAll(conn)
+
+			expectNumbers(t, ns, id, frames, 20)
+			select {
+			case r := <-reasons:
+				t.Fatalf("client disconnected with %v", r)
+			case <-time.After(3 * pongWait):
+			}
+			expectNumbers(t, ns, id, frames, 5)
+		})
+	}
+}
+
+func TestStalledConsumerIsDisconnected(t *testing.T) {
+	s := sockx.NewServer(sockx.WithWatchdog(200*time.Millisecond), sockx.WithWriteTimeout(time.Minute))
+	reasons := disconnects(s.Of("/"))
+	ts := httptest.NewUnstartedServer(s.ServeWebSocket("/"))
+	ln := sockxtest.Listen(ts.Listener)
+	ts.Listener = ln
+	ts.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		s.Shutdown(ctx)
+		ts.Close()
+	})
+
+	_, id := dialThrough(t, "ws"+strings.TrimPrefix(ts.URL, "http"), new(sockxtest.Link))
+	// Stall the server's end, so its writer blocks with frames queued.
+	(<-ln.Accepted()).Stall()
+	for i := 0; i < 5; i++ {
+		s.Of("/").Client(id).Emit("n", i)
+	}
+
+	select {
+	case r := <-reasons:
+		if r != sockx.ReasonStalled {
+			t.Fatalf("disconnect reason = %v, want %v", r, sockx.ReasonStalled)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("stalled consumer not disconnected")
+	}
+}
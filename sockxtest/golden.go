@@ -0,0 +1,287 @@
+package sockxtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/NRO04/sockx"
+)
+
+// Sample is a message of the wire protocol with fixed contents, for golden
+// tests of a codec's encoding. FromClient is set for messages clients
+// send, and clear for those the server sends.
+type Sample struct {
+	Name       string
+	FromClient bool
+	Msg        sockx.Message
+}
+
+// ProtocolSamples returns a sample of each message of the wire protocol,
+// in both directions: the handshake, events with and without a room,
+// acknowledgement requests and answers, batches, errors and namespace
+// multiplexing. Their IDs and data are fixed, so the same codec always
+// encodes them to the same bytes.
+func ProtocolSamples() []Sample {
+	const id = "0000000000000001"
+	return []Sample{
+		{Name: "client-hello", FromClient: true, Msg: sockx.Message{Event: sockx.EventHello, Data: sockx.HelloData{
+			Protocol: sockx.ProtocolVersion,
+			Features: []sockx.Feature{sockx.FeatureBatch, sockx.FeatureAckBatch},
+		}}},
+		{Name: "client-event", FromClient: true, Msg: sockx.Message{Event: "chat", Data: map[string]interface{}{"text": "hello"}}},
+		{Name: "client-event-ack", FromClient: true, Msg: sockx.Message{Event: "chat", Data: map[string]interface{}{"text": "hello"}, Ack: 7}},
+		{Name: "client-ack", FromClient: true, Msg: sockx.Message{Event: sockx.EventAck, Data: "ok", Ack: 3}},
+		{Name: "client-acks", FromClient: true, Msg: sockx.Message{Event: sockx.EventAcks, Data: []sockx.AckBatchEntry{{Ack: 3, Data: "ok"}, {Ack: 4}}}},
+		{Name: "client-join", FromClient: true, Msg: sockx.Message{Event: sockx.EventJoin, Data: "lobby", Ack: 8}},
+		{Name: "client-connect", FromClient: true, Msg: sockx.Message{Event: sockx.EventConnect, Data: "/chat"}},
+		{Name: "client-disconnect", FromClient: true, Msg: sockx.Message{Event: sockx.EventDisconnect, Namespace: "/chat"}},
+
+		{Name: "server-welcome", Msg: sockx.Message{Event: sockx.EventWelcome, Data: sockx.WelcomeData{
+			ID:          id,
+			Protocol:    sockx.ProtocolVersion,
+			Features:    []sockx.Feature{sockx.FeatureBatch, sockx.FeatureAckBatch},
+			Enabled:     []sockx.Feature{sockx.FeatureBatch},
+			ResumeToken: "token",
+			UserID:      "user",
+			Node:        "node",
+		}}},
+		{Name: "server-hello", Msg: sockx.Message{Event: sockx.EventHello, Data: sockx.HelloData{
+			Protocol: sockx.ProtocolVersion,
+			Features: []sockx.Feature{sockx.FeatureBatch},
+		}}},
+		{Name: "server-event", Msg: sockx.Message{ID: "m1", Event: "chat", Data: map[string]interface{}{"text": "hello"}}},
+		{Name: "server-event-room", Msg: sockx.Message{ID: "m2", Event: "chat", Room: "lobby", Data: map[string]interface{}{"text": "hello"}, Seq: 12}},
+		{Name: "server-event-correlation", Msg: sockx.Message{Event: "order-updated", Room: "orders", Data: map[string]interface{}{"id": 42}, Correlation: "req-1"}},
+		{Name: "server-event-ack", Msg: sockx.Message{Event: "confirm", Data: true, Ack: 5}},
+		{Name: "server-ack", Msg: sockx.Message{Event: sockx.EventAck, Data: map[string]interface{}{"ok": true}, Ack: 7}},
+		{Name: "server-acks", Msg: sockx.Message{Event: sockx.EventAcks, Data: []sockx.AckBatchEntry{{Ack: 7, Data: "ok"}, {Ack: 8}}}},
+		{Name: "server-batch", Msg: sockx.Message{Event: sockx.EventBatch, Data: []sockx.Message{
+			{Event: "chat", Data: "one"},
+			{Event: "chat", Room: "lobby", Data: "two"},
+		}}},
+		{Name: "server-error", Msg: sockx.Message{Event: sockx.EventError, Data: sockx.ErrorData{
+			Code:         sockx.ErrCodeRateLimited,
+			Message:      "rate limit exceeded",
+			Event:        "chat",
+			RetryAfterMs: 1000,
+		}}},
+		{Name: "server-connect", Msg: sockx.Message{Event: sockx.EventConnect, Namespace: "/chat", Data: sockx.ConnectResult{ID: id}}},
+		{Name: "server-disconnect", Msg: sockx.Message{Event: sockx.EventDisconnect, Namespace: "/chat", Data: "server shutting down"}},
+		{Name: "server-migrated", Msg: sockx.Message{Event: sockx.EventMigrated, Data: sockx.MigratedData{Namespace: "/games", Room: "lobby"}}},
+	}
+}
+
+// goldenExt is the extension of golden files.
+const goldenExt = ".golden"
+
+// WriteGolden encodes each of ProtocolSamples with codec into dir, one
+// file per sample named after it, replacing the files already there. Run
+// it to create the golden files of a codec, and again only when the wire
+// protocol is meant to change.
+func WriteGolden(dir string, codec sockx.Codec) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, s := range ProtocolSamples() {
+		data, _, err := codec.Marshal(s.Msg)
+		if err != nil {
+			return fmt.Errorf("sockxtest: encoding %s: %w", s.Name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, s.Name+goldenExt), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decoder decodes an encoded message into generic values: maps with string
+// keys, slices and scalars, as json.Unmarshal does into an interface{}.
+// Codecs other than JSONCodec provide their own, such as
+// msgpackcodec.Decode.
+type Decoder func(data []byte) (interface{}, error)
+
+// DecodeJSON is the Decoder of JSONCodec.
+func DecodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// VerifyGolden encodes each of ProtocolSamples with codec and checks with
+// CheckCompatible that it is compatible with its golden file in dir, both
+// decoded with decode. A sample without a golden file, such as a message
+// added since the files were written, is a problem too, so that deleting
+// a file does not turn its check off; WriteGolden creates the missing
+// files, as running the package's tests with -update does. The error lists
+// every problem.
+func VerifyGolden(dir string, codec sockx.Codec, decode Decoder) error {
+	var problems []string
+	for _, s := range ProtocolSamples() {
+		golden, err := os.ReadFile(filepath.Join(dir, s.Name+goldenExt))
+		if errors.Is(err, fs.ErrNotExist) {
+			problems = append(problems, s.Name+": no golden file; write it with WriteGolden (go test -update)")
+			continue
+		}
+		if err != nil {
+			problems = append(problems, s.Name+": "+err.Error())
+			continue
+		}
+		data, _, err := codec.Marshal(s.Msg)
+		if err != nil {
+			problems = append(problems, s.Name+": encoding: "+err.Error())
+			continue
+		}
+		want, err := decode(golden)
+		if err != nil {
+			problems = append(problems, s.Name+": decoding golden file: "+err.Error())
+			continue
+		}
+		got, err := decode(data)
+		if err != nil {
+			problems = append(problems, s.Name+": decoding: "+err.Error())
+			continue
+		}
+		for _, p := range CheckCompatible(want, got) {
+			problems = append(problems, s.Name+": "+p)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("sockxtest: protocol does not match the golden files in " + dir + ":\n\t" + strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// CheckCompatible compares a message as currently encoded with its golden
+// encoding, both decoded to generic values, and describes each way it
+// breaks compatibility with clients built against the golden one. Within a
+// protocol version, messages may gain fields but never lose them: a field
+// of the golden encoding that is missing, because it was renamed or
+// removed, or whose value changed, including its type, is reported. Fields
+// only in current are not. Numbers are compared by value, whatever their
+// Go type, and a null golden value accepts anything.
+func CheckCompatible(golden, current interface{}) []string {
+	var problems []string
+	compareWire("", golden, current, &problems)
+	return problems
+}
+
+func compareWire(path string, golden, current interface{}, problems *[]string) {
+	at := path
+	if at == "" {
+		at = "message"
+	}
+	if golden == nil {
+		return
+	}
+	if gk, ck := wireKind(golden), wireKind(current); gk != ck {
+		*problems = append(*problems, fmt.Sprintf("%s: %s changed to %s", at, gk, ck))
+		return
+	}
+	switch g := golden.(type) {
+	case map[string]interface{}:
+		c := current.(map[string]interface{})
+		keys := make([]string, 0, len(g))
+		for k := range g {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field := k
+			if path != "" {
+				field = path + "." + k
+			}
+			v, ok := c[k]
+			if !ok {
+				*problems = append(*problems, field+": removed or renamed")
+				continue
+			}
+			compareWire(field, g[k], v, problems)
+		}
+	case []interface{}:
+		c := current.([]interface{})
+		if len(c) != len(g) {
+			*problems = append(*problems, fmt.Sprintf("%s: length %d changed to %d", at, len(g), len(c)))
+		}
+		for i := 0; i < len(g) && i < len(c); i++ {
+			compareWire(fmt.Sprintf("%s[%d]", path, i), g[i], c[i], problems)
+		}
+	default:
+		if gv, cv := wireScalar(golden), wireScalar(current); gv != cv {
+			*problems = append(*problems, fmt.Sprintf("%s: %v changed to %v", at, gv, cv))
+		}
+	}
+}
+
+// wireKind names the kind of a decoded value, numbers of any Go type
+// being one kind.
+func wireKind(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case []byte:
+		return "binary"
+	case bool:
+		return "bool"
+	default:
+		if _, ok := wireNumber(v); ok {
+			return "number"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// wireScalar returns a comparable form of a decoded scalar.
+func wireScalar(v interface{}) interface{} {
+	if n, ok := wireNumber(v); ok {
+		return n
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+func wireNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
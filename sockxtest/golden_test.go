@@ -0,0 +1,93 @@
+package sockxtest_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/sockxtest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestJSONGolden(t *testing.T) {
+	dir := filepath.Join("testdata", "json")
+	if *update {
+		if err := sockxtest.WriteGolden(dir, sockx.JSONCodec{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sockxtest.VerifyGolden(dir, sockx.JSONCodec{}, sockxtest.DecodeJSON); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckCompatiblePolicy(t *testing.T) {
+	decode := func(s string) interface{} {
+		v, err := sockxtest.DecodeJSON([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	golden := `{"event":"chat","data":{"text":"hi","n":1,"meta":null},"ack":7}`
+	for _, tt := range []struct {
+		name    string
+		current string
+		want    string
+	}{
+		{"unchanged", golden, ""},
+		{"field added", `{"event":"chat","data":{"text":"hi","n":1,"meta":null,"ts":5},"ack":7,"v":2}`, ""},
+		{"null golden accepts anything", `{"event":"chat","data":{"text":"hi","n":1.0,"meta":[1]},"ack":7}`, ""},
+		{"null golden still required", `{"event":"chat","data":{"text":"hi","n":1},"ack":7}`, "data.meta: removed or renamed"},
+		{"field renamed", `{"type":"chat","data":{"text":"hi","n":1,"meta":null},"ack":7}`, "event: removed or renamed"},
+		{"nested field removed", `{"event":"chat","data":{"n":1,"meta":null},"ack":7}`, "data.text: removed or renamed"},
+		{"type changed", `{"event":"chat","data":{"text":"hi","n":"1","meta":null},"ack":7}`, "data.n: number changed to string"},
+		{"value changed", `{"event":"chat","data":{"text":"hi","n":1,"meta":null},"ack":8}`, "ack: 7 changed to 8"},
+	} {
+		got := strings.Join(sockxtest.CheckCompatible(decode(golden), decode(tt.current)), "; ")
+		if got != tt.want {
+			t.Errorf("%s: problems %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyGoldenReportsBreakingChanges(t *testing.T) {
+	dir := t.TempDir()
+	if err := sockxtest.VerifyGolden(dir, sockx.JSONCodec{}, sockxtest.DecodeJSON); err == nil {
+		t.Fatal("no error for a directory without golden files")
+	}
+	if err := sockxtest.WriteGolden(dir, sockx.JSONCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sockxtest.VerifyGolden(dir, sockx.JSONCodec{}, sockxtest.DecodeJSON); err != nil {
+		t.Fatalf("fresh golden files: %v", err)
+	}
+
+	// A codec naming the event field otherwise breaks every message.
+	renamed := sockx.NewJSONCodec(sockx.EnvelopeFields{Event: "type"})
+	err := sockxtest.VerifyGolden(dir, renamed, sockxtest.DecodeJSON)
+	if err == nil || !strings.Contains(err.Error(), "server-welcome: event: removed or renamed") {
+		t.Fatalf("renamed field: %v", err)
+	}
+
+	// Golden files of messages since removed from the samples are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "retired.golden"), []byte(`{"event":"gone"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := sockxtest.VerifyGolden(dir, sockx.JSONCodec{}, sockxtest.DecodeJSON); err != nil {
+		t.Fatalf("golden file without a sample: %v", err)
+	}
+
+	// A sample without a golden file is reported, pointing to -update.
+	if err := os.Remove(filepath.Join(dir, "server-batch.golden")); err != nil {
+		t.Fatal(err)
+	}
+	err = sockxtest.VerifyGolden(dir, sockx.JSONCodec{}, sockxtest.DecodeJSON)
+	if err == nil || !strings.Contains(err.Error(), "server-batch: no golden file") || !strings.Contains(err.Error(), "-update") {
+		t.Fatalf("missing golden file: %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package sockxtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/client"
+	"github.com/gorilla/websocket"
+)
+
+// Checks made by Selftest, as named by its Failures.
+const (
+	CheckConnect   = "connect"
+	CheckWelcome   = "welcome"
+	CheckEcho      = "echo"
+	CheckAck       = "ack"
+	CheckJoin      = "join"
+	CheckBroadcast = "broadcast"
+	CheckAdapter   = "adapter"
+	CheckLeave     = "leave"
+	CheckClose     = "close"
+)
+
+// Events the self-test exchanges. Their handlers are registered for the
+// duration of the test only.
+const (
+	selftestEcho = "selftest:echo"
+	selftestAck  = "selftest:ack"
+	selftestAsk  = "selftest:ask"
+	selftestRoom = "selftest:room"
+)
+
+const (
+	// defaultSelftestTimeout bounds a Selftest whose context has no
+	// deadline.
+	defaultSelftestTimeout = 5 * time.Second
+
+	// selftestStep bounds each exchange of the self-test.
+	selftestStep = time.Second
+)
+
+// Failure is a check that failed in Selftest.
+type Failure struct {
+	Check string
+	Err   error
+}
+
+func (f *Failure) Error() string {
+	return "sockxtest: selftest: " + f.Check + ": " + f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error { return f.Err }
+
+// SelftestOption configures Selftest.
+type SelftestOption func(*selftest)
+
+// SelftestNamespace runs the self-test in the named namespace, so that its
+// codec and middleware are part of it. Defaults to "/".
+func SelftestNamespace(name string) SelftestOption {
+	return func(st *selftest) { st.namespace = name }
+}
+
+// Credentials provides the handshake headers of the self-test's
+// connections, such as an Authorization header, for namespaces whose
+// middleware authenticates them. It is called once per connection.
+func Credentials(fn func() (http.Header, error)) SelftestOption {
+	return func(st *selftest) { st.credentials = fn }
+}
+
+type selftest struct {
+	namespace   string
+	credentials func() (http.Header, error)
+
+	ns       *sockx.Namespace
+	url      string
+	token    string
+	failures []error
+}
+
+// Selftest checks that srv, as the application configured it, yields a
+// working server, for example at startup or in the CI of applications
+// embedding sockx. It serves srv on a loopback listener and connects two
+// clients with the client package, in the namespace's codec, to check that
+// they are welcomed, that events are echoed and acknowledged both ways,
+// that rooms can be joined, broadcast to, with the adapter if srv has one,
+// and left, and that a client closing is disconnected.
+//
+// It returns nil if all went well and otherwise the errors.Join of a
+// *Failure per failed check; checks that depend on a failed one are
+// skipped. It takes well under a second on a healthy server, and gives up
+// when ctx is done, or after 5s if ctx has no deadline.
+//
+// Selftest registers handlers for events named "selftest:..." in the
+// namespace while it runs, and removes them before returning; with
+// StrictNamespaces they make the namespace count as registered meanwhile.
+func Selftest(ctx context.Context, srv *sockx.Server, opts ...SelftestOption) error {
+	st := &selftest{namespace: "/", credentials: func() (http.Header, error) { return nil, nil }}
+	for _, opt := range opts {
+		opt(st)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultSelftestTimeout)
+		defer cancel()
+	}
+	st.ns = srv.Of(st.namespace)
+	st.token = strconv.FormatInt(time.Now().UnixNano(), 36)
+	defer st.register()()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return &Failure{CheckConnect, err}
+	}
+	hs := &http.Server{Handler: srv.ServeWebSocket(st.namespace)}
+	go hs.Serve(l)
+	defer hs.Close()
+	st.url = "ws://" + l.Addr().String() + "/"
+
+	st.run(ctx)
+	return errors.Join(st.failures...)
+}
+
+// register installs the self-test's handlers and returns the function
+// removing them.
+func (st *selftest) register() func() {
+	subs := []*sockx.Subscription{
+		st.ns.On(selftestEcho, func(c *sockx.Client, data interface{}) {
+			c.Emit(selftestEcho, data)
+		}),
+		st.ns.OnWithAck(selftestAck, func(c *sockx.Client, data interface{}) interface{} {
+			return data
+		}),
+	}
+	return func() {
+		for _, sub := range subs {
+			st.ns.Off(sub.Event(), sub)
+		}
+	}
+}
+
+func (st *selftest) fail(check string, err error) {
+	st.failures = append(st.failures, &Failure{check, err})
+}
+
+// peer is a test connection and the events it received.
+type peer struct {
+	conn   *client.Conn
+	srv    *sockx.Client
+	events chan string
+}
+
+func (st *selftest) run(ctx context.Context) {
+	a, err := st.dial(ctx)
+	if err != nil {
+		st.fail(CheckConnect, err)
+		return
+	}
+	defer a.conn.Close()
+	b, err := st.dial(ctx)
+	if err != nil {
+		st.fail(CheckConnect, err)
+		return
+	}
+	defer b.conn.Close()
+	if a.srv == nil || b.srv == nil {
+		st.fail(CheckWelcome, errors.New("welcomed with an ID the namespace does not know"))
+		return
+	}
+
+	echo := "echo-" + st.token
+	if err := a.conn.Emit(selftestEcho, echo); err != nil {
+		st.fail(CheckEcho, err)
+	} else if err := a.expect(ctx, echo); err != nil {
+		st.fail(CheckEcho, err)
+	}
+	st.checkAck(ctx, a)
+
+	room := "selftest-" + st.token
+	for _, p := range []*peer{a, b} {
+		if err := p.srv.Join(room); err != nil {
+			st.fail(CheckJoin, err)
+			return
+		}
+	}
+	if st.checkBroadcast(ctx, room, a, b) {
+		st.checkLeave(ctx, room, a, b)
+	}
+
+	id := a.srv.ID()
+	a.conn.Close()
+	if err := waitFor(ctx, func() bool { return st.ns.Client(id) == nil }); err != nil {
+		st.fail(CheckClose, fmt.Errorf("client still connected after closing: %w", err))
+	}
+}
+
+// dial connects a peer to the namespace.
+func (st *selftest) dial(ctx context.Context) (*peer, error) {
+	header, err := st.credentials()
+	if err != nil {
+		return nil, err
+	}
+	step := stepTimeout(ctx)
+	conn, err := client.Dial(st.url,
+		client.WithHeader(header),
+		client.WithCodec(st.ns.Codec()),
+		client.WithTimeout(step),
+		client.WithDialer(&websocket.Dialer{HandshakeTimeout: step}))
+	if err != nil {
+		return nil, err
+	}
+	p := &peer{conn: conn, srv: st.ns.Client(conn.ID()), events: make(chan string, 8)}
+	deliver := func(data interface{}) {
+		s, _ := data.(string)
+		select {
+		case p.events <- s:
+		default:
+		}
+	}
+	conn.On(selftestEcho, deliver)
+	conn.On(selftestRoom, deliver)
+	conn.OnWithAck(selftestAsk, func(data interface{}) interface{} { return data })
+	return p, nil
+}
+
+// checkAck sends an event with an acknowledgement each way.
+func (st *selftest) checkAck(ctx context.Context, p *peer) {
+	want := "ack-" + st.token
+	got, err := p.conn.EmitWithAck(selftestAck, want, stepTimeout(ctx))
+	if err == nil && got != want {
+		err = fmt.Errorf("client got acknowledgement %v, want %q", got, want)
+	}
+	if err != nil {
+		st.fail(CheckAck, err)
+		return
+	}
+	got, err = p.srv.EmitWithAck(selftestAsk, want, stepTimeout(ctx))
+	if err == nil && got != want {
+		err = fmt.Errorf("server got acknowledgement %v, want %q", got, want)
+	}
+	if err != nil {
+		st.fail(CheckAck, err)
+	}
+}
+
+// checkBroadcast emits to room, whose members are peers, and reports
+// whether all of them received it.
+func (st *selftest) checkBroadcast(ctx context.Context, room string, peers ...*peer) bool {
+	want := "broadcast-" + st.token
+	res, err := st.ns.EmitTo(room, selftestRoom, want)
+	if res.PublishErr != nil {
+		st.fail(CheckAdapter, res.PublishErr)
+	} else if err != nil {
+		st.fail(CheckBroadcast, err)
+		return false
+	}
+	for _, p := range peers {
+		if err := p.expect(ctx, want); err != nil {
+			st.fail(CheckBroadcast, err)
+			return false
+		}
+	}
+	return true
+}
+
+// checkLeave has b leave room and checks that a broadcast to the room
+// reaches a but not b. b is sent a message of its own after the
+// broadcast, which it must get first.
+func (st *selftest) checkLeave(ctx context.Context, room string, a, b *peer) {
+	if err := b.srv.Leave(room); err != nil {
+		st.fail(CheckLeave, err)
+		return
+	}
+	left, marker := "left-"+st.token, "marker-"+st.token
+	if _, err := st.ns.EmitTo(room, selftestRoom, left); err != nil {
+		st.fail(CheckLeave, err)
+		return
+	}
+	if err := b.srv.Emit(selftestRoom, marker); err != nil {
+		st.fail(CheckLeave, err)
+		return
+	}
+	if err := a.expect(ctx, left); err != nil {
+		st.fail(CheckLeave, err)
+	}
+	if err := b.expect(ctx, marker); err != nil {
+		st.fail(CheckLeave, fmt.Errorf("after leaving: %w", err))
+	}
+}
+
+// expect waits for p to receive the event data want.
+func (p *peer) expect(ctx context.Context, want string) error {
+	t := time.NewTimer(stepTimeout(ctx))
+	defer t.Stop()
+	for {
+		select {
+		case got := <-p.events:
+			if got != want {
+				return fmt.Errorf("got %q, want %q", got, want)
+			}
+			return nil
+		case <-t.C:
+			return fmt.Errorf("%q not received", want)
+		case <-p.conn.Done():
+			return fmt.Errorf("connection closed waiting for %q: %v", want, p.conn.Err())
+		}
+	}
+}
+
+// waitFor polls cond until it holds or a step times out.
+func waitFor(ctx context.Context, cond func() bool) error {
+	deadline := time.Now().Add(stepTimeout(ctx))
+	for !cond() {
+		if time.Now().After(deadline) {
+			return errors.New("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+// stepTimeout bounds an exchange, within what is left of ctx.
+func stepTimeout(ctx context.Context) time.Duration {
+	d := selftestStep
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < d {
+			d = left
+		}
+	}
+	if d <= 0 {
+		d = time.Millisecond
+	}
+	return d
+}
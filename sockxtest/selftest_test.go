@@ -0,0 +1,59 @@
+package sockxtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/sockxtest"
+)
+
+// downAdapter is an adapter whose backend is unreachable.
+type downAdapter struct{}
+
+func (downAdapter) Publish(namespace, room string, msg sockx.Message) error {
+	return errors.New("backend unreachable")
+}
+
+func (downAdapter) Subscribe(handler func(namespace, room string, msg sockx.Message)) {}
+
+func TestSelftestPassesOnHealthyServer(t *testing.T) {
+	s, _ := newServer(t, sockx.WithAdapter(sockx.NewMemoryBus().Adapter()))
+	for i := 0; i < 2; i++ {
+		if err := sockxtest.Selftest(context.Background(), s); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestSelftestReportsMisconfiguredServer(t *testing.T) {
+	s, _ := newServer(t)
+	ns := s.Of("/api")
+	ns.Use(func(c *sockx.Client, r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer ok" {
+			return errors.New("unauthorized")
+		}
+		return nil
+	})
+	err := sockxtest.Selftest(context.Background(), s, sockxtest.SelftestNamespace("/api"))
+	var f *sockxtest.Failure
+	if !errors.As(err, &f) || f.Check != sockxtest.CheckConnect {
+		t.Fatalf("Selftest without credentials = %v, want a %s failure", err, sockxtest.CheckConnect)
+	}
+
+	err = sockxtest.Selftest(context.Background(), s, sockxtest.SelftestNamespace("/api"),
+		sockxtest.Credentials(func() (http.Header, error) {
+			return http.Header{"Authorization": {"Bearer ok"}}, nil
+		}))
+	if err != nil {
+		t.Fatalf("Selftest with credentials: %v", err)
+	}
+
+	down, _ := newServer(t, sockx.WithAdapter(downAdapter{}))
+	err = sockxtest.Selftest(context.Background(), down)
+	if !errors.As(err, &f) || f.Check != sockxtest.CheckAdapter {
+		t.Fatalf("Selftest with the adapter down = %v, want a %s failure", err, sockxtest.CheckAdapter)
+	}
+}
@@ -0,0 +1,33 @@
+// Package sockxtest provides helpers for testing code built on sockx.
+package sockxtest
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// Sequential is a deterministic source for sockx.WithRandSource. Each Read
+// fills its buffer with zeros followed by a big-endian counter that grows
+// by one per Read, so client IDs come out as 0000000000000001,
+// 0000000000000002 and so on. The zero value is ready to use.
+type Sequential struct {
+	mu sync.Mutex
+	n  uint64
+}
+
+// Read implements io.Reader. It never fails.
+func (s *Sequential) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	s.n++
+	n := s.n
+	s.mu.Unlock()
+	clear(p)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	if len(p) >= len(b) {
+		copy(p[len(p)-len(b):], b[:])
+	} else {
+		copy(p, b[len(b)-len(p):])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,117 @@
+package sockxtest_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NRO04/sockx"
+	"github.com/NRO04/sockx/sockxtest"
+	"github.com/gorilla/websocket"
+)
+
+// testTimeout bounds every wait in the tests.
+const testTimeout = 5 * time.Second
+
+// newServer returns a server drawing IDs from a Sequential source, with
+// namespace / served for the duration of the test, and its WebSocket URL.
+func newServer(t *testing.T, opts ...sockx.Option) (*sockx.Server, string) {
+	t.Helper()
+	opts = append([]sockx.Option{sockx.WithRandSource(&sockxtest.Sequential{}), sockx.WithNodeID("node-1")}, opts...)
+	s := sockx.NewServer(opts...)
+	ts := httptest.NewServer(s.ServeWebSocket("/"))
+	t.Cleanup(func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s, "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+// dial connects to url and returns the connection.
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readFrame returns the next frame of conn.
+func readFrame(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSequentialCounts(t *testing.T) {
+	var s sockxtest.Sequential
+	for _, tt := range []struct {
+		size int
+		want []byte
+	}{
+		{8, []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{10, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 2}},
+		{2, []byte{0, 3}},
+	} {
+		p := bytes.Repeat([]byte{0xff}, tt.size)
+		if n, err := s.Read(p); n != tt.size || err != nil {
+			t.Fatalf("Read = %d, %v", n, err)
+		}
+		if !bytes.Equal(p, tt.want) {
+			t.Errorf("Read filled %v, want %v", p, tt.want)
+		}
+	}
+}
+
+func TestWireFormatIsDeterministic(t *testing.T) {
+	want := []string{
+		`{"event":"sockx:welcome","data":{"id":"0000000000000001","protocol":1,"features":["acks","batch"],"resumeToken":"00000000000000020000000000000003","node":"node-1"}}`,
+		`{"event":"sockx:ack","data":"pong","ack":7}`,
+		`{"event":"sockx:error","data":{"code":"bad_message","message":"invalid character 'o' in literal null (expecting 'u')"}}`,
+		`{"event":"question","ack":1}`,
+	}
+	// Two servers produce the same frames.
+	for i := 0; i < 2; i++ {
+		s, url := newServer(t)
+		ns := s.Of("/")
+		ns.EnableResume(time.Minute)
+		ns.OnWithAck("ping", func(c *sockx.Client, data interface{}) interface{} { return "pong" })
+		conn := dial(t, url)
+
+		got := []string{readFrame(t, conn)}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"ping","ack":7}`))
+		got = append(got, readFrame(t, conn))
+		conn.WriteMessage(websocket.TextMessage, []byte(`not json`))
+		got = append(got, readFrame(t, conn))
+		go ns.Client("0000000000000001").EmitWithAck("question", nil, time.Millisecond)
+		got = append(got, readFrame(t, conn))
+
+		for j := range want {
+			if got[j] != want[j] {
+				t.Errorf("server %d, frame %d:\n got %s\nwant %s", i, j, got[j], want[j])
+			}
+		}
+	}
+}
+
+func TestClientIDsFollowTheSource(t *testing.T) {
+	s, url := newServer(t)
+	for _, want := range []string{"0000000000000001", "0000000000000002", "0000000000000003"} {
+		conn := dial(t, url)
+		readFrame(t, conn)
+		if s.Of("/").Client(want) == nil {
+			t.Fatalf("no client %s", want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package sockx
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// statShards is the number of shards of the namespace counters updated
+// on every event and emit. Updates go to a shard picked at random, so
+// concurrent writers rarely share a cache line; reads sum the shards.
+const statShards = 32
+
+// statShard picks the shard for a counter update. The top-level math/rand
+// functions draw from a per-thread source and do not lock.
+func statShard() int {
+	return int(rand.Uint32() % statShards)
+}
+
+// byteCounters attributes outbound payload bytes to rooms. The empty key
+// holds bytes for emits that did not target a room.
+type byteCounters struct {
+	shards [statShards]byteShard
+}
+
+type byteShard struct {
+	mu sync.Mutex
+	m  map[string]int64
+	_  [48]byte // pad to a cache line
+}
+
+func (b *byteCounters) add(room string, n int64) {
+	if n == 0 {
+		return
+	}
+	sh := &b.shards[statShard()]
+	sh.mu.Lock()
+	if sh.m == nil {
+		sh.m = make(map[string]int64)
+	}
+	sh.m[room] += n
+	sh.mu.Unlock()
+}
+
+func (b *byteCounters) get(room string) int64 {
+	var n int64
+	for i := range b.shards {
+		sh := &b.shards[i]
+		sh.mu.Lock()
+		n += sh.m[room]
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+func (b *byteCounters) snapshot() map[string]int64 {
+	out := make(map[string]int64)
+	for i := range b.shards {
+		sh := &b.shards[i]
+		sh.mu.Lock()
+		for k, v := range sh.m {
+			out[k] += v
+		}
+		sh.mu.Unlock()
+	}
+	return out
+}
+
+// collect returns the counters and resets them. Each shard is taken and
+// reset in one step, so no bytes are counted twice or lost between a read
+// and a reset.
+func (b *byteCounters) collect() map[string]int64 {
+	out := make(map[string]int64)
+	for i := range b.shards {
+		sh := &b.shards[i]
+		sh.mu.Lock()
+		m := sh.m
+		sh.m = nil
+		sh.mu.Unlock()
+		for k, v := range m {
+			out[k] += v
+		}
+	}
+	return out
+}
+
+// BytesByRoom returns the outbound payload bytes sent per room since the
+// last CollectBytes. Bytes of emits that targeted no room are reported under
+// the empty key. Broadcasts count the payload once per recipient.
+func (ns *Namespace) BytesByRoom() map[string]int64 {
+	return ns.bytes.snapshot()
+}
+
+// CollectBytes returns the same counters as BytesByRoom and atomically
+// resets them to zero. It is intended for billing exporters.
+func (ns *Namespace) CollectBytes() map[string]int64 {
+	return ns.bytes.collect()
+}
+
+// FlushBytesEvery calls fn with the result of CollectBytes every interval
+// until the returned stop function is called. Counters that were empty for
+// the interval are still reported as an empty map.
+func (ns *Namespace) FlushBytesEvery(interval time.Duration, fn func(map[string]int64)) (stop func()) {
+	t := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-t.C:
+				fn(ns.CollectBytes())
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.Stop()
+			close(done)
+		})
+	}
+}
+
+// BytesSent returns the outbound payload bytes sent to this room since the
+// namespace counters were last collected. The counter outlives the Room
+// value, so it keeps accumulating if the room is emptied and re-created.
+func (r *Room) BytesSent() int64 {
+	return r.Namespace().bytes.get(r.name)
+}
@@ -0,0 +1,202 @@
+package sockx
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedCountersSumExactly(t *testing.T) {
+	const writers, updates = 64, 1000
+	var d durationCounter
+	var b byteCounters
+	var collected atomic.Int64
+	stop := make(chan struct{})
+	collecting := make(chan struct{})
+	go func() {
+		defer close(collecting)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				collected.Add(b.collect()["r"])
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 1; i <= updates; i++ {
+				d.observe(time.Duration(i))
+				b.add("r", 2)
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	<-collecting
+	collected.Add(b.collect()["r"])
+
+	st := d.load()
+	if st.Count != writers*updates {
+		t.Errorf("Count = %d, want %d", st.Count, writers*updates)
+	}
+	if want := time.Duration(writers * updates * (updates + 1) / 2); st.Total != want {
+		t.Errorf("Total = %d, want %d", st.Total, want)
+	}
+	if st.Max != updates {
+		t.Errorf("Max = %d, want %d", st.Max, updates)
+	}
+	if n := collected.Load(); n != 2*writers*updates {
+		t.Errorf("collected %d bytes, want %d", n, 2*writers*updates)
+	}
+}
+
+func TestNamespaceStatsCountEventsAndBytes(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	handled := make(chan struct{}, 10)
+	ns.On("ping", func(c *Client, data interface{}) { handled <- struct{}{} })
+	tc := dial(t, s, "/")
+	for i := 0; i < 10; i++ {
+		tc.emit("ping", i)
+	}
+	for i := 0; i < 10; i++ {
+		<-handled
+	}
+	waitFor(t, "handler times recorded", func() bool { return ns.Stats().HandlerTime.Count == 10 })
+
+	ns.Client(tc.welcome.ID).Join("r")
+	ns.EmitTo("r", "news", "x")
+	tc.expect("news")
+	sent := ns.Room("r").BytesSent()
+	if sent == 0 {
+		t.Fatal("no bytes counted for the room")
+	}
+	if got := ns.CollectBytes()["r"]; got != sent {
+		t.Fatalf("CollectBytes = %d, want %d", got, sent)
+	}
+	if got := ns.BytesByRoom()["r"]; got != 0 {
+		t.Fatalf("BytesByRoom after collect = %d, want 0", got)
+	}
+}
+
+func TestBytesByRoomCountsEveryRecipient(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	a, b := dial(t, s, "/"), dial(t, s, "/")
+	ns.Client(a.welcome.ID).Join("r")
+
+	ns.EmitTo("r", "news", "x")
+	a.expect("news")
+	one := ns.CollectBytes()["r"]
+	if one == 0 {
+		t.Fatal("no bytes counted for one recipient")
+	}
+
+	ns.Client(b.welcome.ID).Join("r")
+	ns.EmitTo("r", "news", "x")
+	a.expect("news")
+	b.expect("news")
+	if got := ns.Room("r").BytesSent(); got != 2*one {
+		t.Fatalf("BytesSent with two recipients = %d, want %d", got, 2*one)
+	}
+
+	// Emits to a single client count under the empty key.
+	if err := ns.Client(b.welcome.ID).Emit("direct", "x"); err != nil {
+		t.Fatal(err)
+	}
+	b.expect("direct")
+	got := ns.BytesByRoom()
+	if got[""] == 0 {
+		t.Fatalf("no bytes counted for the direct emit: %v", got)
+	}
+	if got["r"] != 2*one {
+		t.Fatalf("direct emit counted for the room: %v", got)
+	}
+}
+
+func TestFlushBytesEveryReportsAndStops(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	tc := dial(t, s, "/")
+	ns.Client(tc.welcome.ID).Join("r")
+
+	var mu sync.Mutex
+	var flushed int64
+	calls := 0
+	stop := ns.FlushBytesEvery(time.Millisecond, func(m map[string]int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		flushed += m["r"]
+		calls++
+	})
+	ns.EmitTo("r", "news", "x")
+	tc.expect("news")
+	waitFor(t, "the room's bytes flushed", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return flushed > 0
+	})
+	if got := ns.BytesByRoom()["r"]; got != 0 {
+		t.Fatalf("BytesByRoom after a flush = %d, want 0", got)
+	}
+
+	// stop is idempotent. A flush already under way may still finish.
+	stop()
+	stop()
+	mu.Lock()
+	n := calls
+	mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls > n+1 {
+		t.Fatalf("%d flushes after stop", calls-n)
+	}
+}
+
+// naiveDurationCounter is a durationCounter without shards, for
+// comparison.
+type naiveDurationCounter struct {
+	count, total, max int64
+}
+
+func (d *naiveDurationCounter) observe(v time.Duration) {
+	atomic.AddInt64(&d.count, 1)
+	atomic.AddInt64(&d.total, int64(v))
+	for {
+		cur := atomic.LoadInt64(&d.max)
+		if int64(v) <= cur || atomic.CompareAndSwapInt64(&d.max, cur, int64(v)) {
+			return
+		}
+	}
+}
+
+// BenchmarkDurationCounter compares the sharded counter with a single set
+// of atomics under 64 concurrent writers per CPU.
+func BenchmarkDurationCounter(b *testing.B) {
+	b.Run("sharded", func(b *testing.B) {
+		var d durationCounter
+		b.SetParallelism(64)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				d.observe(time.Microsecond)
+			}
+		})
+	})
+	b.Run("naive", func(b *testing.B) {
+		var d naiveDurationCounter
+		b.SetParallelism(64)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				d.observe(time.Microsecond)
+			}
+		})
+	})
+}
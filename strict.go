@@ -0,0 +1,83 @@
+package sockx
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// unknownNamespaceReason is the close reason sent to connections refused
+// by Config.StrictNamespaces.
+const unknownNamespaceReason = "unknown namespace"
+
+// WithStrictNamespaces enables StrictNamespaces.
+func WithStrictNamespaces() Option {
+	return func(c *Config) { c.StrictNamespaces = true }
+}
+
+// namespaceFor returns the namespace a ServeWebSocket handler attaches
+// clients to. With StrictNamespaces it returns false, instead of creating
+// the namespace, if the namespace does not exist or nothing is registered
+// on it.
+func (s *Server) namespaceFor(name string) (*Namespace, bool) {
+	if !s.cfg().StrictNamespaces {
+		return s.Of(name), true
+	}
+	s.announce.Do(func() {
+		s.logf("serving namespaces %s", strings.Join(s.registeredNamespaces(), ", "))
+	})
+	s.mu.RLock()
+	ns := s.namespaces[name]
+	s.mu.RUnlock()
+	if ns == nil || !ns.registered() {
+		return nil, false
+	}
+	return ns, true
+}
+
+// registered reports whether the application has set the namespace up: it
+// has event handlers, catch-all handlers or lifecycle hooks, or is being
+// set up by OfSetup.
+func (ns *Namespace) registered() bool {
+	t := ns.handlers.Load()
+	if len(t.byEvent) > 0 || len(t.any) > 0 || len(t.unhandled) > 0 || !ns.IsReady() {
+		return true
+	}
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	return len(ns.lifecycleHooks) > 0
+}
+
+// registeredNamespaces returns the sorted names of the registered
+// namespaces.
+func (s *Server) registeredNamespaces() []string {
+	var names []string
+	for _, ns := range s.namespaceList() {
+		if ns.registered() {
+			names = append(names, ns.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// refuseNamespace turns a connection to an unknown namespace away. A
+// WebSocket handshake is completed and closed with a policy violation, so
+// that browser clients, which cannot see HTTP errors, learn the reason;
+// other requests get a 404.
+func refuseNamespace(w http.ResponseWriter, r *http.Request, upgrader *websocket.Upgrader) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, unknownNamespaceReason, http.StatusNotFound)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, unknownNamespaceReason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
@@ -0,0 +1,51 @@
+package sockx
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStrictNamespacesRefuseUnregistered(t *testing.T) {
+	s := newTestServer(t, WithStrictNamespaces())
+	s.Of("/chat").On("msg", func(c *Client, data interface{}) {})
+	s.Of("/empty")
+
+	for _, name := range []string{"/", "/empty"} {
+		url := serve(t, s, name)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("dial %s: %v", name, err)
+		}
+		tc := &testConn{t: t, conn: conn}
+		t.Cleanup(func() { conn.Close() })
+		ce, n := expectClose(t, tc, EventWelcome)
+		if ce.Code != websocket.ClosePolicyViolation || ce.Text != unknownNamespaceReason || n != 0 {
+			t.Fatalf("%s closed with %d %q after %d welcomes", name, ce.Code, ce.Text, n)
+		}
+
+		res, err := http.Get("http" + strings.TrimPrefix(url, "ws"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatalf("plain request to %s got %s, want 404", name, res.Status)
+		}
+	}
+	if s.Of("/").Stats().Clients != 0 {
+		t.Fatal("refused connection added to /")
+	}
+
+	tc := dial(t, s, "/chat")
+	if e := tc.refusedConnect("/other"); e.Code != ErrCodeUnknownNamespace {
+		t.Fatalf("connect to /other refused with %+v, want %s", e, ErrCodeUnknownNamespace)
+	}
+	for _, ns := range s.namespaceList() {
+		if ns.Name() == "/other" {
+			t.Fatal("connect created /other")
+		}
+	}
+}
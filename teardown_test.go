@@ -0,0 +1,114 @@
+package sockx
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmitsFromTeardownHooks(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		drop  bool
+		hooks []string
+	}{
+		{"explicit leave", false, []string{"leave", "lifecycle-leave"}},
+		{"network drop", true, []string{"disconnect", "leave", "lifecycle-disconnect", "lifecycle-leave"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			ns := s.Of("/")
+			url := serve(t, s, "/")
+			a, b := dialURL(t, url, nil), dialURL(t, url, nil)
+			departing := ns.Client(a.welcome.ID)
+			departing.Join("r")
+			ns.Client(b.welcome.ID).Join("r")
+
+			// Every teardown hook broadcasts to the room and the namespace
+			// and emits to the departing client itself.
+			fired := make(chan string, 8)
+			direct := make(chan error, 8)
+			teardown := func(hook string, c *Client) {
+				if c != departing {
+					return
+				}
+				ns.EmitTo("r", hook+":room", nil)
+				ns.Emit(hook+":ns", nil)
+				direct <- c.Emit(hook+":direct", nil)
+				fired <- hook
+			}
+			ns.OnLeave(func(c *Client, room string, reason MembershipReason) { teardown("leave", c) })
+			ns.OnDisconnect(func(c *Client, reason DisconnectReason) { teardown("disconnect", c) })
+			ns.OnLifecycle(func(ev LifecycleEvent) {
+				switch ev.Kind {
+				case LifecycleLeave:
+					teardown("lifecycle-leave", ev.Client)
+				case LifecycleDisconnect:
+					teardown("lifecycle-disconnect", ev.Client)
+				}
+			})
+
+			if tt.drop {
+				a.conn.UnderlyingConn().Close()
+			} else if err := departing.Leave("r"); err != nil {
+				t.Fatal(err)
+			}
+			var hooks []string
+			for range tt.hooks {
+				select {
+				case h := <-fired:
+					hooks = append(hooks, h)
+				case <-time.After(testTimeout):
+					t.Fatalf("hooks fired: %v, want %v", hooks, tt.hooks)
+				}
+			}
+			sort.Strings(hooks)
+			if strings.Join(hooks, " ") != strings.Join(tt.hooks, " ") {
+				t.Fatalf("hooks fired: %v, want %v", hooks, tt.hooks)
+			}
+			for range tt.hooks {
+				err := <-direct
+				if tt.drop && !errors.Is(err, ErrClientClosed) {
+					t.Errorf("emit to the disconnecting client = %v, want ErrClientClosed", err)
+				}
+				if !tt.drop && err != nil {
+					t.Errorf("emit to the client that left a room = %v, want nil", err)
+				}
+			}
+
+			// The client that stays gets every broadcast.
+			want := make(map[string]bool)
+			for _, h := range tt.hooks {
+				want[h+":room"], want[h+":ns"] = true, true
+			}
+			for len(want) > 0 {
+				msg := b.read()
+				if strings.HasSuffix(msg.Event, ":direct") {
+					t.Fatalf("remaining client got %s", msg.Event)
+				}
+				delete(want, msg.Event)
+			}
+			if tt.drop {
+				return
+			}
+
+			// The client that left the room gets the namespace broadcasts
+			// and its own messages, but none of the room's.
+			departing.Emit("marker", nil)
+			got := make(map[string]bool)
+			for msg := a.read(); msg.Event != "marker"; msg = a.read() {
+				if strings.HasSuffix(msg.Event, ":room") {
+					t.Fatalf("client that left the room got %s", msg.Event)
+				}
+				got[msg.Event] = true
+			}
+			for _, h := range tt.hooks {
+				if !got[h+":ns"] || !got[h+":direct"] {
+					t.Errorf("client that left the room missed messages of the %s hook: got %v", h, got)
+				}
+			}
+		})
+	}
+}
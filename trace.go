@@ -0,0 +1,345 @@
+package sockx
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultMaxTracedClients is the default Config.MaxTracedClients.
+const defaultMaxTracedClients = 16
+
+// maxTraceExcerpt is how much of a text frame a trace record quotes.
+const maxTraceExcerpt = 96
+
+// ErrTraceLimit is returned by TraceClient when Config.MaxTracedClients
+// connections are traced already.
+var ErrTraceLimit = errors.New("sockx: too many traced clients")
+
+// TraceKind identifies what a TraceRecord records.
+type TraceKind int
+
+const (
+	// TraceInbound: a message was received from the client.
+	TraceInbound TraceKind = iota
+
+	// TraceEnqueue: a frame was queued for the client.
+	TraceEnqueue
+
+	// TraceDrop: frames for the client were dropped, because its send
+	// queue was full or was discarded.
+	TraceDrop
+
+	// TraceWrite: a frame was taken from the queue to be written.
+	TraceWrite
+
+	// TraceLifecycle: a lifecycle event of the client, or the start or
+	// end of its trace.
+	TraceLifecycle
+)
+
+// String returns the kind's name.
+func (k TraceKind) String() string {
+	switch k {
+	case TraceInbound:
+		return "inbound"
+	case TraceEnqueue:
+		return "enqueue"
+	case TraceDrop:
+		return "drop"
+	case TraceWrite:
+		return "write"
+	case TraceLifecycle:
+		return "lifecycle"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceRecord is one step in the life of a connection traced with
+// TraceClient. Event is the name of an inbound message or lifecycle
+// event, and Detail what else is known, such as the room, the reason or
+// the start of a frame. Bytes is the size of the message or frame, and
+// QueueLen the number of frames queued for the connection afterwards.
+type TraceRecord struct {
+	Time      time.Time
+	ClientID  string
+	Namespace string
+	Kind      TraceKind
+	Event     string
+	Detail    string
+	Bytes     int
+	QueueLen  int
+
+	// Correlation is the Correlation of the message or frame, if any.
+	Correlation string
+}
+
+// tracing holds the server's client traces.
+type tracing struct {
+	// active counts the targets, so that connections can skip looking
+	// for theirs while there are none.
+	active atomic.Int32
+
+	mu      sync.Mutex
+	targets map[string]*traceTarget  // by client or user ID
+	traced  map[*Client]*clientTrace // by connection
+}
+
+// traceTarget is a client or user ID traced until its timer fires.
+type traceTarget struct {
+	until time.Time
+	timer *time.Timer
+}
+
+// clientTrace is the trace of a connection, started for target.
+type clientTrace struct {
+	server *Server
+	client *Client
+	target string
+}
+
+// TraceClient traces the connection of the client with ID idOrUserID, or
+// those of the user with that ID, for d: every message received, frame
+// queued, dropped and written, and lifecycle event is recorded, with a
+// timestamp and the depth of the send queue, to Config.TraceSink or the
+// log. Connections that match while the trace lasts, by connecting or
+// authenticating, are traced too, across namespaces; a connection
+// multiplexed with EventConnect is traced as a whole. Calling it again
+// for the same ID restarts the trace for d from now, and a d of zero
+// ends it.
+//
+// At most Config.MaxTracedClients connections are traced at once; starting
+// a new trace returns ErrTraceLimit if that many are traced already.
+// Connections not traced pay for tracing with a single atomic load per
+// operation.
+func (s *Server) TraceClient(idOrUserID string, d time.Duration) error {
+	t := &s.traces
+	if d <= 0 {
+		t.mu.Lock()
+		if tgt := t.targets[idOrUserID]; tgt != nil {
+			s.endTraceLocked(idOrUserID, tgt)
+		}
+		t.mu.Unlock()
+		return nil
+	}
+	t.mu.Lock()
+	tgt := t.targets[idOrUserID]
+	if tgt == nil {
+		if len(t.traced) >= s.cfg().MaxTracedClients {
+			t.mu.Unlock()
+			return ErrTraceLimit
+		}
+		tgt = &traceTarget{}
+		if t.targets == nil {
+			t.targets = make(map[string]*traceTarget)
+		}
+		t.targets[idOrUserID] = tgt
+		t.active.Add(1)
+	} else {
+		tgt.timer.Stop()
+	}
+	tgt.until = time.Now().Add(d)
+	tgt.timer = time.AfterFunc(d, func() {
+		t.mu.Lock()
+		if t.targets[idOrUserID] == tgt {
+			s.endTraceLocked(idOrUserID, tgt)
+		}
+		t.mu.Unlock()
+	})
+	t.mu.Unlock()
+
+	for _, ns := range s.namespaceList() {
+		if c := ns.Client(idOrUserID); c != nil {
+			s.startTrace(c, idOrUserID)
+		}
+		for _, c := range ns.UserClients(idOrUserID) {
+			s.startTrace(c, idOrUserID)
+		}
+	}
+	return nil
+}
+
+// endTraceLocked ends the trace of target and of the connections it
+// started. s.traces.mu must be held.
+func (s *Server) endTraceLocked(target string, tgt *traceTarget) {
+	t := &s.traces
+	tgt.timer.Stop()
+	delete(t.targets, target)
+	t.active.Add(-1)
+	for c, ct := range t.traced {
+		if ct.target != target {
+			continue
+		}
+		ct.record(TraceRecord{Kind: TraceLifecycle, Event: "trace ended"})
+		c.queue.trace.Store(nil)
+		delete(t.traced, c)
+	}
+}
+
+// matchTrace starts tracing c's connection if c matches a trace target.
+// It is called when c connects and when it authenticates.
+func (s *Server) matchTrace(c *Client) {
+	if s.traces.active.Load() == 0 {
+		return
+	}
+	userID := c.UserID()
+	t := &s.traces
+	t.mu.Lock()
+	target := c.id
+	if t.targets[target] == nil {
+		target = userID
+	}
+	_, ok := t.targets[target]
+	t.mu.Unlock()
+	if ok && target != "" {
+		s.startTrace(c, target)
+	}
+}
+
+// startTrace starts tracing c's connection for target, unless it is
+// traced already or the limit of traced connections is reached.
+func (s *Server) startTrace(c *Client, target string) {
+	if c.parent != nil {
+		c = c.parent
+	}
+	t := &s.traces
+	t.mu.Lock()
+	tgt := t.targets[target]
+	if tgt == nil || t.traced[c] != nil || c.departing.Load() {
+		t.mu.Unlock()
+		return
+	}
+	if len(t.traced) >= s.cfg().MaxTracedClients {
+		t.mu.Unlock()
+		s.logf("not tracing client %s for %s: %d clients traced already", c.id, target, len(t.traced))
+		return
+	}
+	ct := &clientTrace{server: s, client: c, target: target}
+	if t.traced == nil {
+		t.traced = make(map[*Client]*clientTrace)
+	}
+	t.traced[c] = ct
+	c.queue.trace.Store(ct)
+	until := tgt.until
+	t.mu.Unlock()
+	ct.record(TraceRecord{Kind: TraceLifecycle, Event: "trace started", Detail: "for " + target + " until " + until.Format(time.RFC3339)})
+}
+
+// stopTrace frees the trace slot of c's connection once it is gone.
+// Frames still being written are recorded.
+func (s *Server) stopTrace(c *Client) {
+	t := &s.traces
+	t.mu.Lock()
+	delete(t.traced, c)
+	t.mu.Unlock()
+}
+
+// tracer returns the trace of c's connection, or nil if it is not traced.
+func (c *Client) tracer() *clientTrace {
+	return c.queue.trace.Load()
+}
+
+// record completes r and hands it to the sink, or logs it.
+func (ct *clientTrace) record(r TraceRecord) {
+	r.Time = time.Now()
+	if r.ClientID == "" {
+		r.ClientID = ct.client.id
+	}
+	if r.Namespace == "" {
+		if ns := ct.client.ns.Load(); ns != nil {
+			r.Namespace = ns.name
+		}
+	}
+	if sink := ct.server.cfg().TraceSink; sink != nil {
+		select {
+		case sink <- r:
+		default:
+		}
+		return
+	}
+	ct.server.logf("trace client %s in %s: %s %s %s (%d bytes, %d queued)",
+		r.ClientID, r.Namespace, r.Kind, r.Event, r.Detail, r.Bytes, r.QueueLen)
+}
+
+// traceInbound records a message received from the client.
+func (c *Client) traceInbound(msg Message, size int, err error) {
+	t := c.tracer()
+	if t == nil {
+		return
+	}
+	r := TraceRecord{Kind: TraceInbound, Event: msg.Event, Namespace: msg.Namespace, Bytes: size, QueueLen: c.queue.depth(), Correlation: msg.Correlation}
+	if err != nil {
+		r.Detail = "bad message: " + err.Error()
+	}
+	t.record(r)
+}
+
+// traceLifecycle records a lifecycle event of a traced client.
+func (ns *Namespace) traceLifecycle(ev LifecycleEvent) {
+	if ev.Client == nil {
+		return
+	}
+	t := ev.Client.tracer()
+	if t == nil {
+		return
+	}
+	r := TraceRecord{ClientID: ev.Client.id, Namespace: ns.name, Kind: TraceLifecycle, Event: ev.Kind.String(), QueueLen: ev.Client.queue.depth()}
+	switch ev.Kind {
+	case LifecycleJoin, LifecycleLeave:
+		r.Detail = ev.Room + ": " + ev.MembershipReason.String()
+	case LifecycleDisconnect:
+		r.Detail = ev.DisconnectReason.String()
+		if ev.Err != nil {
+			r.Detail += ": " + ev.Err.Error()
+		}
+	}
+	t.record(r)
+}
+
+// traceFrames records n frames that kind affected in the queue, which
+// holds depth frames afterwards. A single frame m is described.
+func (t *clientTrace) traceFrames(kind TraceKind, m *outbound, n, depth int, detail string) {
+	r := TraceRecord{Kind: kind, Detail: detail, QueueLen: depth}
+	switch {
+	case n > 1:
+		r.Event = strconv.Itoa(n) + " frames"
+	case m != nil:
+		r.Bytes = len(m.data)
+		r.Correlation = m.correlation
+		if detail == "" {
+			r.Detail = frameExcerpt(m)
+		}
+	}
+	t.record(r)
+}
+
+// frameExcerpt returns the start of a text frame, or names the type of
+// other frames.
+func frameExcerpt(m *outbound) string {
+	switch m.msgType {
+	case 0, websocket.TextMessage:
+		if len(m.data) > maxTraceExcerpt {
+			return string(m.data[:maxTraceExcerpt]) + "..."
+		}
+		return string(m.data)
+	case websocket.CloseMessage:
+		return "close frame"
+	default:
+		return "binary frame"
+	}
+}
+
+// WithTraceSink sets TraceSink.
+func WithTraceSink(ch chan<- TraceRecord) Option {
+	return func(c *Config) { c.TraceSink = ch }
+}
+
+// WithMaxTracedClients sets MaxTracedClients.
+func WithMaxTracedClients(n int) Option {
+	return func(c *Config) { c.MaxTracedClients = n }
+}
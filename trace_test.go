@@ -0,0 +1,102 @@
+package sockx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// traceUntil reads trace records from sink up to and including the first
+// of kind for event, and returns them.
+func traceUntil(t *testing.T, sink <-chan TraceRecord, kind TraceKind, event string) []TraceRecord {
+	t.Helper()
+	var recs []TraceRecord
+	for {
+		select {
+		case r := <-sink:
+			recs = append(recs, r)
+			if r.Kind == kind && r.Event == event {
+				return recs
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("timed out waiting for a %s %s trace record; got %+v", kind, event, recs)
+			return nil
+		}
+	}
+}
+
+func TestTraceClientRecordsConnection(t *testing.T) {
+	sink := make(chan TraceRecord, 100)
+	s := newTestServer(t, WithTraceSink(sink))
+	ns := s.Of("/")
+	ns.On("ping", func(c *Client, data interface{}) { c.Emit("pong", data) })
+	tc, other := dial(t, s, "/"), dial(t, s, "/")
+	id := tc.welcome.ID
+
+	if err := s.TraceClient(id, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	traceUntil(t, sink, TraceLifecycle, "trace started")
+	other.emit("ping", 2)
+	other.expect("pong")
+	tc.emit("ping", 1)
+	tc.expect("pong")
+	recs := traceUntil(t, sink, TraceInbound, "ping")
+	for len(recs) < 3 {
+		select {
+		case r := <-sink:
+			recs = append(recs, r)
+		case <-time.After(testTimeout):
+			t.Fatalf("got trace records %+v, want inbound, enqueue and write", recs)
+		}
+	}
+	if len(recs) != 3 || recs[1].Kind != TraceEnqueue || recs[2].Kind != TraceWrite {
+		t.Fatalf("got trace records %+v, want inbound, enqueue and write", recs)
+	}
+	for _, r := range recs {
+		if r.ClientID != id || r.Namespace != "/" || r.Time.IsZero() {
+			t.Fatalf("record %+v not attributed to %s", r, id)
+		}
+	}
+	if !strings.Contains(recs[2].Detail, `"pong"`) || recs[2].Bytes == 0 {
+		t.Fatalf("write record %+v does not describe the frame", recs[2])
+	}
+
+	if err := s.TraceClient(id, 0); err != nil {
+		t.Fatal(err)
+	}
+	traceUntil(t, sink, TraceLifecycle, "trace ended")
+	tc.emit("ping", 3)
+	tc.expect("pong")
+	if len(sink) != 0 {
+		t.Fatalf("recorded %+v after the trace ended", <-sink)
+	}
+}
+
+func TestTraceClientFollowsUserAndExpires(t *testing.T) {
+	sink := make(chan TraceRecord, 100)
+	s := newTestServer(t, WithTraceSink(sink), WithMaxTracedClients(1))
+	ns := s.Of("/")
+	if err := s.TraceClient("alice", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	tc := dial(t, s, "/")
+	if len(sink) != 0 {
+		t.Fatalf("traced an anonymous client: %+v", <-sink)
+	}
+
+	ns.Client(tc.welcome.ID).Authenticate("alice", nil)
+	r := traceUntil(t, sink, TraceLifecycle, "trace started")[0]
+	if r.ClientID != tc.welcome.ID || !strings.HasPrefix(r.Detail, "for alice until ") {
+		t.Fatalf("trace started with %+v", r)
+	}
+	if err := s.TraceClient("bob", time.Minute); !errors.Is(err, ErrTraceLimit) {
+		t.Fatalf("TraceClient beyond the limit = %v, want %v", err, ErrTraceLimit)
+	}
+
+	traceUntil(t, sink, TraceLifecycle, "trace ended")
+	if err := s.TraceClient("bob", time.Minute); err != nil {
+		t.Fatalf("TraceClient after the trace expired = %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package sockx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PayloadTransformer rewrites the data of a message for one recipient, c,
+// such as to encrypt it with the recipient's key. data is the message's
+// data encoded as JSON, or as is if it is a []byte. The result becomes the
+// data of the message c receives, as a []byte: a base64 string with
+// JSONCodec. An error skips c, counting it as dropped, and is reported to
+// the namespace's OnError hooks.
+type PayloadTransformer func(c *Client, event string, data []byte) ([]byte, error)
+
+// payloadTransform is a namespace's PayloadTransformer and the events it
+// applies to, all but protocol events if events is nil.
+type payloadTransform struct {
+	ns     *Namespace
+	fn     PayloadTransformer
+	events map[string]bool
+}
+
+// SetPayloadTransformer sets fn to transform the data of the messages
+// the namespace sends, per recipient, for the named events, or for every
+// event but sockx's own if none are named; nil removes the transformer.
+// A message it applies to is encoded anew for each of its recipients,
+// instead of once for all, so it should be limited to the events that
+// need it. Messages recorded in a room's history are transformed as they
+// are replayed, for the resuming client.
+func (ns *Namespace) SetPayloadTransformer(fn PayloadTransformer, events ...string) {
+	if fn == nil {
+		ns.transform.Store(nil)
+		return
+	}
+	t := &payloadTransform{ns: ns, fn: fn}
+	if len(events) > 0 {
+		t.events = make(map[string]bool, len(events))
+		for _, event := range events {
+			t.events[event] = true
+		}
+	}
+	ns.transform.Store(t)
+}
+
+// transformFor returns the transformer that applies to event, if any.
+func (ns *Namespace) transformFor(event string) *payloadTransform {
+	t := ns.transform.Load()
+	if t == nil {
+		return nil
+	}
+	if t.events == nil && strings.HasPrefix(event, reservedPrefix) || t.events != nil && !t.events[event] {
+		return nil
+	}
+	return t
+}
+
+// transformed returns the frame of p's message, or of its given Localized
+// variant if not -1, with the data transformed for c. It returns nil if
+// the transformer failed. m is the shared frame it stands in for.
+func (p *payload) transformed(c *Client, m *outbound, variant int) *outbound {
+	msg := p.msg
+	if variant >= 0 {
+		msg = p.localized.msgs[variant]
+	}
+	data, err := p.plainData(msg, variant)
+	if err == nil {
+		data, err = p.transform.fn(c, msg.Event, data)
+	}
+	var r *outbound
+	if err == nil {
+		msg.Data = data
+		msg.Namespace = c.muxNamespace()
+		r, err = encodeMessage(c.codec, msg)
+	}
+	if err != nil {
+		err = fmt.Errorf("sockx: transforming %q for client %s: %w", msg.Event, c.id, err)
+		p.transform.ns.reportError(c, msg.Event, err)
+		return nil
+	}
+	r.key = m.key
+	return r
+}
+
+// plainData returns the data of msg, the message of the given variant of
+// p, as a transformer is given it, encoding it once.
+func (p *payload) plainData(msg Message, variant int) ([]byte, error) {
+	if b, ok := msg.Data.([]byte); ok {
+		return b, nil
+	}
+	p.recodedMu.Lock()
+	defer p.recodedMu.Unlock()
+	if b, ok := p.plain[variant]; ok {
+		return b, nil
+	}
+	b, err := json.Marshal(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	if p.plain == nil {
+		p.plain = make(map[int][]byte)
+	}
+	p.plain[variant] = b
+	return b, nil
+}
@@ -0,0 +1,39 @@
+package sockx
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDecodeData is reported to the OnError hooks when the data of an event
+// cannot be decoded into the type its OnTyped handler takes.
+var ErrDecodeData = errors.New("sockx: cannot decode event data")
+
+// OnTyped registers handler for event in ns, like On, with the event's
+// data decoded into a T as encoding/json would decode it, for example:
+//
+//	type Move struct {
+//		Piece string `json:"piece"`
+//		To    struct{ X, Y int } `json:"to"`
+//	}
+//	sockx.OnTyped(ns, "move", func(c *sockx.Client, m Move) { ... })
+//
+// T may be a struct, a pointer, a slice or any other type JSON decodes
+// into; data that is absent or null leaves it the zero value. With
+// JSONCodec the data is decoded straight from the received frame; with
+// other codecs it is converted from the codec's decoding through JSON.
+//
+// Data that does not decode into a T does not reach handler. The error,
+// wrapping ErrDecodeData, is reported to the OnError hooks and, if
+// SendHandlerErrors is set, sent to the client with ErrCodeBadMessage.
+func OnTyped[T any](ns *Namespace, event string, handler func(*Client, T), opts ...HandlerOption) *Subscription {
+	return ns.OnEvent(event, func(ev *Event) {
+		var v T
+		if err := ev.Bind(&v); err != nil {
+			ev.client.Namespace().handlerError(ev.client, ev.msg.Event,
+				fmt.Errorf("%w: %w", ErrDecodeData, &ErrorData{Code: ErrCodeBadMessage, Message: err.Error()}))
+			return
+		}
+		handler(ev.client, v)
+	}, opts...)
+}
@@ -0,0 +1,98 @@
+package sockx
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type move struct {
+	Piece string `json:"piece"`
+	To    struct {
+		X, Y int
+	} `json:"to"`
+	Tags []string          `json:"tags"`
+	Meta map[string]string `json:"meta"`
+}
+
+// receive returns the next value sent on ch.
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(testTimeout):
+		t.Fatal("handler not called")
+		panic("unreachable")
+	}
+}
+
+func TestOnTypedDecodesData(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	moves := make(chan move, 1)
+	ptrs := make(chan *move, 2)
+	slices := make(chan []int, 1)
+	OnTyped(ns, "move", func(c *Client, m move) { moves <- m })
+	OnTyped(ns, "ptr", func(c *Client, m *move) { ptrs <- m })
+	OnTyped(ns, "slice", func(c *Client, v []int) { slices <- v })
+	tc := dial(t, s, "/")
+
+	data := map[string]interface{}{
+		"piece": "knight",
+		"to":    map[string]int{"X": 3, "Y": 5},
+		"tags":  []string{"check"},
+		"meta":  map[string]string{"by": "alice"},
+	}
+	want := move{Piece: "knight", Tags: []string{"check"}, Meta: map[string]string{"by": "alice"}}
+	want.To.X, want.To.Y = 3, 5
+
+	tc.emit("move", data)
+	if got := receive(t, moves); !reflect.DeepEqual(got, want) {
+		t.Fatalf("move = %+v, want %+v", got, want)
+	}
+	tc.emit("ptr", data)
+	if got := receive(t, ptrs); got == nil || !reflect.DeepEqual(*got, want) {
+		t.Fatalf("ptr = %+v, want %+v", got, want)
+	}
+	tc.emit("ptr", nil)
+	if got := receive(t, ptrs); got != nil {
+		t.Fatalf("ptr for null data = %+v, want nil", got)
+	}
+	tc.emit("slice", []int{1, 2, 3})
+	if got := receive(t, slices); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("slice = %v", got)
+	}
+}
+
+func TestOnTypedDecodeFailure(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.SendHandlerErrors()
+	errs := make(chan error, 1)
+	ns.OnError(func(c *Client, event string, err error) { errs <- err })
+	called := make(chan move, 1)
+	OnTyped(ns, "move", func(c *Client, m move) { called <- m })
+	tc := dial(t, s, "/")
+
+	tc.emit("move", map[string]interface{}{"piece": 42})
+	if err := receive(t, errs); !errors.Is(err, ErrDecodeData) {
+		t.Fatalf("error = %v, want ErrDecodeData", err)
+	}
+	var e ErrorData
+	if err := tc.expect(EventError).Bind(&e); err != nil || e.Code != ErrCodeBadMessage || e.Event != "move" {
+		t.Fatalf("error sent = %+v, %v; want %s for move", e, err, ErrCodeBadMessage)
+	}
+	select {
+	case m := <-called:
+		t.Fatalf("handler called with %+v", m)
+	default:
+	}
+
+	// The connection is still usable.
+	tc.emit("move", map[string]interface{}{"piece": "rook"})
+	if m := receive(t, called); m.Piece != "rook" {
+		t.Fatalf("move = %+v", m)
+	}
+}
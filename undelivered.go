@@ -0,0 +1,59 @@
+package sockx
+
+// UndeliveredReason says why a room emit reached nobody.
+type UndeliveredReason int
+
+const (
+	// UndeliveredNoRecipients means the room was empty or did not exist.
+	UndeliveredNoRecipients UndeliveredReason = iota + 1
+
+	// UndeliveredDropped means every member's send queue rejected the
+	// message, because it was full or the member was disconnecting.
+	UndeliveredDropped
+)
+
+func (r UndeliveredReason) String() string {
+	switch r {
+	case UndeliveredNoRecipients:
+		return "no recipients"
+	case UndeliveredDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// UndeliveredHandler receives room messages that reached no client.
+type UndeliveredHandler func(room string, msg Message, reason UndeliveredReason)
+
+// OnUndelivered registers h to be called whenever a room emit in this
+// namespace is queued for zero clients, so the application can persist the
+// message or deliver it some other way. h runs synchronously on the
+// emitting goroutine (or the fan-out goroutine for EmitAsync) and should
+// not block. Emits cancelled through EmitHandle.Cancel are not reported.
+func (ns *Namespace) OnUndelivered(h UndeliveredHandler) {
+	ns.mu.Lock()
+	ns.undelivered = append(ns.undelivered, h)
+	ns.mu.Unlock()
+}
+
+// reportUndelivered calls the undelivered hooks if msg was a room emit that
+// reached nobody.
+func (ns *Namespace) reportUndelivered(msg Message, res EmitResult) {
+	if msg.Room == "" || res.Delivered > 0 {
+		return
+	}
+	ns.mu.RLock()
+	hooks := ns.undelivered
+	ns.mu.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+	reason := UndeliveredNoRecipients
+	if res.Dropped > 0 {
+		reason = UndeliveredDropped
+	}
+	for _, h := range hooks {
+		h(msg.Room, msg, reason)
+	}
+}
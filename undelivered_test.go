@@ -0,0 +1,73 @@
+package sockx
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// undeliveredLog records a namespace's undelivered room messages.
+type undeliveredLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *undeliveredLog) watch(ns *Namespace) {
+	ns.OnUndelivered(func(room string, msg Message, reason UndeliveredReason) {
+		l.mu.Lock()
+		l.entries = append(l.entries, fmt.Sprintf("%s %s %v: %s", room, msg.Event, msg.Data, reason))
+		l.mu.Unlock()
+	})
+}
+
+func (l *undeliveredLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprint(l.entries)
+}
+
+func TestOnUndeliveredReportsEmptyRooms(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	var log undeliveredLog
+	log.watch(ns)
+	tc := dial(t, s, "/")
+	ns.Client(tc.welcome.ID).Join("r")
+
+	ns.EmitTo("r", "news", "delivered")
+	tc.expect("news")
+	ns.Emit("news", "roomless")
+	tc.expect("news")
+	ns.EmitTo("nobody", "news", "lost")
+
+	if got, want := log.String(), "[nobody news lost: no recipients]"; got != want {
+		t.Fatalf("undelivered = %s, want %s", got, want)
+	}
+}
+
+func TestOnUndeliveredReportsDroppedMessages(t *testing.T) {
+	s := newTestServer(t, WithSendQueueSize(4))
+	ns := s.Of("/")
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	c := NewDetachedClient(ns, DetachedOutbox(func(f []byte) { <-release }))
+	c.Join("r")
+	var log undeliveredLog
+	log.watch(ns)
+
+	for i := 0; ; i++ {
+		if i > 100 {
+			t.Fatal("the congested member never dropped a message")
+		}
+		res, err := ns.EmitTo("r", "tick", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Dropped > 0 {
+			if got, want := log.String(), fmt.Sprintf("[r tick %d: dropped]", i); got != want {
+				t.Fatalf("undelivered = %s, want %s", got, want)
+			}
+			return
+		}
+	}
+}
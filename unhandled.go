@@ -0,0 +1,65 @@
+package sockx
+
+import "time"
+
+// Replayed wraps the data of an event that arrived before any handler was
+// registered for it and was delivered later by BufferUnhandled. Handlers
+// registered with On receive it in place of the original data; those
+// registered with OnEvent see Event.Replayed instead.
+type Replayed struct {
+	Data       interface{}
+	ReceivedAt time.Time
+}
+
+// BufferUnhandled keeps the last n events that arrive without a registered
+// handler and replays them, flagged as replayed, when a handler for their
+// event is later registered with On or OnEvent. They are dispatched like
+// live events, on the worker pool if the server has one. Passing 0
+// disables buffering and discards anything buffered.
+//
+// This is a development aid for hot-reloaded handler registration and is
+// not meant for production: replayed events may run after newer events for
+// the same name, and their clients may have disconnected in the meantime.
+func (ns *Namespace) BufferUnhandled(n int) {
+	if n < 0 {
+		n = 0
+	}
+	ns.mu.Lock()
+	ns.unhandledMax = n
+	if len(ns.unhandled) > n {
+		ns.unhandled = append([]*Event(nil), ns.unhandled[len(ns.unhandled)-n:]...)
+	}
+	ns.mu.Unlock()
+}
+
+// bufferUnhandledLocked records an event that found no handler. ns.mu must
+// be held for writing.
+func (ns *Namespace) bufferUnhandledLocked(ev *Event) {
+	if ns.unhandledMax == 0 {
+		return
+	}
+	if len(ns.unhandled) == ns.unhandledMax {
+		copy(ns.unhandled, ns.unhandled[1:])
+		ns.unhandled = ns.unhandled[:len(ns.unhandled)-1]
+	}
+	ns.unhandled = append(ns.unhandled, ev)
+}
+
+// takeUnhandledLocked removes and returns the buffered events whose name
+// handled accepts, oldest first. ns.mu must be held for writing.
+func (ns *Namespace) takeUnhandledLocked(handled func(event string) bool) []*Event {
+	var taken []*Event
+	kept := ns.unhandled[:0]
+	for _, ev := range ns.unhandled {
+		if handled(ev.msg.Event) {
+			taken = append(taken, ev)
+		} else {
+			kept = append(kept, ev)
+		}
+	}
+	for i := len(kept); i < len(ns.unhandled); i++ {
+		ns.unhandled[i] = nil
+	}
+	ns.unhandled = kept
+	return taken
+}
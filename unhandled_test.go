@@ -0,0 +1,119 @@
+package sockx
+
+import (
+	"fmt"
+	"testing"
+)
+
+// awaitUnhandled waits until ns has buffered n unhandled events.
+func awaitUnhandled(t *testing.T, ns *Namespace, n int) {
+	t.Helper()
+	waitFor(t, fmt.Sprintf("%d events buffered", n), func() bool {
+		ns.mu.RLock()
+		defer ns.mu.RUnlock()
+		return len(ns.unhandled) == n
+	})
+}
+
+func TestLateHandlerReceivesBufferedEventsInOrder(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.BufferUnhandled(8)
+	tc := dial(t, s, "/")
+	tc.emit("a", 1)
+	tc.emit("b", "other")
+	tc.emit("a", 2)
+	tc.emit("a", 3)
+	awaitUnhandled(t, ns, 4)
+
+	var got []interface{}
+	ns.On("a", func(c *Client, data interface{}) {
+		r, ok := data.(Replayed)
+		if !ok {
+			t.Fatalf("replayed event data is %T, want Replayed", data)
+		}
+		if r.ReceivedAt.IsZero() {
+			t.Error("replayed event has no receive time")
+		}
+		got = append(got, r.Data)
+	})
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Fatalf("replayed %v, want [1 2 3]", got)
+	}
+	// Events of other names stay buffered for their own handlers.
+	awaitUnhandled(t, ns, 1)
+}
+
+func TestReplayedEventsRunLikeLiveEvents(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			s := newTestServer(t, WithHandlerWorkers(workers))
+			ns := s.Of("/")
+			ns.BufferUnhandled(8)
+			tc := dial(t, s, "/")
+			tc.emit("boom", nil)
+			awaitUnhandled(t, ns, 1)
+
+			// The panic is recovered, not raised in the registering
+			// goroutine.
+			ns.On("boom", func(c *Client, data interface{}) { panic("replayed") })
+			waitFor(t, "the replayed handler run", func() bool {
+				st := ns.Stats()
+				return st.HandlerFailures == 1 && st.HandlerTime.Count == 1
+			})
+			ns.On("ping", func(c *Client, data interface{}) { c.Emit("pong", nil) })
+			tc.emit("ping", nil)
+			tc.expect("pong")
+		})
+	}
+}
+
+func TestLiveEventsAreNotFlaggedAsReplayed(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.BufferUnhandled(8)
+	flags := make(chan bool, 1)
+	ns.OnEvent("a", func(ev *Event) { flags <- ev.Replayed() })
+	tc := dial(t, s, "/")
+	tc.emit("a", nil)
+	if <-flags {
+		t.Fatal("event with a registered handler flagged as replayed")
+	}
+}
+
+func TestBufferUnhandledKeepsTheLatestEvents(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	ns.BufferUnhandled(2)
+	tc := dial(t, s, "/")
+	for i := 1; i <= 3; i++ {
+		tc.emit("a", i)
+	}
+	// The third event evicts the first.
+	waitFor(t, "third event buffered", func() bool {
+		ns.mu.RLock()
+		defer ns.mu.RUnlock()
+		return len(ns.unhandled) == 2 && ns.unhandled[1].Data() == 3.0
+	})
+	var got []interface{}
+	ns.OnEvent("a", func(ev *Event) { got = append(got, ev.Data()) })
+	if fmt.Sprint(got) != "[2 3]" {
+		t.Fatalf("replayed %v, want the latest two", got)
+	}
+}
+
+func TestUnhandledEventsAreDiscardedByDefault(t *testing.T) {
+	s := newTestServer(t)
+	ns := s.Of("/")
+	tc := dial(t, s, "/")
+	tc.emit("a", 1)
+	tc.emit("sync", nil)
+	synced := make(chan struct{})
+	ns.On("sync", func(c *Client, data interface{}) { close(synced) })
+	tc.emit("sync", nil)
+	<-synced
+
+	ns.On("a", func(c *Client, data interface{}) {
+		t.Fatalf("event replayed without BufferUnhandled: %v", data)
+	})
+}
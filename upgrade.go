@@ -0,0 +1,80 @@
+package sockx
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// UpgradePolicy governs the WebSocket handshakes of a namespace's
+// connections. A namespace without one uses the server's handshake, which
+// accepts every origin unless Config.CheckOrigin says otherwise.
+type UpgradePolicy struct {
+	// CheckOrigin accepts or rejects a handshake by its request. Nil
+	// accepts only requests without an Origin header or whose Origin host
+	// matches the Host header.
+	CheckOrigin func(r *http.Request) bool
+
+	// RequireClientCert rejects handshakes not made over TLS with a
+	// client certificate verified by the http.Server's tls.Config, which
+	// must request one with ClientAuth.
+	RequireClientCert bool
+
+	// Subprotocols are the supported subprotocols in order of preference.
+	// The first one the client also offers is selected; a client offering
+	// none of them connects without a subprotocol.
+	Subprotocols []string
+
+	// HandshakeTimeout bounds the handshake. Zero means no limit.
+	HandshakeTimeout time.Duration
+
+	// EnableCompression negotiates per-message compression with clients
+	// that support it.
+	EnableCompression bool
+}
+
+// upgradePolicy is an UpgradePolicy prepared for use.
+type upgradePolicy struct {
+	upgrader          websocket.Upgrader
+	requireClientCert bool
+}
+
+// SetUpgradePolicy replaces the handshake used for the namespace's
+// connections with p. The policy is complete on its own: fields left zero
+// take the defaults documented on UpgradePolicy, not the server's
+// settings, so a namespace with a policy never accepts an origin only
+// because the server would. It applies to handshakes that start after the
+// call; for a namespace created by OfSetup, setting it during setup covers
+// every connection.
+func (ns *Namespace) SetUpgradePolicy(p UpgradePolicy) {
+	ns.upgradePolicy.Store(&upgradePolicy{
+		upgrader: websocket.Upgrader{
+			CheckOrigin:       p.CheckOrigin,
+			Subprotocols:      append([]string(nil), p.Subprotocols...),
+			HandshakeTimeout:  p.HandshakeTimeout,
+			EnableCompression: p.EnableCompression,
+		},
+		requireClientCert: p.RequireClientCert,
+	})
+}
+
+// upgrade completes the handshake of a connection to ns under its policy.
+// On failure the client has been answered and nil is returned.
+func (s *Server) upgrade(ns *Namespace, w http.ResponseWriter, r *http.Request) *websocket.Conn {
+	upgrader := &s.upgrader
+	if p := ns.upgradePolicy.Load(); p != nil {
+		if p.requireClientCert && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			http.Error(w, "client certificate required", http.StatusForbidden)
+			return nil
+		}
+		upgrader = &p.upgrader
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client.
+		s.logf("upgrade failed: %v", err)
+		return nil
+	}
+	return conn
+}
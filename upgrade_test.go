@@ -0,0 +1,84 @@
+package sockx
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// handshake dials url with header and returns the response status, or
+// 101 and the connection's subprotocol on success.
+func handshake(t *testing.T, url string, header http.Header, subprotocols ...string) (int, string) {
+	t.Helper()
+	d := websocket.Dialer{Subprotocols: subprotocols}
+	conn, resp, err := d.Dial(url, header)
+	if err != nil {
+		if resp == nil {
+			t.Fatalf("dial %s: %v", url, err)
+		}
+		return resp.StatusCode, ""
+	}
+	defer conn.Close()
+	return resp.StatusCode, conn.Subprotocol()
+}
+
+func TestNamespaceUpgradePolicyDoesNotFallBackToServer(t *testing.T) {
+	s := newTestServer(t)
+	s.Of("/strict").SetUpgradePolicy(UpgradePolicy{})
+	open, strict := serve(t, s, "/open"), serve(t, s, "/strict")
+	evil := http.Header{"Origin": {"http://evil.example"}}
+
+	if code, _ := handshake(t, open, evil); code != http.StatusSwitchingProtocols {
+		t.Fatalf("cross-origin handshake to the permissive namespace: %d, want 101", code)
+	}
+	if code, _ := handshake(t, strict, evil); code != http.StatusForbidden {
+		t.Fatalf("cross-origin handshake to the strict namespace: %d, want 403", code)
+	}
+	if code, _ := handshake(t, strict, nil); code != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake without Origin to the strict namespace: %d, want 101", code)
+	}
+}
+
+func TestNamespaceUpgradePolicyOriginCheck(t *testing.T) {
+	s := newTestServer(t)
+	s.SetAllowedOrigins([]string{"app.example"})
+	s.Of("/partners").SetUpgradePolicy(UpgradePolicy{
+		CheckOrigin: func(r *http.Request) bool { return r.Header.Get("Origin") == "https://partner.example" },
+	})
+	app, partners := serve(t, s, "/"), serve(t, s, "/partners")
+	fromApp := http.Header{"Origin": {"https://app.example"}}
+	fromPartner := http.Header{"Origin": {"https://partner.example"}}
+
+	for _, tt := range []struct {
+		name   string
+		url    string
+		header http.Header
+		want   int
+	}{
+		{"app page to server namespace", app, fromApp, http.StatusSwitchingProtocols},
+		{"partner page to server namespace", app, fromPartner, http.StatusForbidden},
+		{"partner page to partner namespace", partners, fromPartner, http.StatusSwitchingProtocols},
+		{"app page to partner namespace", partners, fromApp, http.StatusForbidden},
+	} {
+		if code, _ := handshake(t, tt.url, tt.header); code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestNamespaceUpgradePolicySubprotocolsAndClientCerts(t *testing.T) {
+	s := newTestServer(t)
+	s.Of("/v").SetUpgradePolicy(UpgradePolicy{Subprotocols: []string{"v2", "v1"}})
+	s.Of("/mtls").SetUpgradePolicy(UpgradePolicy{RequireClientCert: true})
+
+	if _, proto := handshake(t, serve(t, s, "/v"), nil, "v1", "v2"); proto != "v2" {
+		t.Fatalf("subprotocol = %q, want the policy's preferred v2", proto)
+	}
+	if _, proto := handshake(t, serve(t, s, "/v"), nil, "v3"); proto != "" {
+		t.Fatalf("subprotocol = %q for a client offering none, want none", proto)
+	}
+	if code, _ := handshake(t, serve(t, s, "/mtls"), nil); code != http.StatusForbidden {
+		t.Fatalf("handshake without a client certificate: %d, want 403", code)
+	}
+}
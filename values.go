@@ -0,0 +1,39 @@
+package sockx
+
+// Set stores value under key on the client, for later handlers, hooks and
+// emit filters to read with Get, such as the role or tenant connection
+// middleware authenticated the client as. Values last as long as the
+// client and are safe to set and read from any goroutine. Each client of
+// a connection multiplexed with EventConnect has its own values.
+func (c *Client) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]interface{})
+	}
+	c.values[key] = value
+}
+
+// Get returns the value stored under key, and whether there is one.
+func (c *Client) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// MustGet returns the value stored under key, and panics if there is none.
+func (c *Client) MustGet(key string) interface{} {
+	v, ok := c.Get(key)
+	if !ok {
+		panic("sockx: client " + c.id + " has no value " + key)
+	}
+	return v
+}
+
+// Delete removes the value stored under key, if any.
+func (c *Client) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+}
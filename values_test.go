@@ -0,0 +1,51 @@
+package sockx
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientValues(t *testing.T) {
+	s := newTestServer(t)
+	for _, name := range []string{"/", "/b"} {
+		name := name
+		s.Of(name).Use(func(c *Client, r *http.Request) error {
+			c.Set("tenant", name)
+			return nil
+		})
+		s.Of(name).On("tenant", func(c *Client, data interface{}) {
+			c.Emit("tenant", c.MustGet("tenant"))
+		})
+	}
+	tc := dial(t, s, "/")
+	tc.connectNamespace("/b")
+
+	// Each client of a multiplexed connection has its own values.
+	for _, name := range []string{"/", "/b"} {
+		tc.send(Message{Namespace: name, Event: "tenant"})
+		var got string
+		if err := tc.expect("tenant").Bind(&got); err != nil || got != name {
+			t.Fatalf("tenant = %q (%v), want %q", got, err, name)
+		}
+	}
+
+	c := tc.client(s.Of("/"))
+	c.Set("tenant", "acme")
+	if v, ok := c.Get("tenant"); !ok || v != "acme" {
+		t.Fatalf("Get = %v %v, want acme", v, ok)
+	}
+	c.Delete("tenant")
+	c.Delete("tenant")
+	if v, ok := c.Get("tenant"); ok {
+		t.Fatalf("deleted value still there: %v", v)
+	}
+	func() {
+		defer func() {
+			want := "sockx: client " + c.ID() + " has no value tenant"
+			if r := recover(); r != want {
+				t.Fatalf("MustGet panicked with %v, want %q", r, want)
+			}
+		}()
+		c.MustGet("tenant")
+	}()
+}
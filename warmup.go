@@ -0,0 +1,147 @@
+package sockx
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultWarmUpJitter is the default spread of the retry advice given to
+// connections turned away during warm-up.
+const defaultWarmUpJitter = 5 * time.Second
+
+// WarmUpPolicy limits the rate at which a freshly started server accepts
+// connections, so that the reconnect storm after a deploy does not run
+// every OnConnect handler, sync and join at once. Connections beyond the
+// rate are refused with 503 Service Unavailable and a Retry-After spread
+// at random over Jitter, so the refused clients do not come back together.
+type WarmUpPolicy struct {
+	// Duration is how long the warm-up lasts, from the first connection
+	// attempt. Zero lasts until EndWarmUp is called.
+	Duration time.Duration
+
+	// Rate is how many connections per second are accepted during the
+	// warm-up, with bursts of up to Burst. A zero Rate disables the
+	// warm-up.
+	Rate  float64
+	Burst int
+
+	// Jitter is the most that is added at random to the retry advice of a
+	// refused connection. Defaults to 5s.
+	Jitter time.Duration
+}
+
+// WithWarmUp sets WarmUp.
+func WithWarmUp(p WarmUpPolicy) Option {
+	return func(c *Config) { c.WarmUp = p }
+}
+
+// WarmUpStatus describes the progress of the server's warm-up.
+type WarmUpStatus struct {
+	// Configured reports whether the server has a warm-up policy, and
+	// Active whether connections are still being limited by it.
+	Configured bool
+	Active     bool
+
+	// Started is when the warm-up began, at the first connection attempt;
+	// it is zero until then. Elapsed is how long it has been going on, and
+	// Remaining how long it has left, zero if it lasts until EndWarmUp.
+	Started   time.Time
+	Elapsed   time.Duration
+	Remaining time.Duration
+
+	// Accepted and Rejected count the connections let through and turned
+	// away while it was active.
+	Accepted int64
+	Rejected int64
+}
+
+// warmUp tracks the server's warm-up.
+type warmUp struct {
+	limiter *TokenBucketLimiter
+	once    sync.Once
+	started atomic.Int64 // UnixNano, zero until the first attempt
+	ended   atomic.Bool
+
+	accepted atomic.Int64
+	rejected atomic.Int64
+}
+
+// EndWarmUp ends the server's warm-up, if it has one, so that connections
+// are no longer limited by it; for example once the downstream services
+// report that they keep up. Calling it again has no effect.
+func (s *Server) EndWarmUp() {
+	s.endWarmUp("ended")
+}
+
+func (s *Server) endWarmUp(how string) {
+	w := &s.warmUp
+	if w.limiter == nil || !w.ended.CompareAndSwap(false, true) {
+		return
+	}
+	s.logf("warm-up %s after %d connections accepted, %d refused", how, w.accepted.Load(), w.rejected.Load())
+}
+
+// admitWarmUp reports whether a connection attempt may proceed under the
+// warm-up policy and, if not, the retry advice to give it.
+func (s *Server) admitWarmUp() (bool, time.Duration) {
+	w := &s.warmUp
+	if w.limiter == nil || w.ended.Load() {
+		return true, 0
+	}
+	p := s.cfg().WarmUp
+	w.once.Do(func() { w.started.Store(time.Now().UnixNano()) })
+	if p.Duration > 0 && time.Since(time.Unix(0, w.started.Load())) >= p.Duration {
+		s.endWarmUp("over")
+		return true, 0
+	}
+	ok, wait, _ := w.limiter.Allow("warmup", 1)
+	if ok {
+		w.accepted.Add(1)
+		return true, 0
+	}
+	w.rejected.Add(1)
+	jitter := p.Jitter
+	if jitter <= 0 {
+		jitter = defaultWarmUpJitter
+	}
+	return false, wait + time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// refuseWarmUp turns a connection away during the warm-up. The retry
+// advice is not escalated per IP like other rejections: its jitter is what
+// spreads the retries, and clients behind one NAT would all be advised the
+// maximum.
+func refuseWarmUp(w http.ResponseWriter, retry time.Duration) {
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retry.Seconds())), 10))
+	http.Error(w, "server warming up", http.StatusServiceUnavailable)
+}
+
+// WarmUpStatus returns the progress of the server's warm-up.
+func (s *Server) WarmUpStatus() WarmUpStatus {
+	w := &s.warmUp
+	if w.limiter == nil {
+		return WarmUpStatus{}
+	}
+	p := s.cfg().WarmUp
+	st := WarmUpStatus{
+		Configured: true,
+		Active:     !w.ended.Load(),
+		Accepted:   w.accepted.Load(),
+		Rejected:   w.rejected.Load(),
+	}
+	if at := w.started.Load(); at != 0 {
+		st.Started = time.Unix(0, at)
+		st.Elapsed = time.Since(st.Started)
+	}
+	if p.Duration > 0 && st.Active {
+		if st.Remaining = p.Duration - st.Elapsed; st.Remaining <= 0 {
+			st.Active, st.Remaining = false, 0
+		}
+	}
+	return st
+}
@@ -0,0 +1,130 @@
+package sockx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// healthStatus fetches s's health report.
+func healthStatus(t *testing.T, s *Server) healthReport {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.HealthHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	var out healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestWarmUpSmoothsReconnectStorm(t *testing.T) {
+	const clients, rate, burst = 40, 50, 5
+	s := newTestServer(t, WithWarmUp(WarmUpPolicy{Rate: rate, Burst: burst, Jitter: time.Second}))
+	url := serve(t, s, "/")
+
+	var mu sync.Mutex
+	var accepted []time.Duration
+	var retries []int
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Since(start) < testTimeout {
+				conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+				if err == nil {
+					mu.Lock()
+					accepted = append(accepted, time.Since(start))
+					mu.Unlock()
+					t.Cleanup(func() { conn.Close() })
+					return
+				}
+				if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+					t.Errorf("refused with %v, want 503", err)
+					return
+				}
+				retry, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+				mu.Lock()
+				retries = append(retries, retry)
+				mu.Unlock()
+				// Retry far sooner than advised, as a storm would.
+				time.Sleep(5 * time.Millisecond)
+			}
+			t.Error("client never connected")
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	// Connections are let in at the configured rate, not all at once.
+	for i, at := range accepted {
+		if limit := burst + rate*at.Seconds() + 2; float64(i+1) > limit {
+			t.Fatalf("%d connections accepted after %v, want at most %.0f", i+1, at, limit)
+		}
+	}
+	for _, r := range retries {
+		if r < 1 || r > 2 {
+			t.Fatalf("Retry-After %d, want the wait plus at most 1s of jitter", r)
+		}
+	}
+	st := s.WarmUpStatus()
+	if !st.Active || st.Accepted != clients || st.Rejected != int64(len(retries)) {
+		t.Fatalf("status = %+v, want active with %d accepted and %d rejected", st, clients, len(retries))
+	}
+	health := healthStatus(t, s)
+	if health.Status != "warming_up" || health.WarmUp == nil || health.WarmUp.Accepted != clients {
+		t.Fatalf("health = %+v, want warming_up with the counts", health)
+	}
+
+	s.EndWarmUp()
+	for i := 0; i < 2*burst; i++ {
+		dialURL(t, url, nil)
+	}
+	if st := s.WarmUpStatus(); st.Active || st.Accepted != clients {
+		t.Fatalf("status after EndWarmUp = %+v", st)
+	}
+	if health := healthStatus(t, s); health.Status != "ok" || health.WarmUp.Active {
+		t.Fatalf("health after EndWarmUp = %+v", health)
+	}
+}
+
+func TestWarmUpEndsAfterDuration(t *testing.T) {
+	s := newTestServer(t, WithWarmUp(WarmUpPolicy{Duration: 200 * time.Millisecond, Rate: 1, Burst: 1}))
+	if st := s.WarmUpStatus(); !st.Configured || !st.Started.IsZero() {
+		t.Fatalf("status before any connection = %+v", st)
+	}
+	url := serve(t, s, "/")
+	dialURL(t, url, nil)
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second connection = %v, want 503", err)
+	}
+	if st := s.WarmUpStatus(); !st.Active || st.Remaining <= 0 || st.Remaining > 200*time.Millisecond {
+		t.Fatalf("status during the warm-up = %+v", st)
+	}
+	time.Sleep(200 * time.Millisecond)
+	dialURL(t, url, nil)
+	dialURL(t, url, nil)
+	if st := s.WarmUpStatus(); st.Active || st.Remaining != 0 {
+		t.Fatalf("status after the warm-up = %+v", st)
+	}
+}
+
+func TestNoWarmUpByDefault(t *testing.T) {
+	s := newTestServer(t)
+	if st := s.WarmUpStatus(); st.Configured {
+		t.Fatalf("status = %+v, want none", st)
+	}
+	if health := healthStatus(t, s); health.Status != "ok" || health.WarmUp != nil {
+		t.Fatalf("health = %+v", health)
+	}
+}
@@ -0,0 +1,67 @@
+package sockx
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// stalledWriteSlack is how far past WriteTimeout a single write may run
+// before the watchdog gives up on it. Writes normally fail at their
+// deadline; one that outlives it by this much is stuck in the transport.
+const stalledWriteSlack = 5 * time.Second
+
+// watchdog periodically disconnects clients whose writer makes no
+// progress. It runs until the server is closed.
+func (s *Server) watchdog() {
+	interval := s.cfg().StallTimeout / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		var now time.Time
+		select {
+		case now = <-t.C:
+		case <-s.done:
+			return
+		}
+		namespaces := s.namespaceList()
+
+		for _, ns := range namespaces {
+			for _, c := range ns.snapshotClients() {
+				if c.stalled(now) {
+					c.kill(ReasonStalled)
+				}
+			}
+		}
+	}
+}
+
+// stalled reports whether c's writer has made no progress for too long.
+func (c *Client) stalled(now time.Time) bool {
+	cfg := c.server.cfg()
+	if cfg.StallTimeout <= 0 {
+		return false
+	}
+	if start := atomic.LoadInt64(&c.writeStart); start != 0 {
+		if now.Sub(time.Unix(0, start)) > cfg.WriteTimeout+stalledWriteSlack {
+			return true
+		}
+	}
+	since := c.queue.stalledSince()
+	return !since.IsZero() && now.Sub(since) > cfg.StallTimeout
+}
+
+// kill detaches c and closes its connection without waiting for queued
+// frames, unblocking a writer stuck in the transport.
+func (c *Client) kill(reason DisconnectReason) {
+	ns := c.Namespace()
+	if c.teardown(reason, nil, nil) {
+		atomic.AddInt64(&ns.stalled, 1)
+		c.server.logf("disconnected client %s (%s) in %s: %v", c.id, c.realIP, ns.name, reason)
+	}
+	if !c.detached() {
+		c.conn.Close()
+	}
+}
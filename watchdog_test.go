@@ -0,0 +1,67 @@
+package sockx
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// disconnects returns a channel receiving the reasons ns's clients
+// disconnect for.
+func disconnects(ns *Namespace) <-chan DisconnectReason {
+	reasons := make(chan DisconnectReason, 16)
+	ns.OnLifecycle(func(ev LifecycleEvent) {
+		if ev.Kind == LifecycleDisconnect {
+			reasons <- ev.DisconnectReason
+		}
+	})
+	return reasons
+}
+
+func TestWatchdogDisconnectsClientThatStopsReading(t *testing.T) {
+	s := newTestServer(t, WithWatchdog(200*time.Millisecond), WithWriteTimeout(time.Minute))
+	ns := s.Of("/")
+	reasons := disconnects(ns)
+	// The client never reads again: once the socket buffers fill up, the
+	// server's writer blocks in the transport until the watchdog steps in.
+	tc := dial(t, s, "/")
+	c := ns.Client(tc.welcome.ID)
+	chunk := strings.Repeat("x", 256<<10)
+	go func() {
+		for c.Emit("bulk", chunk) == nil {
+		}
+	}()
+
+	select {
+	case r := <-reasons:
+		if r != ReasonStalled {
+			t.Fatalf("disconnect reason = %v, want %v", r, ReasonStalled)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("stuck writer not detected")
+	}
+	if n := ns.Stats().StalledDisconnects; n != 1 {
+		t.Fatalf("StalledDisconnects = %d, want 1", n)
+	}
+}
+
+func TestWatchdogSparesBusyClientThatKeepsReading(t *testing.T) {
+	s := newTestServer(t, WithWatchdog(100*time.Millisecond))
+	ns := s.Of("/")
+	reasons := disconnects(ns)
+	tc := dial(t, s, "/")
+	c := ns.Client(tc.welcome.ID)
+	chunk := strings.Repeat("x", 64<<10)
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for i := 0; time.Now().Before(deadline); i++ {
+		if err := c.Emit("bulk", chunk); err != nil {
+			t.Fatalf("emit %d: %v", i, err)
+		}
+		tc.expect("bulk")
+	}
+	select {
+	case r := <-reasons:
+		t.Fatalf("client disconnected with %v", r)
+	default:
+	}
+}